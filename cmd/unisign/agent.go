@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// errNoAgent is returned when SSH_AUTH_SOCK does not point at a running agent
+var errNoAgent = errors.New("no SSH agent available (SSH_AUTH_SOCK is not set)")
+
+// agentPublicKey returns the key loaded in the SSH agent whose SHA256
+// fingerprint (as printed by ssh-add -l) matches fingerprint
+func agentPublicKey(fingerprint string) (ssh.PublicKey, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errNoAgent
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to SSH agent: %w", err)
+	}
+	defer conn.Close()
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, fmt.Errorf("listing SSH agent keys: %w", err)
+	}
+	for _, key := range keys {
+		if ssh.FingerprintSHA256(key) != fingerprint {
+			continue
+		}
+		// Parse the blob so certificates come back as *ssh.Certificate
+		pubKey, err := ssh.ParsePublicKey(key.Blob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing SSH agent key %s: %w", fingerprint, err)
+		}
+		return pubKey, nil
+	}
+	return nil, fmt.Errorf("no key with fingerprint %s is loaded in the SSH agent (%d keys loaded)", fingerprint, len(keys))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// describeCertificate summarizes a certificate's identity and validity for audit output
+func describeCertificate(cert *ssh.Certificate) string {
+	principals := "any"
+	if len(cert.ValidPrincipals) > 0 {
+		principals = strings.Join(cert.ValidPrincipals, ",")
+	}
+	return fmt.Sprintf("key ID %q, serial %d, principals %s, valid %s to %s",
+		cert.KeyId, cert.Serial, principals, certTime(cert.ValidAfter), certTime(cert.ValidBefore))
+}
+
+// certTime formats a certificate validity bound, which is in seconds since the epoch
+func certTime(t uint64) string {
+	switch t {
+	case 0:
+		return "always"
+	case ssh.CertTimeInfinity:
+		return "forever"
+	}
+	return time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+}
+
+// checkCertificatePrincipal confirms that pub is a certificate listing
+// principal that is valid at now and correctly signed by its CA. Whether the
+// CA is trusted is left to the caller, as with any key given to verify.
+func checkCertificatePrincipal(pub ssh.PublicKey, principal string, now time.Time) error {
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return errors.New("key is not a certificate")
+	}
+	checker := &ssh.CertChecker{Clock: func() time.Time { return now }}
+	return checker.CheckCert(principal, cert)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/unisign"
+)
+
+// exitWithError is defined in verify.go
+
+func diagnoseFile() {
+	// Parse command line flags
+	doctorCmd := flag.NewFlagSet("doctor", flag.ExitOnError)
+	mc := addMagicFlags(doctorCmd)
+
+	// Parse doctor command args
+	doctorCmd.Parse(os.Args[2:])
+
+	if err := mc.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+
+	// Get input file from remaining arguments
+	if doctorCmd.NArg() != 1 {
+		exitWithCode(exitUsage, "input file is required")
+	}
+	inputFile := doctorCmd.Arg(0)
+
+	inputData, err := readFileOrStdin(inputFile)
+	if err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	inputData, gzipped, err := gunzipIfCompressed(inputData)
+	if err != nil {
+		exitWithCode(exitIO, "%v", err)
+	}
+
+	format := appconfig.DetectFormat(inputData)
+	if gzipped {
+		fmt.Printf("Format: %s (gzip-compressed)\n", formatName(format))
+	} else {
+		fmt.Printf("Format: %s\n", formatName(format))
+	}
+
+	// Count placeholders, prefix occurrences and signatures already in place
+	placeholders, err := unisign.FindAllMagicOffsets(inputData, []byte(mc.Magic))
+	if err != nil && !errors.Is(err, unisign.ErrMagicNotFound) {
+		exitWithError("searching for magic string: %v", err)
+	}
+	fmt.Printf("Placeholders: %d%s\n", len(placeholders), offsetList(placeholders))
+
+	fmt.Printf("Signature prefix %q occurrences: %d\n", mc.Prefix, bytes.Count(inputData, []byte(mc.Prefix)))
+
+	var signatures []int64
+	for _, s := range findSlots(inputData, mc) {
+		if s.Filled {
+			signatures = append(signatures, s.Offset)
+		}
+	}
+	fmt.Printf("Signatures: %d%s\n", len(signatures), offsetList(signatures))
+
+	// Explain what the counts mean for sign and verify
+	fmt.Println()
+	switch {
+	case len(placeholders) == 1 && len(signatures) == 0:
+		fmt.Println("Diagnosis: ready to sign.")
+	case len(placeholders) > 1:
+		fmt.Printf("Diagnosis: %d placeholders found; sign each one with --slot, or remove the extras.\n", len(placeholders))
+	case len(placeholders) == 1:
+		fmt.Println("Diagnosis: partially signed; the remaining placeholder can be filled with --slot.")
+	case len(signatures) > 0:
+		fmt.Println("Diagnosis: already signed; verify it with 'unisign verify'.")
+	default:
+		fmt.Println("Diagnosis: no placeholder or signature found, so sign will report \"magic string not found\".")
+		if version, ok := findForeignSignatureVersion(inputData); ok {
+			fmt.Printf("The file holds a signature of format version %d, which this build (version %d) does not read.\n",
+				version, unisign.SignatureVersion)
+		} else if hasTruncatedSlot(inputData, mc) {
+			fmt.Printf("A signature prefix appears too close to the end of the file: %v.\n", errSignatureTruncated)
+		} else if format == appconfig.FormatELF || format == appconfig.FormatPE || format == appconfig.FormatPDF || format == appconfig.FormatZip {
+			fmt.Printf("Run 'unisign inject-placeholder' to add one to this %s file.\n", formatName(format))
+		} else {
+			fmt.Println("Embed the magic string in the file before signing, e.g. as a string constant in source code.")
+		}
+	}
+}
+
+// offsetList formats offsets for display after a count, e.g. " (at 12, 340)"
+func offsetList(offsets []int64) string {
+	if len(offsets) == 0 {
+		return ""
+	}
+
+	var b bytes.Buffer
+	b.WriteString(" (at ")
+	for i, offset := range offsets {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%d", offset)
+	}
+	b.WriteString(")")
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	preparedPath := createTestFileWithMagic(t, tmpDir, "prepared")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, preparedPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	plainPath := filepath.Join(tmpDir, "plain")
+	if err := os.WriteFile(plainPath, []byte("nothing to see here"), 0644); err != nil {
+		t.Fatalf("failed to write plain file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			name: "prepared",
+			path: preparedPath,
+			want: []string{"Format: raw", "Placeholders: 1 (at 10)", "Signatures: 0", "ready to sign"},
+		},
+		{
+			name: "signed",
+			path: preparedPath + ".signed",
+			want: []string{"Placeholders: 0", "Signatures: 1 (at 10)", "already signed"},
+		},
+		{
+			name: "plain",
+			path: plainPath,
+			want: []string{"Placeholders: 0", "occurrences: 0", "Signatures: 0", "magic string not found"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command("go", "run", ".")
+			cmd.Args = append(cmd.Args, "doctor", tc.path)
+			cmd.Dir = "."
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("doctor failed: %v\nOutput: %s", err, output)
+			}
+			for _, want := range tc.want {
+				if !bytes.Contains(output, []byte(want)) {
+					t.Errorf("doctor output lacks %q:\n%s", want, output)
+				}
+			}
+		})
+	}
+
+	// doctor has no side effects
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to list temp dir: %v", err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("doctor created or removed files: %d entries in temp dir", len(entries))
+	}
+}
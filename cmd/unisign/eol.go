@@ -0,0 +1,42 @@
+package main
+
+import "sort"
+
+// normalizeLineEndings returns a copy of data with every CRLF turned into LF,
+// preceded by headroom zero bytes. Bytes inside a slot (sigLen bytes from each
+// slot offset) are copied verbatim. The returned function maps an offset in
+// data to the matching offset in the normalized copy (headroom excluded).
+func normalizeLineEndings(data []byte, slots []slot, sigLen int, headroom int) ([]byte, func(int64) int64) {
+	out := make([]byte, headroom, headroom+len(data))
+	var dropped []int64 // offsets in data of the removed CRs, ascending
+
+	next := 0 // index of the next slot that may contain i
+	for i := 0; i < len(data); i++ {
+		for next < len(slots) && int(slots[next].Offset)+sigLen <= i {
+			next++
+		}
+		inSlot := func(j int) bool {
+			return next < len(slots) && int(slots[next].Offset) <= j && j < int(slots[next].Offset)+sigLen
+		}
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' && !inSlot(i) && !inSlot(i+1) {
+			dropped = append(dropped, int64(i))
+			continue
+		}
+		out = append(out, data[i])
+	}
+
+	shift := func(offset int64) int64 {
+		return offset - int64(sort.Search(len(dropped), func(k int) bool { return dropped[k] >= offset }))
+	}
+	return out, shift
+}
+
+// shiftSlots returns slots with their offsets mapped through shift
+func shiftSlots(slots []slot, shift func(int64) int64) []slot {
+	shifted := make([]slot, len(slots))
+	for i, s := range slots {
+		shifted[i] = s
+		shifted[i].Offset = shift(s.Offset)
+	}
+	return shifted
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Exit codes let scripts tell failure classes apart without parsing stderr.
+// Anything not covered by a specific class exits with exitFailure.
+const (
+	exitFailure = 1 // any other error
+	exitUsage   = 2 // invalid flags or arguments (also used by the flag package)
+	exitIO      = 3 // reading or writing a file failed
+	exitMagic   = 4 // placeholder/signature missing, duplicated or truncated
+	exitVerify  = 5 // a signature was found but did not verify
+)
+
+// exitWithCode prints an error message and exits with the given code
+func exitWithCode(code int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(code)
+}
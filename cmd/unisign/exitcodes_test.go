@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCodes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Build the binary: go run reports its own exit status, not the program's
+	binPath := filepath.Join(tmpDir, "unisign")
+	build := exec.Command("go", "build", "-o", binPath, ".")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build unisign: %v\nOutput: %s", err, output)
+	}
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	wrongKeyPath := generateTestKey(t, tmpDir, "wrong_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+	plainPath := filepath.Join(tmpDir, "plain")
+	if err := os.WriteFile(plainPath, []byte("no placeholder here"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	if output, err := exec.Command(binPath, "sign", "-k", keyPath, inputPath).CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	testCases := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"no command", nil, exitUsage},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"unknown flag", []string{"sign", "--bogus"}, exitUsage},
+		{"missing key flag", []string{"sign", inputPath}, exitUsage},
+		{"missing input file", []string{"sign", "-k", keyPath, filepath.Join(tmpDir, "missing")}, exitIO},
+		{"missing key file", []string{"verify", "-k", filepath.Join(tmpDir, "missing.pub"), signedPath}, exitIO},
+		{"sign without placeholder", []string{"sign", "-k", keyPath, plainPath}, exitMagic},
+		{"verify unsigned file", []string{"verify", "-k", keyPath + ".pub", plainPath}, exitMagic},
+		{"verify with wrong key", []string{"verify", "-k", wrongKeyPath + ".pub", signedPath}, exitVerify},
+		{"verify with wrong key as json", []string{"verify", "--json", "-k", wrongKeyPath + ".pub", signedPath}, exitVerify},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := exec.Command(binPath, tc.args...).CombinedOutput()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("expected a non-zero exit, got %v\nOutput: %s", err, output)
+			}
+			if got := exitErr.ExitCode(); got != tc.wantCode {
+				t.Errorf("exit code = %d, want %d\nOutput: %s", got, tc.wantCode, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// defaultMaxFileSize is the largest file sign and verify read by default. It
+// matches defaultMaxFetchSize, so a file too big to fetch is too big to open.
+const defaultMaxFileSize = defaultMaxFetchSize
+
+// addMaxFileSizeFlag registers --max-file-size on a command's flag set
+func addMaxFileSizeFlag(fs *flag.FlagSet) *int64 {
+	return fs.Int64("max-file-size", defaultMaxFileSize, "Largest file in bytes to read; larger files are rejected before reading (0 for no limit)")
+}
+
+// validateMaxFileSize exits with a usage error if maxSize is negative
+func validateMaxFileSize(maxSize int64) {
+	if maxSize < 0 {
+		exitWithCode(exitUsage, "--max-file-size must not be negative")
+	}
+}
+
+// checkFileSize returns an error if the file at path is larger than maxSize
+// bytes, so it can be refused before being read. A maxSize of 0 is no limit.
+func checkFileSize(path string, maxSize int64) error {
+	if maxSize == 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() && info.Size() > maxSize {
+		return fmt.Errorf("%s is %d bytes, which exceeds --max-file-size (%d)", path, info.Size(), maxSize)
+	}
+	return nil
+}
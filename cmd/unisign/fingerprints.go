@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// fingerprintPrefix starts every SHA256 fingerprint, as printed by ssh-keygen -l
+const fingerprintPrefix = "SHA256:"
+
+// loadAllowedFingerprints reads the --allowed-fingerprints file: one SHA256
+// fingerprint per line, optionally followed by a comment such as the key's
+// owner. A leading bit count is skipped, so lines printed by ssh-keygen -l
+// can be pasted in as they are. Blank lines and # comments are ignored.
+func loadAllowedFingerprints(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[0]); err == nil && len(fields) > 1 {
+			fields = fields[1:]
+		}
+		if !strings.HasPrefix(fields[0], fingerprintPrefix) || len(fields[0]) == len(fingerprintPrefix) {
+			return nil, fmt.Errorf("%s:%d: %q is not a SHA256 fingerprint", path, line, fields[0])
+		}
+		allowed[fields[0]] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("%s lists no fingerprints", path)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// gzipMagic is the two-byte ID that starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gunzipIfCompressed returns the decompressed contents of data if it is a
+// gzip stream, and data unchanged otherwise. The boolean reports whether
+// data was compressed.
+func gunzipIfCompressed(data []byte) ([]byte, bool, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, false, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, true, fmt.Errorf("reading gzip header: %w", err)
+	}
+	defer zr.Close()
+
+	decompressed, err := io.ReadAll(zr)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, true, fmt.Errorf("gzip input is truncated: %w", err)
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("decompressing gzip input: %w", err)
+	}
+
+	return decompressed, true, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/unisign"
+)
+
+// exitWithError is defined in verify.go
+
+// infoReport is the machine-readable form of what info prints with --json
+type infoReport struct {
+	File       string          `json:"file"`
+	Format     string          `json:"format"`
+	Gzipped    bool            `json:"gzipped,omitempty"`
+	Signatures []signatureInfo `json:"signatures"`
+}
+
+// signatureInfo describes one embedded signature, which info does not verify
+type signatureInfo struct {
+	Offset uint64 `json:"offset"`
+
+	// Encoded is the signature as embedded, prefix included
+	Encoded string `json:"encoded"`
+
+	// SignatureLength is the size in bytes of the decoded signature
+	SignatureLength int `json:"signature_length"`
+
+	// KeyID is the hex key ID tag in front of the signature, with --key-id
+	KeyID string `json:"key_id,omitempty"`
+
+	// Version and SignedLength are the header fields the signature covers
+	// for the file as it is, i.e. signed without --json-field or --normalize-eol
+	Version      uint8  `json:"version"`
+	SignedLength uint64 `json:"signed_length"`
+}
+
+// printSignatureInfo lists the signatures embedded in a file and the header
+// each one covers, without checking them against any key
+func printSignatureInfo() {
+	// Parse command line flags
+	infoCmd := flag.NewFlagSet("info", flag.ExitOnError)
+	jsonOutput := infoCmd.Bool("json", false, "Print the signatures as JSON")
+	mc := addMagicFlags(infoCmd)
+
+	// Parse info command args
+	infoCmd.Parse(os.Args[2:])
+
+	if err := mc.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+
+	// Get input file from remaining arguments
+	if infoCmd.NArg() != 1 {
+		exitWithCode(exitUsage, "signed file is required")
+	}
+	inputFile := infoCmd.Arg(0)
+
+	inputData, err := readFileOrStdin(inputFile)
+	if err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	inputData, gzipped, err := gunzipIfCompressed(inputData)
+	if err != nil {
+		exitWithCode(exitIO, "%v", err)
+	}
+
+	mc, err = mc.sizedFor(inputData)
+	if err != nil {
+		exitWithCode(exitMagic, "%v", err)
+	}
+	slots, err := locateSlots(inputData, mc)
+	if err != nil {
+		exitWithCode(exitMagic, "locating signatures: %v", err)
+	}
+
+	report := infoReport{
+		File:       inputFile,
+		Format:     formatName(appconfig.DetectFormat(inputData)),
+		Gzipped:    gzipped,
+		Signatures: []signatureInfo{},
+	}
+	for _, s := range slots {
+		if !s.Filled {
+			continue
+		}
+		report.Signatures = append(report.Signatures, signatureInfo{
+			Offset:          uint64(s.Offset),
+			Encoded:         string(inputData[s.Offset : s.Offset+int64(len(mc.Magic))]),
+			SignatureLength: len(s.Signature),
+			KeyID:           hex.EncodeToString(s.KeyID),
+			Version:         unisign.SignatureVersion,
+			SignedLength:    uint64(len(inputData)),
+		})
+	}
+	if len(report.Signatures) == 0 {
+		exitWithCode(exitMagic, "no signature found in %s", inputFile)
+	}
+
+	if *jsonOutput {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			exitWithError("encoding report: %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	if gzipped {
+		fmt.Printf("Format: %s (gzip-compressed)\n", report.Format)
+	} else {
+		fmt.Printf("Format: %s\n", report.Format)
+	}
+	for i, s := range report.Signatures {
+		fmt.Printf("Signature %d at offset %d (not verified):\n", i, s.Offset)
+		fmt.Printf("  Encoded: %s\n", s.Encoded)
+		fmt.Printf("  Signature length: %d bytes\n", s.SignatureLength)
+		if s.KeyID != "" {
+			fmt.Printf("  Key ID: %s\n", s.KeyID)
+		}
+		fmt.Printf("  Header: magic 0x%X, version %d, length %d, offset %d\n",
+			unisign.SignatureMagic, s.Version, s.SignedLength, s.Offset)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/unisign"
+)
+
+func TestInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	preparedPath := createTestFileWithMagic(t, tmpDir, "prepared")
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, preparedPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := preparedPath + ".signed"
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	encoded := signed[10 : 10+len(appconfig.MagicString)]
+
+	cmd = exec.Command("go", "run", ".", "info", signedPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("info failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"Signature 0 at offset 10 (not verified)",
+		"Encoded: " + string(encoded),
+		"Signature length: 64 bytes",
+		fmt.Sprintf("version %d, length %d, offset 10", unisign.SignatureVersion, len(signed)),
+	} {
+		if !bytes.Contains(output, []byte(want)) {
+			t.Errorf("output is missing %q:\n%s", want, output)
+		}
+	}
+
+	// --json reports the same, and no key is needed for either
+	cmd = exec.Command("go", "run", ".", "info", "--json", signedPath)
+	cmd.Dir = "."
+	output, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("info --json failed: %v\nOutput: %s", err, output)
+	}
+	var report infoReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, output)
+	}
+	if len(report.Signatures) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(report.Signatures))
+	}
+	got := report.Signatures[0]
+	if got.Offset != 10 || got.Encoded != string(encoded) || got.SignedLength != uint64(len(signed)) {
+		t.Errorf("unexpected signature info: %+v", got)
+	}
+
+	// An unsigned file has nothing to report
+	cmd = exec.Command("go", "run", ".", "info", preparedPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("info on an unsigned file should fail\nOutput: %s", output)
+	}
+}
@@ -1,115 +1,243 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
 	appconfig "unisign/internal/unisign"
 )
 
 // exitWithError is defined in verify.go
 
+// peSniffLen is how much of the file is read to detect its format, enough
+// to reach the PE signature of any binary a linker produces
+const peSniffLen = 4096
+
+// zipTailLen is the most a ZIP's end record and comment can take at the end of a file
+const zipTailLen = 22 + 65535
+
 func injectPlaceholder() {
 	// Parse command line flags
 	injectCmd := flag.NewFlagSet("inject-placeholder", flag.ExitOnError)
-	outputFile := injectCmd.String("o", "", "Output file (default: original filename with .placeholder suffix)")
+	outputFile := new(string)
+	injectCmd.StringVar(outputFile, "output", "", "Output file (default: original filename with .placeholder suffix)")
+	injectCmd.StringVar(outputFile, "o", "", "Shorthand for --output")
+	inPlace := injectCmd.Bool("in-place", false, "Replace the input file atomically; needed when -o names the input")
+	dryRun := injectCmd.Bool("dry-run", false, "Perform the injection in memory and report it, without writing the output")
+	addNoteSegment := injectCmd.Bool("add-note-segment", false, "ELF only: also add a PT_NOTE program header for the placeholder")
+	appendComment := injectCmd.Bool("append-comment", false, "ZIP only: keep the existing archive comment and add the placeholder on a new line")
+	reuse := injectCmd.Bool("reuse", false, "PDF only: reset an existing placeholder object, signed or not, instead of adding another")
+	pdfObject := injectCmd.Int("pdf-object", 0, "PDF only: object number to give the placeholder; it must be free (default: the next free number)")
+
+	mc := addMagicFlags(injectCmd)
+	oa := addOutputAttrFlags(injectCmd)
 
 	// Parse inject-placeholder command args
 	injectCmd.Parse(os.Args[2:])
 
+	if err := mc.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+	if err := oa.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+
 	// Get input file from remaining arguments
 	if injectCmd.NArg() != 1 {
-		exitWithError("input file is required")
+		exitWithCode(exitUsage, "input file is required")
 	}
 	inputFile := injectCmd.Arg(0)
 
-	// Detect binary formats by reading file magic bytes
+	// Detect the format by reading the file's magic bytes. PE is only
+	// recognized if the header the DOS stub points to is read too.
 	f, err := os.Open(inputFile)
 	if err != nil {
-		exitWithError("opening input file: %v", err)
+		exitWithCode(exitIO, "opening input file: %v", err)
 	}
-	magic := make([]byte, 5)
-	f.Read(magic)
+	magic := make([]byte, peSniffLen)
+	n, _ := io.ReadFull(f, magic)
 	f.Close()
+	magic = magic[:n]
 
-	if appconfig.IsELF(magic) {
-		fmt.Printf("ELF binary detected: %s\n", inputFile)
+	// Set default output file if not specified. With --in-place it is the input.
+	if *outputFile == "" {
+		*outputFile = inputFile + ".placeholder"
+		if *inPlace {
+			*outputFile = inputFile
+		}
+	}
+	if err := oa.recordInputTime(inputFile); err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+
+	format := appconfig.DetectFormat(magic)
 
-		if *outputFile == "" {
-			*outputFile = inputFile + ".placeholder"
+	// A self-extracting ZIP starts with its extractor, but the placeholder
+	// goes in the archive comment, which keeps both the stub and the archive valid
+	if format != appconfig.FormatZip {
+		if stub, ok := selfExtractingZipStub(inputFile); ok {
+			fmt.Printf("Self-extracting ZIP detected (%d-byte %s stub)\n", stub, formatName(format))
+			format = appconfig.FormatZip
 		}
+	}
+	if *addNoteSegment && format != appconfig.FormatELF {
+		exitWithCode(exitUsage, "--add-note-segment only applies to ELF binaries")
+	}
+	if *appendComment && format != appconfig.FormatZip {
+		exitWithCode(exitUsage, "--append-comment only applies to ZIP files")
+	}
+	if (*pdfObject != 0 || *reuse) && format != appconfig.FormatPDF {
+		exitWithCode(exitUsage, "--pdf-object and --reuse only apply to PDF documents")
+	}
+	if *pdfObject != 0 && *reuse {
+		exitWithCode(exitUsage, "--pdf-object cannot be combined with --reuse")
+	}
+
+	switch format {
+	case appconfig.FormatELF:
+		fmt.Printf("ELF binary detected: %s\n", inputFile)
 
 		opts := appconfig.ELFInjectionOptions{
-			InputPath:   inputFile,
-			OutputPath:  *outputFile,
-			Placeholder: appconfig.MagicString,
+			InputPath:      inputFile,
+			OutputPath:     *outputFile,
+			Placeholder:    mc.Magic,
+			AddNoteSegment: *addNoteSegment,
+			DryRun:         *dryRun,
+			InPlace:        *inPlace,
 		}
 
-		if err := appconfig.InjectPlaceholderIntoELF(opts); err != nil {
+		offset, err := appconfig.InjectPlaceholderIntoELFWithOffset(opts)
+		if errors.Is(err, appconfig.ErrNoSectionHeaders) {
+			// Fully stripped binaries (e.g. by sstrip) are common; point at what still works
+			exitWithError("%s has no section headers, so no section can be added (strip --strip-all keeps them; tools such as sstrip remove them).\n"+
+				"The loader ignores bytes after the last segment, so append the placeholder instead and sign the result:\n"+
+				"  cp %s %s && printf '%%s' '%s' >> %s", inputFile, inputFile, *outputFile, mc.Magic, *outputFile)
+		}
+		if err != nil {
 			exitWithError("injecting placeholder into ELF: %v", err)
 		}
+		fmt.Printf("Placeholder offset: %d\n", offset)
 
-		fmt.Printf("Successfully injected placeholder into %s\n", inputFile)
-		fmt.Printf("Output written to: %s\n", *outputFile)
-		return
-	}
-
-	if appconfig.IsPDF(magic) {
+	case appconfig.FormatPDF:
 		fmt.Printf("PDF document detected: %s\n", inputFile)
 
-		if *outputFile == "" {
-			*outputFile = inputFile + ".placeholder"
-		}
-
 		opts := appconfig.PDFInjectionOptions{
-			InputPath:   inputFile,
-			OutputPath:  *outputFile,
-			Placeholder: appconfig.MagicString,
+			InputPath:    inputFile,
+			OutputPath:   *outputFile,
+			Placeholder:  mc.Magic,
+			DryRun:       *dryRun,
+			InPlace:      *inPlace,
+			ObjectNumber: *pdfObject,
+			Reuse:        *reuse,
+			Prefix:       mc.Prefix,
 		}
 
-		if err := appconfig.InjectPlaceholderIntoPDF(opts); err != nil {
+		objNum, err := appconfig.InjectPlaceholderIntoPDFWithObjectNumber(opts)
+		if errors.Is(err, appconfig.ErrPDFObjectInUse) {
+			exitWithCode(exitUsage, "--pdf-object: %v", err)
+		}
+		if errors.Is(err, appconfig.ErrPDFPlaceholderAmbiguous) {
+			exitWithCode(exitMagic, "--reuse: %v", err)
+		}
+		if err != nil {
 			exitWithError("injecting placeholder into PDF: %v", err)
 		}
+		fmt.Printf("Placeholder object: %d 0 obj\n", objNum)
+
+		// Found through the xref, the offset is the one verify --offset takes
+		if !*dryRun {
+			output, err := os.ReadFile(*outputFile)
+			if err != nil {
+				exitWithCode(exitIO, "reading output file: %v", err)
+			}
+			offset, err := appconfig.PDFPlaceholderOffset(output, objNum)
+			if err != nil {
+				exitWithError("locating placeholder object: %v", err)
+			}
+			fmt.Printf("Placeholder offset: %d\n", offset)
+		}
 
-		fmt.Printf("Successfully injected placeholder into %s\n", inputFile)
-		fmt.Printf("Output written to: %s\n", *outputFile)
-		return
-	}
-
-	// Fall back to extension-based detection for non-binary formats
-	ext := strings.ToLower(filepath.Ext(inputFile))
-	fullname := strings.ToLower(filepath.Base(inputFile))
-
-	// Check if the file is a ZIP file or one of our specially-named ZIP files
-	isZipFile := ext == ".zip" || strings.HasSuffix(fullname, ".zip.placeholder")
-
-	switch {
-	case isZipFile:
+	case appconfig.FormatZip:
 		fmt.Printf("ZIP file detected: %s\n", inputFile)
 
-		// Set default output file if not specified
-		if *outputFile == "" {
-			*outputFile = inputFile + ".placeholder"
-		}
-
-		// Use our ZIP injection implementation
 		opts := appconfig.ZipInjectionOptions{
 			InputPath:   inputFile,
 			OutputPath:  *outputFile,
-			Placeholder: appconfig.MagicString,
+			Placeholder: mc.Magic,
+			DryRun:      *dryRun,
+			InPlace:     *inPlace,
+			Append:      *appendComment,
 		}
 
-		err := appconfig.InjectPlaceholderIntoZip(opts)
+		offset, err := appconfig.InjectPlaceholderIntoZipWithOffset(opts)
 		if err != nil {
 			exitWithError("injecting placeholder into ZIP file: %v", err)
 		}
+		fmt.Printf("Placeholder offset: %d\n", offset)
+
+	case appconfig.FormatPE:
+		fmt.Printf("PE binary detected: %s\n", inputFile)
+
+		opts := appconfig.PEInjectionOptions{
+			InputPath:   inputFile,
+			OutputPath:  *outputFile,
+			Placeholder: mc.Magic,
+			DryRun:      *dryRun,
+			InPlace:     *inPlace,
+		}
 
-		fmt.Printf("Successfully injected placeholder into %s\n", inputFile)
-		fmt.Printf("Output written to: %s\n", *outputFile)
+		offset, err := appconfig.InjectPlaceholderIntoPEWithOffset(opts)
+		if err != nil {
+			exitWithError("injecting placeholder into PE binary: %v", err)
+		}
+		fmt.Printf("Placeholder offset: %d\n", offset)
 
 	default:
-		exitWithError("unsupported file type '%s'. Currently ELF, PDF, and ZIP files are supported", ext)
+		exitWithError("unsupported file type for '%s'. Currently ELF, PE, PDF, and ZIP files are supported", inputFile)
+	}
+
+	if *dryRun {
+		fmt.Printf("Dry run: placeholder can be injected into %s; nothing written to %s\n", inputFile, *outputFile)
+		return
+	}
+
+	if err := oa.apply(inputFile, *outputFile); err != nil {
+		exitWithCode(exitIO, "setting output file attributes: %v", err)
+	}
+
+	fmt.Printf("Successfully injected placeholder into %s\n", inputFile)
+	fmt.Printf("Output written to: %s\n", *outputFile)
+}
+
+// selfExtractingZipStub returns the length of the stub in front of the
+// archive if the file at path is a self-extracting ZIP. The archive's end
+// record is looked for in the file's last 64KB first, so other files are
+// not read in full.
+func selfExtractingZipStub(path string) (int64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+
+	tail := make([]byte, min(info.Size(), zipTailLen))
+	if _, err := f.ReadAt(tail, info.Size()-int64(len(tail))); err != nil {
+		return 0, false
+	}
+	if _, _, err := appconfig.LocateZipComment(tail); err != nil {
+		return 0, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
 	}
+	stub, err := appconfig.ZipArchiveOffset(data)
+	return stub, err == nil && stub > 0
 }
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	appconfig "unisign/internal/unisign"
+)
+
+func TestInjectPlaceholderDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("hello.txt")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	w.Write([]byte("hello"))
+	zw.Close()
+
+	inputPath := filepath.Join(tmpDir, "archive.zip")
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write zip file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "inject-placeholder", "--dry-run", inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("dry-run injection failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Dry run")) {
+		t.Errorf("dry-run output does not describe the planned injection: %s", output)
+	}
+	if _, err := os.Stat(inputPath + ".placeholder"); !os.IsNotExist(err) {
+		t.Errorf("--dry-run created the output file")
+	}
+}
+
+func TestInjectPlaceholderInPlace(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("hello.txt")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	w.Write([]byte("hello"))
+	zw.Close()
+
+	inputPath := filepath.Join(tmpDir, "archive.zip")
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write zip file: %v", err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(inputPath, mtime, mtime); err != nil {
+		t.Fatalf("failed to set input time: %v", err)
+	}
+
+	// -o naming the input is refused and leaves it alone
+	cmd := exec.Command("go", "run", ".", "inject-placeholder", "-o", inputPath, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "--in-place") {
+		t.Errorf("overwriting the input: err %v, output: %s", err, output)
+	}
+	if data, err := os.ReadFile(inputPath); err != nil || !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("input changed without --in-place")
+	}
+
+	// --in-place replaces it, keeping its time with --preserve-time
+	cmd = exec.Command("go", "run", ".", "inject-placeholder", "--in-place", "--preserve-time", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("--in-place injection failed: %v\nOutput: %s", err, output)
+	}
+	data, err := os.ReadFile(inputPath)
+	if err != nil || !bytes.Contains(data, []byte(appconfig.MagicString)) {
+		t.Errorf("placeholder not injected in place: %v", err)
+	}
+	if info, err := os.Stat(inputPath); err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("modification time not preserved: %v, %v", info.ModTime(), err)
+	}
+	if _, err := os.Stat(inputPath + ".placeholder"); !os.IsNotExist(err) {
+		t.Errorf("--in-place also wrote the default output")
+	}
+}
+
+func TestInjectPlaceholderAppendComment(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("hello.txt")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	w.Write([]byte("hello"))
+	zw.SetComment("Release notes:\nfirst build")
+	zw.Close()
+
+	inputPath := filepath.Join(tmpDir, "archive.zip")
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write zip file: %v", err)
+	}
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	for _, args := range [][]string{
+		{"inject-placeholder", "--append-comment", inputPath},
+		{"sign", "-k", keyPath, inputPath + ".placeholder"},
+		{"verify", "-k", keyPath + ".pub", inputPath + ".placeholder.signed"},
+	} {
+		cmd := exec.Command("go", append([]string{"run", "."}, args...)...)
+		cmd.Dir = "."
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s failed: %v\nOutput: %s", args[0], err, output)
+		}
+		if args[0] == "inject-placeholder" {
+			checkReportedPlaceholderOffset(t, output, inputPath+".placeholder")
+		}
+	}
+
+	// The human comment survives signing, followed by the signature
+	zr, err := zip.OpenReader(inputPath + ".placeholder.signed")
+	if err != nil {
+		t.Fatalf("signed archive is not a valid ZIP: %v", err)
+	}
+	defer zr.Close()
+	notes, signature, found := strings.Cut(zr.Comment, "\n"+appconfig.SignaturePrefix)
+	if !found || notes != "Release notes:\nfirst build" || signature == "" {
+		t.Errorf("unexpected comment in signed archive: %q", zr.Comment)
+	}
+
+	// The flag is meaningless for other formats
+	otherPath := createTestFileWithMagic(t, tmpDir, "plain")
+	cmd := exec.Command("go", "run", ".", "inject-placeholder", "--append-comment", otherPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("--append-comment on a non-ZIP file should fail\nOutput: %s", output)
+	}
+}
+
+func TestInjectPlaceholderPE(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	srcPath := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(srcPath, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("failed to write test source: %v", err)
+	}
+	inputPath := filepath.Join(tmpDir, "app.exe")
+	build := exec.Command("go", "build", "-o", inputPath, srcPath)
+	build.Env = append(os.Environ(), "GOOS=windows", "GOARCH=amd64", "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to compile test binary: %v\n%s", err, output)
+	}
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	for _, args := range [][]string{
+		{"inject-placeholder", inputPath},
+		{"sign", "-k", keyPath, inputPath + ".placeholder"},
+		{"verify", "-k", keyPath + ".pub", inputPath + ".placeholder.signed"},
+	} {
+		cmd := exec.Command("go", append([]string{"run", "."}, args...)...)
+		cmd.Dir = "."
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s failed: %v\nOutput: %s", args[0], err, output)
+		}
+		if args[0] == "inject-placeholder" {
+			if !bytes.Contains(output, []byte("PE binary detected")) {
+				t.Errorf("input was not detected as PE: %s", output)
+			}
+			checkReportedPlaceholderOffset(t, output, inputPath+".placeholder")
+		}
+	}
+}
+
+// checkReportedPlaceholderOffset checks that the offset inject-placeholder
+// printed holds the placeholder in the file it wrote
+func checkReportedPlaceholderOffset(t *testing.T, output []byte, path string) {
+	t.Helper()
+
+	_, line, found := strings.Cut(string(output), "Placeholder offset: ")
+	if !found {
+		t.Fatalf("no placeholder offset reported:\n%s", output)
+	}
+	var offset int
+	if _, err := fmt.Sscanf(line, "%d", &offset); err != nil {
+		t.Fatalf("malformed placeholder offset %q: %v", line, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if offset+len(appconfig.MagicString) > len(data) || string(data[offset:offset+len(appconfig.MagicString)]) != appconfig.MagicString {
+		t.Errorf("reported offset %d does not hold the placeholder", offset)
+	}
+}
+
+func TestInjectPlaceholderSelfExtractingZip(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// An extractor stub with the archive appended, as cat stub archive.zip > setup.exe makes
+	stub := append([]byte("\x7fELF"), bytes.Repeat([]byte{0}, 252)...)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("payload.txt")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	w.Write([]byte("payload"))
+	zw.Close()
+	inputPath := filepath.Join(tmpDir, "setup.run")
+	if err := os.WriteFile(inputPath, append(stub, buf.Bytes()...), 0755); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "inject-placeholder", inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("injection failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "Self-extracting ZIP detected (256-byte ELF stub)") {
+		t.Errorf("output does not report the stub: %s", output)
+	}
+
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath+".placeholder")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".placeholder.signed"
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", signedPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	if !bytes.HasPrefix(signed, stub) {
+		t.Error("stub was not preserved")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(signed), int64(len(signed)))
+	if err != nil {
+		t.Fatalf("signed file is not a valid ZIP: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "payload.txt" {
+		t.Errorf("archive entries changed: %v", zr.File)
+	}
+}
+
+// writeTestPDF writes a PDF at path whose objects, numbered from 1, have
+// the given bodies; object 1 must be the catalog
+func writeTestPDF(t *testing.T, path string, objects ...string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var offsets []int
+	buf.WriteString("%PDF-1.4\n")
+	for _, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), obj)
+	}
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write PDF: %v", err)
+	}
+}
+
+func TestInjectPlaceholderPDFObject(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// A one-page PDF: objects 1 to 3, so /Size 4
+	inputPath := filepath.Join(tmpDir, "doc.pdf")
+	writeTestPDF(t, inputPath,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+
+	// An object number in use is refused
+	cmd := exec.Command("go", "run", ".", "inject-placeholder", "--pdf-object", "2", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(output), "not free") {
+		t.Errorf("--pdf-object 2: err %v, output: %s", err, output)
+	}
+
+	cmd = exec.Command("go", "run", ".", "inject-placeholder", "--pdf-object", "7", inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("injection failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "Placeholder object: 7 0 obj\n") {
+		t.Errorf("object number not reported: %s", output)
+	}
+	data, err := os.ReadFile(inputPath + ".placeholder")
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	offset := strings.Index(string(data), appconfig.MagicString)
+	if !strings.Contains(string(output), fmt.Sprintf("Placeholder offset: %d\n", offset)) {
+		t.Errorf("offset %d not reported: %s", offset, output)
+	}
+
+	// The reported offset is the one verify --offset checks
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath+".placeholder")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "--offset", fmt.Sprint(offset), "-k", keyPath+".pub", inputPath+".placeholder.signed")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("verify --offset failed: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestInjectPlaceholderPDFReuse(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := filepath.Join(tmpDir, "doc.pdf")
+	writeTestPDF(t, inputPath,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>")
+
+	// Each cycle prepares the last signed PDF again and signs it
+	var sizes []int64
+	current := inputPath
+	for cycle := 1; cycle <= 2; cycle++ {
+		prepared := fmt.Sprintf("%s.%d", inputPath, cycle)
+		for _, args := range [][]string{
+			{"inject-placeholder", "--reuse", "-o", prepared, current},
+			{"sign", "-k", keyPath, prepared},
+			{"verify", "-k", keyPath + ".pub", prepared + ".signed"},
+		} {
+			cmd := exec.Command("go", append([]string{"run", "."}, args...)...)
+			cmd.Dir = "."
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("cycle %d: %s failed: %v\nOutput: %s", cycle, args[0], err, output)
+			}
+		}
+		current = prepared + ".signed"
+		info, err := os.Stat(current)
+		if err != nil {
+			t.Fatalf("failed to stat signed PDF: %v", err)
+		}
+		sizes = append(sizes, info.Size())
+	}
+	if sizes[0] != sizes[1] {
+		t.Errorf("signed PDF grew from %d to %d bytes on the second cycle", sizes[0], sizes[1])
+	}
+
+	cmd := exec.Command("go", "run", ".", "inject-placeholder", "--reuse", "--pdf-object", "9", current)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("--reuse with --pdf-object succeeded: %s", output)
+	}
+}
+
+func TestInjectPlaceholderStrippedELF(t *testing.T) {
+	if _, err := exec.LookPath("strip"); err != nil {
+		t.Skip("strip not available")
+	}
+	tmpDir := t.TempDir()
+
+	srcPath := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(srcPath, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("failed to write test source: %v", err)
+	}
+	binPath := filepath.Join(tmpDir, "app")
+	build := exec.Command("go", "build", "-o", binPath, srcPath)
+	build.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to compile test binary: %v\n%s", err, output)
+	}
+	if output, err := exec.Command("strip", "--strip-all", binPath).CombinedOutput(); err != nil {
+		t.Skipf("strip cannot process the test binary: %v\n%s", err, output)
+	}
+
+	// strip --strip-all keeps the section headers, so injection still works
+	cmd := exec.Command("go", "run", ".", "inject-placeholder", binPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("inject-placeholder failed on a --strip-all binary: %v\nOutput: %s", err, output)
+	}
+
+	// Dropping the section header table entirely, as sstrip does, gets a suggestion instead
+	data, err := os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("failed to read binary: %v", err)
+	}
+	binary.LittleEndian.PutUint64(data[0x28:], 0) // e_shoff
+	binary.LittleEndian.PutUint16(data[0x3C:], 0) // e_shnum
+	binary.LittleEndian.PutUint16(data[0x3E:], 0) // e_shstrndx
+	noSectionsPath := filepath.Join(tmpDir, "app-nosections")
+	if err := os.WriteFile(noSectionsPath, data, 0755); err != nil {
+		t.Fatalf("failed to write binary: %v", err)
+	}
+
+	cmd = exec.Command("go", "run", ".", "inject-placeholder", noSectionsPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("inject-placeholder accepted a binary without section headers\nOutput: %s", output)
+	}
+	for _, want := range []string{"has no section headers", "append the placeholder", appconfig.MagicString} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("output is missing %q:\n%s", want, output)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// lineCommentOffset is the offset signed with --line-comment. The slot's
+// line is left out of what is signed, so the signature is bound to no
+// position in the file; as a uint64 this is 2^64-1, which no real slot has.
+const lineCommentOffset int64 = -1
+
+// removeCommentLine returns a copy of data without the line holding the slot
+// at offset, preceded by headroom zero bytes. The line must be a '#' comment
+// holding only the slot: optional spaces or tabs, '#', optional spaces or
+// tabs, the sigLen slot bytes, then optional spaces or tabs up to the end of
+// the line. This keeps code from hiding on the one line that is not signed.
+// The line's newline (LF or CRLF) is removed with it, so the line can move.
+func removeCommentLine(data []byte, offset int64, sigLen int, headroom int) ([]byte, error) {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := int(offset) + sigLen
+	if nl := bytes.IndexByte(data[end:], '\n'); nl == -1 {
+		end = len(data)
+	} else {
+		end += nl + 1
+	}
+
+	before := bytes.TrimLeft(data[start:offset], " \t")
+	after := bytes.TrimRight(data[int(offset)+sigLen:end], "\r\n")
+	if !bytes.HasPrefix(before, []byte("#")) || len(bytes.Trim(before[1:], " \t")) != 0 || len(bytes.Trim(after, " \t")) != 0 {
+		return nil, fmt.Errorf("--line-comment: line %d must be a # comment holding only the signature",
+			bytes.Count(data[:offset], []byte("\n"))+1)
+	}
+
+	out := make([]byte, headroom, headroom+len(data)-(end-start))
+	out = append(out, data[:start]...)
+	return append(out, data[end:]...), nil
+}
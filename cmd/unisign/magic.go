@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"strings"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/placeholder"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// magicConfig is the placeholder and signature prefix used for one run.
+// It defaults to the built-in MagicString and SignaturePrefix but can be
+// overridden with --magic and --prefix.
+type magicConfig struct {
+	Magic  string
+	Prefix string
+
+	// KeyID puts the signer's key ID in front of each signature, so a
+	// verifier with several keys tries the right one first. The default
+	// placeholder is then the larger one PlaceholderFor("ed25519-keyid") returns.
+	KeyID bool
+
+	// sizable is set by validate when neither --magic nor --key-id was given,
+	// so the placeholder may be sized by the file's structure instead
+	sizable bool
+}
+
+// addMagicFlags registers --magic, --prefix and --key-id on a command's flag set
+func addMagicFlags(fs *flag.FlagSet) *magicConfig {
+	mc := &magicConfig{}
+	fs.StringVar(&mc.Magic, "magic", appconfig.MagicString, "Placeholder string to look for instead of the built-in one")
+	fs.StringVar(&mc.Prefix, "prefix", appconfig.SignaturePrefix, "Signature prefix to use instead of the built-in one")
+	fs.BoolVar(&mc.KeyID, "key-id", false, "Signatures carry the signer's key ID, in a placeholder that has room for it")
+	return mc
+}
+
+// validate switches to the key ID placeholder if --key-id was given without
+// --magic, then checks that the magic string and prefix are non-blank, that the
+// prefix starts the magic string and that an encoded signature (prefix +
+// base64 signature) is exactly as long as it
+func (mc *magicConfig) validate() error {
+	mc.sizable = mc.Magic == appconfig.MagicString && !mc.KeyID
+
+	// With --key-id the default placeholder is the one sized for the tag
+	if mc.KeyID && mc.Magic == appconfig.MagicString {
+		keyed, err := placeholder.PlaceholderFor("ed25519-keyid")
+		if err != nil {
+			return err
+		}
+		mc.Magic = keyed
+	}
+
+	// Checked first so a blank value gets a clear error rather than a length mismatch
+	if strings.TrimSpace(mc.Magic) == "" {
+		return fmt.Errorf("magic string (--magic) must not be empty or whitespace")
+	}
+	if strings.TrimSpace(mc.Prefix) == "" {
+		return fmt.Errorf("signature prefix (--prefix) must not be empty or whitespace")
+	}
+	if !strings.HasPrefix(mc.Magic, mc.Prefix) {
+		return fmt.Errorf("magic string %q does not start with prefix %q", mc.Magic, mc.Prefix)
+	}
+
+	want := mc.encodedLen()
+	if len(mc.Magic) != want {
+		if mc.KeyID {
+			return fmt.Errorf("magic string is %d bytes, but an encoded signature with prefix %q and a key ID is %d bytes",
+				len(mc.Magic), mc.Prefix, want)
+		}
+		return fmt.Errorf("magic string is %d bytes, but an encoded signature with prefix %q is %d bytes",
+			len(mc.Magic), mc.Prefix, want)
+	}
+	return nil
+}
+
+// sizedFor returns the magic config to use for data. Unless --magic or
+// --key-id was given, where the format defines the placeholder's location
+// (a ZIP comment, PDF placeholder string or ELF note descriptor or section)
+// its length is read from there, and the layout of that length is used: the
+// built-in placeholder, or the key ID one. A file with no such location, or
+// whose placeholder is already the configured length, gets mc itself. mc is
+// never modified, so one config can serve many files.
+func (mc *magicConfig) sizedFor(data []byte) (*magicConfig, error) {
+	if !mc.sizable {
+		return mc, nil
+	}
+	n, ok := structuralPlaceholderLen(data, mc.Prefix)
+	if !ok || n == len(mc.Magic) {
+		return mc, nil
+	}
+
+	keyed := &magicConfig{Magic: mc.Magic, Prefix: mc.Prefix, KeyID: true}
+	if err := keyed.validate(); err != nil {
+		return nil, err
+	}
+	if n != len(keyed.Magic) {
+		return nil, fmt.Errorf("%w: the placeholder is %d bytes, but a signature is %d bytes, or %d with a key ID",
+			errInvalidSignatureRegion, n, len(mc.Magic), len(keyed.Magic))
+	}
+	debugf("placeholder is %d bytes; using the key ID layout", n)
+	return keyed, nil
+}
+
+// encodedLen is the length of a signature in its embedded form, which the
+// magic string must match
+func (mc *magicConfig) encodedLen() int {
+	return len(mc.Prefix) + base64.StdEncoding.EncodedLen(mc.signatureSize())
+}
+
+// signatureSize is the size in bytes of what is base64-encoded after the
+// prefix: the signature, behind the key ID with --key-id
+func (mc *magicConfig) signatureSize() int {
+	if mc.KeyID {
+		return unisign.KeyIDSize + ed25519.SignatureSize
+	}
+	return ed25519.SignatureSize
+}
+
+// encodeSignature renders a raw signature in its embedded form, behind the
+// ID of publicKey with --key-id
+func (mc *magicConfig) encodeSignature(signature []byte, publicKey ssh.PublicKey) string {
+	if mc.KeyID {
+		signature = append(unisign.KeyID(publicKey), signature...)
+	}
+	return mc.Prefix + base64.StdEncoding.EncodeToString(signature)
+}
+
+// decodeEncoded decodes what follows the prefix in an embedded signature.
+// ok is false unless it is base64 of exactly signatureSize bytes; keyID is
+// nil without --key-id.
+func (mc *magicConfig) decodeEncoded(encoded string) (keyID, signature []byte, ok bool) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) != mc.signatureSize() {
+		return nil, nil, false
+	}
+	if mc.KeyID {
+		keyID, signature, err = unisign.SplitKeyID(decoded)
+		return keyID, signature, err == nil
+	}
+	return nil, decoded, true
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// collectManifestFiles returns the absolute paths of the regular files named
+// by args, descending into directories, sorted and without duplicates. The
+// manifest itself is left out so it can live inside the signed directory.
+func collectManifestFiles(args []string, manifestPath string) ([]string, error) {
+	manifestAbs, err := filepath.Abs(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if abs != manifestAbs && !seen[abs] {
+			seen[abs] = true
+			files = append(files, abs)
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if !info.Mode().IsRegular() {
+				return nil, fmt.Errorf("%s is not a regular file", arg)
+			}
+			if err := add(arg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			return add(path)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// manifestRoot returns the deepest directory containing every one of files,
+// which are absolute paths. Manifest entries are relative to it.
+func manifestRoot(files []string) string {
+	root := filepath.Dir(files[0])
+	for _, file := range files[1:] {
+		for {
+			rel, err := filepath.Rel(root, file)
+			if err == nil && filepath.IsLocal(rel) {
+				break
+			}
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
+
+// signManifest writes a manifest to manifestPath listing the hash of each
+// file named by args under one signature
+func signManifest(signer ssh.Signer, mc *magicConfig, manifestPath string, args []string, maxFileSize int64) {
+	files, err := collectManifestFiles(args, manifestPath)
+	if err != nil {
+		exitWithCode(exitIO, "collecting files: %v", err)
+	}
+	if len(files) == 0 {
+		exitWithCode(exitUsage, "no files to sign")
+	}
+	root := manifestRoot(files)
+
+	var m appconfig.Manifest
+	for _, file := range files {
+		if err := checkFileSize(file, maxFileSize); err != nil {
+			exitWithCode(exitIO, "reading %s: %v", file, err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			exitWithCode(exitIO, "reading %s: %v", file, err)
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			exitWithError("%v", err)
+		}
+		m.Entries = append(m.Entries, appconfig.ManifestEntry{Path: filepath.ToSlash(rel), SHA256: sha256.Sum256(data)})
+	}
+
+	signature, err := unisign.SignBuffer(signer, m.SignedMessage(), 0)
+	if err != nil {
+		exitWithError("signing manifest: %v", err)
+	}
+	m.Signature = mc.encodeSignature(signature, signer.PublicKey())
+
+	manifest, err := appconfig.MarshalManifest(m)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	if err := os.WriteFile(manifestPath, manifest, 0644); err != nil {
+		exitWithCode(exitIO, "writing manifest: %v", err)
+	}
+
+	fmt.Printf("Signed %d files relative to %s -> %s\n", len(m.Entries), root, manifestPath)
+}
+
+// verifyManifest checks the signature of the manifest at manifestPath, then
+// every file it lists against the files under dir. Listed files that are
+// missing or changed fail verification, and so do files under dir the
+// manifest doesn't list. No file is checked unless the signature verifies.
+// quiet leaves out the per-file report; problems still appear in the error.
+func verifyManifest(manifestPath, dir string, pubKeys []ssh.PublicKey, keyNames []string, mc *magicConfig, quiet bool, maxFileSize int64) {
+	manifestData, err := os.ReadFile(manifestPath)
+	if err != nil {
+		exitWithCode(exitIO, "reading manifest: %v", err)
+	}
+	m, err := appconfig.ParseManifest(manifestData)
+	if err != nil {
+		exitWithCode(exitMagic, "%v", err)
+	}
+
+	matched := -1
+	if s, err := slotAt([]byte(m.Signature), 0, mc); err == nil && s.Filled {
+		message := m.SignedMessage()
+		for k, pubKey := range pubKeys {
+			if unisign.VerifySignature(pubKey, message, 0, s.Signature) == nil {
+				matched = k
+				break
+			}
+		}
+	}
+	if matched == -1 {
+		exitWithCode(exitVerify, "manifest signature verification failed")
+	}
+
+	report := func(format string, args ...interface{}) {
+		if !quiet {
+			fmt.Printf(format, args...)
+		}
+	}
+
+	report("Manifest signed by %s\n", keyNames[matched])
+
+	var problems []string
+	listed := make(map[string]bool)
+	for _, e := range m.Entries {
+		listed[e.Path] = true
+		path := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if err := checkFileSize(path, maxFileSize); err != nil && !os.IsNotExist(err) {
+			exitWithCode(exitIO, "reading %s: %v", e.Path, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			report("MISSING  %s\n", e.Path)
+			problems = append(problems, "missing "+e.Path)
+			continue
+		}
+		if sha256.Sum256(data) != e.SHA256 {
+			report("MODIFIED %s\n", e.Path)
+			problems = append(problems, "modified "+e.Path)
+			continue
+		}
+		report("OK       %s\n", e.Path)
+	}
+
+	// Report files present under dir that the manifest doesn't cover
+	manifestAbs, _ := filepath.Abs(manifestPath)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		if abs, _ := filepath.Abs(path); abs == manifestAbs {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); !listed[rel] {
+			report("EXTRA    %s\n", rel)
+			problems = append(problems, "unlisted "+rel)
+		}
+		return nil
+	})
+	if err != nil {
+		exitWithCode(exitIO, "scanning %s: %v", dir, err)
+	}
+
+	if len(problems) > 0 {
+		exitWithCode(exitVerify, "manifest verification failed (%d problems): %s",
+			len(problems), strings.Join(problems, ", "))
+	}
+	report("All %d files in the manifest verified successfully.\n", len(m.Entries))
+}
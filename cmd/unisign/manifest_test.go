@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignAndVerifyManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	wrongKeyPath := generateTestKey(t, tmpDir, "wrong_key")
+
+	dir := filepath.Join(tmpDir, "dist")
+	files := map[string]string{
+		"app-linux.tar.gz": "linux build",
+		"app-darwin.zip":   "darwin build",
+		"docs/README.txt":  "read me",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write artifact: %v", err)
+		}
+	}
+
+	// sign --manifest out.sigs ./dist/*
+	manifestPath := filepath.Join(tmpDir, "out.sigs")
+	args, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("failed to list artifacts: %v", err)
+	}
+	cmd := exec.Command("go", append([]string{"run", ".", "sign", "-k", keyPath, "--manifest", manifestPath}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing manifest failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Signed 3 files")) {
+		t.Errorf("sign output should report the number of files: %s", output)
+	}
+
+	verify := func(keyPath string) ([]byte, error) {
+		cmd := exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", "--manifest", manifestPath, dir)
+		return cmd.CombinedOutput()
+	}
+
+	output, err = verify(keyPath)
+	if err != nil {
+		t.Fatalf("verifying manifest failed: %v\nOutput: %s", err, output)
+	}
+	for name := range files {
+		if !bytes.Contains(output, []byte("OK       "+name)) {
+			t.Errorf("verify output does not list %s as OK: %s", name, output)
+		}
+	}
+
+	// A different key fails before any file is checked
+	output, err = verify(wrongKeyPath)
+	if err == nil || !bytes.Contains(output, []byte("manifest signature verification failed")) || bytes.Contains(output, []byte("OK ")) {
+		t.Errorf("verifying with the wrong key should fail: err %v\nOutput: %s", err, output)
+	}
+
+	// Dropping an entry, together with its file, breaks the manifest signature
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	lines := bytes.SplitAfter(manifest, []byte("\n"))
+	dropped := filepath.Join(tmpDir, "dropped.sigs")
+	if err := os.WriteFile(dropped, bytes.Join(append(lines[:2], lines[3:]...), nil), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	droppedDir := filepath.Join(tmpDir, "dropped")
+	if err := os.MkdirAll(filepath.Join(droppedDir, "docs"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	for _, name := range []string{"app-linux.tar.gz", "docs/README.txt"} {
+		if err := os.WriteFile(filepath.Join(droppedDir, filepath.FromSlash(name)), []byte(files[name]), 0644); err != nil {
+			t.Fatalf("failed to write artifact: %v", err)
+		}
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", "--manifest", dropped, droppedDir)
+	output, err = cmd.CombinedOutput()
+	if err == nil || !bytes.Contains(output, []byte("manifest signature verification failed")) {
+		t.Errorf("verifying a manifest with a dropped entry should fail: err %v\nOutput: %s", err, output)
+	}
+
+	// Missing, changed and unlisted files are each reported
+	if err := os.Remove(filepath.Join(dir, "app-darwin.zip")); err != nil {
+		t.Fatalf("failed to remove artifact: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app-linux.tar.gz"), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("failed to modify artifact: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "docs", "new.txt"), []byte("unsigned"), 0644); err != nil {
+		t.Fatalf("failed to add artifact: %v", err)
+	}
+	output, err = verify(keyPath)
+	if err == nil {
+		t.Fatalf("verifying a changed directory should fail\nOutput: %s", output)
+	}
+	for _, want := range []string{
+		"MISSING  app-darwin.zip",
+		"MODIFIED app-linux.tar.gz",
+		"OK       docs/README.txt",
+		"EXTRA    docs/new.txt",
+		"manifest verification failed (3 problems)",
+	} {
+		if !bytes.Contains(output, []byte(want)) {
+			t.Errorf("verify output is missing %q: %s", want, output)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// outputAttrs is how --chmod and --preserve-time adjust a written output
+// file. By default the output keeps the input's permission bits and gets the
+// current time as its mtime.
+type outputAttrs struct {
+	Chmod        string
+	PreserveTime bool
+
+	mode      os.FileMode // parsed from Chmod by validate
+	inputTime time.Time   // set by recordInputTime
+}
+
+// addOutputAttrFlags registers --chmod and --preserve-time on a command's flag set
+func addOutputAttrFlags(fs *flag.FlagSet) *outputAttrs {
+	oa := &outputAttrs{}
+	fs.StringVar(&oa.Chmod, "chmod", "", "Set the output's permission bits (octal, e.g. 0644) instead of copying the input's")
+	fs.BoolVar(&oa.PreserveTime, "preserve-time", false, "Give the output the input's modification time")
+	return oa
+}
+
+// validate parses --chmod, which must be octal permission bits no larger than 0777
+func (oa *outputAttrs) validate() error {
+	if oa.Chmod == "" {
+		return nil
+	}
+	mode, err := strconv.ParseUint(oa.Chmod, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("--chmod %q is not an octal mode between 0000 and 0777", oa.Chmod)
+	}
+	oa.mode = os.FileMode(mode)
+	return nil
+}
+
+// recordInputTime keeps input's modification time for apply, for an output
+// that replaces the input and so would otherwise set the time apply reads
+func (oa *outputAttrs) recordInputTime(input string) error {
+	if !oa.PreserveTime {
+		return nil
+	}
+	info, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+	oa.inputTime = info.ModTime()
+	return nil
+}
+
+// apply sets output's mode and modification time as requested, the latter
+// taken from input unless recordInputTime already did. The access time is
+// left as the write set it.
+func (oa *outputAttrs) apply(input, output string) error {
+	if oa.Chmod != "" {
+		if err := os.Chmod(output, oa.mode); err != nil {
+			return err
+		}
+	}
+	if oa.PreserveTime {
+		if oa.inputTime.IsZero() {
+			if err := oa.recordInputTime(input); err != nil {
+				return err
+			}
+		}
+		if err := os.Chtimes(output, time.Time{}, oa.inputTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"unisign/pkg/unisign"
+)
+
+// exitWithError is defined in verify.go
+
+// printPlaceholderInfo prints the placeholder to embed in a file and how its
+// length follows from the signature prefix and the ed25519 signature size.
+// With --magic and --prefix it checks a custom pair, failing on a mismatch.
+func printPlaceholderInfo() {
+	// Parse command line flags
+	infoCmd := flag.NewFlagSet("placeholder-info", flag.ExitOnError)
+	mc := addMagicFlags(infoCmd)
+
+	// Parse placeholder-info command args
+	infoCmd.Parse(os.Args[2:])
+
+	if infoCmd.NArg() != 0 {
+		exitWithCode(exitUsage, "unexpected arguments: %v", infoCmd.Args())
+	}
+	if err := mc.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+
+	fmt.Printf("Magic string: %s\n", mc.Magic)
+	fmt.Printf("Magic string length: %d\n", len(mc.Magic))
+	fmt.Printf("Signature prefix: %s\n", mc.Prefix)
+	fmt.Printf("Signature size: %d bytes (ed25519), %d base64 characters\n",
+		ed25519.SignatureSize, base64.StdEncoding.EncodedLen(ed25519.SignatureSize))
+	if mc.KeyID {
+		fmt.Printf("Key ID size: %d bytes, in front of the signature\n", unisign.KeyIDSize)
+	}
+	fmt.Printf("Encoded signature length: %d (prefix %d + signature %d)\n",
+		mc.encodedLen(), len(mc.Prefix), base64.StdEncoding.EncodedLen(mc.signatureSize()))
+}
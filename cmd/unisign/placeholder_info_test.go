@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/placeholder"
+)
+
+func TestPlaceholderInfo(t *testing.T) {
+	cmd := exec.Command("go", "run", ".", "placeholder-info")
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("placeholder-info failed: %v\nOutput: %s", err, output)
+	}
+
+	sigLen := base64.StdEncoding.EncodedLen(ed25519.SignatureSize)
+	for _, want := range []string{
+		"Magic string: " + appconfig.MagicString + "\n",
+		fmt.Sprintf("Magic string length: %d\n", len(appconfig.MagicString)),
+		"Signature prefix: " + appconfig.SignaturePrefix + "\n",
+		fmt.Sprintf("Signature size: %d bytes (ed25519), %d base64 characters\n", ed25519.SignatureSize, sigLen),
+		fmt.Sprintf("Encoded signature length: %d (prefix %d + signature %d)\n",
+			len(appconfig.SignaturePrefix)+sigLen, len(appconfig.SignaturePrefix), sigLen),
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("output is missing %q:\n%s", want, output)
+		}
+	}
+
+	// The placeholder package embeds the same string the CLI looks for
+	if placeholder.MagicStringConst != appconfig.MagicString || placeholder.SignaturePrefix != appconfig.SignaturePrefix {
+		t.Errorf("pkg/placeholder constants have drifted from the CLI's")
+	}
+}
+
+func TestPlaceholderInfoRejectsMismatchedLength(t *testing.T) {
+	cmd := exec.Command("go", "run", ".", "placeholder-info", "--magic", "us2-tooshort")
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("placeholder-info accepted a magic string of the wrong length\nOutput: %s", output)
+	}
+	if !strings.Contains(string(output), "is 12 bytes") {
+		t.Errorf("error does not report the length mismatch: %s", output)
+	}
+}
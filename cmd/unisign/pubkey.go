@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// exitWithError is defined in verify.go
+
+func printPublicKey() {
+	// Parse command line flags
+	pubkeyCmd := flag.NewFlagSet("pubkey", flag.ExitOnError)
+	keyFile := new(string)
+	pubkeyCmd.StringVar(keyFile, "key", "", "SSH private key file")
+	pubkeyCmd.StringVar(keyFile, "k", "", "Shorthand for --key")
+	passphraseFile := pubkeyCmd.String("passphrase-file", "", "File holding the private key passphrase (e.g. /dev/fd/3)")
+
+	// Parse pubkey command args
+	pubkeyCmd.Parse(os.Args[2:])
+
+	if *keyFile == "" {
+		exitWithCode(exitUsage, "flag -k (--key) is required")
+	}
+	if pubkeyCmd.NArg() != 0 {
+		exitWithCode(exitUsage, "unexpected arguments: %v", pubkeyCmd.Args())
+	}
+
+	// Read the passphrase, if any, and zero it as soon as the key is decrypted
+	var passphrase []byte
+	if *passphraseFile != "" {
+		var err error
+		passphrase, err = readPassphraseFile(*passphraseFile)
+		if err != nil {
+			exitWithCode(exitIO, "reading passphrase file: %v", err)
+		}
+	}
+
+	// Read the SSH private key
+	signer, err := unisign.ReadSSHPrivateKeyWithPassphrase(*keyFile, passphrase)
+	clear(passphrase)
+	if err != nil {
+		exitWithCode(exitIO, "reading private key: %v", err)
+	}
+
+	// Print the public key in authorized_keys format
+	os.Stdout.Write(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestPubkey(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "pubkey", "-k", keyPath)
+	cmd.Dir = "."
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("unisign pubkey failed: %v\nOutput: %s", err, output)
+	}
+
+	// ssh-keygen appends a comment; compare only the key type and blob
+	want, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	wantFields := bytes.Fields(want)
+	gotFields := bytes.Fields(output)
+	if len(gotFields) != 2 || !bytes.Equal(gotFields[0], wantFields[0]) || !bytes.Equal(gotFields[1], wantFields[1]) {
+		t.Errorf("pubkey output = %q, want key from %q", output, want)
+	}
+}
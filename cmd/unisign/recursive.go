@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// errNoPlaceholder marks a file a recursive run skips because there is nothing to sign
+var errNoPlaceholder = errors.New("no placeholder")
+
+// recursiveJob is one file of a recursive run and where its signed copy goes
+type recursiveJob struct {
+	Input  string
+	Output string
+}
+
+// planRecursiveSign lists the regular files under root and the output path
+// for each. Without outDir, or when outDir is root itself, outputs are
+// written next to their inputs with ".signed" appended, and a file that is
+// the ".signed" output of another file in the tree is taken to be left over
+// from an earlier run rather than signed again. Otherwise each file's path
+// relative to root is recreated under outDir, and outDir is not descended
+// into if it lies within root. An output that would replace one of the
+// inputs is an error, reported before anything is written.
+func planRecursiveSign(root, outDir string) ([]recursiveJob, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	inPlace := outDir == ""
+	outAbs := ""
+	if !inPlace {
+		if outAbs, err = filepath.Abs(outDir); err != nil {
+			return nil, err
+		}
+		inPlace = outAbs == rootAbs
+	}
+
+	var files []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && !inPlace && path != root {
+			if abs, err := filepath.Abs(path); err == nil && abs == outAbs {
+				return filepath.SkipDir
+			}
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	isFile := make(map[string]bool, len(files))
+	for _, file := range files {
+		isFile[file] = true
+	}
+
+	var jobs []recursiveJob
+	inputs := make(map[string]bool, len(files))
+	for _, file := range files {
+		if inPlace && strings.HasSuffix(file, ".signed") && isFile[strings.TrimSuffix(file, ".signed")] {
+			continue
+		}
+		output := file + ".signed"
+		if !inPlace {
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return nil, err
+			}
+			output = filepath.Join(outDir, rel)
+		}
+		jobs = append(jobs, recursiveJob{Input: file, Output: output})
+		if abs, err := filepath.Abs(file); err == nil {
+			inputs[abs] = true
+		}
+	}
+
+	for _, job := range jobs {
+		if abs, err := filepath.Abs(job.Output); err == nil && inputs[abs] {
+			return nil, fmt.Errorf("signed copy of %s would overwrite input %s", job.Input, job.Output)
+		}
+	}
+	return jobs, nil
+}
+
+// signRecursive signs every file under root that holds exactly one
+// placeholder, as planned by planRecursiveSign. Files without a placeholder,
+// or already signed, are skipped; any other failure is reported and the run
+// continues, exiting with an error at the end. oa is applied to every output.
+func signRecursive(signer ssh.Signer, mc *magicConfig, root, outDir string, dryRun bool, oa *outputAttrs, maxFileSize int64) {
+	jobs, err := planRecursiveSign(root, outDir)
+	if err != nil {
+		exitWithCode(exitIO, "collecting files: %v", err)
+	}
+
+	signed, skipped := 0, 0
+	var failures []string
+	for _, job := range jobs {
+		offset, err := signJob(signer, mc, job, dryRun, oa, maxFileSize)
+		switch {
+		case errors.Is(err, errNoPlaceholder) || errors.Is(err, errAlreadySigned):
+			skipped++
+			fmt.Printf("Skipping %s: %v\n", job.Input, err)
+		case err != nil:
+			failures = append(failures, job.Input)
+			fmt.Fprintf(os.Stderr, "Failed to sign %s: %v\n", job.Input, err)
+		case dryRun:
+			signed++
+			fmt.Printf("Dry run: would sign %s -> %s (offset %d)\n", job.Input, job.Output, offset)
+		default:
+			signed++
+			fmt.Printf("Signed %s -> %s (offset %d)\n", job.Input, job.Output, offset)
+		}
+	}
+
+	if len(failures) > 0 {
+		exitWithError("%d of %d files failed to sign: %s", len(failures), len(failures)+signed, strings.Join(failures, ", "))
+	}
+	fmt.Printf("Signed %d files, skipped %d\n", signed, skipped)
+}
+
+// signJob signs one file of a recursive run the way sign does a single file
+// without --slot, and returns the offset of the signature
+func signJob(signer ssh.Signer, mc *magicConfig, job recursiveJob, dryRun bool, oa *outputAttrs, maxFileSize int64) (_ int64, err error) {
+	if err := checkFileSize(job.Input, maxFileSize); err != nil {
+		return 0, err
+	}
+	buf, perm, release, err := appconfig.LoadFileWithHeadroom(job.Input, unisign.HeaderSize)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	data := buf[unisign.HeaderSize:]
+
+	// Truncating a mapped input makes reading it fault; fail the file rather than crash
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if !appconfig.IsMappedFault(r) {
+				panic(r)
+			}
+			err = appconfig.ErrFileTruncated
+		}
+	}()
+	dataSum := sha256.Sum256(data)
+
+	// Each file's structure may call for its own layout
+	mc, err = mc.sizedFor(data)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := unisign.CheckExactlyOneMagicString(data, []byte(mc.Magic))
+	if errors.Is(err, unisign.ErrMagicNotFound) {
+		if bytes.Contains(data, []byte(mc.Prefix)) {
+			return 0, errAlreadySigned
+		}
+		return 0, errNoPlaceholder
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The file has a single signature, so nothing but its placeholder is restored
+	signature, err := unisign.SignBufferWithHeadroom(signer, buf, uint64(offset))
+	if err != nil {
+		return 0, err
+	}
+
+	encodedSig := mc.encodeSignature(signature, signer.PublicKey())
+	if dryRun {
+		return offset, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(job.Output), 0755); err != nil {
+		return 0, err
+	}
+	if err := appconfig.CopyFileWithPatch(job.Input, job.Output, perm, dataSum, offset, []byte(encodedSig)); err != nil {
+		return 0, err
+	}
+	return offset, oa.apply(job.Input, job.Output)
+}
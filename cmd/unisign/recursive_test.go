@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSignRecursiveOutDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	src := filepath.Join(tmpDir, "src")
+	for _, dir := range []string{"bin", "lib/deep"} {
+		if err := os.MkdirAll(filepath.Join(src, dir), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	createTestFileWithMagic(t, filepath.Join(src, "bin"), "tool")
+	createTestFileWithMagic(t, filepath.Join(src, "lib/deep"), "libfoo.so")
+	if err := os.WriteFile(filepath.Join(src, "README"), []byte("no placeholder here"), 0644); err != nil {
+		t.Fatalf("failed to write README: %v", err)
+	}
+
+	out := filepath.Join(tmpDir, "signed")
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, "-r", "--out-dir", out, src)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("recursive signing failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Signed 2 files, skipped 1")) {
+		t.Errorf("unexpected summary: %s", output)
+	}
+
+	// The signed tree mirrors the source, and the source is left untouched
+	for _, rel := range []string{"bin/tool", "lib/deep/libfoo.so"} {
+		cmd := exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", filepath.Join(out, rel))
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("verifying %s failed: %v\nOutput: %s", rel, err, output)
+		}
+		if _, err := os.Stat(filepath.Join(src, rel+".signed")); !os.IsNotExist(err) {
+			t.Errorf("signed copy of %s was written into the source tree", rel)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "README")); !os.IsNotExist(err) {
+		t.Errorf("file without a placeholder was copied to the output tree")
+	}
+
+	// --out-dir without -r is rejected
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--out-dir", out, filepath.Join(src, "bin/tool"))
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("--out-dir without -r should fail\nOutput: %s", output)
+	}
+}
+
+func TestPlanRecursiveSign(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"a", "a.signed", "sub/b", "out/stale"} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	join := func(names ...string) []recursiveJob {
+		jobs := make([]recursiveJob, 0, len(names)/2)
+		for i := 0; i < len(names); i += 2 {
+			jobs = append(jobs, recursiveJob{Input: filepath.Join(src, names[i]), Output: filepath.Join(src, names[i+1])})
+		}
+		return jobs
+	}
+
+	// In place, by default or with --out-dir naming the source root, outputs
+	// get ".signed" and a leftover output isn't signed again
+	inPlace := join("a", "a.signed", "out/stale", "out/stale.signed", "sub/b", "sub/b.signed")
+	for _, outDir := range []string{"", src, src + "/"} {
+		jobs, err := planRecursiveSign(src, outDir)
+		if err != nil {
+			t.Fatalf("planRecursiveSign(%q) failed: %v", outDir, err)
+		}
+		if !reflect.DeepEqual(jobs, inPlace) {
+			t.Errorf("planRecursiveSign(%q) = %v, want %v", outDir, jobs, inPlace)
+		}
+	}
+
+	// An output directory inside the source tree is not itself signed
+	jobs, err := planRecursiveSign(src, filepath.Join(src, "out"))
+	if err != nil {
+		t.Fatalf("planRecursiveSign failed: %v", err)
+	}
+	want := join("a", "out/a", "a.signed", "out/a.signed", "sub/b", "out/sub/b")
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("planRecursiveSign = %v, want %v", jobs, want)
+	}
+
+	// Mirroring sub into its parent maps sub/sub/b onto the input sub/b
+	if err := os.MkdirAll(filepath.Join(src, "sub", "sub"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "sub", "b"), []byte("clash"), 0644); err != nil {
+		t.Fatalf("failed to write sub/sub/b: %v", err)
+	}
+	_, err = planRecursiveSign(filepath.Join(src, "sub"), src)
+	if err == nil || !strings.Contains(err.Error(), "would overwrite input") {
+		t.Errorf("planRecursiveSign with an output over an input: err = %v, want a collision", err)
+	}
+}
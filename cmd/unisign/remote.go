@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultFetchTimeout bounds the whole request when verify fetches a URL
+const defaultFetchTimeout = 60 * time.Second
+
+// defaultMaxFetchSize is the largest response verify reads from a URL by
+// default, matching the 1GB inputs sign is expected to handle
+const defaultMaxFetchSize = 1 << 30
+
+// isRemotePath reports whether path is an http:// or https:// URL rather than a file
+func isRemotePath(path string) bool {
+	u, err := url.Parse(path)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// fetchRemote downloads rawURL into memory. Responses other than 2xx and
+// bodies larger than maxSize bytes are errors; timeout covers the whole
+// request, including reading the body.
+func fetchRemote(rawURL string, timeout time.Duration, maxSize int64) ([]byte, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("fetching %s: server returned %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("fetching %s: response of %d bytes exceeds the %d-byte limit", rawURL, resp.ContentLength, maxSize)
+	}
+
+	// Read one byte past the limit to tell a body of exactly maxSize from a larger one
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", rawURL, err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("fetching %s: response exceeds the %d-byte limit", rawURL, maxSize)
+	}
+	return data, nil
+}
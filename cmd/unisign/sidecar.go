@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sidecarPath is where sign --sidecar writes the signature for inputFile
+func sidecarPath(inputFile string) string {
+	return inputFile + appconfig.SidecarSuffix
+}
+
+// openSignedFile opens inputFile for signing or verifying as a whole and
+// returns it with its size
+func openSignedFile(inputFile string, maxFileSize int64) (*os.File, uint64, error) {
+	if err := checkFileSize(inputFile, maxFileSize); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, 0, fmt.Errorf("%s is not a regular file", inputFile)
+	}
+	return f, uint64(info.Size()), nil
+}
+
+// signSidecar signs the whole of inputFile, at offset 0, and writes the
+// signature with its header fields to a sidecar next to it. The file is left
+// as it is, so it needs no placeholder. An existing sidecar is only replaced
+// with force.
+func signSidecar(signer ssh.Signer, mc *magicConfig, inputFile string, force bool, maxFileSize int64) {
+	sidecarFile := sidecarPath(inputFile)
+	if _, err := os.Stat(sidecarFile); err == nil && !force {
+		exitWithCode(exitUsage, "%s already exists; pass --force to replace it", sidecarFile)
+	}
+
+	f, length, err := openSignedFile(inputFile, maxFileSize)
+	if err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	defer f.Close()
+
+	signature, err := unisign.SignReader(signer, f, length, 0)
+	if err != nil {
+		exitWithError("signing %s: %v", inputFile, err)
+	}
+	sidecar, err := appconfig.MarshalSidecar(appconfig.Sidecar{
+		Length:    length,
+		Offset:    0,
+		Signature: mc.encodeSignature(signature, signer.PublicKey()),
+	})
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	if err := os.WriteFile(sidecarFile, sidecar, 0644); err != nil {
+		exitWithCode(exitIO, "writing sidecar: %v", err)
+	}
+
+	fmt.Printf("Signed %s (%d bytes) -> %s\n", inputFile, length, sidecarFile)
+}
+
+// verifySidecar checks the signature in the sidecar of inputFile, which
+// passes if any of pubKeys made it over the file as it is. quiet leaves out
+// the success message.
+func verifySidecar(inputFile string, pubKeys []ssh.PublicKey, keyNames []string, mc *magicConfig, quiet bool, maxFileSize int64) {
+	sidecarFile := sidecarPath(inputFile)
+	data, err := os.ReadFile(sidecarFile)
+	if err != nil {
+		exitWithCode(exitIO, "reading sidecar: %v", err)
+	}
+	sidecar, err := appconfig.ParseSidecar(data)
+	if err != nil {
+		exitWithCode(exitMagic, "%s: %v", sidecarFile, err)
+	}
+	s, err := slotAt([]byte(sidecar.Signature), 0, mc)
+	if err != nil || !s.Filled {
+		exitWithCode(exitMagic, "%s: %v: malformed signature", sidecarFile, appconfig.ErrInvalidSidecar)
+	}
+
+	// A length mismatch already tells the file changed; no need to read it
+	f, length, err := openSignedFile(inputFile, maxFileSize)
+	if err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	defer f.Close()
+	if length != sidecar.Length {
+		exitWithCode(exitVerify, "%s is %d bytes but its sidecar signature covers %d", inputFile, length, sidecar.Length)
+	}
+
+	// The file is read once, however many keys are tried
+	k, err := unisign.VerifyReaderKeys(pubKeys, f, sidecar.Length, sidecar.Offset, s.Signature)
+	if err != nil {
+		var lengthErr *unisign.HeaderLengthError
+		if errors.As(err, &lengthErr) {
+			exitWithCode(exitVerify, "%v", err)
+		}
+		exitWithCode(exitVerify, "signature verification failed: %v", err)
+	}
+	if !quiet {
+		fmt.Printf("Verified with %s (%s %s) over %d bytes\n",
+			keyNames[k], pubKeys[k].Type(), ssh.FingerprintSHA256(pubKeys[k]), sidecar.Length)
+		fmt.Println("Signature verified successfully.")
+	}
+}
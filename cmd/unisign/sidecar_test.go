@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	appconfig "unisign/internal/unisign"
+)
+
+func TestSignAndVerifySidecar(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	wrongKeyPath := generateTestKey(t, tmpDir, "wrong_key")
+
+	// The file needs no placeholder and is left unchanged
+	content := []byte("\x89PNG\r\n\x1a\n image data with no room for a placeholder")
+	inputPath := filepath.Join(tmpDir, "logo.png")
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, "--sidecar", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	if data, err := os.ReadFile(inputPath); err != nil || string(data) != string(content) {
+		t.Errorf("input file changed: %q, %v", data, err)
+	}
+	data, err := os.ReadFile(inputPath + appconfig.SidecarSuffix)
+	if err != nil {
+		t.Fatalf("failed to read sidecar: %v", err)
+	}
+	sidecar, err := appconfig.ParseSidecar(data)
+	if err != nil {
+		t.Fatalf("sign wrote an unparseable sidecar: %v", err)
+	}
+	if sidecar.Length != uint64(len(content)) || sidecar.Offset != 0 || !strings.HasPrefix(sidecar.Signature, appconfig.SignaturePrefix) {
+		t.Errorf("sidecar = %+v, want the whole file at offset 0", sidecar)
+	}
+
+	// Signing again needs --force
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--sidecar", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(output), "--force") {
+		t.Errorf("signing over an existing sidecar should have failed: %v\nOutput: %s", err, output)
+	}
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--sidecar", "--force", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("re-signing with --force failed: %v\nOutput: %s", err, output)
+	}
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", append([]string{"run", ".", "verify"}, args...)...)
+		cmd.Dir = "."
+		return cmd.CombinedOutput()
+	}
+
+	output, err := run("-k", keyPath+".pub", "--sidecar", inputPath)
+	if err != nil || !strings.Contains(string(output), "Signature verified successfully.") {
+		t.Errorf("verifying the sidecar failed: %v\nOutput: %s", err, output)
+	}
+	if output, err := run("-k", wrongKeyPath+".pub", "--sidecar", inputPath); err == nil {
+		t.Errorf("verifying with the wrong key should have failed\nOutput: %s", output)
+	}
+
+	// Changing the file, in place or by growing it, breaks the signature
+	tampered := append([]byte(nil), content...)
+	tampered[len(tampered)-1] ^= 1
+	if err := os.WriteFile(inputPath, tampered, 0644); err != nil {
+		t.Fatalf("failed to write tampered file: %v", err)
+	}
+	if output, err := run("-k", keyPath+".pub", "--sidecar", inputPath); err == nil || !strings.Contains(string(output), "signature verification failed") {
+		t.Errorf("verifying a modified file should have failed: %v\nOutput: %s", err, output)
+	}
+	if err := os.WriteFile(inputPath, append(content, '\n'), 0644); err != nil {
+		t.Fatalf("failed to write extended file: %v", err)
+	}
+	if output, err := run("-k", keyPath+".pub", "--sidecar", inputPath); err == nil || !strings.Contains(string(output), "covers") {
+		t.Errorf("verifying an extended file should have failed: %v\nOutput: %s", err, output)
+	}
+
+	// A file without a sidecar has nothing to verify
+	if output, err := run("-k", keyPath+".pub", "--sidecar", filepath.Join(tmpDir, "test_key.pub")); err == nil || !strings.Contains(string(output), "reading sidecar") {
+		t.Errorf("verifying without a sidecar should have failed: %v\nOutput: %s", err, output)
+	}
+}
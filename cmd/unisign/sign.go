@@ -1,12 +1,20 @@
 package main
 
 import (
-	"encoding/base64"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime/debug"
+	"strings"
 	appconfig "unisign/internal/unisign"
 	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // exitWithError is defined in verify.go
@@ -14,56 +22,290 @@ import (
 func signFile() {
 	// Parse command line flags
 	signCmd := flag.NewFlagSet("sign", flag.ExitOnError)
-	keyFile := signCmd.String("k", "", "SSH private key file")
+	keyFile := new(string)
+	signCmd.StringVar(keyFile, "key", "", "SSH private key file, - for stdin, or a signer URI such as agent://SHA256:...")
+	signCmd.StringVar(keyFile, "k", "", "Shorthand for --key")
+	passphraseFile := signCmd.String("passphrase-file", "", "File holding the private key passphrase (e.g. /dev/fd/3)")
+	certFile := signCmd.String("cert", "", "OpenSSH certificate for the private key (e.g. id_ed25519-cert.pub)")
+	dryRun := signCmd.Bool("dry-run", false, "Sign in memory and report the result, without writing the signed file")
+	sshsig := signCmd.Bool("sshsig", false, "Write an ssh-keygen -Y sign signature to <input_file>.sig instead of signing in place")
+	namespace := signCmd.String("namespace", defaultSSHSigNamespace, "With --sshsig, the namespace the signature is made for")
+	sidecar := signCmd.Bool("sidecar", false, "Write the signature to <input_file>"+appconfig.SidecarSuffix+" instead of signing in place, for files that can't hold a placeholder")
+	manifestFile := signCmd.String("manifest", "", "Write detached signatures for all the given files to this manifest instead of signing in place")
+	force := signCmd.Bool("force", false, "Re-sign an already-signed file, replacing its signature")
+	printSum := signCmd.Bool("sum", false, "Print the SHA-256 of the signed output")
+	sumFile := signCmd.String("sum-file", "", "Write the SHA-256 of the signed output to this file, in sha256sum format")
+	slotIndex := signCmd.Int("slot", -1, "Fill only the i-th placeholder (0-based), leaving the others for later signers")
+	jsonField := signCmd.String("json-field", "", "Sign the canonical form of a JSON object whose top-level `field` holds the placeholder")
+	normalizeEOL := signCmd.Bool("normalize-eol", false, "Sign the file with CRLF line endings converted to LF; verify must pass it too")
+	lineComment := signCmd.Bool("line-comment", false, "Sign the file without the # comment line holding the placeholder; verify must pass it too")
+	recursive := signCmd.Bool("r", false, "Sign every file holding the placeholder under the given directory")
+	outDir := signCmd.String("out-dir", "", "With -r, write signed copies to this directory, mirroring the input tree")
+	tsaURL := signCmd.String("tsa", "", "Get an RFC 3161 timestamp token over the signature from this TSA URL, written to <output_file>"+appconfig.TimestampSuffix)
+	mc := addMagicFlags(signCmd)
+	oa := addOutputAttrFlags(signCmd)
+	maxFileSize := addMaxFileSizeFlag(signCmd)
+	verbose := addVerboseFlag(signCmd)
 
 	// Parse sign command args
 	signCmd.Parse(os.Args[2:])
 
+	if err := mc.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+	if err := oa.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+	validateMaxFileSize(*maxFileSize)
+	enableVerbose(*verbose)
+
 	if *keyFile == "" {
-		exitWithError("flag -k is required")
+		exitWithCode(exitUsage, "flag -k (--key) is required")
+	}
+	if *keyFile == stdinPath {
+		// Standard input can feed only the key
+		if *certFile != "" {
+			exitWithCode(exitUsage, "--cert cannot be combined with -k - (reading the key from stdin)")
+		}
+		for _, path := range append([]string{*passphraseFile}, signCmd.Args()...) {
+			if path == stdinPath {
+				exitWithCode(exitUsage, "only one of the private key and the other inputs may be read from stdin (-)")
+			}
+		}
+	}
+
+	if *jsonField != "" && (*slotIndex >= 0 || *normalizeEOL) {
+		exitWithCode(exitUsage, "--json-field cannot be combined with --slot or --normalize-eol")
+	}
+	if *lineComment && (*slotIndex >= 0 || *jsonField != "" || *normalizeEOL) {
+		exitWithCode(exitUsage, "--line-comment cannot be combined with --slot, --json-field or --normalize-eol")
+	}
+
+	// Key ID tags live in placeholders, which neither detached format has
+	if mc.KeyID && (*sshsig || *manifestFile != "") {
+		exitWithCode(exitUsage, "--key-id cannot be combined with --sshsig or --manifest")
+	}
+
+	// With --sshsig the file is signed as ssh-keygen would, into a separate file
+	if *namespace != defaultSSHSigNamespace && !*sshsig {
+		exitWithCode(exitUsage, "--namespace is only valid with --sshsig")
+	}
+	if *sshsig {
+		if *manifestFile != "" || *recursive || *slotIndex >= 0 || *jsonField != "" || *normalizeEOL || *lineComment || *printSum || *sumFile != "" || *dryRun || oa.Chmod != "" || oa.PreserveTime || *tsaURL != "" || *sidecar {
+			exitWithCode(exitUsage, "--sshsig cannot be combined with --sidecar, --manifest, -r, --slot, --json-field, --normalize-eol, --line-comment, --sum, --sum-file, --dry-run, --chmod, --preserve-time or --tsa")
+		}
+		if signCmd.NArg() != 1 {
+			exitWithCode(exitUsage, "input file is required")
+		}
+		signSSHSig(loadSigner(*keyFile, *passphraseFile, *certFile), *namespace, signCmd.Arg(0), *force, *maxFileSize)
+		return
+	}
+
+	// With --sidecar the whole file is signed as it is, into a separate file
+	if *sidecar {
+		if *manifestFile != "" || *recursive || *slotIndex >= 0 || *jsonField != "" || *normalizeEOL || *lineComment || *printSum || *sumFile != "" || *dryRun || oa.Chmod != "" || oa.PreserveTime || *tsaURL != "" {
+			exitWithCode(exitUsage, "--sidecar cannot be combined with --manifest, -r, --slot, --json-field, --normalize-eol, --line-comment, --sum, --sum-file, --dry-run, --chmod, --preserve-time or --tsa")
+		}
+		if signCmd.NArg() != 1 {
+			exitWithCode(exitUsage, "input file is required")
+		}
+		if signCmd.Arg(0) == stdinPath {
+			exitWithCode(exitUsage, "--sidecar needs a named input file to write the sidecar next to")
+		}
+		signSidecar(loadSigner(*keyFile, *passphraseFile, *certFile), mc, signCmd.Arg(0), *force, *maxFileSize)
+		return
+	}
+
+	// With --manifest every argument is signed into one detached manifest
+	if *manifestFile != "" {
+		if *recursive || *slotIndex >= 0 || *jsonField != "" || *normalizeEOL || *lineComment || *force || *printSum || *sumFile != "" || *dryRun || oa.Chmod != "" || oa.PreserveTime || *tsaURL != "" {
+			exitWithCode(exitUsage, "--manifest cannot be combined with -r, --slot, --json-field, --normalize-eol, --line-comment, --force, --sum, --sum-file, --dry-run, --chmod, --preserve-time or --tsa")
+		}
+		if signCmd.NArg() == 0 {
+			exitWithCode(exitUsage, "files to sign are required")
+		}
+		signManifest(loadSigner(*keyFile, *passphraseFile, *certFile), mc, *manifestFile, signCmd.Args(), *maxFileSize)
+		return
+	}
+
+	// With -r every file under the directory argument is signed
+	if *outDir != "" && !*recursive {
+		exitWithCode(exitUsage, "--out-dir is only valid with -r")
+	}
+	if *recursive {
+		if *slotIndex >= 0 || *jsonField != "" || *normalizeEOL || *lineComment || *force || *printSum || *sumFile != "" || *tsaURL != "" {
+			exitWithCode(exitUsage, "-r cannot be combined with --slot, --json-field, --normalize-eol, --line-comment, --force, --sum, --sum-file or --tsa")
+		}
+		if signCmd.NArg() != 1 {
+			exitWithCode(exitUsage, "a directory to sign is required")
+		}
+		signRecursive(loadSigner(*keyFile, *passphraseFile, *certFile), mc, signCmd.Arg(0), *outDir, *dryRun, oa, *maxFileSize)
+		return
+	}
+
+	// A dry run writes nothing, so it has nowhere to keep a timestamp token
+	if *tsaURL != "" && *dryRun {
+		exitWithCode(exitUsage, "--tsa cannot be combined with --dry-run")
 	}
 
 	// Get input file from remaining arguments
 	if signCmd.NArg() != 1 {
-		exitWithError("input file is required")
+		exitWithCode(exitUsage, "input file is required")
 	}
 	inputFile := signCmd.Arg(0)
 
-	// Read the input file
-	inputData, err := os.ReadFile(inputFile)
+	// Read the input file, keeping its permission bits for the signed output.
+	// Room is left in front of it for the signature header so the file is
+	// signed in place rather than copied. Large files are memory-mapped.
+	if err := checkFileSize(inputFile, *maxFileSize); err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	buf, inputPerm, release, err := appconfig.LoadFileWithHeadroom(inputFile, unisign.HeaderSize)
 	if err != nil {
-		exitWithError("reading input file: %v", err)
+		exitWithCode(exitIO, "reading input file: %v", err)
 	}
+	defer release()
+	inputData := buf[unisign.HeaderSize:]
+	debugf("read %s (%d bytes)", inputFile, len(inputData))
+
+	// Truncating a mapped input makes reading it fault; report that rather than crash
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if appconfig.IsMappedFault(r) {
+				exitWithCode(exitIO, "reading input file: %v", appconfig.ErrFileTruncated)
+			}
+			panic(r)
+		}
+	}()
+
+	// The signed copy is checked against the input as it is now, before signing
+	inputSum := sha256.Sum256(inputData)
 
-	// Check that there is exactly one magic string in the file
-	offset, err := unisign.CheckExactlyOneMagicString(inputData, []byte(appconfig.MagicString))
+	// Where the format bounds the placeholder, its length picks the signature layout
+	mc, err = mc.sizedFor(inputData)
 	if err != nil {
-		exitWithError("magic string: %v", err)
+		exitWithCode(exitMagic, "%v", err)
 	}
 
-	// Read the SSH private key
-	signer, err := unisign.ReadSSHPrivateKey(*keyFile, "")
+	// Locate the slot to fill. Without --slot there must be exactly one placeholder.
+	var offset int64
+	slots, err := locateSlots(inputData, mc)
 	if err != nil {
-		exitWithError("reading private key: %v", err)
+		exitWithCode(exitMagic, "locating signature slots: %v", err)
+	}
+	if *slotIndex < 0 {
+		offset, err = unisign.CheckExactlyOneMagicString(inputData, []byte(mc.Magic))
+		if errors.Is(err, unisign.ErrMagicNotFound) && bytes.Contains(inputData, []byte(mc.Prefix)) {
+			if !*force {
+				exitWithCode(exitMagic, "%v (use --force to re-sign)", errAlreadySigned)
+			}
+			offset, err = unsignSlot(inputData, slots, mc)
+			if err != nil {
+				exitWithCode(exitMagic, "--force: %v", err)
+			}
+			fmt.Printf("Replacing the existing signature at offset %d\n", offset)
+		}
+		if err != nil {
+			exitWithCode(exitMagic, "magic string: %v", err)
+		}
+	} else {
+		if *slotIndex >= len(slots) {
+			exitWithCode(exitMagic, "slot %d does not exist (file has %d slots)", *slotIndex, len(slots))
+		}
+		if slots[*slotIndex].Filled {
+			exitWithCode(exitMagic, "slot %d is already signed", *slotIndex)
+		}
+		offset = slots[*slotIndex].Offset
+	}
+
+	debugf("magic found at offset %d; file has %d slot(s)", offset, len(slots))
+
+	// With --json-field the signature covers the canonical form of the JSON,
+	// with the field holding the placeholder, rather than the file's bytes
+	var canonical []byte
+	var canonicalOffset int64
+	if *jsonField != "" {
+		var value string
+		canonical, value, err = appconfig.CanonicalizeJSONField(inputData, *jsonField)
+		if err != nil {
+			exitWithCode(exitMagic, "%v", err)
+		}
+		if value != mc.Magic {
+			exitWithCode(exitMagic, "JSON field %q does not hold the placeholder", *jsonField)
+		}
+		canonicalOffset, err = unisign.CheckExactlyOneMagicString(canonical, []byte(mc.Magic))
+		if err != nil {
+			exitWithCode(exitMagic, "magic string in canonical JSON: %v", err)
+		}
+	}
+
+	signer := loadSigner(*keyFile, *passphraseFile, *certFile)
+
+	// With --json-field, --normalize-eol or --line-comment the signature covers
+	// a transformed copy of the file, at the slot's offset within that copy
+	// (or at lineCommentOffset, as the slot's line is left out). The file
+	// itself only gets the signature written into its placeholder.
+	//
+	// With --slot every slot is restored to the placeholder before signing,
+	// as all signers sign the same canonical buffer. Without it the file has
+	// a single signature, so only its own slot is restored. That slot holds
+	// the placeholder already, and any other prefix look-alike is signed as
+	// it stands rather than left out of what the signature covers.
+	restore := slots
+	if *slotIndex < 0 {
+		restore = nil
+	}
+	signBuf, signSlots, signOffset := buf, restore, offset
+	switch {
+	case canonical != nil:
+		signBuf = append(make([]byte, unisign.HeaderSize, unisign.HeaderSize+len(canonical)), canonical...)
+		signSlots, signOffset = nil, canonicalOffset
+		fmt.Printf("Signing canonical JSON with field %q blanked to the placeholder\n", *jsonField)
+	case *normalizeEOL:
+		var shift func(int64) int64
+		signBuf, shift = normalizeLineEndings(inputData, slots, len(mc.Magic), unisign.HeaderSize)
+		signSlots = shiftSlots(restore, shift)
+		signOffset = shift(offset)
+		fmt.Println("Signing with line endings normalized (CRLF -> LF)")
+	case *lineComment:
+		if len(slots) != 1 {
+			exitWithCode(exitMagic, "--line-comment needs a file with a single signature slot (found %d)", len(slots))
+		}
+		signBuf, err = removeCommentLine(inputData, offset, len(mc.Magic), unisign.HeaderSize)
+		if err != nil {
+			exitWithCode(exitMagic, "%v", err)
+		}
+		signSlots, signOffset = nil, lineCommentOffset
+		fmt.Println("Signing without the placeholder's comment line")
 	}
+	signData := signBuf[unisign.HeaderSize:]
 
-	// Sign the file
-	signature, err := unisign.SignBuffer(signer, inputData, uint64(offset))
+	// Sign over the file with every other signer's slot, if any, restored to the placeholder
+	saved, err := restoreSlotsInPlace(signData, signSlots, mc)
+	if err != nil {
+		exitWithError("restoring slots: %v", err)
+	}
+	signature, err := unisign.SignBufferWithHeadroom(signer, signBuf, uint64(signOffset))
 	if err != nil {
 		exitWithError("signing file: %v", err)
 	}
+	if err := refillSlots(signData, signSlots, saved, mc); err != nil {
+		exitWithError("restoring slots: %v", err)
+	}
 
 	// Base64 encode the signature and add prefix
-	encodedSig := appconfig.SignaturePrefix + base64.StdEncoding.EncodeToString(signature)
+	encodedSig := mc.encodeSignature(signature, signer.PublicKey())
+	debugf("signature computed over %d bytes at offset %d (%d bytes, %d encoded)", len(signData), signOffset, len(signature), len(encodedSig))
 
 	// Verify signature length matches magic string length
-	if len(encodedSig) != len(appconfig.MagicString) {
-		exitWithError("encoded signature length (%d) doesn't match magic string length (%d)", 
-			len(encodedSig), len(appconfig.MagicString))
+	if len(encodedSig) != len(mc.Magic) {
+		exitWithError("%v", &unisign.SignatureLengthError{Encoded: len(encodedSig), Magic: len(mc.Magic)})
 	}
+	debugf("length check passed: encoded signature fills the %d-byte placeholder", len(mc.Magic))
 
 	// Replace the magic string with the signature
-	err = unisign.ReplaceMagicAtOffset(inputData, offset, []byte(encodedSig), []byte(appconfig.MagicString))
+	err = unisign.ReplaceMagicAtOffset(inputData, offset, []byte(encodedSig), []byte(mc.Magic))
 	if err != nil {
 		exitWithError("replacing magic string: %v", err)
 	}
@@ -71,11 +313,161 @@ func signFile() {
 	// Create output filename
 	outputFile := inputFile + ".signed"
 
-	// Write the signed file
-	err = os.WriteFile(outputFile, inputData, 0644)
+	if *dryRun {
+		fmt.Printf("Dry run: signature of %d bytes fits the placeholder at offset %d; nothing written to %s\n",
+			len(encodedSig), offset, outputFile)
+		return
+	}
+
+	// The token covers the raw signature, so it attests the signature existed
+	// at that time without depending on where or how the file embeds it. It is
+	// requested first so a TSA failure leaves no signed file behind.
+	var token []byte
+	if *tsaURL != "" {
+		token, err = timestampSignature(*tsaURL, signature)
+		if err != nil {
+			exitWithError("timestamping signature: %v", err)
+		}
+	}
+
+	// Write the signed file. A regular input is copied and patched with just
+	// the signature bytes, and the copy fails if the input no longer hashes
+	// to inputSum; anything else is written out from the buffer. When a
+	// checksum is wanted it is taken over the bytes as they are written.
+	wantSum := *printSum || *sumFile != ""
+	sum := sha256.New()
+	if info, statErr := os.Stat(inputFile); statErr == nil && info.Mode().IsRegular() {
+		if wantSum {
+			err = appconfig.CopyFileWithPatchHashed(inputFile, outputFile, inputPerm, inputSum, offset, []byte(encodedSig), sum)
+		} else {
+			err = appconfig.CopyFileWithPatch(inputFile, outputFile, inputPerm, inputSum, offset, []byte(encodedSig))
+		}
+	} else {
+		err = appconfig.WriteFileMode(outputFile, inputData, inputPerm)
+		sum.Write(inputData)
+	}
+	if err == nil {
+		err = oa.apply(inputFile, outputFile)
+	}
 	if err != nil {
-		exitWithError("writing signed file: %v", err)
+		exitWithCode(exitIO, "writing signed file: %v", err)
 	}
+	debugf("wrote %s (%d bytes)", outputFile, len(inputData))
 
 	fmt.Printf("Successfully signed %s -> %s\n", inputFile, outputFile)
-} 
\ No newline at end of file
+	fmt.Printf("Signature offset: %d\n", offset)
+
+	if token != nil {
+		tokenFile := outputFile + appconfig.TimestampSuffix
+		if err := os.WriteFile(tokenFile, token, 0644); err != nil {
+			exitWithCode(exitIO, "writing timestamp token: %v", err)
+		}
+		fmt.Printf("Timestamp token written to: %s\n", tokenFile)
+	}
+
+	digest := hex.EncodeToString(sum.Sum(nil))
+	if *printSum {
+		fmt.Printf("SHA-256: %s\n", digest)
+	}
+	if *sumFile != "" {
+		if err := os.WriteFile(*sumFile, []byte(digest+"  "+outputFile+"\n"), 0644); err != nil {
+			exitWithCode(exitIO, "writing sum file: %v", err)
+		}
+	}
+}
+
+// loadSigner reads the SSH private key, decrypting it with the passphrase in
+// passphraseFile if one is given and wrapping it with the certificate in
+// certFile if one is given. It exits on failure.
+func loadSigner(keyFile, passphraseFile, certFile string) ssh.Signer {
+	// A scheme://... key is opened by the backend registered for the scheme.
+	// file:// is just a path, so it keeps --passphrase-file and --cert.
+	if scheme, ok := unisign.SignerURIScheme(keyFile); ok {
+		if scheme != "file" {
+			if passphraseFile != "" || certFile != "" {
+				exitWithCode(exitUsage, "--passphrase-file and --cert only apply to key files, not %s:// keys", scheme)
+			}
+			signer, err := unisign.OpenSigner(keyFile)
+			if err != nil {
+				exitWithCode(exitIO, "opening signer: %v", err)
+			}
+			return signer
+		}
+		_, keyFile, _ = strings.Cut(keyFile, "://")
+	}
+
+	// Read the passphrase, if any, and zero it as soon as the key is decrypted
+	var passphrase []byte
+	if passphraseFile != "" {
+		var err error
+		passphrase, err = readPassphraseFile(passphraseFile)
+		if err != nil {
+			exitWithCode(exitIO, "reading passphrase file: %v", err)
+		}
+	}
+
+	var signer ssh.Signer
+	var err error
+	if certFile != "" {
+		var cert *ssh.Certificate
+		signer, cert, err = unisign.ReadSSHCertSigner(keyFile, certFile, passphrase)
+		if err == nil {
+			fmt.Printf("Signing with certificate %s\n", describeCertificate(cert))
+		}
+	} else if keyFile == stdinPath {
+		// The key is zeroed as soon as it is parsed and never printed
+		var keyBytes []byte
+		keyBytes, err = readStdinKey()
+		if err == nil {
+			signer, err = unisign.ParseSSHPrivateKeyWithPassphrase(keyBytes, passphrase)
+		}
+		clear(keyBytes)
+	} else {
+		signer, err = unisign.ReadSSHPrivateKeyWithPassphrase(keyFile, passphrase)
+	}
+	clear(passphrase)
+	if err != nil {
+		exitWithCode(exitIO, "reading private key: %v", err)
+	}
+	return signer
+}
+
+// maxStdinKeySize bounds a private key read from standard input. OpenSSH
+// ed25519 keys are under 500 bytes, even encrypted and with a long comment.
+const maxStdinKeySize = 16 << 10
+
+// readStdinKey reads a private key from standard input into a single buffer,
+// so zeroing the returned slice leaves no other copy of the key behind as
+// the partial buffers of io.ReadAll would
+func readStdinKey() ([]byte, error) {
+	buf := make([]byte, maxStdinKeySize+1)
+	n, err := io.ReadFull(os.Stdin, buf)
+	if err == nil {
+		clear(buf)
+		return nil, fmt.Errorf("private key on stdin is larger than %d bytes", maxStdinKeySize)
+	}
+	if err != io.ErrUnexpectedEOF && err != io.EOF {
+		clear(buf)
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readPassphraseFile reads a passphrase from path, which may also be a
+// /dev/fd/N descriptor, dropping a single trailing newline.
+func readPassphraseFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(data)
+	if n > 0 && data[n-1] == '\n' {
+		n--
+		if n > 0 && data[n-1] == '\r' {
+			n--
+		}
+	}
+
+	return data[:n], nil
+}
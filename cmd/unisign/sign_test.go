@@ -1,11 +1,21 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 	appconfig "unisign/internal/unisign"
+
+	"golang.org/x/crypto/ssh"
 )
 
 func TestSign(t *testing.T) {
@@ -66,6 +76,37 @@ func TestSign(t *testing.T) {
 	}
 }
 
+func TestSignLongFlags(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// --key signs just as -k does; ed25519 signatures are deterministic
+	var signed [][]byte
+	for _, flagName := range []string{"-k", "--key"} {
+		inputPath := createTestFileWithMagic(t, t.TempDir(), "test_input")
+		cmd := exec.Command("go", "run", ".", "sign", flagName, keyPath, inputPath)
+		cmd.Dir = "."
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("sign %s failed: %v\nOutput: %s", flagName, err, output)
+		}
+		data, err := os.ReadFile(inputPath + ".signed")
+		if err != nil {
+			t.Fatalf("failed to read signed file: %v", err)
+		}
+		signed = append(signed, data)
+	}
+	if !bytes.Equal(signed[0], signed[1]) {
+		t.Error("signing with --key gave a different file than with -k")
+	}
+
+	// The error for a missing key names both forms
+	cmd := exec.Command("go", "run", ".", "sign", createTestFileWithMagic(t, tmpDir, "unsigned"))
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(output), "flag -k (--key) is required") {
+		t.Errorf("signing without a key: %v\nOutput: %s", err, output)
+	}
+}
+
 func TestSignErrors(t *testing.T) {
 	// Test cases
 	testCases := []struct {
@@ -125,4 +166,926 @@ func TestSignErrors(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestSignPreservesFileMode(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_script")
+	if err := os.Chmod(inputPath, 0700); err != nil {
+		t.Fatalf("failed to chmod input file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("unisign failed: %v\nOutput: %s", err, output)
+	}
+
+	info, err := os.Stat(inputPath + ".signed")
+	if err != nil {
+		t.Fatalf("output file not created: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0700 {
+		t.Errorf("signed file mode = %o, want %o", got, 0700)
+	}
+}
+
+func TestSignChmodAndPreserveTime(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_script")
+	if err := os.Chmod(inputPath, 0700); err != nil {
+		t.Fatalf("failed to chmod input file: %v", err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(inputPath, mtime, mtime); err != nil {
+		t.Fatalf("failed to set input mtime: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, "--chmod", "0644", "--preserve-time", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("unisign failed: %v\nOutput: %s", err, output)
+	}
+
+	info, err := os.Stat(inputPath + ".signed")
+	if err != nil {
+		t.Fatalf("output file not created: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0644 {
+		t.Errorf("signed file mode = %o, want %o", got, 0644)
+	}
+	// Compare at one-second resolution, which every filesystem keeps
+	if got := info.ModTime().Truncate(time.Second); !got.Equal(mtime) {
+		t.Errorf("signed file mtime = %v, want %v", got, mtime)
+	}
+
+	// The same flags apply to the output of inject-placeholder
+	zipPath := filepath.Join(tmpDir, "archive.zip")
+	var buf bytes.Buffer
+	zip.NewWriter(&buf).Close()
+	if err := os.WriteFile(zipPath, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write zip file: %v", err)
+	}
+	if err := os.Chtimes(zipPath, mtime, mtime); err != nil {
+		t.Fatalf("failed to set zip mtime: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "inject-placeholder", "--chmod", "640", "--preserve-time", zipPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("inject-placeholder failed: %v\nOutput: %s", err, output)
+	}
+	info, err = os.Stat(zipPath + ".placeholder")
+	if err != nil {
+		t.Fatalf("output file not created: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0640 {
+		t.Errorf("injected file mode = %o, want %o", got, 0640)
+	}
+	if got := info.ModTime().Truncate(time.Second); !got.Equal(mtime) {
+		t.Errorf("injected file mtime = %v, want %v", got, mtime)
+	}
+
+	// A mode that is not octal permission bits is a usage error
+	for _, mode := range []string{"rw-r--r--", "0999", "01777"} {
+		cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--chmod", mode, inputPath)
+		cmd.Dir = "."
+		if output, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(output), "--chmod") {
+			t.Errorf("--chmod %s: expected a usage error, got %v\nOutput: %s", mode, err, output)
+		}
+	}
+}
+
+func TestSignMultipleSlots(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	firstKey := generateTestKey(t, tmpDir, "first_key")
+	secondKey := generateTestKey(t, tmpDir, "second_key")
+
+	inputPath := filepath.Join(tmpDir, "release")
+	content := []byte("a " + appconfig.MagicString + " b " + appconfig.MagicString + " c")
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", "run", ".")
+		cmd.Args = append(cmd.Args, args...)
+		cmd.Dir = "."
+		return cmd.CombinedOutput()
+	}
+
+	// Without --slot, two placeholders are ambiguous
+	if output, err := run("sign", "-k", firstKey, inputPath); err == nil {
+		t.Fatalf("sign without --slot should fail on multiple placeholders\nOutput: %s", output)
+	}
+
+	// The second signer fills its slot first to show order doesn't matter
+	if output, err := run("sign", "-k", secondKey, "--slot", "1", inputPath); err != nil {
+		t.Fatalf("signing slot 1 failed: %v\nOutput: %s", err, output)
+	}
+	partialPath := inputPath + ".signed"
+	if output, err := run("sign", "-k", firstKey, "--slot", "1", partialPath); err == nil {
+		t.Fatalf("re-signing a filled slot should fail\nOutput: %s", output)
+	}
+	if output, err := run("sign", "-k", firstKey, "--slot", "0", partialPath); err != nil {
+		t.Fatalf("signing slot 0 failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := partialPath + ".signed"
+
+	output, err := run("verify", "-k", firstKey+".pub", "-k", secondKey+".pub", signedPath)
+	if err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Slot 0")) || !bytes.Contains(output, []byte("Slot 1")) {
+		t.Errorf("verify output does not report per-slot results: %s", output)
+	}
+
+	// With --require-all, missing one signer's key must fail
+	if output, err := run("verify", "--require-all", "-k", firstKey+".pub", signedPath); err == nil {
+		t.Errorf("verification with an incomplete key set should fail\nOutput: %s", output)
+	}
+	if output, err := run("verify", "--require-all", "-k", firstKey+".pub", "-k", secondKey+".pub", signedPath); err != nil {
+		t.Errorf("verification with the full key set failed: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestSignCoversSignatureLookAlikes(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// Documentation quoting a signature looks like a filled slot
+	lookAlike := func(b byte) string {
+		return appconfig.SignaturePrefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 64))
+	}
+	inputPath := filepath.Join(tmpDir, "release")
+	content := []byte("example: " + lookAlike(1) + "\nsignature: " + appconfig.MagicString + "\n")
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", "run", ".")
+		cmd.Args = append(cmd.Args, args...)
+		cmd.Dir = "."
+		return cmd.CombinedOutput()
+	}
+	if output, err := run("sign", "-k", keyPath, inputPath); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+	if output, err := run("verify", "-k", keyPath+".pub", signedPath); err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+
+	// The look-alike was signed as it stands, so it can't be swapped for another
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	tamperedPath := filepath.Join(tmpDir, "tampered")
+	tampered := bytes.Replace(signed, []byte(lookAlike(1)), []byte(lookAlike(2)), 1)
+	if err := os.WriteFile(tamperedPath, tampered, 0644); err != nil {
+		t.Fatalf("failed to write tampered file: %v", err)
+	}
+	if output, err := run("verify", "-k", keyPath+".pub", tamperedPath); err == nil {
+		t.Errorf("verification should fail once the look-alike changed\nOutput: %s", output)
+	}
+}
+
+func TestSignWithPassphraseFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := filepath.Join(tmpDir, "encrypted_key")
+	keygen := exec.Command("ssh-keygen", "-t", "ed25519", "-f", keyPath, "-N", "s3cret pass", "-C", "test@example.com")
+	if err := keygen.Run(); err != nil {
+		t.Fatalf("failed to generate encrypted key: %v", err)
+	}
+
+	// CI systems typically mount the passphrase with a trailing newline
+	passPath := filepath.Join(tmpDir, "passphrase")
+	if err := os.WriteFile(passPath, []byte("s3cret pass\n"), 0600); err != nil {
+		t.Fatalf("failed to write passphrase file: %v", err)
+	}
+
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, "--passphrase-file", passPath, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing with passphrase file failed: %v\nOutput: %s", err, output)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", inputPath+".signed")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+
+	// Without the passphrase the encrypted key can't be read
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("signing an encrypted key without a passphrase should fail\nOutput: %s", output)
+	}
+}
+
+func TestSignCustomMagic(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// A custom placeholder with its own prefix, sized for an ed25519 signature
+	prefix := "acme-"
+	magic := prefix + strings.Repeat("Z", 88)
+	inputPath := filepath.Join(tmpDir, "custom")
+	if err := os.WriteFile(inputPath, []byte("head "+magic+" tail"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", "run", ".")
+		cmd.Args = append(cmd.Args, args...)
+		cmd.Dir = "."
+		return cmd.CombinedOutput()
+	}
+
+	if output, err := run("sign", "-k", keyPath, "--magic", magic, "--prefix", prefix, inputPath); err != nil {
+		t.Fatalf("signing with custom magic failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+	if output, err := run("verify", "-k", keyPath+".pub", "--magic", magic, "--prefix", prefix, signedPath); err != nil {
+		t.Fatalf("verification with custom magic failed: %v\nOutput: %s", err, output)
+	}
+
+	// The built-in magic doesn't occur in the file
+	if output, err := run("sign", "-k", keyPath, inputPath); err == nil {
+		t.Errorf("signing without --magic should fail\nOutput: %s", output)
+	}
+
+	// Inconsistent prefix and magic are rejected up front
+	if output, err := run("sign", "-k", keyPath, "--magic", magic, "--prefix", "other-", inputPath); err == nil {
+		t.Errorf("prefix that doesn't start the magic should be rejected\nOutput: %s", output)
+	}
+	if output, err := run("sign", "-k", keyPath, "--magic", magic+"Z", "--prefix", prefix, inputPath); err == nil {
+		t.Errorf("magic of the wrong length should be rejected\nOutput: %s", output)
+	}
+}
+
+func TestBlankMagicRejected(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	for _, tc := range []struct {
+		name    string
+		args    []string
+		message string
+	}{
+		{"sign empty magic", []string{"sign", "-k", keyPath, "--magic", "", inputPath}, "magic string (--magic) must not be empty"},
+		{"sign whitespace magic", []string{"sign", "-k", keyPath, "--magic", "   ", inputPath}, "magic string (--magic) must not be empty"},
+		{"sign empty prefix", []string{"sign", "-k", keyPath, "--prefix", "", inputPath}, "signature prefix (--prefix) must not be empty"},
+		{"verify empty magic", []string{"verify", "-k", keyPath + ".pub", "--magic", "", inputPath}, "magic string (--magic) must not be empty"},
+		{"inject empty magic", []string{"inject-placeholder", "--magic", "", inputPath}, "magic string (--magic) must not be empty"},
+		{"doctor whitespace prefix", []string{"doctor", "--prefix", "\t", inputPath}, "signature prefix (--prefix) must not be empty"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command("go", append([]string{"run", "."}, tc.args...)...)
+			cmd.Dir = "."
+			output, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatalf("command should fail\nOutput: %s", output)
+			}
+			if !bytes.Contains(output, []byte(tc.message)) {
+				t.Errorf("output does not explain the blank value: %s", output)
+			}
+			if !bytes.Contains(output, []byte("exit status 2")) {
+				t.Errorf("want usage exit code 2: %s", output)
+			}
+		})
+	}
+}
+
+func TestSignLargeFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping large file test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// Larger than the size from which sign memory-maps its input
+	inputPath := filepath.Join(tmpDir, "large")
+	f, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	chunk := bytes.Repeat([]byte{0x5A}, 1<<20)
+	for i := 0; i < 100; i++ {
+		if i == 50 {
+			f.WriteString(appconfig.MagicString)
+		}
+		if _, err := f.Write(chunk); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+	f.Close()
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", inputPath+".signed")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestSignAndVerifyWithCertificate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	caPath := generateTestKey(t, tmpDir, "ca")
+	cmd := exec.Command("ssh-keygen", "-s", caPath, "-I", "release-signer", "-n", "alice", "-V", "+1h", keyPath+".pub")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to sign certificate: %v\n%s", err, output)
+	}
+	certPath := keyPath + "-cert.pub"
+
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, "--cert", certPath, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing with certificate failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte(`key ID "release-signer"`)) || !bytes.Contains(output, []byte("principals alice")) {
+		t.Errorf("sign output does not record the certificate: %s", output)
+	}
+
+	// The certificate can stand in for the public key
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", certPath, inputPath+".signed")
+	cmd.Dir = "."
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification with certificate failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("signed under certificate")) {
+		t.Errorf("verify output does not mention the certificate: %s", output)
+	}
+
+	// A certificate for another key is rejected at sign time
+	otherKey := generateTestKey(t, tmpDir, "other_key")
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", otherKey, "--cert", certPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("signing with a mismatched certificate should fail\nOutput: %s", output)
+	}
+}
+
+func TestSignDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "--dry-run", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("dry-run signing failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Dry run")) || !bytes.Contains(output, []byte("offset 10")) {
+		t.Errorf("dry-run output does not describe the planned signature: %s", output)
+	}
+	if _, err := os.Stat(inputPath + ".signed"); !os.IsNotExist(err) {
+		t.Errorf("--dry-run created the signed file")
+	}
+
+	// Errors still surface, e.g. a missing placeholder
+	plainPath := filepath.Join(tmpDir, "plain")
+	if err := os.WriteFile(plainPath, []byte("no placeholder"), 0644); err != nil {
+		t.Fatalf("failed to write plain file: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "--dry-run", "-k", keyPath, plainPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("dry-run signing without a placeholder should fail\nOutput: %s", output)
+	}
+}
+
+func TestSignNormalizeEOL(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	pubKeyPath := keyPath + ".pub"
+
+	// A text file with LF line endings; the placeholder sits after several lines
+	inputPath := filepath.Join(tmpDir, "notes.txt")
+	content := "line one\nline two\nsignature: " + appconfig.MagicString + "\nline three\n"
+	if err := os.WriteFile(inputPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "--normalize-eol", "-k", keyPath, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("line endings normalized")) {
+		t.Errorf("sign output should flag the normalization: %s", output)
+	}
+	signedPath := inputPath + ".signed"
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	if bytes.Contains(signed, []byte("\r\n")) {
+		t.Error("sign must not rewrite the file's line endings")
+	}
+
+	// The LF file verifies as signed when the flag is given on both sides
+	cmd = exec.Command("go", "run", ".", "verify", "--normalize-eol", "-k", pubKeyPath, signedPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("verification of LF file failed: %v\nOutput: %s", err, output)
+	}
+
+	// Simulate a Windows checkout converting the file to CRLF
+	crlfPath := filepath.Join(tmpDir, "notes-crlf.txt")
+	crlf := bytes.ReplaceAll(signed, []byte("\n"), []byte("\r\n"))
+	if err := os.WriteFile(crlfPath, crlf, 0644); err != nil {
+		t.Fatalf("failed to write CRLF file: %v", err)
+	}
+
+	cmd = exec.Command("go", "run", ".", "verify", "--normalize-eol", "-k", pubKeyPath, crlfPath)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification of CRLF file failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Signature verified successfully")) {
+		t.Errorf("verification output did not indicate success: %s", output)
+	}
+
+	// Without the flag the converted file no longer matches
+	cmd = exec.Command("go", "run", ".", "verify", "-k", pubKeyPath, crlfPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("verification of CRLF file without --normalize-eol should have failed\nOutput: %s", output)
+	}
+
+	// Signing without the flag is not verifiable with it, and vice versa
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	crlfInput := filepath.Join(tmpDir, "crlf-input.txt")
+	if err := os.WriteFile(crlfInput, []byte(strings.ReplaceAll(content, "\n", "\r\n")), 0644); err != nil {
+		t.Fatalf("failed to write CRLF input: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, crlfInput)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing CRLF input failed: %v\nOutput: %s", err, output)
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "--normalize-eol", "-k", pubKeyPath, crlfInput+".signed")
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("a file signed without --normalize-eol should not verify with it\nOutput: %s", output)
+	}
+}
+
+func TestSignLineComment(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	pubKeyPath := keyPath + ".pub"
+
+	inputPath := filepath.Join(tmpDir, "deploy.sh")
+	content := "#!/bin/sh\n# " + appconfig.MagicString + "\necho deploying\n"
+	if err := os.WriteFile(inputPath, []byte(content), 0755); err != nil {
+		t.Fatalf("failed to write test script: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "--line-comment", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signed, err := os.ReadFile(inputPath + ".signed")
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	lines := strings.SplitAfter(string(signed), "\n")
+	sigLine := lines[1]
+
+	verify := func(name, script string, flags ...string) error {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		args := append(append([]string{"run", ".", "verify"}, flags...), "-k", pubKeyPath, path)
+		output, err := exec.Command("go", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v\nOutput: %s", err, output)
+		}
+		return nil
+	}
+
+	if err := verify("signed.sh", string(signed), "--line-comment"); err != nil {
+		t.Errorf("signed script does not verify: %v", err)
+	}
+
+	// The signature line can move and be reindented without breaking the signature
+	moved := lines[0] + lines[2] + "    #   " + strings.TrimPrefix(sigLine, "# ")
+	if err := verify("moved.sh", moved, "--line-comment"); err != nil {
+		t.Errorf("script with the signature line moved does not verify: %v", err)
+	}
+
+	// Any other change is still caught, including code added to the signature line
+	for name, script := range map[string]string{
+		"edited.sh":   lines[0] + sigLine + "echo pwned\n",
+		"smuggled.sh": lines[0] + "echo pwned " + sigLine + lines[2],
+	} {
+		if err := verify(name, script, "--line-comment"); err == nil {
+			t.Errorf("%s verified despite the change", name)
+		}
+	}
+
+	// The flag must be given to both sign and verify
+	if err := verify("noflag.sh", string(signed)); err == nil {
+		t.Error("a script signed with --line-comment verified without it")
+	}
+
+	// A placeholder sharing its line with code is refused at signing time
+	codePath := filepath.Join(tmpDir, "code.sh")
+	if err := os.WriteFile(codePath, []byte("echo hi # "+appconfig.MagicString+"\n"), 0755); err != nil {
+		t.Fatalf("failed to write test script: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "sign", "--line-comment", "-k", keyPath, codePath)
+	if output, err := cmd.CombinedOutput(); err == nil || !bytes.Contains(output, []byte("must be a # comment")) {
+		t.Errorf("signing a placeholder that shares a line with code should fail: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestSignJSONField(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	pubKeyPath := keyPath + ".pub"
+
+	inputPath := filepath.Join(tmpDir, "config.json")
+	content := `{"name": "app", "version": 2, "signature": "` + appconfig.MagicString + `", "limits": {"b": 1, "a": [1, 2.50]}}`
+	if err := os.WriteFile(inputPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "--json-field", "signature", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	start := strings.Index(string(signed), appconfig.SignaturePrefix)
+	if start == -1 {
+		t.Fatalf("signed file has no signature: %s", signed)
+	}
+	signature := string(signed[start : start+len(appconfig.MagicString)])
+
+	// Another tool re-serializes the file with different key order and whitespace
+	reformattedPath := filepath.Join(tmpDir, "reformatted.json")
+	reformatted := "{\n  \"limits\": {\n    \"a\": [1, 2.50],\n    \"b\": 1\n  },\n  \"name\": \"app\",\n  \"signature\": \"" +
+		signature + "\",\n  \"version\": 2\n}\n"
+	if err := os.WriteFile(reformattedPath, []byte(reformatted), 0644); err != nil {
+		t.Fatalf("failed to write reformatted file: %v", err)
+	}
+
+	for _, path := range []string{signedPath, reformattedPath} {
+		cmd = exec.Command("go", "run", ".", "verify", "--json-field", "signature", "-k", pubKeyPath, path)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("verification of %s failed: %v\nOutput: %s", filepath.Base(path), err, output)
+		}
+		if !bytes.Contains(output, []byte("Signature verified successfully")) {
+			t.Errorf("verification output did not indicate success: %s", output)
+		}
+	}
+
+	// Byte-level verification doesn't survive the reformatting
+	cmd = exec.Command("go", "run", ".", "verify", "-k", pubKeyPath, reformattedPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("verification of reformatted file without --json-field should have failed\nOutput: %s", output)
+	}
+
+	// A changed value is still caught
+	tamperedPath := filepath.Join(tmpDir, "tampered.json")
+	tampered := strings.Replace(reformatted, `"version": 2`, `"version": 3`, 1)
+	if err := os.WriteFile(tamperedPath, []byte(tampered), 0644); err != nil {
+		t.Fatalf("failed to write tampered file: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "--json-field", "signature", "-k", pubKeyPath, tamperedPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("verification of tampered file should have failed\nOutput: %s", output)
+	}
+
+	// The placeholder has to be in the named field
+	cmd = exec.Command("go", "run", ".", "sign", "--json-field", "name", "-k", keyPath, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("signing with the wrong field should have failed\nOutput: %s", output)
+	}
+	if !bytes.Contains(output, []byte("does not hold the placeholder")) {
+		t.Errorf("expected a wrong field error, got: %s", output)
+	}
+}
+
+func TestSignAlreadySigned(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	// Signing the signed output again finds the signature instead of the placeholder
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath+".signed")
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("signing an already-signed file should have failed\nOutput: %s", output)
+	}
+	if !bytes.Contains(output, []byte("file appears to already be signed")) {
+		t.Errorf("expected an already-signed error, got: %s", output)
+	}
+}
+
+func TestSignForceResign(t *testing.T) {
+	tmpDir := t.TempDir()
+	firstKeyPath := generateTestKey(t, tmpDir, "first_key")
+	secondKeyPath := generateTestKey(t, tmpDir, "second_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", firstKeyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	// Re-sign the signed file with a different key
+	cmd = exec.Command("go", "run", ".", "sign", "--force", "-k", secondKeyPath, signedPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("re-signing failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Replacing the existing signature at offset 10")) {
+		t.Errorf("re-sign output should report the replaced signature: %s", output)
+	}
+	resignedPath := signedPath + ".signed"
+
+	cmd = exec.Command("go", "run", ".", "verify", "-k", secondKeyPath+".pub", resignedPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("verification with the second key failed: %v\nOutput: %s", err, output)
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "-k", firstKeyPath+".pub", resignedPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("verification with the first key should fail after re-signing\nOutput: %s", output)
+	}
+
+	// A prefix that isn't followed by a full signature is left alone
+	strayPath := filepath.Join(tmpDir, "stray")
+	if err := os.WriteFile(strayPath, []byte("docs mention "+appconfig.SignaturePrefix+"abc"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "sign", "--force", "-k", firstKeyPath, strayPath)
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("re-signing a file without a complete signature should have failed\nOutput: %s", output)
+	}
+	if !bytes.Contains(output, []byte("not followed by a complete signature")) {
+		t.Errorf("expected an incomplete signature error, got: %s", output)
+	}
+}
+
+func TestSignSum(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+	sumPath := filepath.Join(tmpDir, "test_input.sha256")
+
+	cmd := exec.Command("go", "run", ".", "sign", "--sum", "--sum-file", sumPath, "-k", keyPath, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	signedPath := inputPath + ".signed"
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	digest := sha256.Sum256(signed)
+	want := hex.EncodeToString(digest[:])
+
+	if !bytes.Contains(output, []byte("SHA-256: "+want+"\n")) {
+		t.Errorf("sign output does not report the output's SHA-256 %s: %s", want, output)
+	}
+	sumData, err := os.ReadFile(sumPath)
+	if err != nil {
+		t.Fatalf("failed to read sum file: %v", err)
+	}
+	if string(sumData) != want+"  "+signedPath+"\n" {
+		t.Errorf("sum file = %q, want %q", sumData, want+"  "+signedPath+"\n")
+	}
+
+	// Without the flags no hash is printed
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil || bytes.Contains(output, []byte("SHA-256")) {
+		t.Errorf("sign without --sum: err %v, output: %s", err, output)
+	}
+}
+
+func TestSignKeyFromStdin(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "input.txt")
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", "-", inputPath)
+	cmd.Dir = "."
+	cmd.Stdin = bytes.NewReader(keyData)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing with the key on stdin failed: %v\nOutput: %s", err, output)
+	}
+	if bytes.Contains(output, bytes.TrimSpace(keyData)[40:80]) {
+		t.Errorf("sign output contains the private key: %s", output)
+	}
+
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", inputPath+".signed")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("verification failed: %v\nOutput: %s", err, output)
+	}
+
+	failures := []struct {
+		name  string
+		args  []string
+		stdin []byte
+	}{
+		{"input also from stdin", []string{"-k", "-", "-"}, keyData},
+		{"passphrase also from stdin", []string{"-k", "-", "--passphrase-file", "-", inputPath}, keyData},
+		{"not a key", []string{"-k", "-", inputPath}, []byte("not a key\n")},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command("go", append([]string{"run", ".", "sign", "--force"}, tc.args...)...)
+			cmd.Dir = "."
+			cmd.Stdin = bytes.NewReader(tc.stdin)
+			output, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Errorf("signing should have failed\nOutput: %s", output)
+			}
+			if bytes.Contains(output, bytes.TrimSpace(keyData)[40:80]) {
+				t.Errorf("error output contains the private key: %s", output)
+			}
+		})
+	}
+}
+
+func TestSignWithSignerURI(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	socket := startTestAgent(t, tmpDir, keyPath)
+	pubKeyData, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubKeyData)
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+
+	sign := func(key, name string, extra ...string) ([]byte, []byte, error) {
+		inputPath := createTestFileWithMagic(t, tmpDir, name)
+		cmd := exec.Command("go", append(append([]string{"run", ".", "sign", "-k", key}, extra...), inputPath)...)
+		cmd.Dir = "."
+		cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+socket)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, output, err
+		}
+		signed, err := os.ReadFile(inputPath + ".signed")
+		return signed, output, err
+	}
+
+	// A key file, the same file as a file:// URI and the same key in the agent
+	// all give the same signed file, ed25519 signatures being deterministic
+	want, output, err := sign(keyPath, "plain.txt")
+	if err != nil {
+		t.Fatalf("signing with a key file failed: %v\nOutput: %s", err, output)
+	}
+	for _, key := range []string{"file://" + keyPath, "agent://" + ssh.FingerprintSHA256(pubKey), "agent://"} {
+		got, output, err := sign(key, "uri.txt")
+		if err != nil {
+			t.Errorf("signing with -k %s failed: %v\nOutput: %s", key, err, output)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("signing with -k %s gave a different signed file", key)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		key    string
+		extra  []string
+		errMsg string
+	}{
+		{"unknown scheme", "pkcs11://token/key", nil, "unknown signer scheme"},
+		{"agent without the key", "agent://SHA256:not-loaded", nil, "key not found in SSH agent"},
+		{"passphrase with agent", "agent://", []string{"--passphrase-file", keyPath}, "only apply to key files"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, output, err := sign(tc.key, "fail.txt", tc.extra...)
+			if err == nil || !bytes.Contains(output, []byte(tc.errMsg)) {
+				t.Errorf("expected %q, got %v\nOutput: %s", tc.errMsg, err, output)
+			}
+		})
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "input.txt")
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		t.Fatalf("failed to stat input file: %v", err)
+	}
+	size := info.Size()
+
+	// One byte under the file's size is refused before anything is read
+	tooSmall := fmt.Sprint(size - 1)
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, "--max-file-size", tooSmall, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "exceeds --max-file-size") {
+		t.Errorf("sign of a file over the limit: err %v, output: %s", err, output)
+	}
+	if _, err := os.Stat(inputPath + ".signed"); !os.IsNotExist(err) {
+		t.Errorf("sign wrote an output for a file over the limit")
+	}
+
+	// A limit of exactly the file's size is fine
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--max-file-size", fmt.Sprint(size), inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("sign at the limit failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", "--max-file-size", tooSmall, signedPath)
+	output, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "exceeds --max-file-size") {
+		t.Errorf("verify of a file over the limit: err %v, output: %s", err, output)
+	}
+
+	// Standard input has no size to check up front, so it is cut off at the limit
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", "--max-file-size", tooSmall, "-")
+	cmd.Stdin = bytes.NewReader(signed)
+	output, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "exceeds --max-file-size") {
+		t.Errorf("verify of stdin over the limit: err %v, output: %s", err, output)
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", "--max-file-size", fmt.Sprint(size), "-")
+	cmd.Stdin = bytes.NewReader(signed)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("verify of stdin at the limit failed: %v\nOutput: %s", err, output)
+	}
+
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", "--max-file-size", "-1", signedPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("negative --max-file-size was accepted\nOutput: %s", output)
+	}
+}
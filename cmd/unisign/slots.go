@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/placeholder"
+	"unisign/pkg/unisign"
+)
+
+// errSignatureTruncated is reported when a signature prefix sits too close
+// to the end of the file to be followed by a complete signature
+var errSignatureTruncated = errors.New("signature truncated or prefix matched near EOF")
+
+// errAlreadySigned is reported by sign when a file has no placeholder left
+// but does contain the signature prefix, as after an earlier sign
+var errAlreadySigned = errors.New("file appears to already be signed (found signature prefix, no placeholder)")
+
+// errInvalidSignatureRegion is reported when a located slot does not span a
+// whole signature starting with the prefix, or restoring the slots did not
+// leave the placeholder in each of them, as when slots overlap
+var errInvalidSignatureRegion = errors.New("located bytes are not a valid signature region")
+
+// maxSignatureCandidates caps how many filled slots verify will try, so a
+// file stuffed with look-alike signatures cannot make it run unboundedly
+const maxSignatureCandidates = 64
+
+// slot is a signature location in a file: either a still-unfilled
+// placeholder or a signature written by an earlier signer.
+type slot struct {
+	Offset    int64
+	Filled    bool
+	Signature []byte // decoded signature, nil if the slot is unfilled
+	KeyID     []byte // key ID tag in front of the signature with --key-id
+}
+
+// findSlots returns every signature slot in data, in file order.
+// A slot is any signature prefix followed by a base64-encoded ed25519
+// signature; slots holding the exact magic string are unfilled.
+func findSlots(data []byte, mc *magicConfig) []slot {
+	var slots []slot
+	prefix := []byte(mc.Prefix)
+	magic := []byte(mc.Magic)
+	sigLen := int64(len(magic))
+
+	for pos := int64(0); pos+sigLen <= int64(len(data)); {
+		index := bytes.Index(data[pos:], prefix)
+		if index == -1 {
+			break
+		}
+		start := pos + int64(index)
+		if start+sigLen > int64(len(data)) {
+			break
+		}
+
+		candidate := data[start : start+sigLen]
+		if bytes.Equal(candidate, magic) {
+			slots = append(slots, slot{Offset: start})
+			pos = start + sigLen
+			continue
+		}
+
+		keyID, decoded, ok := mc.decodeEncoded(string(candidate[len(prefix):]))
+		if !ok {
+			pos = start + 1
+			continue
+		}
+		slots = append(slots, slot{Offset: start, Filled: true, Signature: decoded, KeyID: keyID})
+		pos = start + sigLen
+	}
+
+	return slots
+}
+
+// slotAt returns the slot at a caller-supplied offset without scanning.
+// The bytes at offset must start with the signature prefix.
+func slotAt(data []byte, offset int64, mc *magicConfig) (slot, error) {
+	sigLen := int64(len(mc.Magic))
+	if offset < 0 || offset >= int64(len(data)) {
+		return slot{}, fmt.Errorf("offset %d is outside the file (size %d)", offset, len(data))
+	}
+	if !bytes.HasPrefix(data[offset:], []byte(mc.Prefix)) {
+		return slot{}, fmt.Errorf("no signature prefix %q at offset %d", mc.Prefix, offset)
+	}
+	if offset+sigLen > int64(len(data)) {
+		return slot{}, errSignatureTruncated
+	}
+
+	candidate := data[offset : offset+sigLen]
+	if bytes.Equal(candidate, []byte(mc.Magic)) {
+		return slot{Offset: offset}, nil
+	}
+	keyID, decoded, ok := mc.decodeEncoded(string(candidate[len(mc.Prefix):]))
+	if !ok {
+		return slot{}, fmt.Errorf("bytes at offset %d are not a valid signature", offset)
+	}
+	return slot{Offset: offset, Filled: true, Signature: decoded, KeyID: keyID}, nil
+}
+
+// decodeSignature decodes a signature given in its embedded form (prefix
+// followed by base64), as passed to verify --signature, returning it with its
+// key ID if it has one
+func decodeSignature(encoded string, mc *magicConfig) ([]byte, []byte, error) {
+	if !strings.HasPrefix(encoded, mc.Prefix) {
+		return nil, nil, fmt.Errorf("signature does not start with prefix %q", mc.Prefix)
+	}
+	if len(encoded) != len(mc.Magic) {
+		return nil, nil, fmt.Errorf("signature is %d characters, want %d", len(encoded), len(mc.Magic))
+	}
+	keyID, decoded, ok := mc.decodeEncoded(encoded[len(mc.Prefix):])
+	if !ok {
+		return nil, nil, fmt.Errorf("signature is not a base64-encoded %d-byte signature", mc.signatureSize())
+	}
+	return decoded, keyID, nil
+}
+
+// hasTruncatedSlot reports whether the last signature prefix in data starts
+// less than one full signature length before the end of the file
+func hasTruncatedSlot(data []byte, mc *magicConfig) bool {
+	index := bytes.LastIndex(data, []byte(mc.Prefix))
+	return index != -1 && index+len(mc.Magic) > len(data)
+}
+
+// locateSlots returns the signature slots of data, using the file's structure
+// where the format defines where the signature lives. For ZIP archives only the
+// EOCD comment is considered, so look-alike bytes inside compressed entries are
+// never mistaken for a signature. For PDFs only the placeholder objects
+// inject-placeholder adds are, if any are found through the xref, and for ELF
+// files only the descriptors of its notes, if it added any.
+func locateSlots(data []byte, mc *magicConfig) ([]slot, error) {
+	format := appconfig.DetectFormat(data)
+	if format == appconfig.FormatPDF {
+		return locatePDFSlots(data, mc)
+	}
+	if format == appconfig.FormatELF {
+		return locateELFSlots(data, mc)
+	}
+	if format != appconfig.FormatZip {
+		return findSlots(data, mc), nil
+	}
+
+	commentOffset, commentLen, err := appconfig.LocateZipComment(data)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := findSlots(data[commentOffset:commentOffset+int64(commentLen)], mc)
+	if len(slots) != 1 {
+		return nil, fmt.Errorf("ZIP comment must contain exactly one signature slot (found %d)", len(slots))
+	}
+	slots[0].Offset += commentOffset
+
+	return slots, nil
+}
+
+// locatePDFSlots returns the slots in the placeholder objects of a PDF.
+// Prefix bytes in content streams are thus ignored, so they are neither
+// candidates nor restored to the placeholder, which would leave them out of
+// what is signed. A PDF with no such object, or whose xref can't be read, is
+// scanned instead.
+func locatePDFSlots(data []byte, mc *magicConfig) ([]slot, error) {
+	offsets, err := appconfig.PDFPlaceholderOffsets(data, mc.Prefix)
+	if err != nil || len(offsets) == 0 {
+		return findSlots(data, mc), nil
+	}
+
+	slots := make([]slot, 0, len(offsets))
+	for _, offset := range offsets {
+		s, err := slotAt(data, offset, mc)
+		if err != nil {
+			return nil, fmt.Errorf("PDF placeholder object: %w", err)
+		}
+		slots = append(slots, s)
+	}
+	return slots, nil
+}
+
+// locateELFSlots returns the slots in the descriptors of the "unisign" notes
+// of an ELF file, reached through its SHT_NOTE sections and PT_NOTE segments.
+// Each descriptor must be exactly one signature long. An ELF file with no such
+// note, such as one whose placeholder was injected into a plain section or
+// embedded by its build, or one whose headers can't be read, is scanned instead.
+func locateELFSlots(data []byte, mc *magicConfig) ([]slot, error) {
+	descs, err := appconfig.ELFNoteDescriptors(data)
+	if err != nil || len(descs) == 0 {
+		return findSlots(data, mc), nil
+	}
+
+	slots := make([]slot, 0, len(descs))
+	for _, desc := range descs {
+		if desc.Size != int64(len(mc.Magic)) {
+			return nil, fmt.Errorf("%w: ELF note descriptor at offset %d is %d bytes, want %d",
+				errInvalidSignatureRegion, desc.Offset, desc.Size, len(mc.Magic))
+		}
+		s, err := slotAt(data, desc.Offset, mc)
+		if err != nil {
+			return nil, fmt.Errorf("ELF note: %w", err)
+		}
+		slots = append(slots, s)
+	}
+	return slots, nil
+}
+
+// structuralPlaceholderLen returns the length of the placeholder, or of the
+// signature that replaced it, where data's format says it lives: from the
+// last prefix in a ZIP comment to the comment's end, the string of a PDF
+// placeholder object, or an ELF file's unisign note descriptor or its
+// .note.unisign section. ok is false when the format locates none, or when
+// several placeholders disagree on length.
+func structuralPlaceholderLen(data []byte, prefix string) (int, bool) {
+	var lengths []int
+	switch appconfig.DetectFormat(data) {
+	case appconfig.FormatZip:
+		commentOffset, commentLen, err := appconfig.LocateZipComment(data)
+		if err != nil {
+			return 0, false
+		}
+		index := bytes.LastIndex(data[commentOffset:commentOffset+int64(commentLen)], []byte(prefix))
+		if index == -1 {
+			return 0, false
+		}
+		lengths = append(lengths, commentLen-index)
+	case appconfig.FormatPDF:
+		strs, err := appconfig.PDFPlaceholderStrings(data, prefix)
+		if err != nil {
+			return 0, false
+		}
+		for _, str := range strs {
+			lengths = append(lengths, str.Len)
+		}
+	case appconfig.FormatELF:
+		descs, err := appconfig.ELFNoteDescriptors(data)
+		if err != nil {
+			return 0, false
+		}
+		for _, desc := range descs {
+			lengths = append(lengths, int(desc.Size))
+		}
+		if _, size, ok := appconfig.ELFPlaceholderSection(data); ok && len(descs) == 0 {
+			lengths = append(lengths, int(size))
+		}
+	}
+
+	if len(lengths) == 0 {
+		return 0, false
+	}
+	for _, n := range lengths[1:] {
+		if n != lengths[0] {
+			return 0, false
+		}
+	}
+	return lengths[0], true
+}
+
+// restoreSlots returns a copy of data with every filled slot swapped back
+// to the magic string. This is the canonical buffer every slot is signed
+// over, so signers can fill their slots in any order.
+func restoreSlots(data []byte, slots []slot, mc *magicConfig) ([]byte, error) {
+	restored := make([]byte, len(data))
+	copy(restored, data)
+
+	if _, err := restoreSlotsInPlace(restored, slots, mc); err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// restoreSlotsInPlace is like restoreSlots but modifies data itself. It
+// returns the bytes each filled slot held so refillSlots can put them back.
+func restoreSlotsInPlace(data []byte, slots []slot, mc *magicConfig) ([][]byte, error) {
+	magic := []byte(mc.Magic)
+	saved := make([][]byte, len(slots))
+	for i, s := range slots {
+		if !s.Filled {
+			continue
+		}
+		if s.Offset < 0 || s.Offset+int64(len(magic)) > int64(len(data)) {
+			return nil, fmt.Errorf("%w: slot at offset %d does not fit %d signature bytes in the %d-byte file", errInvalidSignatureRegion, s.Offset, len(magic), len(data))
+		}
+		if !bytes.HasPrefix(data[s.Offset:], []byte(mc.Prefix)) {
+			return nil, fmt.Errorf("%w: slot at offset %d does not start with prefix %q", errInvalidSignatureRegion, s.Offset, mc.Prefix)
+		}
+		saved[i] = append([]byte(nil), data[s.Offset:s.Offset+int64(len(magic))]...)
+		if err := unisign.ReplaceMagicAtOffset(data, s.Offset, magic, saved[i]); err != nil {
+			return nil, fmt.Errorf("restoring slot at offset %d: %w", s.Offset, err)
+		}
+	}
+
+	// Each restore must have re-created the placeholder exactly, which a
+	// later, overlapping slot would have undone
+	for _, s := range slots {
+		if s.Filled && !bytes.Equal(data[s.Offset:s.Offset+int64(len(magic))], magic) {
+			return nil, fmt.Errorf("%w: slot at offset %d overlaps another slot", errInvalidSignatureRegion, s.Offset)
+		}
+	}
+
+	return saved, nil
+}
+
+// refillSlots undoes restoreSlotsInPlace, writing each filled slot's saved bytes back
+func refillSlots(data []byte, slots []slot, saved [][]byte, mc *magicConfig) error {
+	magic := []byte(mc.Magic)
+	for i, s := range slots {
+		if !s.Filled {
+			continue
+		}
+		if err := unisign.ReplaceMagicAtOffset(data, s.Offset, saved[i], magic); err != nil {
+			return fmt.Errorf("refilling slot at offset %d: %w", s.Offset, err)
+		}
+	}
+
+	return nil
+}
+
+// unsignSlot turns the single filled slot of data back into the placeholder
+// so the file can be signed again, and marks it unfilled in slots. A slot is
+// only filled if a complete, decodable signature of exactly the placeholder's
+// length follows the prefix, so stray prefix bytes are never overwritten.
+func unsignSlot(data []byte, slots []slot, mc *magicConfig) (int64, error) {
+	filled := -1
+	for i, s := range slots {
+		if !s.Filled {
+			continue
+		}
+		if filled != -1 {
+			return 0, fmt.Errorf("file has more than one signature")
+		}
+		filled = i
+	}
+	if filled == -1 {
+		return 0, fmt.Errorf("signature prefix is not followed by a complete signature")
+	}
+
+	offset := slots[filled].Offset
+	magic := []byte(mc.Magic)
+	signature := append([]byte(nil), data[offset:offset+int64(len(magic))]...)
+	if err := unisign.ReplaceMagicAtOffset(data, offset, magic, signature); err != nil {
+		return 0, fmt.Errorf("restoring placeholder at offset %d: %w", offset, err)
+	}
+	slots[filled] = slot{Offset: offset}
+
+	return offset, nil
+}
+
+// versionedSignaturePattern matches an embedded signature of any format
+// version: "us<version>-" followed by a base64-encoded 64-byte signature
+var versionedSignaturePattern = regexp.MustCompile(`us([0-9]{1,3})-[A-Za-z0-9+/]{86}==`)
+
+// findForeignSignatureVersion reports the format version of the first
+// embedded signature whose version differs from unisign.SignatureVersion.
+// It lets verify explain why no signature of the current format was found.
+// Placeholders of every version share the filler after their prefix, so an
+// unsigned placeholder from an older version is not taken for a signature.
+func findForeignSignatureVersion(data []byte) (int, bool) {
+	filler := []byte(strings.TrimPrefix(appconfig.MagicString, appconfig.SignaturePrefix))
+	for _, match := range versionedSignaturePattern.FindAllSubmatch(data, -1) {
+		version, err := strconv.Atoi(string(match[1]))
+		if err != nil || version == int(unisign.SignatureVersion) || bytes.HasSuffix(match[0], filler) {
+			continue
+		}
+		return version, true
+	}
+	return 0, false
+}
+
+// foreignAlgorithmPrefixes are the prefixes of signatures made with an
+// algorithm other than ed25519, which this build can't verify
+var foreignAlgorithmPrefixes = []string{placeholder.ECDSAPrefix, placeholder.RSAPrefix}
+
+// findForeignSignatureAlgorithm reports the algorithm of the first embedded
+// signature whose prefix announces an algorithm other than ed25519. The
+// prefix selects the candidate algorithms, and each one's signature size
+// how much base64 after it to decode; the longest that decodes wins, so a
+// signature is not mistaken for a shorter one of the same family. Like
+// findForeignSignatureVersion, it lets verify explain why no signature was found.
+func findForeignSignatureAlgorithm(data []byte) (string, bool) {
+	for _, prefix := range foreignAlgorithmPrefixes {
+		algos := placeholder.AlgorithmsForPrefix(prefix)
+		sizes := make(map[string]int, len(algos))
+		for _, algo := range algos {
+			sizes[algo], _ = placeholder.SignatureSize(algo)
+		}
+		sort.Slice(algos, func(i, j int) bool { return sizes[algos[i]] > sizes[algos[j]] })
+
+		for pos := 0; ; {
+			index := bytes.Index(data[pos:], []byte(prefix))
+			if index == -1 {
+				break
+			}
+			start := pos + index
+			pos = start + len(prefix)
+
+			for _, algo := range algos {
+				end := pos + base64.StdEncoding.EncodedLen(sizes[algo])
+				if end > len(data) {
+					continue
+				}
+				decoded, err := base64.StdEncoding.DecodeString(string(data[pos:end]))
+				if err != nil || len(decoded) != sizes[algo] {
+					continue
+				}
+				if magic, _ := placeholder.PlaceholderFor(algo); string(data[start:end]) == magic {
+					break
+				}
+				return algo, true
+			}
+		}
+	}
+	return "", false
+}
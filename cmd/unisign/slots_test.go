@@ -0,0 +1,267 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/placeholder"
+)
+
+func TestRestoreSlotsChecksRegion(t *testing.T) {
+	mc := &magicConfig{Magic: appconfig.MagicString, Prefix: appconfig.SignaturePrefix}
+	if err := mc.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	// A stand-in signature: the prefix, then filler of the right length
+	filled := mc.Prefix + string(bytes.Repeat([]byte("A"), len(mc.Magic)-len(mc.Prefix)))
+	data := []byte("head " + filled + " tail")
+	offset := int64(len("head "))
+
+	restored, err := restoreSlots(data, []slot{{Offset: offset, Filled: true}}, mc)
+	if err != nil {
+		t.Fatalf("restoreSlots failed: %v", err)
+	}
+	if want := "head " + mc.Magic + " tail"; string(restored) != want {
+		t.Errorf("restored %q, want %q", restored, want)
+	}
+
+	for name, slots := range map[string][]slot{
+		"no prefix": {{Offset: offset + 1, Filled: true}},
+		"past EOF":  {{Offset: int64(len(data)) - 10, Filled: true}},
+		"negative":  {{Offset: -1, Filled: true}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := restoreSlots(data, slots, mc); !errors.Is(err, errInvalidSignatureRegion) {
+				t.Errorf("error = %v, want errInvalidSignatureRegion", err)
+			}
+		})
+	}
+
+	// Restoring the second slot overwrites the start of the first, which
+	// therefore no longer holds the placeholder
+	overlapping := []byte("head " + filled[:10] + filled + " tail")
+	_, err = restoreSlots(overlapping, []slot{{Offset: offset + 10, Filled: true}, {Offset: offset, Filled: true}}, mc)
+	if !errors.Is(err, errInvalidSignatureRegion) || !strings.Contains(err.Error(), "overlaps") {
+		t.Errorf("overlapping slots: error = %v, want errInvalidSignatureRegion", err)
+	}
+}
+
+func TestSignAndVerifyELFNote(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	srcPath := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(srcPath, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("failed to write test source: %v", err)
+	}
+	binPath := filepath.Join(tmpDir, "app")
+	build := exec.Command("go", "build", "-o", binPath, srcPath)
+	build.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to compile test binary: %v\n%s", err, output)
+	}
+
+	// One placeholder note reached through a PT_NOTE segment, one through an SHT_NOTE section
+	segmentPath := filepath.Join(tmpDir, "app-segment")
+	cmd := exec.Command("go", "run", ".", "inject-placeholder", "--add-note-segment", "-o", segmentPath, binPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("inject-placeholder failed: %v\nOutput: %s", err, output)
+	}
+	sectionPath := filepath.Join(tmpDir, "app-section")
+	err := appconfig.InjectPlaceholderIntoELF(appconfig.ELFInjectionOptions{
+		InputPath:   binPath,
+		OutputPath:  sectionPath,
+		Placeholder: appconfig.MagicString,
+		SectionType: elf.SHT_NOTE,
+	})
+	if err != nil {
+		t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+	}
+
+	mc := &magicConfig{Magic: appconfig.MagicString, Prefix: appconfig.SignaturePrefix}
+	if err := mc.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	for _, path := range []string{segmentPath, sectionPath} {
+		cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, path)
+		cmd.Dir = "."
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("signing %s failed: %v\nOutput: %s", path, err, output)
+		}
+		cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", path+".signed")
+		cmd.Dir = "."
+		if output, err := cmd.CombinedOutput(); err != nil || !strings.Contains(string(output), "Signature verified successfully.") {
+			t.Errorf("verifying %s failed: %v\nOutput: %s", path, err, output)
+		}
+
+		// The slot is the note's descriptor, found through the note header
+		signed, err := os.ReadFile(path + ".signed")
+		if err != nil {
+			t.Fatalf("failed to read signed file: %v", err)
+		}
+		descs, err := appconfig.ELFNoteDescriptors(signed)
+		if err != nil || len(descs) != 1 {
+			t.Fatalf("ELFNoteDescriptors = %+v, %v; want one note", descs, err)
+		}
+		slots, err := locateELFSlots(signed, mc)
+		if err != nil || len(slots) != 1 || !slots[0].Filled || slots[0].Offset != descs[0].Offset {
+			t.Errorf("locateELFSlots = %+v, %v; want the signed note descriptor at %d", slots, err, descs[0].Offset)
+		}
+
+		// A descriptor of another size is not a signature region
+		sizeOffset := descs[0].Offset - int64(len("unisign\x00")) - 8 // n_descsz
+		binary.LittleEndian.PutUint32(signed[sizeOffset:], uint32(len(mc.Magic)-1))
+		if _, err := locateELFSlots(signed, mc); !errors.Is(err, errInvalidSignatureRegion) {
+			t.Errorf("short descriptor: error = %v, want errInvalidSignatureRegion", err)
+		}
+	}
+}
+
+func TestSignAndVerifyZipSizedPlaceholder(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("hello.txt")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	w.Write([]byte("hello"))
+	zw.SetComment("Release notes")
+	zw.Close()
+	inputPath := filepath.Join(tmpDir, "archive.zip")
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write zip file: %v", err)
+	}
+
+	// The key ID placeholder is 100 bytes, not 92; only inject is told so
+	keyed := &magicConfig{Magic: appconfig.MagicString, Prefix: appconfig.SignaturePrefix, KeyID: true}
+	if err := keyed.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("go", append([]string{"run", "."}, args...)...)
+		cmd.Dir = "."
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s failed: %v\nOutput: %s", args[0], err, output)
+		}
+		return string(output)
+	}
+	run("inject-placeholder", "--key-id", "--append-comment", inputPath)
+	run("sign", "-k", keyPath, inputPath+".placeholder")
+	output := run("verify", "-k", keyPath+".pub", inputPath+".placeholder.signed")
+	if !strings.Contains(output, "Signature verified successfully.") {
+		t.Errorf("verify output: %s", output)
+	}
+	if output := run("info", inputPath+".placeholder.signed"); !strings.Contains(output, "Key ID: ") {
+		t.Errorf("info does not show the key ID: %s", output)
+	}
+
+	// The signature took the whole 100-byte region, key ID included
+	zr, err := zip.OpenReader(inputPath + ".placeholder.signed")
+	if err != nil {
+		t.Fatalf("signed archive is not a valid ZIP: %v", err)
+	}
+	defer zr.Close()
+	notes, signature, _ := strings.Cut(zr.Comment, "\n")
+	if notes != "Release notes" || len(signature) != len(keyed.Magic) {
+		t.Errorf("comment = %q, want the notes and a %d-byte signature", zr.Comment, len(keyed.Magic))
+	}
+}
+
+func TestSizedFor(t *testing.T) {
+	mc := &magicConfig{Magic: appconfig.MagicString, Prefix: appconfig.SignaturePrefix}
+	if err := mc.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	zipWithComment := func(comment string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		zw.SetComment(comment)
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	// The default placeholder, or data whose format bounds none, keeps mc
+	for name, data := range map[string][]byte{
+		"default placeholder": zipWithComment(appconfig.MagicString),
+		"raw file":            []byte("data " + appconfig.MagicString + "A more data"),
+	} {
+		if got, err := mc.sizedFor(data); err != nil || got != mc {
+			t.Errorf("%s: sizedFor = %+v, %v; want mc itself", name, got, err)
+		}
+	}
+
+	keyedLen := len(appconfig.MagicString) + 8
+	got, err := mc.sizedFor(zipWithComment(appconfig.SignaturePrefix + strings.Repeat("A", keyedLen-len(appconfig.SignaturePrefix))))
+	if err != nil || !got.KeyID || len(got.Magic) != keyedLen {
+		t.Errorf("100-byte comment: sizedFor = %+v, %v; want the key ID layout", got, err)
+	}
+	if mc.KeyID || mc.Magic != appconfig.MagicString {
+		t.Error("sizedFor modified its receiver")
+	}
+
+	// No layout is 95 bytes
+	odd := zipWithComment(appconfig.SignaturePrefix + strings.Repeat("A", 91))
+	if _, err := mc.sizedFor(odd); !errors.Is(err, errInvalidSignatureRegion) {
+		t.Errorf("95-byte comment: error = %v, want errInvalidSignatureRegion", err)
+	}
+
+	// An explicit --magic is used as given
+	explicit := &magicConfig{Magic: appconfig.SignaturePrefix + strings.Repeat("B", 88), Prefix: appconfig.SignaturePrefix}
+	if err := explicit.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	if got, err := explicit.sizedFor(odd); err != nil || got != explicit {
+		t.Errorf("explicit magic: sizedFor = %+v, %v; want it unchanged", got, err)
+	}
+}
+
+func TestFindForeignSignatureAlgorithm(t *testing.T) {
+	for _, prefix := range foreignAlgorithmPrefixes {
+		for _, algo := range placeholder.AlgorithmsForPrefix(prefix) {
+			t.Run(algo, func(t *testing.T) {
+				size, err := placeholder.SignatureSize(algo)
+				if err != nil {
+					t.Fatalf("SignatureSize failed: %v", err)
+				}
+				signature := prefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x5a}, size))
+
+				// The prefix picks the family and the signature's length the algorithm
+				if got, ok := findForeignSignatureAlgorithm([]byte("head " + signature + " tail")); !ok || got != algo {
+					t.Errorf("findForeignSignatureAlgorithm() = %q, %v, want %q", got, ok, algo)
+				}
+
+				magic, err := placeholder.PlaceholderFor(algo)
+				if err != nil {
+					t.Fatalf("PlaceholderFor failed: %v", err)
+				}
+				if got, ok := findForeignSignatureAlgorithm([]byte("head " + magic + " tail")); ok {
+					t.Errorf("placeholder taken for a %s signature", got)
+				}
+			})
+		}
+	}
+
+	// Too short for any algorithm of the family, or with the ed25519 prefix
+	short := placeholder.ECDSAPrefix + base64.StdEncoding.EncodeToString(make([]byte, 48))
+	ed25519 := appconfig.SignaturePrefix + base64.StdEncoding.EncodeToString(make([]byte, 64))
+	for _, data := range []string{short, ed25519} {
+		if got, ok := findForeignSignatureAlgorithm([]byte(data)); ok {
+			t.Errorf("findForeignSignatureAlgorithm(%q) = %q, want none", data, got)
+		}
+	}
+}
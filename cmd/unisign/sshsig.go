@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultSSHSigNamespace is the namespace ssh-keygen users pass with -n for
+// signing files; the other common one, "git", is for commits
+const defaultSSHSigNamespace = "file"
+
+// sshsigPath is where sign --sshsig writes the signature for inputFile, the
+// same place ssh-keygen -Y sign does
+func sshsigPath(inputFile string) string {
+	return inputFile + ".sig"
+}
+
+// signSSHSig writes an armored SSH signature for inputFile next to it, in the
+// format of ssh-keygen -Y sign. The file is left as it is, so it needs no
+// placeholder. An existing signature is only replaced with force.
+func signSSHSig(signer ssh.Signer, namespace, inputFile string, force bool, maxFileSize int64) {
+	sigFile := sshsigPath(inputFile)
+	if _, err := os.Stat(sigFile); err == nil && !force {
+		exitWithCode(exitUsage, "%s already exists; pass --force to replace it", sigFile)
+	}
+
+	if err := checkFileSize(inputFile, maxFileSize); err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	f, err := os.Open(inputFile)
+	if err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	defer f.Close()
+
+	armored, err := unisign.SignSSHSig(signer, f, namespace)
+	if err != nil {
+		exitWithError("signing %s: %v", inputFile, err)
+	}
+	if err := os.WriteFile(sigFile, armored, 0644); err != nil {
+		exitWithCode(exitIO, "writing signature: %v", err)
+	}
+
+	fmt.Printf("Signed %s (namespace %s) -> %s\n", inputFile, namespace, sigFile)
+}
+
+// verifySSHSig checks the armored SSH signature in sigFile over inputFile,
+// which passes if any of pubKeys made it for namespace. quiet leaves out the
+// success message.
+func verifySSHSig(sigFile, namespace, inputFile string, pubKeys []ssh.PublicKey, keyNames []string, quiet bool, maxFileSize int64) {
+	armored, err := readFileOrStdin(sigFile)
+	if err != nil {
+		exitWithCode(exitIO, "reading signature: %v", err)
+	}
+
+	if err := checkFileSize(inputFile, maxFileSize); err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+
+	f, err := os.Open(inputFile)
+	if err != nil {
+		exitWithCode(exitIO, "reading input file: %v", err)
+	}
+	defer f.Close()
+
+	// The signature names its key, so the file is hashed once
+	k, err := unisign.VerifySSHSigKeys(pubKeys, f, namespace, armored)
+	if err != nil {
+		if errors.Is(err, unisign.ErrInvalidSSHSig) {
+			exitWithCode(exitMagic, "%s: %v", sigFile, err)
+		}
+		exitWithCode(exitVerify, "%v", err)
+	}
+	if !quiet {
+		fmt.Printf("Verified with %s (%s %s), namespace %s\n",
+			keyNames[k], pubKeys[k].Type(), ssh.FingerprintSHA256(pubKeys[k]), namespace)
+		fmt.Println("Signature verified successfully.")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignAndVerifySSHSig(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	wrongKeyPath := generateTestKey(t, tmpDir, "wrong_key")
+
+	// The file needs no placeholder and is left unchanged
+	content := []byte("release tarball contents\n")
+	inputPath := filepath.Join(tmpDir, "app.tar.gz")
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, "--sshsig", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	if data, err := os.ReadFile(inputPath); err != nil || string(data) != string(content) {
+		t.Errorf("input file changed: %q, %v", data, err)
+	}
+	sigPath := inputPath + ".sig"
+
+	// ssh-keygen accepts the signature
+	pubKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	allowedSigners := filepath.Join(tmpDir, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, append([]byte("release@example.com "), pubKey...), 0644); err != nil {
+		t.Fatalf("failed to write allowed signers: %v", err)
+	}
+	cmd = exec.Command("ssh-keygen", "-Y", "verify", "-f", allowedSigners,
+		"-I", "release@example.com", "-n", "file", "-s", sigPath)
+	cmd.Stdin = bytes.NewReader(content)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("ssh-keygen -Y verify failed: %v\nOutput: %s", err, output)
+	}
+
+	// Signing again needs --force
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--sshsig", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("signing over an existing signature should have failed\nOutput: %s", output)
+	}
+
+	// unisign accepts ssh-keygen's signature, made for another namespace
+	keygenSigPath := filepath.Join(tmpDir, "app.tar.gz.keygen.sig")
+	cmd = exec.Command("ssh-keygen", "-Y", "sign", "-f", keyPath, "-n", "release")
+	cmd.Stdin = bytes.NewReader(content)
+	keygenSig, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("ssh-keygen -Y sign failed: %v", err)
+	}
+	if err := os.WriteFile(keygenSigPath, keygenSig, 0644); err != nil {
+		t.Fatalf("failed to write signature: %v", err)
+	}
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", append([]string{"run", ".", "verify"}, args...)...)
+		cmd.Dir = "."
+		return cmd.CombinedOutput()
+	}
+
+	if output, err := run("-k", keyPath+".pub", "--sshsig", sigPath, inputPath); err != nil {
+		t.Errorf("verifying unisign's signature failed: %v\nOutput: %s", err, output)
+	}
+	if output, err := run("-k", keyPath+".pub", "--sshsig", keygenSigPath, "--namespace", "release", inputPath); err != nil {
+		t.Errorf("verifying ssh-keygen's signature failed: %v\nOutput: %s", err, output)
+	}
+
+	modifiedPath := filepath.Join(tmpDir, "modified.tar.gz")
+	if err := os.WriteFile(modifiedPath, []byte("release tarball contents!\n"), 0644); err != nil {
+		t.Fatalf("failed to write modified file: %v", err)
+	}
+	failures := []struct {
+		name string
+		args []string
+	}{
+		{"wrong key", []string{"-k", wrongKeyPath + ".pub", "--sshsig", sigPath, inputPath}},
+		{"wrong namespace", []string{"-k", keyPath + ".pub", "--sshsig", keygenSigPath, inputPath}},
+		{"modified file", []string{"-k", keyPath + ".pub", "--sshsig", sigPath, modifiedPath}},
+		{"not a signature", []string{"-k", keyPath + ".pub", "--sshsig", inputPath, inputPath}},
+		{"namespace without sshsig", []string{"-k", keyPath + ".pub", "--namespace", "release", inputPath}},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			if output, err := run(tc.args...); err == nil {
+				t.Errorf("verification should have failed\nOutput: %s", output)
+			}
+		})
+	}
+}
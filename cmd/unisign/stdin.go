@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	appconfig "unisign/internal/unisign"
+)
+
+// stdinPath is the file argument that stands for standard input
+const stdinPath = "-"
+
+// stdinFileMode is the mode given to outputs derived from standard input
+const stdinFileMode os.FileMode = 0644
+
+// readFileOrStdin reads path, or standard input if path is "-"
+func readFileOrStdin(path string) ([]byte, error) {
+	if path == stdinPath {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readFileOrStdinWithMode is like readFileOrStdin but also returns the
+// permission bits to carry over to derived outputs. Input larger than
+// maxSize bytes is an error; a maxSize of 0 is no limit.
+func readFileOrStdinWithMode(path string, maxSize int64) ([]byte, os.FileMode, error) {
+	if path == stdinPath {
+		if maxSize == 0 {
+			data, err := io.ReadAll(os.Stdin)
+			return data, stdinFileMode, err
+		}
+		// Read one byte past the limit to tell input of exactly maxSize from a larger one
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, maxSize+1))
+		if err == nil && int64(len(data)) > maxSize {
+			err = fmt.Errorf("standard input exceeds --max-file-size (%d)", maxSize)
+		}
+		return data, stdinFileMode, err
+	}
+	if err := checkFileSize(path, maxSize); err != nil {
+		return nil, 0, err
+	}
+	return appconfig.ReadFileWithMode(path)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	appconfig "unisign/internal/unisign"
+)
+
+// timestampSignature obtains a token from the TSA at tsaURL over the raw
+// signature bytes
+func timestampSignature(tsaURL string, signature []byte) ([]byte, error) {
+	token, err := appconfig.RequestTimestamp(tsaURL, signature, defaultFetchTimeout)
+	if err != nil {
+		return nil, err
+	}
+	debugf("timestamp token of %d bytes from %s", len(token), tsaURL)
+	return token, nil
+}
+
+// loadTSARoots returns the CA certificates in the PEM file caFile, or the
+// system pool if caFile is empty
+func loadTSARoots(caFile string) (*x509.CertPool, error) {
+	if caFile == "" {
+		return x509.SystemCertPool()
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s holds no PEM certificates", caFile)
+	}
+	return pool, nil
+}
+
+// verifyTimestampToken checks token against roots and returns what it
+// attests. The token must cover one of signatures, the raw signatures that
+// verified.
+func verifyTimestampToken(token []byte, roots *x509.CertPool, signatures [][]byte) (*appconfig.Timestamp, error) {
+	var firstErr error
+	for _, signature := range signatures {
+		ts, err := appconfig.VerifyTimestamp(token, signature, roots)
+		if err == nil {
+			return ts, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
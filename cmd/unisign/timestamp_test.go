@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unisign/internal/tsatest"
+	appconfig "unisign/internal/unisign"
+)
+
+func TestSignAndVerifyTimestamp(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "input.txt")
+	signedPath := inputPath + ".signed"
+	tokenPath := signedPath + ".tst"
+
+	tsa, err := tsatest.NewServer(tsatest.Options{})
+	if err != nil {
+		t.Fatalf("failed to start mock TSA: %v", err)
+	}
+	defer tsa.Close()
+	caPath := filepath.Join(tmpDir, "tsa-ca.pem")
+	if err := os.WriteFile(caPath, tsa.RootPEM(), 0644); err != nil {
+		t.Fatalf("failed to write TSA CA: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, "--tsa", tsa.URL, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "Timestamp token written to: "+tokenPath) {
+		t.Errorf("sign did not report the token file\nOutput: %s", output)
+	}
+	if _, err := os.Stat(tokenPath); err != nil {
+		t.Fatalf("token file missing: %v", err)
+	}
+
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command("go", append([]string{"run", ".", "verify", "-k", keyPath + ".pub"}, args...)...)
+		cmd.Dir = "."
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+
+	verifyOutput, err := run("--tsa-verify", "--tsa-ca", caPath, signedPath)
+	if err != nil {
+		t.Fatalf("verifying the timestamp failed: %v\nOutput: %s", err, verifyOutput)
+	}
+	if !strings.Contains(verifyOutput, "Timestamp: ") || !strings.Contains(verifyOutput, "CN=tsatest TSA") {
+		t.Errorf("verify did not report the timestamp\nOutput: %s", verifyOutput)
+	}
+
+	// A TSA chaining to another root isn't trusted
+	other, err := tsatest.NewServer(tsatest.Options{})
+	if err != nil {
+		t.Fatalf("failed to start mock TSA: %v", err)
+	}
+	defer other.Close()
+	otherCAPath := filepath.Join(tmpDir, "other-ca.pem")
+	if err := os.WriteFile(otherCAPath, other.RootPEM(), 0644); err != nil {
+		t.Fatalf("failed to write TSA CA: %v", err)
+	}
+	if output, err := run("--tsa-verify", "--tsa-ca", otherCAPath, signedPath); err == nil || !strings.Contains(output, "timestamp verification failed") {
+		t.Errorf("expected an untrusted TSA to fail verification, got %v\nOutput: %s", err, output)
+	}
+
+	// A token over another signature doesn't count
+	otherInput := filepath.Join(tmpDir, "other.txt")
+	if err := os.WriteFile(otherInput, []byte("other data "+appconfig.MagicString), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--tsa", tsa.URL, otherInput)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	if output, err := run("--tsa-verify", "--tsa-ca", caPath, "--tsa-token", otherInput+".signed.tst", signedPath); err == nil || !strings.Contains(output, "timestamp verification failed") {
+		t.Errorf("expected a token over another signature to fail verification, got %v\nOutput: %s", err, output)
+	}
+
+	// Without a token --tsa-verify fails, while plain verify doesn't need one
+	if err := os.Remove(tokenPath); err != nil {
+		t.Fatalf("failed to remove token: %v", err)
+	}
+	if output, err := run("--tsa-verify", "--tsa-ca", caPath, signedPath); err == nil || !strings.Contains(output, "reading timestamp token") {
+		t.Errorf("expected a missing token to fail, got %v\nOutput: %s", err, output)
+	}
+	if output, err := run(signedPath); err != nil {
+		t.Errorf("verify without --tsa-verify failed: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestSignTimestampRejected(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "input.txt")
+
+	tsa, err := tsatest.NewServer(tsatest.Options{})
+	if err != nil {
+		t.Fatalf("failed to start mock TSA: %v", err)
+	}
+	defer tsa.Close()
+	tsa.Reject = true
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, "--tsa", tsa.URL, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "timestamp request rejected") {
+		t.Errorf("expected sign to report the rejection, got %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(inputPath + ".signed.tst"); !os.IsNotExist(err) {
+		t.Errorf("token file written for a rejected request")
+	}
+	if _, err := os.Stat(inputPath + ".signed"); !os.IsNotExist(err) {
+		t.Errorf("signed file written for a rejected request")
+	}
+
+	cmd = exec.Command("go", "run", ".", "sign", "-k", keyPath, "--tsa", tsa.URL, "--dry-run", inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(output), "--tsa cannot be combined with --dry-run") {
+		t.Errorf("expected --tsa with --dry-run to be rejected, got %v\nOutput: %s", err, output)
+	}
+}
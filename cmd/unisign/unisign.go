@@ -3,13 +3,19 @@ package main
 import (
 	"fmt"
 	"os"
+	"runtime"
+	"unisign/pkg/unisign"
 )
 
+// Version is the unisign release, injected at build time with
+// -ldflags "-X main.Version=..."
+var Version = "dev"
+
 func main() {
 	// Check if we have at least one argument
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	// Check the command (sign or verify)
@@ -20,20 +26,83 @@ func main() {
 		verifyFile()
 	case "inject-placeholder":
 		injectPlaceholder()
+	case "pubkey":
+		printPublicKey()
+	case "doctor":
+		diagnoseFile()
+	case "placeholder-info":
+		printPlaceholderInfo()
+	case "info":
+		printSignatureInfo()
+	case "version", "--version", "-version":
+		printVersion()
 	default:
 		fmt.Fprintf(os.Stderr, "Error: Unknown command '%s'\n", os.Args[1])
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 }
 
+func printVersion() {
+	fmt.Printf("unisign %s\n", Version)
+	fmt.Printf("go runtime: %s\n", runtime.Version())
+	fmt.Printf("signature magic: 0x%X\n", unisign.SignatureMagic)
+	fmt.Printf("signature format version: %d\n", unisign.SignatureVersion)
+}
+
 func printUsage() {
 	fmt.Fprintf(os.Stderr, "Usage:\n")
-	fmt.Fprintf(os.Stderr, "  %s sign -k <private_key_file> <input_file>\n", os.Args[0])
-	fmt.Fprintf(os.Stderr, "  %s verify -k <public_key_file> <signed_file>\n", os.Args[0])
-	fmt.Fprintf(os.Stderr, "  %s inject-placeholder [-o <output_file>] <input_file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s sign -k <private_key_file or scheme://...> [--passphrase-file <file>] [--cert <cert_file>] [--slot <i>] [--force] [--json-field <name>] [--normalize-eol] [--line-comment] [--sum] [--sum-file <file>] [--chmod <mode>] [--preserve-time] [--dry-run] <input_file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s verify -k <public_key_file> [-k <public_key_file>...] [--agent --fingerprint <SHA256:...>] [--principal <name>] [--allowed-fingerprints <file>] [--quiet] [--allow-remote] [--json-field <name>] [--normalize-eol] [--line-comment] [--emit-original -o <output_file>] <signed_file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s sign -k <private_key_file> -r [--out-dir <dir>] [--chmod <mode>] [--preserve-time] [--dry-run] <dir>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s sign -k <private_key_file> --manifest <manifest_file> <file_or_dir>...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s verify -k <public_key_file> (--signature <sig> | --signature-file <file>) --offset <n> <file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s verify -k <public_key_file> --manifest <manifest_file> <dir>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s sign -k <private_key_file> --sshsig [--namespace <ns>] [--force] <file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s verify -k <public_key_file> --sshsig <sig_file> [--namespace <ns>] [--quiet] <file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s sign -k <private_key_file> --sidecar [--force] <file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s verify -k <public_key_file> --sidecar [--quiet] <file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s inject-placeholder [-o <output_file>] [--in-place] [--add-note-segment] [--append-comment] [--pdf-object <n>] [--reuse] [--chmod <mode>] [--preserve-time] [--dry-run] <input_file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s pubkey -k <private_key_file> [--passphrase-file <file>]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s doctor <file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s placeholder-info\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s info [--json] <signed_file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s version\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "\nCommands:\n")
 	fmt.Fprintf(os.Stderr, "  sign              - Sign a file containing the magic placeholder\n")
 	fmt.Fprintf(os.Stderr, "  verify            - Verify a signed file\n")
-	fmt.Fprintf(os.Stderr, "  inject-placeholder - Inject the magic placeholder into supported file formats (ELF, PDF, .zip)\n")
+	fmt.Fprintf(os.Stderr, "  inject-placeholder - Inject the magic placeholder into supported file formats (ELF, PE, PDF, .zip)\n")
+	fmt.Fprintf(os.Stderr, "  pubkey            - Print the public key of a private key in authorized_keys format\n")
+	fmt.Fprintf(os.Stderr, "  doctor            - Report placeholders, signatures and format to explain sign/verify failures\n")
+	fmt.Fprintf(os.Stderr, "  placeholder-info  - Print the placeholder to embed and the lengths it is derived from\n")
+	fmt.Fprintf(os.Stderr, "  info              - Print the embedded signatures and the headers they cover, without verifying\n")
+	fmt.Fprintf(os.Stderr, "  version           - Print the unisign version and signature format\n")
+	fmt.Fprintf(os.Stderr, "\nCommon options (sign, verify, inject-placeholder, doctor, placeholder-info, info):\n")
+	fmt.Fprintf(os.Stderr, "  --magic <string>   - Placeholder to use instead of the built-in one\n")
+	fmt.Fprintf(os.Stderr, "  --prefix <string>  - Signature prefix; must start --magic\n")
+	fmt.Fprintf(os.Stderr, "  --key-id           - Signatures carry the signer's key ID, in a 100-character placeholder; must be given to all\n")
+	fmt.Fprintf(os.Stderr, "\nSign and verify options:\n")
+	fmt.Fprintf(os.Stderr, "  -k, --key <file>   - Key to sign with (sign, pubkey) or verify against (verify, also --pubkey)\n")
+	fmt.Fprintf(os.Stderr, "  --normalize-eol    - Sign/verify the file with CRLF converted to LF; must be given to both\n")
+	fmt.Fprintf(os.Stderr, "  --line-comment     - Sign/verify the file without the # comment line holding the signature; must be given to both\n")
+	fmt.Fprintf(os.Stderr, "  --json-field <f>   - Sign/verify the canonical form of a JSON object whose top-level field holds the signature\n")
+	fmt.Fprintf(os.Stderr, "  -v, --verbose      - Log each step (file read, offsets, signature, length check, output) to stderr\n")
+	fmt.Fprintf(os.Stderr, "  --max-file-size <n> - Refuse inputs larger than n bytes before reading them (default 1GB, 0 for no limit)\n")
+	fmt.Fprintf(os.Stderr, "  --sshsig           - Sign/verify with a separate signature file compatible with ssh-keygen -Y (--namespace, default file)\n")
+	fmt.Fprintf(os.Stderr, "  --sidecar          - Sign/verify the whole file as it is, with the signature in <file>.unisig\n")
+	fmt.Fprintf(os.Stderr, "\nVerify options:\n")
+	fmt.Fprintf(os.Stderr, "  --emit-original    - After successful verification, write the placeholder-restored original\n")
+	fmt.Fprintf(os.Stderr, "  -o, --output <f>   - Destination for --emit-original (only valid together with it)\n")
+	fmt.Fprintf(os.Stderr, "  --json             - Print the format, slot offsets and result as JSON, even on failure\n")
+	fmt.Fprintf(os.Stderr, "  --require-all      - Fail unless every filled slot verifies, not just one\n")
+	fmt.Fprintf(os.Stderr, "  --offset <n>       - Check only the signature at offset n (as printed by sign), skipping the scan\n")
+	fmt.Fprintf(os.Stderr, "  --signature <sig>  - With --offset, verify this signature against the unmodified file (or --signature-file <f>)\n")
+	fmt.Fprintf(os.Stderr, "  --agent            - Verify with a key from the SSH agent (SSH_AUTH_SOCK)\n")
+	fmt.Fprintf(os.Stderr, "  --fingerprint <fp> - SHA256 fingerprint of the agent key, as printed by ssh-add -l\n")
+	fmt.Fprintf(os.Stderr, "\nExit codes:\n")
+	fmt.Fprintf(os.Stderr, "  1 - Other error\n")
+	fmt.Fprintf(os.Stderr, "  2 - Invalid flags or arguments\n")
+	fmt.Fprintf(os.Stderr, "  3 - Reading or writing a file failed\n")
+	fmt.Fprintf(os.Stderr, "  4 - Placeholder or signature not found, duplicated or truncated\n")
+	fmt.Fprintf(os.Stderr, "  5 - Signature verification failed\n")
 } 
\ No newline at end of file
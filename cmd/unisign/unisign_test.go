@@ -161,4 +161,20 @@ func TestUnisignErrors(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestVersion(t *testing.T) {
+	for _, arg := range []string{"version", "--version"} {
+		t.Run(arg, func(t *testing.T) {
+			cmd := exec.Command("go", "run", "-ldflags", "-X main.Version=v1.2.3-test", ".", arg)
+			cmd.Dir = "."
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("unisign %s failed: %v\nOutput: %s", arg, err, output)
+			}
+			if !bytes.Contains(output, []byte("unisign v1.2.3-test")) {
+				t.Errorf("version output missing version line: %s", output)
+			}
+		})
+	}
+}
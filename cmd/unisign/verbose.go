@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+)
+
+// debugLog receives the step-by-step diagnostics of --verbose. It goes to
+// stderr so it can be combined with --json, whose report stays alone on stdout.
+var debugLog = log.New(io.Discard, "", 0)
+
+// addVerboseFlag registers --verbose and its short form -v on a command's flag set
+func addVerboseFlag(fs *flag.FlagSet) *bool {
+	verbose := new(bool)
+	fs.BoolVar(verbose, "verbose", false, "Log each step (file read, magic found, signature computed, output written) to stderr")
+	fs.BoolVar(verbose, "v", false, "Shorthand for --verbose")
+	return verbose
+}
+
+// enableVerbose starts sending debugf output to stderr if verbose is set
+func enableVerbose(verbose bool) {
+	if verbose {
+		debugLog = log.New(os.Stderr, "unisign: DEBUG ", 0)
+	}
+}
+
+// debugf logs one diagnostic step; it prints nothing without --verbose
+func debugf(format string, args ...interface{}) {
+	debugLog.Printf(format, args...)
+}
@@ -1,94 +1,669 @@
 package main
 
 import (
-	"encoding/base64"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 	appconfig "unisign/internal/unisign"
 	"unisign/pkg/unisign"
 
 	"golang.org/x/crypto/ssh"
 )
 
-// exitWithError prints an error message and exits with code 1
+// exitWithError prints an error message and exits with exitFailure
 func exitWithError(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
-	os.Exit(1)
+	exitWithCode(exitFailure, format, args...)
+}
+
+// keyFileList collects the values of a repeatable -k flag
+type keyFileList []string
+
+func (l *keyFileList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *keyFileList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// verifyReport is the result of a verify run as printed by --json
+type verifyReport struct {
+	File     string       `json:"file"`
+	Format   string       `json:"format"`
+	Gzipped  bool         `json:"gzipped,omitempty"`
+	Slots    []slotReport `json:"slots"`
+	Verified bool         `json:"verified"`
+	Original string       `json:"original,omitempty"`
+	Error    string       `json:"error,omitempty"`
+
+	// Timestamp is the time a --tsa-verify token attests, and TSA the subject of its signer
+	Timestamp string `json:"timestamp,omitempty"`
+	TSA       string `json:"tsa,omitempty"`
+}
+
+// slotReport describes one signature slot within a verifyReport
+type slotReport struct {
+	Offset   int64  `json:"offset"`
+	Signed   bool   `json:"signed"`
+	Verified bool   `json:"verified"`
+	Key      string `json:"key,omitempty"`
+
+	// Certificate describes the certificate in Key, if it is one
+	Certificate string `json:"certificate,omitempty"`
+
+	// Principal is the --principal the certificate was checked against
+	Principal string `json:"principal,omitempty"`
+
+	// KeyType and Fingerprint identify the key that made the signature,
+	// which for a certificate is the key it certifies
+	KeyType     string `json:"key_type,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// SignedLength is the message length recorded in the signed header
+	SignedLength uint64 `json:"signed_length,omitempty"`
+}
+
+// loadPublicKeys reads the keys verify checks signatures against: every key
+// in each of files, then the SSH agent key with agentFingerprint if it is not
+// empty. The returned names label each key in the output. Failures are passed
+// to fail, which does not return; quiet suppresses progress output.
+func loadPublicKeys(files []string, agentFingerprint string, quiet bool, fail func(int, string, ...interface{})) ([]ssh.PublicKey, []string) {
+	var pubKeys []ssh.PublicKey
+	var keyNames []string
+	for _, pubKeyFile := range files {
+		pubKeyData, err := readFileOrStdin(pubKeyFile)
+		if err != nil {
+			fail(exitIO, "reading public key file: %v", err)
+		}
+
+		// A key file may be a whole authorized_keys file holding several keys
+		fileKeys, _, err := unisign.ParseAuthorizedKeys(pubKeyData)
+		if err != nil {
+			fail(exitFailure, "parsing public key %s: %v", pubKeyFile, err)
+		}
+		if len(fileKeys) > 1 && !quiet {
+			fmt.Printf("Loaded %d public keys from %s\n", len(fileKeys), pubKeyFile)
+		}
+		for i, pubKey := range fileKeys {
+			pubKeys = append(pubKeys, pubKey)
+			if len(fileKeys) > 1 {
+				keyNames = append(keyNames, fmt.Sprintf("%s#%d", pubKeyFile, i+1))
+			} else {
+				keyNames = append(keyNames, pubKeyFile)
+			}
+		}
+	}
+	if agentFingerprint != "" {
+		pubKey, err := agentPublicKey(agentFingerprint)
+		if err != nil {
+			fail(exitIO, "%v", err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+		keyNames = append(keyNames, "agent:"+agentFingerprint)
+	}
+	return pubKeys, keyNames
+}
+
+// formatName names the container format verify treated the input as
+func formatName(f appconfig.Format) string {
+	if f == appconfig.FormatUnknown {
+		return "raw"
+	}
+	return f.String()
+}
+
+// printJSONReport writes report to stdout as indented JSON
+func printJSONReport(report *verifyReport) {
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		exitWithError("encoding report: %v", err)
+	}
+	fmt.Println(string(out))
 }
 
 func verifyFile() {
 	// Set up a separate flagset for the verify command
 	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
-	pubKeyFile := verifyCmd.String("k", "", "SSH public key file")
+	var pubKeyFiles keyFileList
+	// -k, --key and --pubkey add to the same list, so they can be mixed
+	verifyCmd.Var(&pubKeyFiles, "pubkey", "SSH public key file, or - for stdin (repeat for multiple signers)")
+	verifyCmd.Var(&pubKeyFiles, "key", "Same as --pubkey")
+	verifyCmd.Var(&pubKeyFiles, "k", "Shorthand for --pubkey")
+	emitOriginal := verifyCmd.Bool("emit-original", false, "After successful verification, write the placeholder-restored original to -o")
+	outputFile := new(string)
+	verifyCmd.StringVar(outputFile, "output", "", "Output file for the restored original (only valid with --emit-original)")
+	verifyCmd.StringVar(outputFile, "o", "", "Shorthand for --output")
+	jsonOutput := verifyCmd.Bool("json", false, "Print the result as JSON on stdout")
+	quiet := verifyCmd.Bool("quiet", false, "Print nothing but errors; the exit code reports the result")
+	allowRemote := verifyCmd.Bool("allow-remote", false, "Allow the signed file to be an http:// or https:// URL, fetched into memory")
+	fetchTimeout := verifyCmd.Duration("fetch-timeout", defaultFetchTimeout, "Time limit for fetching a URL given with --allow-remote")
+	maxFetchSize := verifyCmd.Int64("max-fetch-size", defaultMaxFetchSize, "Largest response in bytes accepted from a URL given with --allow-remote")
+	offsetFlag := verifyCmd.Int64("offset", -1, "Signature offset; skips scanning the file for it")
+	signatureFlag := verifyCmd.String("signature", "", "Verify this signature (us2-...), kept outside the file, against the unmodified file at --offset")
+	signatureFile := verifyCmd.String("signature-file", "", "Like --signature, reading the signature from this file")
+	requireAll := verifyCmd.Bool("require-all", false, "Fail unless every filled slot verifies (for files with several signers)")
+	jsonField := verifyCmd.String("json-field", "", "Verify the canonical form of a JSON object whose top-level `field` holds the signature")
+	normalizeEOL := verifyCmd.Bool("normalize-eol", false, "Verify with CRLF line endings converted to LF (for files signed with --normalize-eol)")
+	lineComment := verifyCmd.Bool("line-comment", false, "Verify without the # comment line holding the signature (for files signed with --line-comment)")
+	sshsigFile := verifyCmd.String("sshsig", "", "Verify the file against this ssh-keygen -Y sign signature instead of an embedded one")
+	namespace := verifyCmd.String("namespace", defaultSSHSigNamespace, "With --sshsig, the namespace the signature must be made for")
+	sidecar := verifyCmd.Bool("sidecar", false, "Verify the file against the signature in <input_file>"+appconfig.SidecarSuffix+" instead of an embedded one")
+	maxFileSize := addMaxFileSizeFlag(verifyCmd)
+	verbose := addVerboseFlag(verifyCmd)
+	manifestFile := verifyCmd.String("manifest", "", "Verify every file listed in this manifest against the directory given instead of a signed file")
+	useAgent := verifyCmd.Bool("agent", false, "Take the public key from the SSH agent (requires --fingerprint)")
+	fingerprint := verifyCmd.String("fingerprint", "", "SHA256 fingerprint of the agent key to verify with, as printed by ssh-add -l")
+	principal := verifyCmd.String("principal", "", "Require the signing key to be a certificate listing this principal and valid now")
+	allowedFingerprints := verifyCmd.String("allowed-fingerprints", "", "Only accept signatures by keys whose SHA256 fingerprint is listed in this file, one per line")
+	tsaVerify := verifyCmd.Bool("tsa-verify", false, "Also verify the RFC 3161 timestamp token over the signature, read from <input_file>"+appconfig.TimestampSuffix)
+	tsaToken := verifyCmd.String("tsa-token", "", "With --tsa-verify, read the timestamp token from this file")
+	tsaCA := verifyCmd.String("tsa-ca", "", "With --tsa-verify, PEM file of the CA certificates the TSA must chain to (default: system roots)")
+	mc := addMagicFlags(verifyCmd)
 
 	// Parse arguments for verify command
 	verifyCmd.Parse(os.Args[2:])
 
-	if *pubKeyFile == "" {
-		exitWithError("flag -k with public key file is required")
+	if err := mc.validate(); err != nil {
+		exitWithCode(exitUsage, "%v", err)
+	}
+
+	validateMaxFileSize(*maxFileSize)
+	enableVerbose(*verbose)
+
+	if *quiet && *jsonOutput {
+		exitWithCode(exitUsage, "--quiet cannot be combined with --json")
+	}
+	// Progress and success output is left out with --json, which prints the report instead, and with --quiet
+	silent := *jsonOutput || *quiet
+
+	if *offsetFlag < -1 {
+		exitWithCode(exitUsage, "--offset must not be negative")
+	}
+
+	if *jsonField != "" && *normalizeEOL {
+		exitWithCode(exitUsage, "--json-field cannot be combined with --normalize-eol")
+	}
+	if *lineComment && (*jsonField != "" || *normalizeEOL) {
+		exitWithCode(exitUsage, "--line-comment cannot be combined with --json-field or --normalize-eol")
+	}
+
+	if *signatureFlag != "" && *signatureFile != "" {
+		exitWithCode(exitUsage, "--signature and --signature-file cannot be combined")
+	}
+	detached := *signatureFlag != "" || *signatureFile != ""
+	if detached && *offsetFlag < 0 {
+		exitWithCode(exitUsage, "--signature and --signature-file require --offset")
+	}
+	if detached && (*jsonField != "" || *normalizeEOL || *lineComment) {
+		exitWithCode(exitUsage, "--signature and --signature-file cannot be combined with --json-field, --normalize-eol or --line-comment")
+	}
+
+	if *useAgent != (*fingerprint != "") {
+		exitWithCode(exitUsage, "--agent and --fingerprint must be used together")
+	}
+
+	if len(pubKeyFiles) == 0 && !*useAgent {
+		exitWithCode(exitUsage, "flag -k (--pubkey) with public key file (or --agent) is required")
+	}
+
+	if *emitOriginal && *outputFile == "" {
+		exitWithCode(exitUsage, "flag -o (--output) is required with --emit-original")
+	}
+	if !*emitOriginal && *outputFile != "" {
+		exitWithCode(exitUsage, "flag -o (--output) is only valid with --emit-original")
 	}
 
 	// Get input file from remaining arguments
 	if verifyCmd.NArg() != 1 {
-		exitWithError("input file is required")
+		exitWithCode(exitUsage, "input file is required")
 	}
 	inputFile := verifyCmd.Arg(0)
 
-	// Read the input file
-	inputData, err := os.ReadFile(inputFile)
-	if err != nil {
-		exitWithError("reading input file: %v", err)
+	if (*tsaToken != "" || *tsaCA != "") && !*tsaVerify {
+		exitWithCode(exitUsage, "--tsa-token and --tsa-ca are only valid with --tsa-verify")
+	}
+	tokenFile := *tsaToken
+	if *tsaVerify && tokenFile == "" {
+		if inputFile == stdinPath || isRemotePath(inputFile) {
+			exitWithCode(exitUsage, "--tsa-verify needs --tsa-token when the signed file is stdin or a URL")
+		}
+		tokenFile = inputFile + appconfig.TimestampSuffix
+	}
+
+	// Key ID tags live in placeholders, which neither detached format has
+	if mc.KeyID && (*sshsigFile != "" || *manifestFile != "") {
+		exitWithCode(exitUsage, "--key-id cannot be combined with --sshsig or --manifest")
+	}
+
+	// With --sshsig the file is checked against a signature made as ssh-keygen would
+	if *namespace != defaultSSHSigNamespace && *sshsigFile == "" {
+		exitWithCode(exitUsage, "--namespace is only valid with --sshsig")
+	}
+	if *sshsigFile != "" {
+		if *manifestFile != "" || *emitOriginal || *jsonOutput || *offsetFlag >= 0 || *requireAll || *jsonField != "" || *normalizeEOL || *lineComment || *principal != "" || *allowedFingerprints != "" || *allowRemote || detached || *tsaVerify || *sidecar {
+			exitWithCode(exitUsage, "--sshsig cannot be combined with --sidecar, --manifest, --emit-original, --json, --offset, --require-all, --json-field, --normalize-eol, --line-comment, --principal, --allowed-fingerprints, --allow-remote, --signature, --signature-file or --tsa-verify")
+		}
+		agentFingerprint := ""
+		if *useAgent {
+			agentFingerprint = *fingerprint
+		}
+		pubKeys, keyNames := loadPublicKeys(pubKeyFiles, agentFingerprint, *quiet, exitWithCode)
+		verifySSHSig(*sshsigFile, *namespace, inputFile, pubKeys, keyNames, *quiet, *maxFileSize)
+		return
 	}
 
-	// Extract the signature from the file
-	signatureStart := strings.Index(string(inputData), appconfig.SignaturePrefix)
-	if signatureStart == -1 {
-		exitWithError("file does not contain a signature")
+	// With --sidecar the file is checked as it is against the signature next to it
+	if *sidecar {
+		if *manifestFile != "" || *emitOriginal || *jsonOutput || *offsetFlag >= 0 || *requireAll || *jsonField != "" || *normalizeEOL || *lineComment || *principal != "" || *allowedFingerprints != "" || *allowRemote || detached || *tsaVerify {
+			exitWithCode(exitUsage, "--sidecar cannot be combined with --manifest, --emit-original, --json, --offset, --require-all, --json-field, --normalize-eol, --line-comment, --principal, --allowed-fingerprints, --allow-remote, --signature, --signature-file or --tsa-verify")
+		}
+		if inputFile == stdinPath || isRemotePath(inputFile) {
+			exitWithCode(exitUsage, "--sidecar needs a named input file to find the sidecar next to")
+		}
+		agentFingerprint := ""
+		if *useAgent {
+			agentFingerprint = *fingerprint
+		}
+		pubKeys, keyNames := loadPublicKeys(pubKeyFiles, agentFingerprint, *quiet, exitWithCode)
+		verifySidecar(inputFile, pubKeys, keyNames, mc, *quiet, *maxFileSize)
+		return
 	}
 
-	// The signature is the full 92 characters (matching MagicString length)
-	signature := string(inputData[signatureStart:signatureStart+len(appconfig.MagicString)])
+	// With --manifest the argument is the directory the manifest covers
+	if *manifestFile != "" {
+		if *emitOriginal || *jsonOutput || *offsetFlag >= 0 || *requireAll || *jsonField != "" || *normalizeEOL || *lineComment || *principal != "" || *allowedFingerprints != "" || detached || *tsaVerify {
+			exitWithCode(exitUsage, "--manifest cannot be combined with --emit-original, --json, --offset, --require-all, --json-field, --normalize-eol, --line-comment, --principal, --allowed-fingerprints, --signature, --signature-file or --tsa-verify")
+		}
+		agentFingerprint := ""
+		if *useAgent {
+			agentFingerprint = *fingerprint
+		}
+		pubKeys, keyNames := loadPublicKeys(pubKeyFiles, agentFingerprint, *quiet, exitWithCode)
+		verifyManifest(*manifestFile, inputFile, pubKeys, keyNames, mc, *quiet, *maxFileSize)
+		return
+	}
 
-	// Remove the prefix from the signature
-	signatureWithoutPrefix := signature[len(appconfig.SignaturePrefix):]
+	// Standard input can feed only one of the key or the signed file
+	stdinUsers := 0
+	for _, path := range append([]string{inputFile}, pubKeyFiles...) {
+		if path == stdinPath {
+			stdinUsers++
+		}
+	}
+	if stdinUsers > 1 {
+		exitWithCode(exitUsage, "only one of the public key and the signed file may be read from stdin (-)")
+	}
 
-	// Decode the base64 signature
-	decodedSig, err := base64.StdEncoding.DecodeString(signatureWithoutPrefix)
+	// Read the input file. A URL is only fetched when explicitly allowed, so
+	// a path taken from untrusted input can't make verify issue requests.
+	var inputData []byte
+	var inputPerm os.FileMode
+	var err error
+	if isRemotePath(inputFile) {
+		if !*allowRemote {
+			exitWithCode(exitUsage, "%s is a URL; pass --allow-remote to fetch it", inputFile)
+		}
+		if *maxFetchSize <= 0 {
+			exitWithCode(exitUsage, "--max-fetch-size must be positive")
+		}
+		inputData, err = fetchRemote(inputFile, *fetchTimeout, *maxFetchSize)
+		inputPerm = stdinFileMode
+	} else {
+		inputData, inputPerm, err = readFileOrStdinWithMode(inputFile, *maxFileSize)
+	}
 	if err != nil {
-		exitWithError("decoding signature: %v", err)
+		exitWithCode(exitIO, "reading input file: %v", err)
 	}
 
-	// Read and parse the public key
-	pubKeyData, err := os.ReadFile(*pubKeyFile)
+	// A gzip-compressed file is verified by its decompressed contents, which are what was signed
+	inputData, gzipped, err := gunzipIfCompressed(inputData)
 	if err != nil {
-		exitWithError("reading public key file: %v", err)
+		exitWithCode(exitIO, "%v", err)
 	}
-	
-	// Parse the public key
-	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubKeyData)
+
+	debugf("read %s (%d bytes, gzip %v)", inputFile, len(inputData), gzipped)
+
+	// From here on every outcome, including failures, reports the format and offsets
+	report := &verifyReport{
+		File:    inputFile,
+		Format:  formatName(appconfig.DetectFormat(inputData)),
+		Gzipped: gzipped,
+		Slots:   []slotReport{},
+	}
+
+	fail := func(code int, format string, args ...interface{}) {
+		if *jsonOutput {
+			report.Error = fmt.Sprintf(format, args...)
+			printJSONReport(report)
+			os.Exit(code)
+		}
+		exitWithCode(code, format, args...)
+	}
+	if !silent {
+		if gzipped {
+			fmt.Printf("Format: %s (gzip-compressed)\n", report.Format)
+		} else {
+			fmt.Printf("Format: %s\n", report.Format)
+		}
+	}
+
+	// With --json-field the file is verified in its canonical JSON form, which
+	// is what was signed, so reordered keys or changed whitespace don't matter.
+	// Offsets from here on refer to that form.
+	if *jsonField != "" {
+		canonical, value, err := appconfig.CanonicalizeJSONField(inputData, *jsonField)
+		if err != nil {
+			fail(exitMagic, "%v", err)
+		}
+		if !strings.HasPrefix(value, mc.Prefix) {
+			fail(exitMagic, "JSON field %q does not hold a signature", *jsonField)
+		}
+		inputData = canonical
+	}
+
+	// Where the format bounds the placeholder, its length picks the signature layout
+	mc, err = mc.sizedFor(inputData)
 	if err != nil {
-		exitWithError("parsing public key: %v", err)
+		fail(exitMagic, "%v", err)
 	}
 
-	// Create a copy of inputData with the original magic string
-	verificationData := make([]byte, len(inputData))
-	copy(verificationData, inputData)
+	// Locate every signature slot in the file, or take the one the caller named.
+	// A signature given on the command line is checked against the file as it
+	// is, which must be exactly what was signed, at the given offset.
+	var slots []slot
+	if detached {
+		encoded := *signatureFlag
+		if *signatureFile != "" {
+			data, err := os.ReadFile(*signatureFile)
+			if err != nil {
+				fail(exitIO, "reading signature file: %v", err)
+			}
+			encoded = strings.TrimSpace(string(data))
+		}
+		signature, keyID, err := decodeSignature(encoded, mc)
+		if err != nil {
+			fail(exitUsage, "%v", err)
+		}
+		if *offsetFlag > int64(len(inputData)) {
+			fail(exitUsage, "offset %d is outside the file (size %d)", *offsetFlag, len(inputData))
+		}
+		slots = []slot{{Offset: *offsetFlag, Filled: true, Signature: signature, KeyID: keyID}}
+	} else if *offsetFlag >= 0 {
+		s, err := slotAt(inputData, *offsetFlag, mc)
+		if err != nil {
+			fail(exitMagic, "signature at offset: %v", err)
+		}
+		slots = []slot{s}
+	} else {
+		slots, err = locateSlots(inputData, mc)
+		if err != nil {
+			fail(exitMagic, "locating signature: %v", err)
+		}
+	}
+	filled := 0
+	for _, s := range slots {
+		debugf("magic found at offset %d (signed %v)", s.Offset, s.Filled)
+		report.Slots = append(report.Slots, slotReport{Offset: s.Offset, Signed: s.Filled})
+		if s.Filled {
+			filled++
+		}
+	}
+	if len(slots) == 1 && !silent {
+		fmt.Printf("Signature offset: %d\n", slots[0].Offset)
+	}
+	if filled == 0 {
+		if version, ok := findForeignSignatureVersion(inputData); ok {
+			fail(exitFailure, "%v: file is signed with format version %d, this build supports %d",
+				unisign.ErrUnsupportedFormatVersion, version, unisign.SignatureVersion)
+		}
+		if algo, ok := findForeignSignatureAlgorithm(inputData); ok {
+			fail(exitFailure, "file is signed with %s, this build verifies only ed25519 signatures", algo)
+		}
+		if hasTruncatedSlot(inputData, mc) {
+			fail(exitMagic, "%v", errSignatureTruncated)
+		}
+		fail(exitMagic, "file does not contain a signature")
+	}
+	if filled > maxSignatureCandidates {
+		fail(exitMagic, "too many signature candidates (%d, limit %d)", filled, maxSignatureCandidates)
+	}
+
+	agentFingerprint := ""
+	if *useAgent {
+		agentFingerprint = *fingerprint
+	}
+	pubKeys, keyNames := loadPublicKeys(pubKeyFiles, agentFingerprint, silent, fail)
+	debugf("loaded %d public keys", len(pubKeys))
+	var allowed map[string]bool
+	if *allowedFingerprints != "" {
+		if allowed, err = loadAllowedFingerprints(*allowedFingerprints); err != nil {
+			fail(exitIO, "reading --allowed-fingerprints: %v", err)
+		}
+		debugf("loaded %d allowed fingerprints", len(allowed))
+	}
+
+	// prepare returns the file with the restore slots swapped back to the
+	// placeholder, together with what the signatures cover: with
+	// --normalize-eol a CRLF-to-LF copy, where each slot's offset moves by
+	// shift, and with --line-comment the file without the signature's
+	// comment line, and no offset within it. A detached signature covers the
+	// file unmodified, so nothing is restored.
+	prepare := func(restore []slot) ([]byte, []byte, func(int64) int64) {
+		original := inputData
+		if !detached {
+			original, err = restoreSlots(inputData, restore, mc)
+			if errors.Is(err, errInvalidSignatureRegion) {
+				fail(exitMagic, "%v", err)
+			}
+			if err != nil {
+				fail(exitFailure, "replacing signature with magic string: %v", err)
+			}
+		}
+		data, shift := original, func(offset int64) int64 { return offset }
+		if *normalizeEOL {
+			data, shift = normalizeLineEndings(original, slots, len(mc.Magic), 0)
+		}
+		if *lineComment {
+			data, err = removeCommentLine(original, slots[0].Offset, len(mc.Magic), 0)
+			if err != nil {
+				fail(exitMagic, "%v", err)
+			}
+			shift = func(int64) int64 { return lineCommentOffset }
+		}
+		return original, data, shift
+	}
 
-	// Replace the signature in the verification data with the original magic string
+	if *normalizeEOL && !silent {
+		fmt.Println("Verifying with line endings normalized (CRLF -> LF)")
+	}
+	if *lineComment {
+		if len(slots) != 1 {
+			fail(exitMagic, "--line-comment needs a file with a single signature slot (found %d)", len(slots))
+		}
+		if !silent {
+			fmt.Println("Verifying without the signature's comment line")
+		}
+	}
+
+	// Restore every signed slot to the original magic string
 	// (This simulates the file before it was signed)
-	err = unisign.ReplaceMagicAtOffset(verificationData, int64(signatureStart), 
-		[]byte(appconfig.MagicString), []byte(signature))
-	if err != nil {
-		exitWithError("replacing signature with magic string: %v", err)
+	allOriginal, allData, allShift := prepare(slots)
+	var originalData []byte
+
+	// Verify each filled slot against the key set. A filled slot is only a
+	// candidate: the prefix may also occur in unrelated content, so by default
+	// one verified slot is enough and the rest are reported as unverified.
+	failed := 0
+	var failedOffset int64
+	var verifiedSignatures [][]byte
+	now := time.Now()
+	for i, s := range slots {
+		if !s.Filled {
+			if len(slots) > 1 && !silent {
+				fmt.Printf("Slot %d (offset %d): unsigned\n", i, s.Offset)
+			}
+			continue
+		}
+
+		// With --principal a key only counts if it is a certificate
+		// authorizing that principal, so a plain key or an expired
+		// certificate for the same signer doesn't satisfy it. With
+		// --allowed-fingerprints it must also be on the list. With --key-id
+		// the key the slot's tag names is tried first.
+		matched := -1
+		var info unisign.VerifyInfo
+		var principalErr, allowedErr error
+		order := unisign.OrderByKeyID(pubKeys, s.KeyID)
+		if s.KeyID != nil {
+			if bytes.Equal(unisign.KeyID(pubKeys[order[0]]), s.KeyID) {
+				debugf("key ID %x names %s, trying it first", s.KeyID, keyNames[order[0]])
+			} else {
+				debugf("key ID %x matches none of the keys, trying them all", s.KeyID)
+			}
+		}
+
+		// A signature made with --slot covers the file with every slot
+		// restored. One made without it covers the file with only its own
+		// slot restored, so other prefix look-alikes are signed as they
+		// stand; with several candidates, that is tried next.
+		original, data, shift := allOriginal, allData, allShift
+	views:
+		for view := 0; view < 2; view++ {
+			if view == 1 {
+				if filled == 1 || detached {
+					break
+				}
+				debugf("trying the signature at offset %d with only its own slot restored", s.Offset)
+				original, data, shift = prepare([]slot{s})
+			}
+			for _, k := range order {
+				pubKey := pubKeys[k]
+				var err error
+				if info, err = unisign.VerifyDetailed(pubKey, data, uint64(shift(s.Offset)), s.Signature); err != nil {
+					continue
+				}
+				if *principal != "" {
+					if err := checkCertificatePrincipal(pubKey, *principal, now); err != nil {
+						principalErr = fmt.Errorf("%s: %v", keyNames[k], err)
+						continue
+					}
+				}
+				if allowed != nil && !allowed[info.Fingerprint] {
+					debugf("signature at offset %d verified with %s, but %s is not allowed", s.Offset, keyNames[k], info.Fingerprint)
+					allowedErr = fmt.Errorf("%s has fingerprint %s", keyNames[k], info.Fingerprint)
+					continue
+				}
+				matched = k
+				break views
+			}
+		}
+		if matched == -1 && principalErr != nil {
+			fail(exitVerify, "signature at offset %d is valid but not authorized for principal %q: %v", s.Offset, *principal, principalErr)
+		}
+		if matched == -1 && allowedErr != nil {
+			fail(exitVerify, "signature at offset %d is valid but its key is not in --allowed-fingerprints: %v", s.Offset, allowedErr)
+		}
+
+		if matched == -1 {
+			debugf("signature at offset %d (%d bytes) did not verify with any of %d keys", s.Offset, len(s.Signature), len(pubKeys))
+			failed++
+			failedOffset = s.Offset
+			if len(slots) > 1 && !silent {
+				fmt.Fprintf(os.Stderr, "Slot %d (offset %d): signature verification failed\n", i, s.Offset)
+			}
+			continue
+		}
+		debugf("signature at offset %d (%d bytes) verified with %s", s.Offset, len(s.Signature), keyNames[matched])
+		debugf("length check: header covers %d bytes, verified data is %d bytes", info.Header.Length, len(data))
+		verifiedSignatures = append(verifiedSignatures, s.Signature)
+		if originalData == nil {
+			originalData = original
+		}
+		report.Slots[i].Verified = true
+		report.Slots[i].Key = keyNames[matched]
+		report.Slots[i].KeyType = info.KeyType
+		report.Slots[i].Fingerprint = info.Fingerprint
+		report.Slots[i].SignedLength = info.Header.Length
+		if !silent {
+			if len(slots) > 1 {
+				fmt.Printf("Slot %d (offset %d): verified with %s (%s %s)\n", i, s.Offset, keyNames[matched], info.KeyType, info.Fingerprint)
+			} else {
+				fmt.Printf("Signed by %s key %s over %d bytes\n", info.KeyType, info.Fingerprint, info.Header.Length)
+			}
+		}
+		if cert, ok := pubKeys[matched].(*ssh.Certificate); ok {
+			report.Slots[i].Certificate = describeCertificate(cert)
+			if !silent {
+				fmt.Printf("Slot %d (offset %d): signed under certificate %s\n", i, s.Offset, report.Slots[i].Certificate)
+			}
+		}
+		if *principal != "" {
+			report.Slots[i].Principal = *principal
+			if !silent {
+				fmt.Printf("Slot %d (offset %d): certificate authorizes principal %s\n", i, s.Offset, *principal)
+			}
+		}
+		if allowed != nil && !silent {
+			fmt.Printf("Slot %d (offset %d): fingerprint %s is allowed\n", i, s.Offset, info.Fingerprint)
+		}
+	}
+	if *requireAll && failed > 0 {
+		fail(exitVerify, "signature verification failed for %d of %d signed slot(s)", failed, filled)
+	}
+	if failed == filled {
+		if filled == 1 {
+			fail(exitVerify, "signature verification failed at offset %d", failedOffset)
+		}
+		fail(exitVerify, "signature verification failed for all %d signature candidates", filled)
 	}
 
-	// Verify the signature
-	err = unisign.VerifySignature(pubKey, verificationData, uint64(signatureStart), decodedSig)
-	if err != nil {
-		exitWithError("signature verification failed: %v", err)
+	// With --tsa-verify a verified signature must also carry a timestamp
+	// token from a TSA that chains to the trusted roots
+	if *tsaVerify {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			fail(exitIO, "reading timestamp token: %v", err)
+		}
+		roots, err := loadTSARoots(*tsaCA)
+		if err != nil {
+			fail(exitIO, "loading TSA roots: %v", err)
+		}
+		ts, err := verifyTimestampToken(token, roots, verifiedSignatures)
+		if err != nil {
+			fail(exitVerify, "timestamp verification failed: %v", err)
+		}
+		report.Timestamp = ts.Time.UTC().Format(time.RFC3339)
+		report.TSA = ts.Signer.Subject.String()
+		if !silent {
+			fmt.Printf("Timestamp: %s (TSA %s)\n", report.Timestamp, report.TSA)
+		}
 	}
+	report.Verified = true
 
+	// Only emit the reconstructed original once the signature has been verified
+	if *emitOriginal {
+		if err := appconfig.WriteFileMode(*outputFile, originalData, inputPerm); err != nil {
+			fail(exitIO, "writing original file: %v", err)
+		}
+		debugf("wrote %s (%d bytes)", *outputFile, len(originalData))
+		report.Original = *outputFile
+	}
+
+	if *jsonOutput {
+		printJSONReport(report)
+		return
+	}
+	if *quiet {
+		return
+	}
 	fmt.Println("Signature verified successfully.")
+	if *emitOriginal {
+		fmt.Printf("Original written to: %s\n", *outputFile)
+	}
 } 
\ No newline at end of file
@@ -1,10 +1,26 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	appconfig "unisign/internal/unisign"
+	"unisign/pkg/placeholder"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 func TestVerifySignature(t *testing.T) {
@@ -60,4 +76,1098 @@ func TestVerifySignature(t *testing.T) {
 	if err == nil {
 		t.Errorf("verification with wrong key should have failed but succeeded")
 	}
-} 
\ No newline at end of file
+}
+
+func TestVerifyEmitOriginal(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	// Emitting the original after a successful verification should reproduce the input
+	originalPath := filepath.Join(tmpDir, "original")
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", "--emit-original", "-o", originalPath, signedPath)
+	cmd.Dir = "."
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+
+	want, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("failed to read input file: %v", err)
+	}
+	got, err := os.ReadFile(originalPath)
+	if err != nil {
+		t.Fatalf("failed to read emitted original: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("emitted original does not match the pre-sign input")
+	}
+
+	// A failed verification must not produce an original
+	wrongKeyPath := generateTestKey(t, tmpDir, "wrong_key")
+	wrongOriginalPath := filepath.Join(tmpDir, "wrong_original")
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", wrongKeyPath+".pub", "--emit-original", "-o", wrongOriginalPath, signedPath)
+	cmd.Dir = "."
+	if output, err = cmd.CombinedOutput(); err == nil {
+		t.Fatalf("verification with wrong key should have failed\nOutput: %s", output)
+	}
+	if _, err := os.Stat(wrongOriginalPath); !os.IsNotExist(err) {
+		t.Errorf("original was written despite failed verification")
+	}
+}
+
+func TestVerifyLongFlags(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	wrongKeyPath := generateTestKey(t, tmpDir, "wrong_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".", "sign", "--key", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	verify := func(args ...string) (string, error) {
+		cmd := exec.Command("go", append([]string{"run", ".", "verify"}, args...)...)
+		cmd.Dir = "."
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+
+	for _, flagName := range []string{"--pubkey", "--key"} {
+		if output, err := verify(flagName, keyPath+".pub", signedPath); err != nil || !strings.Contains(output, "Signature verified successfully.") {
+			t.Errorf("verify %s failed: %v\nOutput: %s", flagName, err, output)
+		}
+	}
+
+	// The forms add to one list of keys, so they can be mixed
+	if output, err := verify("-k", wrongKeyPath+".pub", "--pubkey", keyPath+".pub", signedPath); err != nil {
+		t.Errorf("verifying with -k and --pubkey failed: %v\nOutput: %s", err, output)
+	}
+
+	// --output is -o for --emit-original
+	originalPath := filepath.Join(tmpDir, "original")
+	if output, err := verify("--pubkey", keyPath+".pub", "--emit-original", "--output", originalPath, signedPath); err != nil {
+		t.Fatalf("verifying with --output failed: %v\nOutput: %s", err, output)
+	}
+	want, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("failed to read input file: %v", err)
+	}
+	if got, err := os.ReadFile(originalPath); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("--output did not receive the original: %v", err)
+	}
+	if output, err := verify("--pubkey", keyPath+".pub", "--output", originalPath, signedPath); err == nil || !strings.Contains(output, "flag -o (--output) is only valid with --emit-original") {
+		t.Errorf("--output without --emit-original: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestVerifyZipIgnoresDecoySignature(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// Store an entry uncompressed whose content looks exactly like a signature
+	decoy := appconfig.SignaturePrefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xAB}, 64))
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "decoy.txt", Method: zip.Store})
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	writer.Write([]byte(decoy))
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("failed to close zip writer: %v", err)
+	}
+	zipPath := filepath.Join(tmpDir, "archive.zip")
+	if err := os.WriteFile(zipPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+
+	preparedPath := filepath.Join(tmpDir, "archive.prepared.zip")
+	for _, args := range [][]string{
+		{"inject-placeholder", "-o", preparedPath, zipPath},
+		{"sign", "-k", keyPath, preparedPath},
+		{"verify", "-k", keyPath + ".pub", preparedPath + ".signed"},
+	} {
+		cmd := exec.Command("go", "run", ".")
+		cmd.Args = append(cmd.Args, args...)
+		cmd.Dir = "."
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\nOutput: %s", args[0], err, output)
+		}
+	}
+}
+
+func TestVerifyUnsupportedFormatVersion(t *testing.T) {
+	// The embedded prefix carries the format version
+	if want := fmt.Sprintf("us%d-", unisign.SignatureVersion); appconfig.SignaturePrefix != want {
+		t.Fatalf("SignaturePrefix = %q, want %q", appconfig.SignaturePrefix, want)
+	}
+
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	// Pretend the file was signed by a future unisign
+	signedData, err := os.ReadFile(inputPath + ".signed")
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	futurePath := filepath.Join(tmpDir, "future.signed")
+	futureData := bytes.Replace(signedData, []byte(appconfig.SignaturePrefix), []byte("us9-"), 1)
+	if err := os.WriteFile(futurePath, futureData, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", futurePath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("verification of an unknown format version should fail")
+	}
+	if !bytes.Contains(output, []byte("unsupported signature format version")) {
+		t.Errorf("expected an unsupported version error, got: %s", output)
+	}
+
+	// An unsigned placeholder from version 1 is not a version 1 signature
+	oldPath := filepath.Join(tmpDir, "old_placeholder")
+	oldPlaceholder := "us1-" + strings.TrimPrefix(appconfig.MagicString, appconfig.SignaturePrefix)
+	if err := os.WriteFile(oldPath, []byte("0123456789"+oldPlaceholder+"rest of file"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", oldPath)
+	cmd.Dir = "."
+	output, err = cmd.CombinedOutput()
+	if err == nil || !bytes.Contains(output, []byte("file does not contain a signature")) {
+		t.Errorf("expected no signature to be found, got: %v\n%s", err, output)
+	}
+}
+
+func TestVerifyForeignSignatureAlgorithm(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// A file signed with RSA-2048 announces it through the "ur2-" prefix
+	signature := placeholder.RSAPrefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x5a}, 256))
+	inputPath := filepath.Join(tmpDir, "rsa.signed")
+	if err := os.WriteFile(inputPath, []byte("0123456789"+signature+"rest of file"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err == nil || !bytes.Contains(output, []byte("file is signed with rsa-2048")) {
+		t.Errorf("expected the RSA signature to be reported, got: %v\n%s", err, output)
+	}
+}
+
+func TestVerifyPublicKeyFromStdin(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	pubKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", "-", signedPath)
+	cmd.Dir = "."
+	cmd.Stdin = bytes.NewReader(pubKey)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification with key on stdin failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Signature verified successfully")) {
+		t.Errorf("verification output did not indicate success: %s", output)
+	}
+
+	// The key and the signed file can't both come from stdin
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", "-", "-")
+	cmd.Dir = "."
+	cmd.Stdin = bytes.NewReader(pubKey)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("verify with both key and file on stdin should fail\nOutput: %s", output)
+	}
+}
+
+func TestVerifyReportsFormatAndOffset(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	offset := int64(bytes.Index(signed, []byte(appconfig.SignaturePrefix)))
+
+	// Human output names the format and offset
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", signedPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Format: raw")) || !bytes.Contains(output, []byte(fmt.Sprintf("Signature offset: %d", offset))) {
+		t.Errorf("verify output lacks format or offset: %s", output)
+	}
+
+	// JSON output still reports both when verification fails
+	wrongKeyPath := generateTestKey(t, tmpDir, "wrong_key")
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "--json", "-k", wrongKeyPath+".pub", signedPath)
+	cmd.Dir = "."
+	output, err = cmd.Output()
+	if err == nil {
+		t.Fatalf("verification with wrong key should have failed\nOutput: %s", output)
+	}
+
+	var report verifyReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		t.Fatalf("failed to parse JSON report: %v\nOutput: %s", err, output)
+	}
+	if report.Verified || report.Error == "" {
+		t.Errorf("report should record the failure: %+v", report)
+	}
+	if report.Format != "raw" {
+		t.Errorf("format = %q, want raw", report.Format)
+	}
+	if len(report.Slots) != 1 || report.Slots[0].Offset != offset || !report.Slots[0].Signed {
+		t.Errorf("unexpected slots: %+v", report.Slots)
+	}
+}
+
+func TestVerifyTruncatedSignature(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// A prefix followed by fewer than 88 bytes cannot hold a complete signature
+	truncatedPath := filepath.Join(tmpDir, "truncated")
+	content := "some content\n" + appconfig.SignaturePrefix + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	if err := os.WriteFile(truncatedPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", truncatedPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("verification of a truncated signature should have failed\nOutput: %s", output)
+	}
+	if bytes.Contains(output, []byte("panic")) {
+		t.Fatalf("verify panicked on a truncated signature:\n%s", output)
+	}
+	if !bytes.Contains(output, []byte("signature truncated or prefix matched near EOF")) {
+		t.Errorf("expected a truncation error, got: %s", output)
+	}
+}
+
+func TestVerifySkipsDecoySignature(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// Documentation text quoting a signature-shaped string ahead of the real placeholder
+	decoy := appconfig.SignaturePrefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x42}, 64))
+	inputPath := filepath.Join(tmpDir, "release")
+	content := "Signatures look like " + decoy + "\n" + appconfig.MagicString + "\n"
+	if err := os.WriteFile(inputPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", signedPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification should succeed past the decoy: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Slot 0")) || !bytes.Contains(output, []byte("Slot 1")) {
+		t.Errorf("verify output does not report both candidates: %s", output)
+	}
+
+	// Requiring every candidate to verify rejects the decoy
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "--require-all", "-k", keyPath+".pub", signedPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("--require-all should fail on the decoy\nOutput: %s", output)
+	}
+}
+
+func TestVerifyAtOffset(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	// sign reports the offset it used so it can be fed back to verify
+	var offset int64
+	for _, line := range strings.Split(string(output), "\n") {
+		if _, err := fmt.Sscanf(line, "Signature offset: %d", &offset); err == nil {
+			break
+		}
+	}
+	if offset == 0 {
+		t.Fatalf("sign output does not report the offset: %s", output)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", "--offset", fmt.Sprint(offset), signedPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("verification at offset %d failed: %v\nOutput: %s", offset, err, output)
+	}
+
+	// An offset that doesn't start with the prefix is rejected
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", "--offset", fmt.Sprint(offset+1), signedPath)
+	cmd.Dir = "."
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("verification at a wrong offset should have failed\nOutput: %s", output)
+	}
+	if !bytes.Contains(output, []byte("no signature prefix")) {
+		t.Errorf("expected a missing-prefix error, got: %s", output)
+	}
+}
+
+func TestVerifyGzipInput(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signed, err := os.ReadFile(inputPath + ".signed")
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(signed)
+	zw.Close()
+
+	gzPath := filepath.Join(tmpDir, "test_input.signed.gz")
+	if err := os.WriteFile(gzPath, compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write gzip file: %v", err)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", gzPath)
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification of gzip input failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("gzip-compressed")) {
+		t.Errorf("verify output does not mention the compression: %s", output)
+	}
+
+	// A truncated gzip stream is reported as such
+	truncatedPath := filepath.Join(tmpDir, "truncated.gz")
+	if err := os.WriteFile(truncatedPath, compressed.Bytes()[:compressed.Len()/2], 0644); err != nil {
+		t.Fatalf("failed to write truncated gzip file: %v", err)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Args = append(cmd.Args, "verify", "-k", keyPath+".pub", truncatedPath)
+	cmd.Dir = "."
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("verification of truncated gzip input should have failed\nOutput: %s", output)
+	}
+	if !bytes.Contains(output, []byte("gzip input is truncated")) {
+		t.Errorf("expected a truncation error, got: %s", output)
+	}
+}
+
+// startTestAgent serves an in-memory SSH agent holding the private key at
+// keyPath and returns its socket path
+func startTestAgent(t *testing.T, dir, keyPath string) string {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	rawKey, err := ssh.ParseRawPrivateKey(keyData)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: rawKey}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on agent socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return socket
+}
+
+func TestVerifyWithSSHAgent(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	otherKeyPath := generateTestKey(t, tmpDir, "other_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	fingerprintOf := func(path string) string {
+		pubKeyData, err := os.ReadFile(path + ".pub")
+		if err != nil {
+			t.Fatalf("failed to read public key: %v", err)
+		}
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubKeyData)
+		if err != nil {
+			t.Fatalf("failed to parse public key: %v", err)
+		}
+		return ssh.FingerprintSHA256(pubKey)
+	}
+	socket := startTestAgent(t, tmpDir, keyPath)
+
+	runVerify := func(env []string, args ...string) ([]byte, error) {
+		cmd := exec.Command("go", "run", ".", "verify")
+		cmd.Args = append(cmd.Args, args...)
+		cmd.Args = append(cmd.Args, signedPath)
+		cmd.Env = append(os.Environ(), env...)
+		return cmd.CombinedOutput()
+	}
+
+	// The signing key is in the agent
+	output, err := runVerify([]string{"SSH_AUTH_SOCK=" + socket}, "--agent", "--fingerprint", fingerprintOf(keyPath))
+	if err != nil {
+		t.Fatalf("verification with agent key failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Signature verified successfully")) {
+		t.Errorf("verification output did not indicate success: %s", output)
+	}
+
+	// A fingerprint the agent doesn't hold
+	output, err = runVerify([]string{"SSH_AUTH_SOCK=" + socket}, "--agent", "--fingerprint", fingerprintOf(otherKeyPath))
+	if err == nil {
+		t.Fatalf("verification with unknown fingerprint should have failed\nOutput: %s", output)
+	}
+	if !bytes.Contains(output, []byte("is loaded in the SSH agent")) {
+		t.Errorf("expected a missing fingerprint error, got: %s", output)
+	}
+
+	// No agent at all
+	output, err = runVerify([]string{"SSH_AUTH_SOCK="}, "--agent", "--fingerprint", fingerprintOf(keyPath))
+	if err == nil {
+		t.Fatalf("verification without an agent should have failed\nOutput: %s", output)
+	}
+	if !bytes.Contains(output, []byte("no SSH agent available")) {
+		t.Errorf("expected a missing agent error, got: %s", output)
+	}
+
+	// --agent without --fingerprint
+	output, err = runVerify([]string{"SSH_AUTH_SOCK=" + socket}, "--agent")
+	if err == nil {
+		t.Fatalf("--agent without --fingerprint should have failed\nOutput: %s", output)
+	}
+}
+
+func TestVerifyAuthorizedKeysFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	var keyPaths []string
+	for _, name := range []string{"alice", "bob", "carol"} {
+		keyPaths = append(keyPaths, generateTestKey(t, tmpDir, name))
+	}
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+
+	// Sign with the last key in the file
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPaths[2], inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	keysFile := "# release signers\n\n"
+	for _, keyPath := range keyPaths {
+		pubKey, err := os.ReadFile(keyPath + ".pub")
+		if err != nil {
+			t.Fatalf("failed to read public key: %v", err)
+		}
+		keysFile += "# " + filepath.Base(keyPath) + "\n" + string(pubKey) + "\n"
+	}
+	keysPath := filepath.Join(tmpDir, "authorized_keys")
+	if err := os.WriteFile(keysPath, []byte(keysFile), 0644); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keysPath, signedPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+	textOutput := output
+	if !bytes.Contains(output, []byte("Loaded 3 public keys from "+keysPath)) {
+		t.Errorf("verify should report the number of keys loaded: %s", output)
+	}
+	if !bytes.Contains(output, []byte("Signature verified successfully")) {
+		t.Errorf("verification output did not indicate success: %s", output)
+	}
+
+	// The JSON report names the key within the file that matched
+	cmd = exec.Command("go", "run", ".", "verify", "--json", "-k", keysPath, signedPath)
+	output, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, output)
+	}
+	var report verifyReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		t.Fatalf("failed to parse JSON report: %v\nOutput: %s", err, output)
+	}
+	if len(report.Slots) != 1 || report.Slots[0].Key != keysPath+"#3" {
+		t.Fatalf("report slots = %+v, want key %s#3", report.Slots, keysPath)
+	}
+
+	// It also identifies the signing key and the signed length
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	slot := report.Slots[0]
+	if slot.KeyType != "ssh-ed25519" || !strings.HasPrefix(slot.Fingerprint, "SHA256:") || slot.SignedLength != uint64(len(signed)) {
+		t.Errorf("slot reports key %q %q over %d bytes, want an ssh-ed25519 fingerprint over %d bytes",
+			slot.KeyType, slot.Fingerprint, slot.SignedLength, len(signed))
+	}
+	if !bytes.Contains(textOutput, []byte("Signed by ssh-ed25519 key "+slot.Fingerprint)) {
+		t.Errorf("verify output does not identify the signing key: %s", textOutput)
+	}
+}
+
+func TestVerifyPrincipal(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	caPath := generateTestKey(t, tmpDir, "ca")
+	issue := func(name, validity string) string {
+		t.Helper()
+		pubPath := filepath.Join(tmpDir, name+".pub")
+		pubData, err := os.ReadFile(keyPath + ".pub")
+		if err != nil {
+			t.Fatalf("failed to read public key: %v", err)
+		}
+		if err := os.WriteFile(pubPath, pubData, 0644); err != nil {
+			t.Fatalf("failed to copy public key: %v", err)
+		}
+		cmd := exec.Command("ssh-keygen", "-s", caPath, "-I", name, "-n", "release@corp", "-V", validity, pubPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("failed to sign certificate: %v\n%s", err, output)
+		}
+		return filepath.Join(tmpDir, name+"-cert.pub")
+	}
+	validCert := issue("valid", "-1h:+1h")
+	expiredCert := issue("expired", "20200101:20200102")
+
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	verify := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", append([]string{"run", ".", "verify"}, append(args, signedPath)...)...)
+		cmd.Dir = "."
+		return cmd.CombinedOutput()
+	}
+
+	output, err := verify("-k", validCert, "--principal", "release@corp")
+	if err != nil {
+		t.Fatalf("verification with a valid certificate failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("certificate authorizes principal release@corp")) {
+		t.Errorf("verify output does not confirm the principal: %s", output)
+	}
+
+	// The plain key listed first doesn't stop the certificate from matching
+	if output, err := verify("-k", keyPath+".pub", "-k", validCert, "--principal", "release@corp"); err != nil {
+		t.Errorf("verification with a key and a certificate failed: %v\nOutput: %s", err, output)
+	}
+
+	failures := []struct {
+		name    string
+		args    []string
+		message string
+	}{
+		{"expired certificate", []string{"-k", expiredCert, "--principal", "release@corp"}, "expired"},
+		{"other principal", []string{"-k", validCert, "--principal", "ops@corp"}, "not in the set of valid principals"},
+		{"plain key", []string{"-k", keyPath + ".pub", "--principal", "release@corp"}, "key is not a certificate"},
+	}
+	for _, tc := range failures {
+		output, err := verify(tc.args...)
+		if err == nil {
+			t.Errorf("%s: verification should fail\nOutput: %s", tc.name, output)
+			continue
+		}
+		if !bytes.Contains(output, []byte("not authorized for principal")) || !bytes.Contains(output, []byte(tc.message)) {
+			t.Errorf("%s: unexpected error: %s", tc.name, output)
+		}
+	}
+}
+
+func TestVerifyQuiet(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signedPath := inputPath + ".signed"
+
+	verify := func(pubKey string, args ...string) (string, string, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("go", append([]string{"run", ".", "verify", "-k", pubKey}, append(args, signedPath)...)...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+
+	// Success prints nothing at all
+	stdout, stderr, err := verify(keyPath+".pub", "--quiet")
+	if err != nil {
+		t.Fatalf("quiet verification failed: %v\nStderr: %s", err, stderr)
+	}
+	if stdout != "" || stderr != "" {
+		t.Errorf("quiet verification printed output\nStdout: %s\nStderr: %s", stdout, stderr)
+	}
+
+	// Failure still explains itself on stderr and exits non-zero
+	wrongKey := generateTestKey(t, tmpDir, "wrong_key")
+	stdout, stderr, err = verify(wrongKey+".pub", "--quiet")
+	if err == nil {
+		t.Fatal("quiet verification with the wrong key should fail")
+	}
+	if stdout != "" {
+		t.Errorf("quiet verification printed to stdout: %s", stdout)
+	}
+	if !strings.Contains(stderr, "signature verification failed") {
+		t.Errorf("quiet failure does not report the error on stderr: %s", stderr)
+	}
+
+	// --json already replaces the human output, so the two don't mix
+	if _, _, err := verify(keyPath+".pub", "--quiet", "--json"); err == nil {
+		t.Error("--quiet with --json should be rejected")
+	}
+}
+
+func TestVerifyRemote(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "test_input")
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+	signed, err := os.ReadFile(inputPath + ".signed")
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/artifact", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(signed)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	verify := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", append([]string{"run", ".", "verify", "-k", keyPath + ".pub"}, args...)...)
+		return cmd.CombinedOutput()
+	}
+
+	output, err := verify("--allow-remote", server.URL+"/artifact")
+	if err != nil {
+		t.Fatalf("verifying a URL failed: %v\nOutput: %s", err, output)
+	}
+	if !bytes.Contains(output, []byte("Signature verified successfully")) {
+		t.Errorf("verification output did not indicate success: %s", output)
+	}
+
+	failures := []struct {
+		name    string
+		args    []string
+		message string
+	}{
+		{"not allowed", []string{server.URL + "/artifact"}, "pass --allow-remote"},
+		{"not found", []string{"--allow-remote", server.URL + "/missing"}, "404 Not Found"},
+		{"too large", []string{"--allow-remote", "--max-fetch-size", "16", server.URL + "/artifact"}, "exceeds the 16-byte limit"},
+	}
+	for _, tc := range failures {
+		output, err := verify(tc.args...)
+		if err == nil {
+			t.Errorf("%s: verification should fail\nOutput: %s", tc.name, output)
+			continue
+		}
+		if !bytes.Contains(output, []byte(tc.message)) {
+			t.Errorf("%s: output does not mention %q: %s", tc.name, tc.message, output)
+		}
+	}
+}
+
+func TestVerifyDetachedSignature(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "vendor_blob")
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	// Split the sign output: the signature is kept apart, the file stays as it was
+	signed, err := os.ReadFile(inputPath + ".signed")
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	signature := string(signed[10 : 10+len(appconfig.MagicString)])
+	sigPath := filepath.Join(tmpDir, "vendor_blob.sig")
+	if err := os.WriteFile(sigPath, []byte(signature+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write signature file: %v", err)
+	}
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("go", append([]string{"run", ".", "verify", "-k", keyPath + ".pub"}, args...)...)
+		cmd.Dir = "."
+		return cmd.CombinedOutput()
+	}
+
+	if output, err := run("--signature", signature, "--offset", "10", inputPath); err != nil {
+		t.Errorf("--signature failed: %v\nOutput: %s", err, output)
+	}
+	if output, err := run("--signature-file", sigPath, "--offset", "10", inputPath); err != nil {
+		t.Errorf("--signature-file failed: %v\nOutput: %s", err, output)
+	}
+
+	failures := []struct {
+		name string
+		args []string
+	}{
+		{"wrong offset", []string{"--signature", signature, "--offset", "11", inputPath}},
+		{"modified file", []string{"--signature", signature, "--offset", "10", inputPath + ".signed"}},
+		{"missing offset", []string{"--signature", signature, inputPath}},
+		{"bad prefix", []string{"--signature", "xx" + signature[2:], "--offset", "10", inputPath}},
+		{"wrong length", []string{"--signature", signature[:len(signature)-4], "--offset", "10", inputPath}},
+		{"not base64", []string{"--signature", signature[:10] + "!!!!" + signature[14:], "--offset", "10", inputPath}},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			if output, err := run(tc.args...); err == nil {
+				t.Errorf("verification should have failed\nOutput: %s", output)
+			}
+		})
+	}
+}
+
+func TestSignAndVerifyVerbose(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+	inputPath := createTestFileWithMagic(t, tmpDir, "input.txt")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "run", ".", "sign", "-v", "-k", keyPath, inputPath)
+	cmd.Dir = "."
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s%s", err, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "unisign: DEBUG magic found at offset 10") {
+		t.Errorf("-v did not log the offset to stderr: %s", stderr.String())
+	}
+	if strings.Contains(stdout.String(), "DEBUG") {
+		t.Errorf("-v logged to stdout: %s", stdout.String())
+	}
+
+	// With --json the report stays alone on stdout
+	stdout.Reset()
+	stderr.Reset()
+	cmd = exec.Command("go", "run", ".", "verify", "--verbose", "--json", "-k", keyPath+".pub", inputPath+".signed")
+	cmd.Dir = "."
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s%s", err, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "unisign: DEBUG magic found at offset 10") {
+		t.Errorf("--verbose did not log the offset to stderr: %s", stderr.String())
+	}
+	var report verifyReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || !report.Verified {
+		t.Errorf("stdout is not just the JSON report (%v): %s", err, stdout.String())
+	}
+
+	// Without the flag nothing is logged
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", inputPath+".signed")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil || bytes.Contains(output, []byte("DEBUG")) {
+		t.Errorf("verify without -v: err %v, output: %s", err, output)
+	}
+}
+
+func TestSignAndVerifyWithKeyID(t *testing.T) {
+	tmpDir := t.TempDir()
+	var pubKeys []string
+	for _, name := range []string{"alice", "bob", "carol"} {
+		pubKeys = append(pubKeys, generateTestKey(t, tmpDir, name)+".pub")
+	}
+
+	// The key ID placeholder has room for the tag in front of the signature
+	mc := &magicConfig{Magic: appconfig.MagicString, Prefix: appconfig.SignaturePrefix, KeyID: true}
+	if err := mc.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, []byte("some data "+mc.Magic+" more data"), 0644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "sign", "--key-id", "-k", filepath.Join(tmpDir, "carol"), inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	// The tag sends verify straight to carol's key, listed last
+	var stdout, stderr bytes.Buffer
+	args := []string{"run", ".", "verify", "--key-id", "-v"}
+	for _, pubKey := range pubKeys {
+		args = append(args, "-k", pubKey)
+	}
+	cmd = exec.Command("go", append(args, inputPath+".signed")...)
+	cmd.Dir = "."
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s%s", err, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "names "+pubKeys[2]+", trying it first") {
+		t.Errorf("verify did not pick the tagged key: %s", stderr.String())
+	}
+
+	// info shows the tag
+	cmd = exec.Command("go", "run", ".", "info", "--key-id", inputPath+".signed")
+	cmd.Dir = "."
+	output, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(output), "Key ID: ") {
+		t.Errorf("info --key-id: err %v, output: %s", err, output)
+	}
+
+	// Without --key-id the longer slot isn't a signature
+	cmd = exec.Command("go", "run", ".", "verify", "-k", pubKeys[2], inputPath+".signed")
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("verify without --key-id succeeded: %s", output)
+	}
+}
+
+func TestVerifyPDFIgnoresStreamDecoy(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := generateTestKey(t, tmpDir, "test_key")
+
+	// The page's content stream holds something that decodes like a signature
+	decoy := appconfig.SignaturePrefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xAB}, 64))
+	stream := "BT (" + decoy + ") Tj ET"
+	inputPath := filepath.Join(tmpDir, "doc.pdf")
+	writeTestPDF(t, inputPath,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+
+	for _, args := range [][]string{
+		{"inject-placeholder", "-o", inputPath + ".prepared", inputPath},
+		{"sign", "-k", keyPath, inputPath + ".prepared"},
+	} {
+		cmd := exec.Command("go", append([]string{"run", "."}, args...)...)
+		cmd.Dir = "."
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\nOutput: %s", args[0], err, output)
+		}
+	}
+	signedPath := inputPath + ".prepared.signed"
+
+	// Only the placeholder object is a slot, so --require-all passes
+	var stdout bytes.Buffer
+	cmd := exec.Command("go", "run", ".", "verify", "--require-all", "--json", "-k", keyPath+".pub", signedPath)
+	cmd.Dir = "."
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("verification failed: %v\nOutput: %s", err, stdout.String())
+	}
+	var report verifyReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	if len(report.Slots) != 1 {
+		t.Errorf("report has %d slots, want 1: %s", len(report.Slots), stdout.String())
+	}
+
+	// The decoy is signed content like any other, so changing it is caught
+	signed, err := os.ReadFile(signedPath)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %v", err)
+	}
+	other := appconfig.SignaturePrefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xCD}, 64))
+	tampered := bytes.Replace(signed, []byte(decoy), []byte(other), 1)
+	if err := os.WriteFile(signedPath, tampered, 0644); err != nil {
+		t.Fatalf("failed to write tampered file: %v", err)
+	}
+	cmd = exec.Command("go", "run", ".", "verify", "-k", keyPath+".pub", signedPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("verify accepted a changed content stream: %s", output)
+	}
+}
+
+func TestVerifyAllowedFingerprints(t *testing.T) {
+	tmpDir := t.TempDir()
+	aliceKey := generateTestKey(t, tmpDir, "alice")
+	bobKey := generateTestKey(t, tmpDir, "bob")
+	inputPath := createTestFileWithMagic(t, tmpDir, "input.txt")
+
+	cmd := exec.Command("go", "run", ".", "sign", "-k", bobKey, inputPath)
+	cmd.Dir = "."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("signing failed: %v\nOutput: %s", err, output)
+	}
+
+	// Lines as ssh-keygen -l prints them
+	fingerprintLine := func(pubKey string) string {
+		output, err := exec.Command("ssh-keygen", "-l", "-f", pubKey).Output()
+		if err != nil {
+			t.Fatalf("ssh-keygen -l failed: %v", err)
+		}
+		return string(output)
+	}
+	aliceLine, bobLine := fingerprintLine(aliceKey+".pub"), fingerprintLine(bobKey+".pub")
+	bobFingerprint := strings.Fields(bobLine)[1]
+
+	verify := func(allowlist string) (string, error) {
+		listPath := filepath.Join(tmpDir, "allowed")
+		if err := os.WriteFile(listPath, []byte(allowlist), 0644); err != nil {
+			t.Fatalf("failed to write allowlist: %v", err)
+		}
+		cmd := exec.Command("go", "run", ".", "verify", "--allowed-fingerprints", listPath,
+			"-k", aliceKey+".pub", "-k", bobKey+".pub", inputPath+".signed")
+		cmd.Dir = "."
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+
+	// Bob's signature is valid, but only alice is allowed
+	output, err := verify("# release signers\n" + aliceLine)
+	if err == nil {
+		t.Errorf("verify accepted a key missing from the allowlist: %s", output)
+	}
+	if !strings.Contains(output, "not in --allowed-fingerprints") || !strings.Contains(output, bobFingerprint) {
+		t.Errorf("rejection does not name the fingerprint: %s", output)
+	}
+
+	output, err = verify(aliceLine + "\n" + bobFingerprint + " bob\n")
+	if err != nil {
+		t.Fatalf("verify with bob allowed failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "fingerprint "+bobFingerprint+" is allowed") {
+		t.Errorf("accepted fingerprint not printed: %s", output)
+	}
+
+	if output, err := verify("not-a-fingerprint\n"); err == nil || !strings.Contains(output, "not a SHA256 fingerprint") {
+		t.Errorf("malformed allowlist: err %v, output: %s", err, output)
+	}
+}
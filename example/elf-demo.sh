@@ -44,7 +44,7 @@ PREP_SIZE=$(wc -c < "$TEMP_DIR/hello.prepared" | tr -d ' ')
 echo "   Size: $ORIG_SIZE -> $PREP_SIZE bytes (+$(($PREP_SIZE - $ORIG_SIZE)) bytes for section)"
 
 # Verify placeholder made it in
-if strings "$TEMP_DIR/hello.prepared" | grep -q "us1-"; then
+if strings "$TEMP_DIR/hello.prepared" | grep -q "us2-"; then
     echo "   Placeholder found in binary."
 fi
 
@@ -63,7 +63,7 @@ echo -e "\n2. Injecting signature placeholder into PDF..."
 echo "   $(file "$TEMP_DIR/document.prepared.pdf")"
 
 # Verify placeholder is present
-if strings "$TEMP_DIR/document.prepared.pdf" | grep -q "us1-"; then
+if strings "$TEMP_DIR/document.prepared.pdf" | grep -q "us2-"; then
     echo "   Placeholder found in PDF."
 fi
 
@@ -0,0 +1,122 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReadFileWithMode reads the file at path and returns its contents together
+// with its permission bits, opening the file only once.
+func ReadFileWithMode(path string) ([]byte, os.FileMode, error) {
+	return ReadFileWithHeadroom(path, 0)
+}
+
+// ReadFileWithHeadroom is like ReadFileWithMode but leaves headroom unused
+// bytes in front of the contents, which start at data[headroom:]. Callers
+// that must prepend a header to the whole file can then do so in place
+// instead of copying it. The buffer is sized from the file's length up
+// front, so a regular file is read without reallocating.
+func ReadFileWithHeadroom(path string, headroom int) ([]byte, os.FileMode, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// One spare byte lets the final read report EOF without growing the buffer
+	data := make([]byte, headroom, headroom+int(info.Size())+1)
+	for {
+		if len(data) == cap(data) {
+			data = append(data, 0)[:len(data)]
+		}
+		n, err := f.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return data, info.Mode().Perm(), nil
+}
+
+// WriteFileMode writes data to path and applies perm to the result.
+// Unlike os.WriteFile, the permission bits are also applied when the file
+// already exists, so the output always mirrors the mode of its input.
+func WriteFileMode(path string, data []byte, perm os.FileMode) error {
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
+
+// CopyFileWithPatch writes a copy of the regular file at src to dst with
+// patch written at offset, and applies perm to dst. want is the SHA-256 of
+// src as it was read to be signed. The bytes copied are hashed on the way
+// through, and if they don't match, because src changed after it was read,
+// dst is removed and an error returned, so a signature is never written
+// next to contents it doesn't cover.
+func CopyFileWithPatch(src, dst string, perm os.FileMode, want [sha256.Size]byte, offset int64, patch []byte) error {
+	return CopyFileWithPatchHashed(src, dst, perm, want, offset, patch, io.Discard)
+}
+
+// CopyFileWithPatchHashed is like CopyFileWithPatch but also writes every
+// byte it writes to dst into h, in the same pass. The patch is spliced into
+// the stream instead of being written afterwards, so h sees exactly what dst
+// holds.
+func CopyFileWithPatchHashed(src, dst string, perm os.FileMode, want [sha256.Size]byte, offset int64, patch []byte, h io.Writer) error {
+	if offset < 0 {
+		return fmt.Errorf("patch offset %d is negative", offset)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	// Copy up to the patch, write the patch in place of the bytes it
+	// replaces, then copy the rest. Every byte read from src is hashed,
+	// the replaced ones included, to compare against want.
+	read := sha256.New()
+	r := io.TeeReader(in, read)
+	w := io.MultiWriter(out, h)
+	_, err = io.CopyN(w, r, offset)
+	if err == nil {
+		_, err = w.Write(patch)
+	}
+	if err == nil {
+		_, err = io.CopyN(io.Discard, r, int64(len(patch)))
+	}
+	if err == nil {
+		_, err = io.Copy(w, r)
+	}
+	if errors.Is(err, io.EOF) || (err == nil && !bytes.Equal(read.Sum(nil), want[:])) {
+		err = fmt.Errorf("%s no longer matches what was signed; was it modified?", src)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Chmod(dst, perm)
+}
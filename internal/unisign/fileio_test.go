@@ -0,0 +1,140 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCopyFileWithPatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	dst := filepath.Join(tmpDir, "dst")
+
+	if err := os.WriteFile(src, []byte("hello PLACEHOLDER world"), 0640); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	// A longer pre-existing destination must be truncated
+	if err := os.WriteFile(dst, []byte("stale contents that are longer than the source"), 0600); err != nil {
+		t.Fatalf("failed to write destination: %v", err)
+	}
+
+	want := sha256.Sum256([]byte("hello PLACEHOLDER world"))
+	if err := CopyFileWithPatch(src, dst, 0640, want, 6, []byte("SIGNATURE!!")); err != nil {
+		t.Fatalf("CopyFileWithPatch failed: %v", err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	if string(got) != "hello SIGNATURE!! world" {
+		t.Errorf("destination = %q", got)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("failed to stat destination: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("destination mode = %o, want 640", info.Mode().Perm())
+	}
+
+	// A source that changed since it was read is rejected, even at the
+	// same size, and no copy is left behind
+	if err := os.WriteFile(src, []byte("hello PLACEHOLDER World"), 0640); err != nil {
+		t.Fatalf("failed to rewrite source: %v", err)
+	}
+	if err := CopyFileWithPatch(src, dst, 0640, want, 6, []byte("SIGNATURE!!")); err == nil {
+		t.Error("expected an error for a modified source")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("destination of a failed copy still exists: %v", err)
+	}
+	// So is a patch that would run past the end of the file
+	if err := CopyFileWithPatch(src, dst, 0640, want, 20, []byte("SIGNATURE!!")); err == nil {
+		t.Error("expected an error for a patch past the end of the file")
+	}
+}
+
+func TestCopyFileWithPatchHashed(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	dst := filepath.Join(tmpDir, "dst")
+
+	if err := os.WriteFile(src, []byte("hello PLACEHOLDER world"), 0640); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	want := sha256.Sum256([]byte("hello PLACEHOLDER world"))
+	h := sha256.New()
+	if err := CopyFileWithPatchHashed(src, dst, 0640, want, 6, []byte("SIGNATURE!!"), h); err != nil {
+		t.Fatalf("CopyFileWithPatchHashed failed: %v", err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	if string(got) != "hello SIGNATURE!! world" {
+		t.Errorf("destination = %q", got)
+	}
+	if sum := sha256.Sum256(got); !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Errorf("hash = %x, want %x", h.Sum(nil), sum)
+	}
+
+	// A source that is shorter or longer than what was signed is rejected
+	for _, content := range []string{"hello PLACEHOLDER", "hello PLACEHOLDER world!"} {
+		if err := os.WriteFile(src, []byte(content), 0640); err != nil {
+			t.Fatalf("failed to rewrite source: %v", err)
+		}
+		if err := CopyFileWithPatchHashed(src, dst, 0640, want, 6, []byte("SIGNATURE!!"), sha256.New()); err == nil {
+			t.Errorf("expected an error for source %q", content)
+		}
+	}
+	if err := CopyFileWithPatchHashed(src, dst, 0640, want, 20, []byte("SIGNATURE!!"), sha256.New()); err == nil {
+		t.Error("expected an error for a patch past the end of the file")
+	}
+}
+
+func TestFileIOLongPath(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("the 260-character path limit only exists on Windows")
+	}
+
+	// Nest directories until the path is well past MAX_PATH
+	dir := t.TempDir()
+	for len(dir) < 300 {
+		dir = filepath.Join(dir, strings.Repeat("d", 40))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create nested directories: %v", err)
+	}
+	src := filepath.Join(dir, "artifact.bin")
+	dst := filepath.Join(dir, "artifact.bin.signed")
+
+	if err := WriteFileMode(src, []byte("hello PLACEHOLDER world"), 0644); err != nil {
+		t.Fatalf("WriteFileMode failed on a %d-character path: %v", len(src), err)
+	}
+	if _, _, err := ReadFileWithMode(src); err != nil {
+		t.Fatalf("ReadFileWithMode failed on a long path: %v", err)
+	}
+	buf, _, release, err := LoadFileWithHeadroom(src, 8)
+	if err != nil {
+		t.Fatalf("LoadFileWithHeadroom failed on a long path: %v", err)
+	}
+	defer release()
+	if err := CopyFileWithPatch(src, dst, 0644, sha256.Sum256(buf[8:]), 6, []byte("SIGNATURE..")); err != nil {
+		t.Fatalf("CopyFileWithPatch failed on a long path: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read patched copy: %v", err)
+	}
+	if string(got) != "hello SIGNATURE.. world" {
+		t.Errorf("patched copy = %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package unisign
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Format identifies a file format that supports placeholder injection
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatELF
+	FormatPDF
+	FormatZip
+	FormatMachO
+	FormatPE
+)
+
+// FormatSniffLen is the number of leading bytes DetectFormat needs. PE is the
+// exception: its signature sits wherever the DOS header points, so it is only
+// recognized when that much of the file is passed.
+const FormatSniffLen = 8
+
+// String returns a human-readable name for the format
+func (f Format) String() string {
+	switch f {
+	case FormatELF:
+		return "ELF"
+	case FormatPDF:
+		return "PDF"
+	case FormatZip:
+		return "ZIP"
+	case FormatMachO:
+		return "Mach-O"
+	case FormatPE:
+		return "PE"
+	default:
+		return "unknown"
+	}
+}
+
+// DetectFormat identifies the format of data from its leading magic bytes.
+// Only the first FormatSniffLen bytes are inspected, so callers may pass a
+// short prefix, except that PE files need the DOS header's target too.
+func DetectFormat(data []byte) Format {
+	switch {
+	case IsELF(data):
+		return FormatELF
+	case IsPDF(data):
+		return FormatPDF
+	case IsZip(data):
+		return FormatZip
+	case IsMachO(data):
+		return FormatMachO
+	case IsPE(data):
+		return FormatPE
+	default:
+		return FormatUnknown
+	}
+}
+
+// Mach-O magic numbers, as read big-endian from the start of the file
+const (
+	machOMagic32  = 0xfeedface
+	machOMagic64  = 0xfeedfacf
+	machOFatMagic = 0xcafebabe
+	machOFat64    = 0xcafebabf
+)
+
+// machOMaxFatArchs bounds the architecture count of a fat Mach-O header.
+// Java class files share the 0xCAFEBABE magic but follow it with their
+// version number, which is at least 45 and so always exceeds this.
+const machOMaxFatArchs = 30
+
+// IsMachO checks if the given data starts with a thin (32- or 64-bit) or
+// fat Mach-O header, in either byte order
+func IsMachO(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case machOMagic32, machOMagic64:
+		return true
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case machOMagic32, machOMagic64:
+		return true
+	}
+	return IsFatMachO(data)
+}
+
+// IsFatMachO checks if the given data starts with a fat (universal) Mach-O
+// header bundling binaries for several architectures
+func IsFatMachO(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	order := binary.ByteOrder(binary.BigEndian)
+	switch {
+	case isFatMagic(binary.BigEndian.Uint32(data)):
+	case isFatMagic(binary.LittleEndian.Uint32(data)):
+		order = binary.LittleEndian
+	default:
+		return false
+	}
+	archs := order.Uint32(data[4:])
+	return archs > 0 && archs <= machOMaxFatArchs
+}
+
+func isFatMagic(magic uint32) bool {
+	return magic == machOFatMagic || magic == machOFat64
+}
+
+// peHeaderOffsetField is where the DOS header stores e_lfanew, the offset
+// of the PE signature
+const peHeaderOffsetField = 0x3c
+
+// IsPE checks if the given data starts with an MZ DOS header whose e_lfanew
+// field points at a "PE\0\0" signature
+func IsPE(data []byte) bool {
+	if len(data) < peHeaderOffsetField+4 || data[0] != 'M' || data[1] != 'Z' {
+		return false
+	}
+	offset := uint64(binary.LittleEndian.Uint32(data[peHeaderOffsetField:]))
+	if offset+4 > uint64(len(data)) {
+		return false
+	}
+	return bytes.Equal(data[offset:offset+4], []byte("PE\x00\x00"))
+}
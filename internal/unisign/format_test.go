@@ -0,0 +1,134 @@
+package unisign
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Format
+	}{
+		{"elf", []byte{0x7f, 'E', 'L', 'F', 2}, FormatELF},
+		{"pdf", []byte("%PDF-1.7"), FormatPDF},
+		{"zip", []byte("PK\x03\x04"), FormatZip},
+		{"unknown", []byte("plain text"), FormatUnknown},
+		{"empty", []byte{}, FormatUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.data); got != tt.want {
+				t.Errorf("DetectFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFormat_EmptyZipArchive(t *testing.T) {
+	// An archive with no entries consists of only the EOCD record
+	var buf bytes.Buffer
+	if err := zip.NewWriter(&buf).Close(); err != nil {
+		t.Fatalf("failed to write empty archive: %v", err)
+	}
+	data := buf.Bytes()
+
+	if _, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("archive/zip rejected empty archive: %v", err)
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		t.Fatal("empty archive unexpectedly starts with a local file header")
+	}
+	if got := DetectFormat(data); got != FormatZip {
+		t.Errorf("DetectFormat() = %v, want %v", got, FormatZip)
+	}
+}
+
+func TestIsMachO(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantAny bool
+		wantFat bool
+	}{
+		{"thin 32-bit big-endian", []byte{0xfe, 0xed, 0xfa, 0xce, 0, 0, 0, 0x12}, true, false},
+		{"thin 32-bit little-endian", []byte{0xce, 0xfa, 0xed, 0xfe, 0x07, 0, 0, 0}, true, false},
+		{"thin 64-bit big-endian", []byte{0xfe, 0xed, 0xfa, 0xcf, 0x01, 0, 0, 0x0c}, true, false},
+		{"thin 64-bit little-endian", []byte{0xcf, 0xfa, 0xed, 0xfe, 0x0c, 0, 0, 0x01}, true, false},
+		{"fat big-endian", []byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 2}, true, true},
+		{"fat little-endian", []byte{0xbe, 0xba, 0xfe, 0xca, 2, 0, 0, 0}, true, true},
+		{"fat 64-bit", []byte{0xca, 0xfe, 0xba, 0xbf, 0, 0, 0, 1}, true, true},
+		{"java class file", []byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 61}, false, false},
+		{"fat with no architectures", []byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 0}, false, false},
+		{"fat magic only", []byte{0xca, 0xfe, 0xba, 0xbe}, false, false},
+		{"short", []byte{0xfe, 0xed, 0xfa}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsMachO(tt.data); got != tt.wantAny {
+				t.Errorf("IsMachO() = %v, want %v", got, tt.wantAny)
+			}
+			if got := IsFatMachO(tt.data); got != tt.wantFat {
+				t.Errorf("IsFatMachO() = %v, want %v", got, tt.wantFat)
+			}
+			wantFormat := FormatUnknown
+			if tt.wantAny {
+				wantFormat = FormatMachO
+			}
+			if got := DetectFormat(tt.data); got != wantFormat {
+				t.Errorf("DetectFormat() = %v, want %v", got, wantFormat)
+			}
+		})
+	}
+}
+
+func TestIsPE(t *testing.T) {
+	// newPE returns a DOS header pointing at offset, with the PE signature there
+	newPE := func(offset uint32, size int) []byte {
+		data := make([]byte, size)
+		copy(data, "MZ")
+		binary.LittleEndian.PutUint32(data[0x3c:], offset)
+		if int(offset)+4 <= size {
+			copy(data[offset:], "PE\x00\x00")
+		}
+		return data
+	}
+
+	notPE := newPE(0x80, 0x100)
+	copy(notPE[0x80:], "NE\x00\x00")
+	noMZ := newPE(0x80, 0x100)
+	copy(noMZ, "ZM")
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"pe", newPE(0x80, 0x100), true},
+		{"signature at end of data", newPE(0xfc, 0x100), true},
+		{"signature right after the DOS header", newPE(0x40, 0x44), true},
+		{"signature past end of data", newPE(0x100, 0x100), false},
+		{"huge e_lfanew", newPE(0xffffffff, 0x100), false},
+		{"wrong signature", notPE, false},
+		{"no MZ", noMZ, false},
+		{"MZ only", []byte("MZ"), false},
+		{"truncated DOS header", newPE(0x80, 0x100)[:0x3f], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPE(tt.data); got != tt.want {
+				t.Errorf("IsPE() = %v, want %v", got, tt.want)
+			}
+			wantFormat := FormatUnknown
+			if tt.want {
+				wantFormat = FormatPE
+			}
+			if got := DetectFormat(tt.data); got != wantFormat {
+				t.Errorf("DetectFormat() = %v, want %v", got, wantFormat)
+			}
+		})
+	}
+}
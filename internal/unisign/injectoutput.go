@@ -0,0 +1,74 @@
+package unisign
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrOutputIsInput is returned when an injector's output path names its
+// input file and the options don't ask for the input to be replaced
+var ErrOutputIsInput = errors.New("output is the input file; set InPlace (--in-place) to replace it")
+
+// sameFile reports whether output names the existing file input does, which
+// also catches symlinks, hard links and differently spelled paths
+func sameFile(input, output string) bool {
+	in, err := os.Stat(input)
+	if err != nil {
+		return false
+	}
+	out, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(in, out)
+}
+
+// checkInjectionOutput refuses an output that is the input unless inPlace is set.
+// Injectors call it before reading the input so the mistake costs nothing.
+func checkInjectionOutput(input, output string, inPlace bool) error {
+	if !inPlace && sameFile(input, output) {
+		return fmt.Errorf("%w: %s", ErrOutputIsInput, output)
+	}
+	return nil
+}
+
+// writeInjectionOutput writes an injector's output. An output that is the
+// input is replaced atomically, so a failure part way leaves the original
+// intact rather than truncated.
+func writeInjectionOutput(input, output string, data []byte, perm os.FileMode) error {
+	if sameFile(input, output) {
+		return replaceFile(output, data, perm)
+	}
+	return WriteFileMode(output, data, perm)
+}
+
+// replaceFile atomically replaces the file at path with data: it is written
+// to a temporary file in the same directory, which is then renamed over it.
+// A symlink at path is followed, so the link stays and its target changes.
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package unisign
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInjectorsRefuseToOverwriteInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input")
+	original := []byte("not touched")
+	if err := os.WriteFile(inputPath, original, 0644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	linkPath := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(inputPath, linkPath); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	// The guard runs before the input is read, so the format doesn't matter
+	injectors := map[string]func(output string) error{
+		"ELF": func(output string) error {
+			return InjectPlaceholderIntoELF(ELFInjectionOptions{InputPath: inputPath, OutputPath: output, Placeholder: MagicString})
+		},
+		"PDF": func(output string) error {
+			return InjectPlaceholderIntoPDF(PDFInjectionOptions{InputPath: inputPath, OutputPath: output, Placeholder: MagicString})
+		},
+		"ZIP": func(output string) error {
+			return InjectPlaceholderIntoZip(ZipInjectionOptions{InputPath: inputPath, OutputPath: output, Placeholder: MagicString})
+		},
+		"PE": func(output string) error {
+			return InjectPlaceholderIntoPE(PEInjectionOptions{InputPath: inputPath, OutputPath: output, Placeholder: MagicString})
+		},
+		"embedded": func(output string) error {
+			return InjectPlaceholderIntoEmbeddedData(EmbeddedInjectionOptions{InputPath: inputPath, OutputPath: output, Placeholder: MagicString})
+		},
+	}
+	outputs := map[string]string{
+		"same path":      inputPath,
+		"other spelling": tmpDir + string(filepath.Separator) + "." + string(filepath.Separator) + "input",
+		"symlink":        linkPath,
+	}
+
+	for name, inject := range injectors {
+		for how, output := range outputs {
+			t.Run(name+"/"+how, func(t *testing.T) {
+				if err := inject(output); !errors.Is(err, ErrOutputIsInput) {
+					t.Errorf("error = %v, want ErrOutputIsInput", err)
+				}
+			})
+		}
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil || !bytes.Equal(data, original) {
+		t.Errorf("input changed: %q, %v", data, err)
+	}
+}
+
+func TestInjectPlaceholderInPlace(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	createMinimalPDF(t, pdfPath)
+	if err := os.Chmod(pdfPath, 0600); err != nil {
+		t.Fatalf("failed to chmod input: %v", err)
+	}
+	linkPath := filepath.Join(tmpDir, "link.pdf")
+	if err := os.Symlink(pdfPath, linkPath); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	// Replacing through the symlink keeps the link and rewrites its target
+	opts := PDFInjectionOptions{
+		InputPath:   linkPath,
+		OutputPath:  linkPath,
+		Placeholder: MagicString,
+		InPlace:     true,
+	}
+	if err := InjectPlaceholderIntoPDF(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoPDF failed: %v", err)
+	}
+
+	if info, err := os.Lstat(linkPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced: %v, %v", info, err)
+	}
+	info, err := os.Stat(pdfPath)
+	if err != nil {
+		t.Fatalf("failed to stat output: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("output mode = %o, want 600", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if !bytes.Contains(data, []byte(MagicString)) {
+		t.Error("placeholder not injected in place")
+	}
+
+	// No temporary file is left next to it
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to list directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("directory holds %d entries, want 2", len(entries))
+	}
+}
+
+func TestInjectorsReportPlaceholderOffset(t *testing.T) {
+	tmpDir := t.TempDir()
+	elfPath := buildTestELF64(t, tmpDir)
+	zipPath := filepath.Join(tmpDir, "test.zip")
+	createSampleZipWithComment(t, zipPath, "release notes")
+	pePath := filepath.Join(tmpDir, "test.exe")
+	signedPEPath := filepath.Join(tmpDir, "signed.exe")
+	peData := buildTestPE(t, tmpDir)
+	if err := os.WriteFile(pePath, peData, 0755); err != nil {
+		t.Fatalf("failed to write PE: %v", err)
+	}
+	if err := os.WriteFile(signedPEPath, fakeAuthenticodeSign(t, peData), 0755); err != nil {
+		t.Fatalf("failed to write PE: %v", err)
+	}
+
+	injectors := map[string]func(output string, dryRun bool) (int64, error){
+		"ELF": func(output string, dryRun bool) (int64, error) {
+			return InjectPlaceholderIntoELFWithOffset(ELFInjectionOptions{InputPath: elfPath, OutputPath: output, Placeholder: MagicString, DryRun: dryRun})
+		},
+		"ELF note segment": func(output string, dryRun bool) (int64, error) {
+			return InjectPlaceholderIntoELFWithOffset(ELFInjectionOptions{InputPath: elfPath, OutputPath: output, Placeholder: MagicString, DryRun: dryRun, AddNoteSegment: true})
+		},
+		"ZIP": func(output string, dryRun bool) (int64, error) {
+			return InjectPlaceholderIntoZipWithOffset(ZipInjectionOptions{InputPath: zipPath, OutputPath: output, Placeholder: MagicString, DryRun: dryRun})
+		},
+		"ZIP appended": func(output string, dryRun bool) (int64, error) {
+			return InjectPlaceholderIntoZipWithOffset(ZipInjectionOptions{InputPath: zipPath, OutputPath: output, Placeholder: MagicString, DryRun: dryRun, Append: true})
+		},
+		"PE overlay": func(output string, dryRun bool) (int64, error) {
+			return InjectPlaceholderIntoPEWithOffset(PEInjectionOptions{InputPath: pePath, OutputPath: output, Placeholder: MagicString, DryRun: dryRun})
+		},
+		"PE certificate table": func(output string, dryRun bool) (int64, error) {
+			return InjectPlaceholderIntoPEWithOffset(PEInjectionOptions{InputPath: signedPEPath, OutputPath: output, Placeholder: MagicString, DryRun: dryRun})
+		},
+	}
+
+	for name, inject := range injectors {
+		t.Run(name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "output")
+			offset, err := inject(outPath, false)
+			if err != nil {
+				t.Fatalf("injection failed: %v", err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if offset < 0 || offset+int64(len(MagicString)) > int64(len(data)) || string(data[offset:offset+int64(len(MagicString))]) != MagicString {
+				t.Errorf("reported offset %d does not hold the placeholder", offset)
+			}
+
+			// A dry run reports the same offset without writing anything
+			dryPath := filepath.Join(t.TempDir(), "dry")
+			if dryOffset, err := inject(dryPath, true); err != nil || dryOffset != offset {
+				t.Errorf("dry run reported %d, %v; want %d", dryOffset, err, offset)
+			}
+			if _, err := os.Stat(dryPath); !os.IsNotExist(err) {
+				t.Errorf("dry run wrote its output: %v", err)
+			}
+		})
+	}
+}
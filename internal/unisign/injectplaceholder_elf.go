@@ -5,7 +5,7 @@ import (
 	"debug/elf"
 	"errors"
 	"fmt"
-	"os"
+	"strings"
 )
 
 // ELFInjectionOptions defines the options for injecting a placeholder into an ELF file
@@ -21,6 +21,27 @@ type ELFInjectionOptions struct {
 
 	// SectionName is the name of the section to create (defaults to ".note.unisign")
 	SectionName string
+
+	// DryRun performs the injection in memory without writing OutputPath
+	DryRun bool
+
+	// InPlace allows OutputPath to name the input file, which is then
+	// replaced atomically. Without it such an output is ErrOutputIsInput.
+	InPlace bool
+
+	// AddNoteSegment also exposes the placeholder through a PT_NOTE program
+	// header, for tools that scan segments rather than sections
+	AddNoteSegment bool
+
+	// SectionType is the new section's sh_type, SHT_PROGBITS (the default)
+	// or SHT_NOTE. An SHT_NOTE section holds the whole note wrapping the
+	// placeholder, as note readers expect, rather than the placeholder alone.
+	SectionType elf.SectionType
+
+	// SectionFlags is the new section's sh_flags (default none). Flags that
+	// only make sense for loaded sections, such as SHF_ALLOC, are rejected
+	// because the section is never part of a loadable segment.
+	SectionFlags elf.SectionFlag
 }
 
 var (
@@ -28,10 +49,64 @@ var (
 	ErrELFUnsupported   = errors.New("unsupported ELF format")
 	ErrSectionExists    = errors.New("section already exists in ELF binary")
 	ErrNoSectionHeaders = errors.New("ELF file has no section headers")
+	ErrNoSectionNames   = errors.New("ELF file has no section name string table")
+
+	ErrInvalidSectionName = errors.New("invalid ELF section name")
+	ErrInvalidSectionKind = errors.New("unsupported ELF section type or flags")
 )
 
 const defaultELFSection = ".note.unisign"
 
+// maxELFSectionNameLen bounds section names; real toolchains stay far below it
+const maxELFSectionNameLen = 64
+
+// validateSectionName rejects names that would corrupt .shstrtab, which
+// stores names NUL-terminated, and names that don't follow the "." convention
+func validateSectionName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: empty name", ErrInvalidSectionName)
+	case len(name) > maxELFSectionNameLen:
+		return fmt.Errorf("%w: %d bytes exceeds the %d-byte limit", ErrInvalidSectionName, len(name), maxELFSectionNameLen)
+	case strings.IndexByte(name, 0) != -1:
+		return fmt.Errorf("%w: %q contains a NUL byte", ErrInvalidSectionName, name)
+	case name[0] != '.':
+		return fmt.Errorf("%w: %q does not start with '.'", ErrInvalidSectionName, name)
+	}
+	return nil
+}
+
+// disallowedELFSectionFlags are the section flags the injected section cannot
+// honestly carry, with the reason for each
+var disallowedELFSectionFlags = []struct {
+	flag   elf.SectionFlag
+	reason string
+}{
+	{elf.SHF_ALLOC, "the section is not part of a loadable segment"},
+	{elf.SHF_WRITE, "the section is not loaded"},
+	{elf.SHF_EXECINSTR, "the section is not loaded"},
+	{elf.SHF_TLS, "the section is not loaded"},
+	{elf.SHF_MERGE, "the section has no sh_entsize"},
+	{elf.SHF_INFO_LINK, "the section has no sh_info"},
+	{elf.SHF_LINK_ORDER, "the section has no sh_link"},
+	{elf.SHF_GROUP, "the section is in no section group"},
+	{elf.SHF_COMPRESSED, "the placeholder is stored uncompressed"},
+}
+
+// validateSectionKind rejects section types other than SHT_PROGBITS and
+// SHT_NOTE, and flags describing properties the injected section lacks
+func validateSectionKind(typ elf.SectionType, flags elf.SectionFlag) error {
+	if typ != elf.SHT_PROGBITS && typ != elf.SHT_NOTE {
+		return fmt.Errorf("%w: type %v, want SHT_PROGBITS or SHT_NOTE", ErrInvalidSectionKind, typ)
+	}
+	for _, d := range disallowedELFSectionFlags {
+		if flags&d.flag != 0 {
+			return fmt.Errorf("%w: %v set but %s", ErrInvalidSectionKind, d.flag, d.reason)
+		}
+	}
+	return nil
+}
+
 // InjectPlaceholderIntoELF injects a magic placeholder as a new ELF section
 // without affecting the executable's runtime behavior.
 //
@@ -42,64 +117,101 @@ const defaultELFSection = ".note.unisign"
 // The approach:
 //  1. Append the placeholder data after the existing file content
 //  2. Append an updated copy of .shstrtab with the new section name
-//  3. Rewrite the section header table at the new end of file
+//  3. Rewrite the section header table at the new end of file, replacing
+//     the old one if it was the last thing in the file
 //  4. Patch the ELF header to point to the new section header table
 func InjectPlaceholderIntoELF(opts ELFInjectionOptions) error {
+	_, err := InjectPlaceholderIntoELFWithOffset(opts)
+	return err
+}
+
+// InjectPlaceholderIntoELFWithOffset is like InjectPlaceholderIntoELF but
+// also returns the offset of the placeholder in the output, also with
+// opts.DryRun, so signing tools need not scan for it
+func InjectPlaceholderIntoELFWithOffset(opts ELFInjectionOptions) (int64, error) {
 	if opts.SectionName == "" {
 		opts.SectionName = defaultELFSection
 	}
 
-	data, err := os.ReadFile(opts.InputPath)
+	if err := checkInjectionOutput(opts.InputPath, opts.OutputPath, opts.InPlace); err != nil {
+		return 0, err
+	}
+
+	data, perm, err := ReadFileWithMode(opts.InputPath)
 	if err != nil {
-		return fmt.Errorf("failed to read input file: %w", err)
+		return 0, fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	output, offset, err := injectELFData(data, opts)
+	if err != nil {
+		return 0, err
+	}
+	if opts.DryRun {
+		return offset, nil
+	}
+
+	if err := writeInjectionOutput(opts.InputPath, opts.OutputPath, output, perm); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// injectELFData performs the injection on an in-memory ELF image and
+// returns the modified image and the placeholder's offset in it.
+// opts.SectionName must already be set.
+func injectELFData(data []byte, opts ELFInjectionOptions) ([]byte, int64, error) {
+	if err := validateSectionName(opts.SectionName); err != nil {
+		return nil, 0, err
+	}
+	if opts.SectionType == elf.SHT_NULL {
+		opts.SectionType = elf.SHT_PROGBITS
+	}
+	if err := validateSectionKind(opts.SectionType, opts.SectionFlags); err != nil {
+		return nil, 0, err
 	}
 
 	ef, err := elf.NewFile(bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrNotELF, err)
+		return nil, 0, fmt.Errorf("%w: %v", ErrNotELF, err)
 	}
 	defer ef.Close()
 
 	if sec := ef.Section(opts.SectionName); sec != nil {
-		return fmt.Errorf("%w: %s", ErrSectionExists, opts.SectionName)
+		return nil, 0, fmt.Errorf("%w: %s", ErrSectionExists, opts.SectionName)
 	}
 
-	var output []byte
 	switch ef.Class {
 	case elf.ELFCLASS64:
-		output, err = injectELF64(data, ef, opts)
+		return injectELF64(data, ef, opts)
 	case elf.ELFCLASS32:
-		output, err = injectELF32(data, ef, opts)
+		return injectELF32(data, ef, opts)
 	default:
-		return fmt.Errorf("%w: class %v", ErrELFUnsupported, ef.Class)
-	}
-	if err != nil {
-		return err
+		return nil, 0, fmt.Errorf("%w: class %v", ErrELFUnsupported, ef.Class)
 	}
-
-	return os.WriteFile(opts.OutputPath, output, 0755)
 }
 
-func injectELF64(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, error) {
+func injectELF64(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, int64, error) {
 	bo := ef.ByteOrder
 
 	// ELF64 header field offsets
 	shoff := bo.Uint64(data[0x28:])
 	shentsize := bo.Uint16(data[0x3A:])
-	shnum := bo.Uint16(data[0x3C:])
-	shstrndx := bo.Uint16(data[0x3E:])
-
-	if shnum == 0 || int(shstrndx) >= int(shnum) {
-		return nil, ErrNoSectionHeaders
+	shnum, shstrndx, err := elfSectionIndexes(ef, bo.Uint16(data[0x3E:]))
+	if err != nil {
+		return nil, 0, err
 	}
 	if shentsize < 64 {
-		return nil, fmt.Errorf("unexpected ELF64 section header entry size: %d", shentsize)
+		return nil, 0, fmt.Errorf("unexpected ELF64 section header entry size: %d", shentsize)
+	}
+	tableSize := uint64(shnum) * uint64(shentsize)
+	if shoff > uint64(len(data)) || tableSize > uint64(len(data))-shoff {
+		return nil, 0, fmt.Errorf("%w: section header table at %d runs past the end of the file", ErrELFUnsupported, shoff)
 	}
 
 	// Read existing section header string table
 	shstrtabData, err := ef.Sections[shstrndx].Data()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read .shstrtab: %w", err)
+		return nil, 0, fmt.Errorf("failed to read .shstrtab: %w", err)
 	}
 
 	// Build new shstrtab: original content + new section name + null terminator
@@ -110,16 +222,22 @@ func injectELF64(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, e
 
 	placeholderData := []byte(opts.Placeholder)
 
-	// Start with the entire original file
-	output := make([]byte, len(data))
-	copy(output, data)
+	// Start with the original file, minus a trailing section header table we are about to replace
+	output := elfOutputBase(data, ef, shoff, tableSize)
 
 	// Append new content after the original file
-	padTo(&output, 8)
+	align := elfSectionAlign(ef, opts)
+	padTo(&output, align)
+
+	noteOff := uint64(len(output))
+	if opts.wrapsNote() {
+		output = append(output, elfNoteHeader(ef, len(placeholderData))...)
+	}
 
 	placeholderOff := uint64(len(output))
 	output = append(output, placeholderData...)
 	padTo(&output, 8)
+	sectionOff, sectionSize := opts.sectionExtent(noteOff, placeholderOff, len(placeholderData))
 
 	newShstrtabOff := uint64(len(output))
 	output = append(output, newShstrtabData...)
@@ -128,7 +246,7 @@ func injectELF64(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, e
 	// Write new section header table
 	newShoff := uint64(len(output))
 
-	for i := uint16(0); i < shnum; i++ {
+	for i := 0; i < shnum; i++ {
 		off := shoff + uint64(i)*uint64(shentsize)
 		entry := make([]byte, shentsize)
 		copy(entry, data[off:off+uint64(shentsize)])
@@ -138,6 +256,10 @@ func injectELF64(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, e
 			bo.PutUint64(entry[24:], newShstrtabOff)
 			bo.PutUint64(entry[32:], uint64(len(newShstrtabData)))
 		}
+		// An extended section count lives in sh_size of section 0
+		if i == 0 && shnum+1 >= int(elf.SHN_LORESERVE) {
+			bo.PutUint64(entry[32:], uint64(shnum+1))
+		}
 
 		output = append(output, entry...)
 	}
@@ -145,38 +267,47 @@ func injectELF64(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, e
 	// Append new section header for .note.unisign
 	newShdr := make([]byte, shentsize)
 	bo.PutUint32(newShdr[0:], newNameOffset)              // sh_name
-	bo.PutUint32(newShdr[4:], uint32(elf.SHT_PROGBITS))   // sh_type
-	bo.PutUint64(newShdr[24:], placeholderOff)             // sh_offset
-	bo.PutUint64(newShdr[32:], uint64(len(placeholderData))) // sh_size
-	bo.PutUint64(newShdr[48:], 1)                          // sh_addralign
+	bo.PutUint32(newShdr[4:], uint32(opts.SectionType))   // sh_type
+	bo.PutUint64(newShdr[8:], uint64(opts.SectionFlags))  // sh_flags
+	bo.PutUint64(newShdr[24:], sectionOff)                 // sh_offset
+	bo.PutUint64(newShdr[32:], sectionSize)                // sh_size
+	bo.PutUint64(newShdr[48:], uint64(align))              // sh_addralign
 	output = append(output, newShdr...)
 
 	// Patch ELF header
-	bo.PutUint64(output[0x28:], newShoff) // e_shoff
-	bo.PutUint16(output[0x3C:], shnum+1)  // e_shnum
+	bo.PutUint64(output[0x28:], newShoff)                // e_shoff
+	bo.PutUint16(output[0x3C:], elfHeaderShnum(shnum+1)) // e_shnum
+
+	if opts.AddNoteSegment {
+		if err := addNoteSegment(output, ef, noteOff, elfNoteSize(len(placeholderData))); err != nil {
+			return nil, 0, err
+		}
+	}
 
-	return output, nil
+	return output, int64(placeholderOff), nil
 }
 
-func injectELF32(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, error) {
+func injectELF32(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, int64, error) {
 	bo := ef.ByteOrder
 
 	// ELF32 header field offsets
 	shoff := bo.Uint32(data[0x20:])
 	shentsize := bo.Uint16(data[0x2E:])
-	shnum := bo.Uint16(data[0x30:])
-	shstrndx := bo.Uint16(data[0x32:])
-
-	if shnum == 0 || int(shstrndx) >= int(shnum) {
-		return nil, ErrNoSectionHeaders
+	shnum, shstrndx, err := elfSectionIndexes(ef, bo.Uint16(data[0x32:]))
+	if err != nil {
+		return nil, 0, err
 	}
 	if shentsize < 40 {
-		return nil, fmt.Errorf("unexpected ELF32 section header entry size: %d", shentsize)
+		return nil, 0, fmt.Errorf("unexpected ELF32 section header entry size: %d", shentsize)
+	}
+	tableSize := uint64(shnum) * uint64(shentsize)
+	if uint64(shoff) > uint64(len(data)) || tableSize > uint64(len(data))-uint64(shoff) {
+		return nil, 0, fmt.Errorf("%w: section header table at %d runs past the end of the file", ErrELFUnsupported, shoff)
 	}
 
 	shstrtabData, err := ef.Sections[shstrndx].Data()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read .shstrtab: %w", err)
+		return nil, 0, fmt.Errorf("failed to read .shstrtab: %w", err)
 	}
 
 	newNameOffset := uint32(len(shstrtabData))
@@ -186,13 +317,19 @@ func injectELF32(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, e
 
 	placeholderData := []byte(opts.Placeholder)
 
-	output := make([]byte, len(data))
-	copy(output, data)
-	padTo(&output, 4)
+	output := elfOutputBase(data, ef, uint64(shoff), tableSize)
+	align := elfSectionAlign(ef, opts)
+	padTo(&output, align)
+
+	noteOff := uint64(len(output))
+	if opts.wrapsNote() {
+		output = append(output, elfNoteHeader(ef, len(placeholderData))...)
+	}
 
 	placeholderOff := uint32(len(output))
 	output = append(output, placeholderData...)
 	padTo(&output, 4)
+	sectionOff, sectionSize := opts.sectionExtent(noteOff, uint64(placeholderOff), len(placeholderData))
 
 	newShstrtabOff := uint32(len(output))
 	output = append(output, newShstrtabData...)
@@ -200,7 +337,7 @@ func injectELF32(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, e
 
 	newShoff := uint32(len(output))
 
-	for i := uint16(0); i < shnum; i++ {
+	for i := 0; i < shnum; i++ {
 		off := shoff + uint32(i)*uint32(shentsize)
 		entry := make([]byte, shentsize)
 		copy(entry, data[off:off+uint32(shentsize)])
@@ -209,22 +346,98 @@ func injectELF32(data []byte, ef *elf.File, opts ELFInjectionOptions) ([]byte, e
 			bo.PutUint32(entry[16:], newShstrtabOff)
 			bo.PutUint32(entry[20:], uint32(len(newShstrtabData)))
 		}
+		if i == 0 && shnum+1 >= int(elf.SHN_LORESERVE) {
+			bo.PutUint32(entry[20:], uint32(shnum+1))
+		}
 
 		output = append(output, entry...)
 	}
 
 	newShdr := make([]byte, shentsize)
 	bo.PutUint32(newShdr[0:], newNameOffset)              // sh_name
-	bo.PutUint32(newShdr[4:], uint32(elf.SHT_PROGBITS))   // sh_type
-	bo.PutUint32(newShdr[16:], placeholderOff)             // sh_offset
-	bo.PutUint32(newShdr[20:], uint32(len(placeholderData))) // sh_size
-	bo.PutUint32(newShdr[32:], 1)                          // sh_addralign
+	bo.PutUint32(newShdr[4:], uint32(opts.SectionType))   // sh_type
+	bo.PutUint32(newShdr[8:], uint32(opts.SectionFlags))  // sh_flags
+	bo.PutUint32(newShdr[16:], uint32(sectionOff))         // sh_offset
+	bo.PutUint32(newShdr[20:], uint32(sectionSize))        // sh_size
+	bo.PutUint32(newShdr[32:], uint32(align))              // sh_addralign
 	output = append(output, newShdr...)
 
-	bo.PutUint32(output[0x20:], newShoff) // e_shoff
-	bo.PutUint16(output[0x30:], shnum+1)  // e_shnum
+	bo.PutUint32(output[0x20:], newShoff)                // e_shoff
+	bo.PutUint16(output[0x30:], elfHeaderShnum(shnum+1)) // e_shnum
+
+	if opts.AddNoteSegment {
+		if err := addNoteSegment(output, ef, noteOff, elfNoteSize(len(placeholderData))); err != nil {
+			return nil, 0, err
+		}
+	}
 
-	return output, nil
+	return output, int64(placeholderOff), nil
+}
+
+// elfSectionIndexes returns the number of sections and the index of the
+// section name string table, given e_shstrndx. Files with SHN_LORESERVE or
+// more sections keep both in section 0: e_shnum is then 0 with the count in
+// its sh_size, which debug/elf already resolves, and e_shstrndx is
+// SHN_XINDEX with the index in its sh_link.
+func elfSectionIndexes(ef *elf.File, eShstrndx uint16) (int, int, error) {
+	shnum := len(ef.Sections)
+	if shnum == 0 {
+		return 0, 0, ErrNoSectionHeaders
+	}
+
+	shstrndx := int(eShstrndx)
+	if eShstrndx == uint16(elf.SHN_XINDEX) {
+		shstrndx = int(ef.Sections[0].Link)
+	}
+	// SHN_UNDEF leaves nowhere to name the new section
+	if shstrndx == int(elf.SHN_UNDEF) {
+		return 0, 0, ErrNoSectionNames
+	}
+	if shstrndx >= shnum {
+		return 0, 0, ErrNoSectionHeaders
+	}
+	return shnum, shstrndx, nil
+}
+
+// elfHeaderShnum is the e_shnum recording shnum sections: shnum itself, or
+// 0 once it no longer fits and section 0's sh_size holds it instead
+func elfHeaderShnum(shnum int) uint16 {
+	if shnum >= int(elf.SHN_LORESERVE) {
+		return 0
+	}
+	return uint16(shnum)
+}
+
+// elfOutputBase returns a copy of the bytes the injected content is appended to.
+// When the section header table is the last thing in the file, as linkers
+// normally leave it, the table is dropped so the rewritten one replaces it
+// rather than leaving a stale copy behind. Otherwise, e.g. with data appended
+// after the table, the whole file is kept so nothing at a known offset moves;
+// the old table stays in place but e_shoff no longer points to it.
+func elfOutputBase(data []byte, ef *elf.File, shoff, tableSize uint64) []byte {
+	end := uint64(len(data))
+	if shoff+tableSize == end && !elfContentAfter(ef, shoff) {
+		end = shoff
+	}
+
+	output := make([]byte, end)
+	copy(output, data)
+	return output
+}
+
+// elfContentAfter reports whether any section or segment has file content at or beyond off
+func elfContentAfter(ef *elf.File, off uint64) bool {
+	for _, sec := range ef.Sections {
+		if sec.Type != elf.SHT_NOBITS && sec.Size > 0 && sec.Offset+sec.Size > off {
+			return true
+		}
+	}
+	for _, prog := range ef.Progs {
+		if prog.Filesz > 0 && prog.Off+prog.Filesz > off {
+			return true
+		}
+	}
+	return false
 }
 
 // IsELF checks if the given data starts with the ELF magic bytes
@@ -232,6 +445,37 @@ func IsELF(data []byte) bool {
 	return len(data) >= 4 && data[0] == 0x7f && data[1] == 'E' && data[2] == 'L' && data[3] == 'F'
 }
 
+// elfSectionAlign is the alignment of the injected section, which its
+// sh_addralign records. Wrapped in a note the placeholder is the note's
+// descriptor, aligned like the note's 4-byte words; otherwise it is aligned
+// to the word size of the ELF class.
+func elfSectionAlign(ef *elf.File, opts ELFInjectionOptions) int {
+	switch {
+	case opts.wrapsNote():
+		return elfNoteAlign
+	case ef.Class == elf.ELFCLASS64:
+		return 8
+	default:
+		return 4
+	}
+}
+
+// wrapsNote reports whether the placeholder is written as the descriptor of
+// an ELF note, which both a PT_NOTE segment and an SHT_NOTE section require
+func (opts ELFInjectionOptions) wrapsNote() bool {
+	return opts.AddNoteSegment || opts.SectionType == elf.SHT_NOTE
+}
+
+// sectionExtent returns the file range the injected section covers: the
+// whole note starting at noteOff for an SHT_NOTE section, otherwise just the
+// placeholder of placeholderLen bytes at placeholderOff
+func (opts ELFInjectionOptions) sectionExtent(noteOff, placeholderOff uint64, placeholderLen int) (uint64, uint64) {
+	if opts.SectionType == elf.SHT_NOTE {
+		return noteOff, elfNoteSize(placeholderLen)
+	}
+	return placeholderOff, uint64(placeholderLen)
+}
+
 func padTo(data *[]byte, align int) {
 	for len(*data)%align != 0 {
 		*data = append(*data, 0)
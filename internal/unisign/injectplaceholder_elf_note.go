@@ -0,0 +1,233 @@
+package unisign
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrNoRoomForSegment is returned when a PT_NOTE program header cannot be added
+// without moving existing file content
+var ErrNoRoomForSegment = errors.New("no room for an extra program header")
+
+// elfNoteName is the owner name of the note wrapping the placeholder
+const elfNoteName = "unisign\x00"
+
+// elfNoteType is the note type of the placeholder note; types are scoped to the owner name
+const elfNoteType = 1
+
+// elfNoteAlign is the alignment of the note and of its descriptor, the placeholder
+const elfNoteAlign = 4
+
+// elfNoteHeaderSize is the size of the note header and name that precede the placeholder
+const elfNoteHeaderSize = 12 + len(elfNoteName)
+
+// elfNoteHeader returns the note header and owner name for a note whose
+// descriptor is a placeholder of the given length. Placing it directly before
+// the placeholder makes the two a well-formed ELF note that a PT_NOTE segment
+// can point at, while the section still covers the placeholder alone.
+func elfNoteHeader(ef *elf.File, placeholderLen int) []byte {
+	header := make([]byte, elfNoteHeaderSize)
+	ef.ByteOrder.PutUint32(header[0:], uint32(len(elfNoteName))) // n_namesz
+	ef.ByteOrder.PutUint32(header[4:], uint32(placeholderLen))   // n_descsz
+	ef.ByteOrder.PutUint32(header[8:], elfNoteType)              // n_type
+	copy(header[12:], elfNoteName)
+	return header
+}
+
+// elfNoteSize is the size of the note wrapping a placeholder of the given
+// length, whose descriptor is padded to 4 bytes
+func elfNoteSize(placeholderLen int) uint64 {
+	return uint64(elfNoteHeaderSize + (placeholderLen+3)&^3)
+}
+
+// addNoteSegment adds a PT_NOTE program header covering [noteOff, noteOff+noteSize)
+// to output, which must still hold the original file's layout up to its old
+// section header table. The program header table is grown in place, which is
+// only possible when the bytes after it are unused; with Go's linker they hold
+// the old section header table, which injection has just relocated. The
+// segment is read-only and not loadable, so the program runs unchanged.
+func addNoteSegment(output []byte, ef *elf.File, noteOff, noteSize uint64) error {
+	bo := ef.ByteOrder
+
+	var phoff uint64
+	var phentsize, phnum uint16
+	if ef.Class == elf.ELFCLASS64 {
+		phoff = bo.Uint64(output[0x20:])
+		phentsize = bo.Uint16(output[0x36:])
+		phnum = bo.Uint16(output[0x38:])
+	} else {
+		phoff = uint64(bo.Uint32(output[0x1C:]))
+		phentsize = bo.Uint16(output[0x2A:])
+		phnum = bo.Uint16(output[0x2C:])
+	}
+	if phnum == 0 || phnum == 0xFFFF {
+		return fmt.Errorf("%w: unsupported program header count %d", ErrNoRoomForSegment, phnum)
+	}
+
+	oldEnd := phoff + uint64(phnum)*uint64(phentsize)
+	newEnd := oldEnd + uint64(phentsize)
+
+	// The new entry must not overwrite any section or segment content
+	for _, sec := range ef.Sections {
+		if sec.Type == elf.SHT_NULL || sec.Type == elf.SHT_NOBITS || sec.Size == 0 {
+			continue
+		}
+		if sec.Offset < newEnd && sec.Offset+sec.Size > oldEnd {
+			return fmt.Errorf("%w: section %s follows the program header table", ErrNoRoomForSegment, sec.Name)
+		}
+	}
+	for _, prog := range ef.Progs {
+		if prog.Type == elf.PT_PHDR || prog.Filesz == 0 {
+			continue
+		}
+		// A loadable segment mapping the whole grown table is fine; it is what makes the table visible at run time
+		if prog.Type == elf.PT_LOAD && prog.Off <= phoff && prog.Off+prog.Filesz >= newEnd {
+			continue
+		}
+		if prog.Off < newEnd && prog.Off+prog.Filesz > oldEnd {
+			return fmt.Errorf("%w: a %v segment follows the program header table", ErrNoRoomForSegment, prog.Type)
+		}
+		if prog.Type == elf.PT_LOAD && prog.Off <= phoff && prog.Off+prog.Filesz > phoff {
+			return fmt.Errorf("%w: the loaded program header table cannot grow", ErrNoRoomForSegment)
+		}
+	}
+
+	entry := output[oldEnd:newEnd]
+	clear(entry)
+	if ef.Class == elf.ELFCLASS64 {
+		bo.PutUint32(entry[0:], uint32(elf.PT_NOTE)) // p_type
+		bo.PutUint32(entry[4:], uint32(elf.PF_R))    // p_flags
+		bo.PutUint64(entry[8:], noteOff)             // p_offset
+		bo.PutUint64(entry[32:], noteSize)           // p_filesz
+		bo.PutUint64(entry[40:], noteSize)           // p_memsz
+		bo.PutUint64(entry[48:], elfNoteAlign)       // p_align
+		bo.PutUint16(output[0x38:], phnum+1)         // e_phnum
+	} else {
+		bo.PutUint32(entry[0:], uint32(elf.PT_NOTE)) // p_type
+		bo.PutUint32(entry[4:], uint32(noteOff))     // p_offset
+		bo.PutUint32(entry[16:], uint32(noteSize))   // p_filesz
+		bo.PutUint32(entry[20:], uint32(noteSize))   // p_memsz
+		bo.PutUint32(entry[24:], uint32(elf.PF_R))   // p_flags
+		bo.PutUint32(entry[28:], elfNoteAlign)       // p_align
+		bo.PutUint16(output[0x2C:], phnum+1)         // e_phnum
+	}
+
+	// PT_PHDR describes the table itself, so it grows with it
+	for i, prog := range ef.Progs {
+		if prog.Type != elf.PT_PHDR {
+			continue
+		}
+		ph := output[phoff+uint64(i)*uint64(phentsize):]
+		if ef.Class == elf.ELFCLASS64 {
+			bo.PutUint64(ph[32:], prog.Filesz+uint64(phentsize))
+			bo.PutUint64(ph[40:], prog.Memsz+uint64(phentsize))
+		} else {
+			bo.PutUint32(ph[16:], uint32(prog.Filesz)+uint32(phentsize))
+			bo.PutUint32(ph[20:], uint32(prog.Memsz)+uint32(phentsize))
+		}
+	}
+
+	return nil
+}
+
+// ELFNoteDescriptor is the descriptor of a "unisign" note, the placeholder or
+// the signature that replaced it
+type ELFNoteDescriptor struct {
+	Offset int64 // file offset of the descriptor
+	Size   int64 // n_descsz, without padding
+}
+
+// ELFNoteDescriptors returns, in file order, the descriptor of every note
+// owned by "unisign" with the placeholder's note type, as inject-placeholder
+// writes them with an SHT_NOTE section or a PT_NOTE segment. Both are read,
+// and a note reached through both is returned once. Notes are parsed through
+// their headers, so the note header and owner name in front of the descriptor
+// are never taken for part of the signature region. An ELF file without such
+// a note gives none and no error.
+func ELFNoteDescriptors(data []byte) ([]ELFNoteDescriptor, error) {
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotELF, err)
+	}
+	defer ef.Close()
+
+	seen := make(map[int64]bool)
+	var descs []ELFNoteDescriptor
+	add := func(off, size, align uint64) {
+		if off > uint64(len(data)) || size > uint64(len(data))-off {
+			return
+		}
+		for _, desc := range parseELFNotes(data[off:off+size], ef.ByteOrder, align) {
+			desc.Offset += int64(off)
+			if !seen[desc.Offset] {
+				seen[desc.Offset] = true
+				descs = append(descs, desc)
+			}
+		}
+	}
+	for _, sec := range ef.Sections {
+		if sec.Type == elf.SHT_NOTE {
+			add(sec.Offset, sec.Size, sec.Addralign)
+		}
+	}
+	for _, prog := range ef.Progs {
+		if prog.Type == elf.PT_NOTE {
+			add(prog.Off, prog.Filesz, prog.Align)
+		}
+	}
+
+	sort.Slice(descs, func(i, j int) bool { return descs[i].Offset < descs[j].Offset })
+	return descs, nil
+}
+
+// ELFPlaceholderSection returns the file range of the .note.unisign section
+// inject-placeholder adds by default, if data has one holding the placeholder
+// alone, as an SHT_PROGBITS section does. An SHT_NOTE section holds a whole
+// note, whose descriptor ELFNoteDescriptors returns instead.
+func ELFPlaceholderSection(data []byte) (offset, size int64, ok bool) {
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	defer ef.Close()
+
+	sec := ef.Section(defaultELFSection)
+	if sec == nil || sec.Type != elf.SHT_PROGBITS || sec.Offset > uint64(len(data)) || sec.Size > uint64(len(data))-sec.Offset {
+		return 0, 0, false
+	}
+	return int64(sec.Offset), int64(sec.Size), true
+}
+
+// parseELFNotes returns the descriptors of the placeholder notes in region,
+// a run of notes aligned to align bytes (8 for 8-aligned notes, 4 otherwise),
+// with offsets relative to region. Parsing
+// stops at the first note that doesn't fit in region.
+func parseELFNotes(region []byte, bo binary.ByteOrder, align uint64) []ELFNoteDescriptor {
+	if align != 8 {
+		align = elfNoteAlign
+	}
+	pad := func(n uint64) uint64 { return (n + align - 1) &^ (align - 1) }
+
+	var descs []ELFNoteDescriptor
+	for pos := uint64(0); pos+12 <= uint64(len(region)); {
+		namesz := uint64(bo.Uint32(region[pos:]))
+		descsz := uint64(bo.Uint32(region[pos+4:]))
+		typ := bo.Uint32(region[pos+8:])
+
+		// The descriptor is aligned within the note, header included
+		nameOff := pos + 12
+		descOff := pos + pad(12+namesz)
+		if descOff > uint64(len(region)) || descsz > uint64(len(region))-descOff {
+			break
+		}
+		if typ == elfNoteType && string(region[nameOff:nameOff+namesz]) == elfNoteName {
+			descs = append(descs, ELFNoteDescriptor{Offset: int64(descOff), Size: int64(descsz)})
+		}
+		pos = descOff + pad(descsz)
+	}
+	return descs
+}
@@ -3,15 +3,25 @@ package unisign
 import (
 	"bytes"
 	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
 func buildTestELF64(t *testing.T, dir string) string {
 	t.Helper()
+	return buildTestELF(t, dir, "amd64")
+}
+
+// buildTestELF cross-compiles a small Go program for linux/goarch
+func buildTestELF(t *testing.T, dir, goarch string) string {
+	t.Helper()
 
 	srcPath := filepath.Join(dir, "main.go")
 	if err := os.WriteFile(srcPath, []byte(`package main
@@ -25,7 +35,7 @@ func main() { fmt.Println("hello from elf") }
 
 	binPath := filepath.Join(dir, "testbin")
 	cmd := exec.Command("go", "build", "-o", binPath, srcPath)
-	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+goarch, "CGO_ENABLED=0")
 	if out, err := cmd.CombinedOutput(); err != nil {
 		t.Fatalf("failed to compile test binary: %v\n%s", err, out)
 	}
@@ -146,6 +156,27 @@ func TestInjectPlaceholderIntoELF_SectionAlreadyExists(t *testing.T) {
 	}
 }
 
+func TestInjectPlaceholderIntoELF_InvalidSectionName(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+
+	for _, name := range []string{".note\x00evil", "no_dot", "." + strings.Repeat("x", 64)} {
+		outPath := filepath.Join(tmpDir, "out")
+		err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+			InputPath:   binPath,
+			OutputPath:  outPath,
+			Placeholder: MagicString,
+			SectionName: name,
+		})
+		if !errors.Is(err, ErrInvalidSectionName) {
+			t.Errorf("section name %q: expected ErrInvalidSectionName, got %v", name, err)
+		}
+		if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+			t.Errorf("section name %q: output was written despite the rejection", name)
+		}
+	}
+}
+
 func TestInjectPlaceholderIntoELF_InvalidFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	invalidPath := filepath.Join(tmpDir, "notelf")
@@ -222,3 +253,825 @@ func TestIsELF(t *testing.T) {
 		})
 	}
 }
+
+func TestInjectPlaceholderIntoELF_PreservesFileMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+	if err := os.Chmod(binPath, 0700); err != nil {
+		t.Fatalf("failed to chmod input: %v", err)
+	}
+
+	outPath := filepath.Join(tmpDir, "testbin.placeholder")
+	opts := ELFInjectionOptions{
+		InputPath:   binPath,
+		OutputPath:  outPath,
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoELF(opts); err != nil {
+		t.Fatalf("injection failed: %v", err)
+	}
+
+	info, err := os.Stat(outPath)
+	if err != nil {
+		t.Fatalf("failed to stat output: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0700 {
+		t.Errorf("output mode = %o, want %o", got, 0700)
+	}
+}
+
+// sectionHeaderTable returns the raw section header table of an ELF64 file
+func sectionHeaderTable(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not parseable as ELF: %v", err)
+	}
+	defer ef.Close()
+
+	bo := ef.ByteOrder
+	shoff := bo.Uint64(data[0x28:])
+	size := uint64(bo.Uint16(data[0x3A:])) * uint64(bo.Uint16(data[0x3C:]))
+	return data[shoff : shoff+size]
+}
+
+func TestInjectPlaceholderIntoELF_ReplacesTrailingSectionHeaders(t *testing.T) {
+	if _, err := exec.LookPath("strip"); err != nil {
+		t.Skip("strip not available")
+	}
+
+	// Go's linker puts the section headers near the start; strip moves them to the end
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+	if out, err := exec.Command("strip", binPath).CombinedOutput(); err != nil {
+		t.Skipf("strip cannot process the test binary: %v\n%s", err, out)
+	}
+
+	inData, err := os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("failed to read input: %v", err)
+	}
+	oldTable := sectionHeaderTable(t, inData)
+	if !bytes.HasSuffix(inData, oldTable) {
+		t.Skip("strip did not place the section header table at the end of the file")
+	}
+
+	outPath := filepath.Join(tmpDir, "out")
+	if err := InjectPlaceholderIntoELF(ELFInjectionOptions{InputPath: binPath, OutputPath: outPath, Placeholder: MagicString}); err != nil {
+		t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+	}
+	outData, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	// The old table is replaced, not left dangling before the new one
+	if bytes.Contains(outData, oldTable) {
+		t.Error("output still contains the original section header table")
+	}
+	if !bytes.HasSuffix(outData, sectionHeaderTable(t, outData)) {
+		t.Error("rewritten section header table is not at the end of the output")
+	}
+}
+
+func TestInjectPlaceholderIntoELF_TrailingData(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+
+	// Data after the section header table, e.g. an appended payload, must stay in place
+	inData, err := os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("failed to read input: %v", err)
+	}
+	inData = append(inData, []byte("APPENDED PAYLOAD")...)
+	inPath := filepath.Join(tmpDir, "with_trailer")
+	if err := os.WriteFile(inPath, inData, 0755); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	outPath := filepath.Join(tmpDir, "out")
+	if err := InjectPlaceholderIntoELF(ELFInjectionOptions{InputPath: inPath, OutputPath: outPath, Placeholder: MagicString}); err != nil {
+		t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+	}
+	outData, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	if !bytes.HasPrefix(outData, inData[:0x28]) || !bytes.Equal(outData[0x40:len(inData)], inData[0x40:]) {
+		t.Error("original content after the ELF header moved or changed")
+	}
+	ef, err := elf.NewFile(bytes.NewReader(outData))
+	if err != nil {
+		t.Fatalf("output is not parseable as ELF: %v", err)
+	}
+	defer ef.Close()
+	if sec := ef.Section(defaultELFSection); sec == nil {
+		t.Fatalf("%s section not found", defaultELFSection)
+	}
+}
+
+func TestInjectPlaceholderIntoELF_StrippedBinary(t *testing.T) {
+	if _, err := exec.LookPath("strip"); err != nil {
+		t.Skip("strip not available")
+	}
+
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+	if out, err := exec.Command("strip", binPath).CombinedOutput(); err != nil {
+		t.Skipf("strip cannot process the test binary: %v\n%s", err, out)
+	}
+
+	outPath := filepath.Join(tmpDir, "stripped.placeholder")
+	if err := InjectPlaceholderIntoELF(ELFInjectionOptions{InputPath: binPath, OutputPath: outPath, Placeholder: MagicString}); err != nil {
+		t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+	}
+
+	ef, err := elf.Open(outPath)
+	if err != nil {
+		t.Fatalf("output is not parseable as ELF: %v", err)
+	}
+	sec := ef.Section(defaultELFSection)
+	if sec == nil {
+		ef.Close()
+		t.Fatalf("%s section not found", defaultELFSection)
+	}
+	secData, err := sec.Data()
+	ef.Close()
+	if err != nil || string(secData) != MagicString {
+		t.Fatalf("section data = %q, %v", secData, err)
+	}
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return
+	}
+	out, err := exec.Command(outPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("stripped binary failed to run after injection: %v\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("hello from elf")) {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestInjectPlaceholderIntoELF_AddNoteSegment(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+
+	outPath := filepath.Join(tmpDir, "testbin.placeholder")
+	err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+		InputPath:      binPath,
+		OutputPath:     outPath,
+		Placeholder:    MagicString,
+		AddNoteSegment: true,
+	})
+	if err != nil {
+		t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+	}
+
+	ef, err := elf.Open(outPath)
+	if err != nil {
+		t.Fatalf("output is not parseable as ELF: %v", err)
+	}
+	defer ef.Close()
+
+	sec := ef.Section(defaultELFSection)
+	if sec == nil {
+		t.Fatalf("%s section not found", defaultELFSection)
+	}
+
+	// Exactly one new PT_NOTE segment wraps the placeholder section
+	var note *elf.Prog
+	for _, prog := range ef.Progs {
+		if prog.Type == elf.PT_NOTE && prog.Off+uint64(elfNoteHeaderSize) == sec.Offset {
+			note = prog
+		}
+	}
+	if note == nil {
+		t.Fatal("no PT_NOTE segment points at the placeholder")
+	}
+	if note.Flags != elf.PF_R {
+		t.Errorf("note segment flags = %v, want PF_R", note.Flags)
+	}
+
+	data := make([]byte, note.Filesz)
+	if _, err := note.ReadAt(data, 0); err != nil {
+		t.Fatalf("failed to read note segment: %v", err)
+	}
+	namesz := ef.ByteOrder.Uint32(data[0:])
+	descsz := ef.ByteOrder.Uint32(data[4:])
+	if name := string(data[12 : 12+namesz]); name != elfNoteName {
+		t.Errorf("note name = %q, want %q", name, elfNoteName)
+	}
+	if desc := string(data[elfNoteHeaderSize : elfNoteHeaderSize+int(descsz)]); desc != MagicString {
+		t.Errorf("note descriptor = %q, want the placeholder", desc)
+	}
+
+	// PT_PHDR grew with the table
+	for _, prog := range ef.Progs {
+		if prog.Type == elf.PT_PHDR && prog.Filesz != uint64(len(ef.Progs))*56 {
+			t.Errorf("PT_PHDR size = %d, want %d", prog.Filesz, len(ef.Progs)*56)
+		}
+	}
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return
+	}
+	out, err := exec.Command(outPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("binary with note segment failed to run: %v\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("hello from elf")) {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestInjectPlaceholderIntoELF_AddNoteSegmentNoRoom(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not available")
+	}
+
+	// GNU ld places .interp right after the program header table
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "main.c")
+	if err := os.WriteFile(srcPath, []byte("int main(void) { return 0; }\n"), 0644); err != nil {
+		t.Fatalf("failed to write test source: %v", err)
+	}
+	binPath := filepath.Join(tmpDir, "cbin")
+	if out, err := exec.Command("gcc", "-o", binPath, srcPath).CombinedOutput(); err != nil {
+		t.Skipf("gcc cannot build the test binary: %v\n%s", err, out)
+	}
+
+	outPath := filepath.Join(tmpDir, "out")
+	err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+		InputPath:      binPath,
+		OutputPath:     outPath,
+		Placeholder:    MagicString,
+		AddNoteSegment: true,
+	})
+	if !errors.Is(err, ErrNoRoomForSegment) {
+		t.Fatalf("expected ErrNoRoomForSegment, got %v", err)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Error("output was written despite the rejection")
+	}
+}
+
+func TestInjectPlaceholderIntoELF_BigEndian(t *testing.T) {
+	for _, tc := range []struct {
+		goarch string
+		class  elf.Class
+	}{
+		{"s390x", elf.ELFCLASS64},
+		{"mips", elf.ELFCLASS32},
+	} {
+		t.Run(tc.goarch, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			binPath := buildTestELF(t, tmpDir, tc.goarch)
+
+			outPath := filepath.Join(tmpDir, "testbin.placeholder")
+			err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+				InputPath:      binPath,
+				OutputPath:     outPath,
+				Placeholder:    MagicString,
+				AddNoteSegment: true,
+			})
+			if err != nil {
+				t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+			}
+
+			ef, err := elf.Open(outPath)
+			if err != nil {
+				t.Fatalf("output is not parseable as ELF: %v", err)
+			}
+			defer ef.Close()
+
+			if ef.ByteOrder != binary.BigEndian || ef.Class != tc.class {
+				t.Fatalf("test binary is %v %v, want big-endian %v", ef.ByteOrder, ef.Class, tc.class)
+			}
+
+			sec := ef.Section(defaultELFSection)
+			if sec == nil {
+				t.Fatalf("%s section not found", defaultELFSection)
+			}
+			secData, err := sec.Data()
+			if err != nil {
+				t.Fatalf("failed to read section data: %v", err)
+			}
+			if string(secData) != MagicString {
+				t.Errorf("section data = %q, want %q", secData, MagicString)
+			}
+
+			// The note must decode with the file's byte order too
+			found := false
+			for _, prog := range ef.Progs {
+				if prog.Type != elf.PT_NOTE || prog.Off+uint64(elfNoteHeaderSize) != sec.Offset {
+					continue
+				}
+				header := make([]byte, 12)
+				if _, err := prog.ReadAt(header, 0); err != nil {
+					t.Fatalf("failed to read note: %v", err)
+				}
+				if binary.BigEndian.Uint32(header[4:]) != uint32(len(MagicString)) {
+					t.Errorf("note descriptor size = %d, want %d", binary.BigEndian.Uint32(header[4:]), len(MagicString))
+				}
+				found = true
+			}
+			if !found {
+				t.Error("no PT_NOTE segment points at the placeholder")
+			}
+
+			// Every original section survives
+			origEf, err := elf.Open(binPath)
+			if err != nil {
+				t.Fatalf("failed to parse input: %v", err)
+			}
+			defer origEf.Close()
+			for _, origSec := range origEf.Sections {
+				if origSec.Name != "" && ef.Section(origSec.Name) == nil {
+					t.Errorf("original section %q missing from output", origSec.Name)
+				}
+			}
+		})
+	}
+}
+
+// syntheticELF builds a little-endian ELF object of the given class with
+// shnum sections, the last of them .shstrtab. With extended set, the count
+// and the string table index are stored in section 0, as for files with
+// SHN_LORESERVE or more sections.
+func syntheticELF(class elf.Class, shnum int, extended bool) []byte {
+	bo := binary.LittleEndian
+	shstrtab := []byte("\x00.shstrtab\x00")
+
+	// Header fields and section header size of each class
+	ehsize, shentsize, shoffAt, shnumAt, machine := 64, 64, 0x28, 0x3C, elf.EM_X86_64
+	if class == elf.ELFCLASS32 {
+		ehsize, shentsize, shoffAt, shnumAt, machine = 52, 40, 0x20, 0x30, elf.EM_386
+	}
+	putWord := func(b []byte, v uint64) {
+		if class == elf.ELFCLASS32 {
+			bo.PutUint32(b, uint32(v))
+		} else {
+			bo.PutUint64(b, v)
+		}
+	}
+	// sh_offset, sh_size and sh_link within a section header
+	offsetAt, sizeAt, linkAt := 24, 32, 40
+	if class == elf.ELFCLASS32 {
+		offsetAt, sizeAt, linkAt = 16, 20, 24
+	}
+	shstrtabOff := ehsize
+	shoff := ehsize + 16
+
+	data := make([]byte, shoff+shnum*shentsize)
+	copy(data, []byte{0x7f, 'E', 'L', 'F', byte(class), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)})
+	bo.PutUint16(data[0x10:], uint16(elf.ET_REL))
+	bo.PutUint16(data[0x12:], uint16(machine))
+	bo.PutUint32(data[0x14:], uint32(elf.EV_CURRENT))
+	putWord(data[shoffAt:], uint64(shoff))
+	bo.PutUint16(data[shnumAt-8:], uint16(ehsize))    // e_ehsize
+	bo.PutUint16(data[shnumAt-2:], uint16(shentsize)) // e_shentsize
+	if extended {
+		bo.PutUint16(data[shnumAt+2:], uint16(elf.SHN_XINDEX))
+		putWord(data[shoff+sizeAt:], uint64(shnum))
+		bo.PutUint32(data[shoff+linkAt:], uint32(shnum-1))
+	} else {
+		bo.PutUint16(data[shnumAt:], uint16(shnum))
+		bo.PutUint16(data[shnumAt+2:], uint16(shnum-1))
+	}
+	copy(data[shstrtabOff:], shstrtab)
+
+	last := data[shoff+(shnum-1)*shentsize:]
+	bo.PutUint32(last[0:], 1) // sh_name
+	bo.PutUint32(last[4:], uint32(elf.SHT_STRTAB))
+	putWord(last[offsetAt:], uint64(shstrtabOff))
+	putWord(last[sizeAt:], uint64(len(shstrtab)))
+	return data
+}
+
+func TestInjectPlaceholderIntoELF_ExtendedSectionNumbering(t *testing.T) {
+	for _, class := range []elf.Class{elf.ELFCLASS64, elf.ELFCLASS32} {
+		t.Run(class.String(), func(t *testing.T) {
+			shnum := int(elf.SHN_LORESERVE) + 1
+			output, _, err := injectELFData(syntheticELF(class, shnum, true), ELFInjectionOptions{
+				Placeholder: MagicString,
+				SectionName: defaultELFSection,
+			})
+			if err != nil {
+				t.Fatalf("injectELFData failed: %v", err)
+			}
+
+			ef, err := elf.NewFile(bytes.NewReader(output))
+			if err != nil {
+				t.Fatalf("output is not parseable as ELF: %v", err)
+			}
+			defer ef.Close()
+
+			// .shstrtab was found through section 0's sh_link and extended in place
+			if len(ef.Sections) != shnum+1 {
+				t.Errorf("got %d sections, want %d", len(ef.Sections), shnum+1)
+			}
+			if sec := ef.Sections[shnum-1]; sec.Name != ".shstrtab" {
+				t.Errorf("section %d is %q, want .shstrtab", shnum-1, sec.Name)
+			}
+			sec := ef.Section(defaultELFSection)
+			if sec == nil {
+				t.Fatalf("%s section not found", defaultELFSection)
+			}
+			secData, err := sec.Data()
+			if err != nil || string(secData) != MagicString {
+				t.Errorf("section data = %q, %v", secData, err)
+			}
+		})
+	}
+}
+
+func TestInjectPlaceholderIntoELF_SectionCountBoundary(t *testing.T) {
+	loreserve := int(elf.SHN_LORESERVE)
+	for _, class := range []elf.Class{elf.ELFCLASS64, elf.ELFCLASS32} {
+		shnumAt := 0x3C
+		if class == elf.ELFCLASS32 {
+			shnumAt = 0x30
+		}
+		for _, tc := range []struct {
+			shnum       int
+			wantEShnum  uint16
+			wantSection uint64
+		}{
+			// The new count still fits e_shnum
+			{loreserve - 2, uint16(loreserve - 1), 0},
+			// The new count would read as SHN_LORESERVE, so it moves to section 0
+			{loreserve - 1, 0, uint64(loreserve)},
+		} {
+			t.Run(fmt.Sprintf("%v/%d", class, tc.shnum), func(t *testing.T) {
+				output, _, err := injectELFData(syntheticELF(class, tc.shnum, false), ELFInjectionOptions{
+					Placeholder: MagicString,
+					SectionName: defaultELFSection,
+				})
+				if err != nil {
+					t.Fatalf("injectELFData failed: %v", err)
+				}
+
+				if got := binary.LittleEndian.Uint16(output[shnumAt:]); got != tc.wantEShnum {
+					t.Errorf("e_shnum = %#x, want %#x", got, tc.wantEShnum)
+				}
+				ef, err := elf.NewFile(bytes.NewReader(output))
+				if err != nil {
+					t.Fatalf("output is not parseable as ELF: %v", err)
+				}
+				defer ef.Close()
+				if ef.Sections[0].Size != tc.wantSection {
+					t.Errorf("section 0 sh_size = %d, want %d", ef.Sections[0].Size, tc.wantSection)
+				}
+				if len(ef.Sections) != tc.shnum+1 || ef.Section(defaultELFSection) == nil {
+					t.Errorf("got %d sections, want %d ending with %s", len(ef.Sections), tc.shnum+1, defaultELFSection)
+				}
+			})
+		}
+	}
+}
+
+func TestInjectPlaceholderIntoELF_NoSectionNames(t *testing.T) {
+	data := syntheticELF(elf.ELFCLASS64, 3, false)
+	binary.LittleEndian.PutUint16(data[0x3E:], uint16(elf.SHN_UNDEF))
+
+	_, _, err := injectELFData(data, ELFInjectionOptions{Placeholder: MagicString, SectionName: defaultELFSection})
+	if !errors.Is(err, ErrNoSectionNames) {
+		t.Errorf("error = %v, want ErrNoSectionNames", err)
+	}
+}
+
+func TestInjectPlaceholderIntoELF_SectionAlignment(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		goarch    string
+		addNote   bool
+		wantAlign uint64
+	}{
+		{"elf64", "amd64", false, 8},
+		{"elf64 note", "amd64", true, elfNoteAlign},
+		{"elf32", "386", false, 4},
+		{"elf32 note", "386", true, elfNoteAlign},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			binPath := buildTestELF(t, tmpDir, tc.goarch)
+
+			outPath := filepath.Join(tmpDir, "testbin.placeholder")
+			err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+				InputPath:      binPath,
+				OutputPath:     outPath,
+				Placeholder:    MagicString,
+				AddNoteSegment: tc.addNote,
+			})
+			if err != nil {
+				t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+			}
+
+			ef, err := elf.Open(outPath)
+			if err != nil {
+				t.Fatalf("output is not parseable as ELF: %v", err)
+			}
+			defer ef.Close()
+
+			sec := ef.Section(defaultELFSection)
+			if sec == nil {
+				t.Fatalf("%s section not found", defaultELFSection)
+			}
+			if sec.Addralign != tc.wantAlign {
+				t.Errorf("sh_addralign = %d, want %d", sec.Addralign, tc.wantAlign)
+			}
+			if sec.Offset%sec.Addralign != 0 {
+				t.Errorf("sh_offset %d is not a multiple of sh_addralign %d", sec.Offset, sec.Addralign)
+			}
+
+			if !tc.addNote {
+				return
+			}
+			for _, prog := range ef.Progs {
+				if prog.Type != elf.PT_NOTE || prog.Off+uint64(elfNoteHeaderSize) != sec.Offset {
+					continue
+				}
+				if prog.Align != elfNoteAlign || prog.Off%prog.Align != 0 {
+					t.Errorf("note segment at %d has p_align %d, want an offset aligned to %d", prog.Off, prog.Align, elfNoteAlign)
+				}
+				return
+			}
+			t.Error("no PT_NOTE segment points at the placeholder")
+		})
+	}
+}
+
+func TestInjectPlaceholderIntoELF_SectionTypeAndFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		goarch  string
+		addNote bool
+	}{
+		{"elf64", "amd64", false},
+		{"elf64 note segment", "amd64", true},
+		{"elf32", "386", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			binPath := buildTestELF(t, tmpDir, tc.goarch)
+
+			outPath := filepath.Join(tmpDir, "testbin.placeholder")
+			err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+				InputPath:      binPath,
+				OutputPath:     outPath,
+				Placeholder:    MagicString,
+				AddNoteSegment: tc.addNote,
+				SectionType:    elf.SHT_NOTE,
+				SectionFlags:   elf.SHF_OS_NONCONFORMING,
+			})
+			if err != nil {
+				t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+			}
+
+			ef, err := elf.Open(outPath)
+			if err != nil {
+				t.Fatalf("output is not parseable as ELF: %v", err)
+			}
+			defer ef.Close()
+
+			sec := ef.Section(defaultELFSection)
+			if sec == nil {
+				t.Fatalf("%s section not found", defaultELFSection)
+			}
+			if sec.Type != elf.SHT_NOTE || sec.Flags != elf.SHF_OS_NONCONFORMING {
+				t.Errorf("section type %v, flags %v; want SHT_NOTE, SHF_OS_NONCONFORMING", sec.Type, sec.Flags)
+			}
+
+			// The section is a well-formed note whose descriptor is the placeholder
+			data, err := sec.Data()
+			if err != nil {
+				t.Fatalf("failed to read section: %v", err)
+			}
+			if uint64(len(data)) != elfNoteSize(len(MagicString)) {
+				t.Fatalf("section is %d bytes, want the %d-byte note", len(data), elfNoteSize(len(MagicString)))
+			}
+			namesz := ef.ByteOrder.Uint32(data[0:])
+			descsz := ef.ByteOrder.Uint32(data[4:])
+			if typ := ef.ByteOrder.Uint32(data[8:]); typ != elfNoteType {
+				t.Errorf("note type = %d, want %d", typ, elfNoteType)
+			}
+			if name := string(data[12 : 12+namesz]); name != elfNoteName {
+				t.Errorf("note name = %q, want %q", name, elfNoteName)
+			}
+			if desc := string(data[elfNoteHeaderSize : elfNoteHeaderSize+int(descsz)]); desc != MagicString {
+				t.Errorf("note descriptor = %q, want the placeholder", desc)
+			}
+
+			if !tc.addNote {
+				return
+			}
+			for _, prog := range ef.Progs {
+				if prog.Type == elf.PT_NOTE && prog.Off == sec.Offset && prog.Filesz == sec.Size {
+					return
+				}
+			}
+			t.Error("no PT_NOTE segment covers the note section")
+		})
+	}
+}
+
+func TestELFNoteDescriptors(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+
+	for _, tc := range []struct {
+		name string
+		opts ELFInjectionOptions
+		want int
+	}{
+		{"note section", ELFInjectionOptions{SectionType: elf.SHT_NOTE}, 1},
+		// The section and segment reach the same note, which counts once
+		{"note section and segment", ELFInjectionOptions{SectionType: elf.SHT_NOTE, AddNoteSegment: true}, 1},
+		{"note segment", ELFInjectionOptions{AddNoteSegment: true}, 1},
+		{"plain section", ELFInjectionOptions{}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.InputPath = binPath
+			opts.OutputPath = filepath.Join(t.TempDir(), "testbin.placeholder")
+			opts.Placeholder = MagicString
+			if err := InjectPlaceholderIntoELF(opts); err != nil {
+				t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+			}
+			data, err := os.ReadFile(opts.OutputPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+
+			// The Go build ID note is skipped; only the placeholder note is returned
+			descs, err := ELFNoteDescriptors(data)
+			if err != nil {
+				t.Fatalf("ELFNoteDescriptors failed: %v", err)
+			}
+			if len(descs) != tc.want {
+				t.Fatalf("got %d descriptors, want %d: %+v", len(descs), tc.want, descs)
+			}
+			for _, desc := range descs {
+				if desc.Size != int64(len(MagicString)) || string(data[desc.Offset:desc.Offset+desc.Size]) != MagicString {
+					t.Errorf("descriptor %+v does not hold the placeholder", desc)
+				}
+			}
+		})
+	}
+
+	if _, err := ELFNoteDescriptors([]byte("not an ELF file")); !errors.Is(err, ErrNotELF) {
+		t.Errorf("non-ELF input = %v, want ErrNotELF", err)
+	}
+}
+
+func TestELFPlaceholderSection(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+
+	for _, tc := range []struct {
+		name string
+		typ  elf.SectionType
+		want bool
+	}{
+		{"plain section", elf.SHT_PROGBITS, true},
+		// A note section holds the note header too; its descriptor is the region
+		{"note section", elf.SHT_NOTE, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "testbin.placeholder")
+			err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+				InputPath:   binPath,
+				OutputPath:  outPath,
+				Placeholder: MagicString,
+				SectionType: tc.typ,
+			})
+			if err != nil {
+				t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+
+			offset, size, ok := ELFPlaceholderSection(data)
+			if ok != tc.want {
+				t.Fatalf("ok = %v, want %v", ok, tc.want)
+			}
+			if ok && string(data[offset:offset+size]) != MagicString {
+				t.Errorf("section [%d, +%d) does not hold the placeholder", offset, size)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("failed to read binary: %v", err)
+	}
+	if _, _, ok := ELFPlaceholderSection(data); ok {
+		t.Error("found a placeholder section in a binary without one")
+	}
+}
+
+func TestParseELFNotes(t *testing.T) {
+	note := func(name string, typ uint32, desc string, align int) []byte {
+		var b []byte
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(name)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(desc)))
+		b = binary.LittleEndian.AppendUint32(b, typ)
+		b = append(b, name...)
+		padTo(&b, align)
+		b = append(b, desc...)
+		padTo(&b, align)
+		return b
+	}
+
+	// Another owner's note, one of ours with another type, then ours
+	region := note("GNU\x00", 3, "buildid", 4)
+	region = append(region, note(elfNoteName, 2, "other", 4)...)
+	ourOffset := len(region) + elfNoteHeaderSize
+	region = append(region, note(elfNoteName, elfNoteType, "us2-desc", 4)...)
+	descs := parseELFNotes(region, binary.LittleEndian, 4)
+	if len(descs) != 1 || descs[0] != (ELFNoteDescriptor{Offset: int64(ourOffset), Size: 8}) {
+		t.Errorf("got %+v, want one descriptor at %d", descs, ourOffset)
+	}
+
+	// 8-aligned notes pad the header and name, and the descriptor, to 8 bytes
+	region = append(note("GNU\x00", 5, "prop", 8), note(elfNoteName, elfNoteType, "us2-desc", 8)...)
+	descs = parseELFNotes(region, binary.LittleEndian, 8)
+	if len(descs) != 1 || descs[0].Offset != int64(len(note("GNU\x00", 5, "prop", 8))+24) {
+		t.Errorf("8-aligned: got %+v", descs)
+	}
+
+	// A descriptor running past the region ends parsing
+	truncated := note(elfNoteName, elfNoteType, "us2-desc", 4)
+	if descs := parseELFNotes(truncated[:len(truncated)-4], binary.LittleEndian, 4); len(descs) != 0 {
+		t.Errorf("truncated note: got %+v, want none", descs)
+	}
+}
+
+func TestInjectPlaceholderIntoELF_DefaultSectionKind(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+
+	outPath := filepath.Join(tmpDir, "testbin.placeholder")
+	if err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+		InputPath:   binPath,
+		OutputPath:  outPath,
+		Placeholder: MagicString,
+	}); err != nil {
+		t.Fatalf("InjectPlaceholderIntoELF failed: %v", err)
+	}
+
+	ef, err := elf.Open(outPath)
+	if err != nil {
+		t.Fatalf("output is not parseable as ELF: %v", err)
+	}
+	defer ef.Close()
+
+	sec := ef.Section(defaultELFSection)
+	if sec == nil {
+		t.Fatalf("%s section not found", defaultELFSection)
+	}
+	if sec.Type != elf.SHT_PROGBITS || sec.Flags != 0 || sec.Size != uint64(len(MagicString)) {
+		t.Errorf("section type %v, flags %v, size %d; want SHT_PROGBITS, no flags, the placeholder alone",
+			sec.Type, sec.Flags, sec.Size)
+	}
+}
+
+func TestInjectPlaceholderIntoELF_InvalidSectionKind(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+
+	for _, tc := range []struct {
+		name  string
+		typ   elf.SectionType
+		flags elf.SectionFlag
+	}{
+		{"alloc", elf.SHT_PROGBITS, elf.SHF_ALLOC},
+		{"alloc note", elf.SHT_NOTE, elf.SHF_ALLOC | elf.SHF_WRITE},
+		{"executable", elf.SHT_PROGBITS, elf.SHF_EXECINSTR},
+		{"compressed", elf.SHT_PROGBITS, elf.SHF_COMPRESSED},
+		{"nobits", elf.SHT_NOBITS, 0},
+		{"symtab", elf.SHT_SYMTAB, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tmpDir, "out-"+tc.name)
+			err := InjectPlaceholderIntoELF(ELFInjectionOptions{
+				InputPath:    binPath,
+				OutputPath:   outPath,
+				Placeholder:  MagicString,
+				SectionType:  tc.typ,
+				SectionFlags: tc.flags,
+			})
+			if !errors.Is(err, ErrInvalidSectionKind) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidSectionKind)
+			}
+			if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+				t.Errorf("output written despite the invalid section kind")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package unisign
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"unisign/pkg/unisign"
+)
+
+// EmbeddedInjectionOptions defines the options for injecting a placeholder
+// into data a Go program embeds with //go:embed
+type EmbeddedInjectionOptions struct {
+	// InputPath is the path to the built binary
+	InputPath string
+
+	// OutputPath is the path where the modified binary will be written
+	OutputPath string
+
+	// Marker is the unique content of the embedded file that is replaced by
+	// the placeholder. If empty, the placeholder itself is expected to be
+	// embedded already and is only validated.
+	Marker string
+
+	// Placeholder is the magic string to be injected
+	Placeholder string
+
+	// InPlace allows OutputPath to name the input file, which is then
+	// replaced atomically. Without it such an output is ErrOutputIsInput.
+	InPlace bool
+}
+
+var (
+	ErrMarkerLength              = errors.New("embedded marker must have the same length as the placeholder")
+	ErrPlaceholderNotAddressable = errors.New("placeholder is not stored in a file-backed ELF section")
+)
+
+// InjectPlaceholderIntoEmbeddedData injects a magic placeholder into a region
+// of a binary that holds //go:embed data.
+//
+// The Go toolchain stores embedded files verbatim in the binary's read-only
+// data, so a program can embed a file containing a unique marker and this
+// function swaps the marker for the placeholder in place. It works like the
+// generic buffer replace used by sign, with extra validation:
+//  1. The marker (or placeholder) must occur exactly once in the binary
+//  2. For ELF binaries, it must lie inside a section with file contents,
+//     so the bytes unisign replaces are the ones the program reads at runtime
+func InjectPlaceholderIntoEmbeddedData(opts EmbeddedInjectionOptions) error {
+	marker := opts.Marker
+	if marker == "" {
+		marker = opts.Placeholder
+	}
+	if len(marker) != len(opts.Placeholder) {
+		return ErrMarkerLength
+	}
+
+	if err := checkInjectionOutput(opts.InputPath, opts.OutputPath, opts.InPlace); err != nil {
+		return err
+	}
+
+	data, perm, err := ReadFileWithMode(opts.InputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	offset, err := unisign.CheckExactlyOneMagicString(data, []byte(marker))
+	if err != nil {
+		return fmt.Errorf("embedded marker: %w", err)
+	}
+
+	if IsELF(data) {
+		if err := checkELFAddressable(data, offset, int64(len(marker))); err != nil {
+			return err
+		}
+	}
+
+	if err := unisign.ReplaceMagicAtOffset(data, offset, []byte(opts.Placeholder), []byte(marker)); err != nil {
+		return fmt.Errorf("failed to replace embedded marker: %w", err)
+	}
+
+	return writeInjectionOutput(opts.InputPath, opts.OutputPath, data, perm)
+}
+
+// checkELFAddressable verifies that [offset, offset+length) lies entirely
+// within a single section whose contents are stored in the file
+func checkELFAddressable(data []byte, offset, length int64) error {
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotELF, err)
+	}
+	defer ef.Close()
+
+	for _, sec := range ef.Sections {
+		if sec.Type == elf.SHT_NOBITS || sec.Type == elf.SHT_NULL {
+			continue
+		}
+		start := int64(sec.Offset)
+		end := start + int64(sec.FileSize)
+		if offset >= start && offset+length <= end {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: offset %d", ErrPlaceholderNotAddressable, offset)
+}
@@ -0,0 +1,144 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// embedMarker is the unique content of the file the test program embeds
+var embedMarker = strings.Repeat("E", len(MagicString))
+
+func buildTestEmbedELF(t *testing.T, dir string) string {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, "marker.txt"), []byte(embedMarker), 0644); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+	srcPath := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(srcPath, []byte(`package main
+
+import (
+	_ "embed"
+	"fmt"
+)
+
+//go:embed marker.txt
+var signature string
+
+func main() { fmt.Println("embedded", len(signature), signature[:4]) }
+`), 0644); err != nil {
+		t.Fatalf("failed to write test source: %v", err)
+	}
+
+	binPath := filepath.Join(dir, "embedbin")
+	cmd := exec.Command("go", "build", "-o", binPath, "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to compile test binary: %v\n%s", err, out)
+	}
+
+	return binPath
+}
+
+func TestInjectPlaceholderIntoEmbeddedData(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestEmbedELF(t, tmpDir)
+
+	outPath := filepath.Join(tmpDir, "embedbin.placeholder")
+	opts := EmbeddedInjectionOptions{
+		InputPath:   binPath,
+		OutputPath:  outPath,
+		Marker:      embedMarker,
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoEmbeddedData(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoEmbeddedData failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	offset, err := unisign.CheckExactlyOneMagicString(data, []byte(MagicString))
+	if err != nil {
+		t.Fatalf("placeholder not found exactly once: %v", err)
+	}
+
+	// Sign the embedded placeholder the way the sign command does
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	sig, err := unisign.SignBuffer(signer, data, uint64(offset))
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+	unsigned := append([]byte(nil), data...)
+	encoded := SignaturePrefix + base64.StdEncoding.EncodeToString(sig)
+	if err := unisign.ReplaceMagicAtOffset(data, offset, []byte(encoded), []byte(MagicString)); err != nil {
+		t.Fatalf("failed to write signature: %v", err)
+	}
+	if err := unisign.VerifySignature(signer.PublicKey(), unsigned, uint64(offset), sig); err != nil {
+		t.Fatalf("VerifySignature failed: %v", err)
+	}
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return
+	}
+
+	// The signed program reads the signature through its embedded variable
+	signedPath := filepath.Join(tmpDir, "embedbin.signed")
+	if err := os.WriteFile(signedPath, data, 0755); err != nil {
+		t.Fatalf("failed to write signed binary: %v", err)
+	}
+	out, err := exec.Command(signedPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("signed binary failed to run: %v\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("embedded 92 "+SignaturePrefix)) {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestInjectPlaceholderIntoEmbeddedData_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestEmbedELF(t, tmpDir)
+
+	// The marker must be as long as the placeholder
+	err := InjectPlaceholderIntoEmbeddedData(EmbeddedInjectionOptions{
+		InputPath:   binPath,
+		OutputPath:  filepath.Join(tmpDir, "out"),
+		Marker:      "short",
+		Placeholder: MagicString,
+	})
+	if !errors.Is(err, ErrMarkerLength) {
+		t.Errorf("expected ErrMarkerLength, got %v", err)
+	}
+
+	// With no marker, the placeholder itself must already be embedded
+	err = InjectPlaceholderIntoEmbeddedData(EmbeddedInjectionOptions{
+		InputPath:   binPath,
+		OutputPath:  filepath.Join(tmpDir, "out"),
+		Placeholder: MagicString,
+	})
+	if !errors.Is(err, unisign.ErrMagicNotFound) {
+		t.Errorf("expected ErrMagicNotFound, got %v", err)
+	}
+}
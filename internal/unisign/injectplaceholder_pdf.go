@@ -2,9 +2,10 @@ package unisign
 
 import (
 	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
-	"os"
+	"slices"
 	"strconv"
 )
 
@@ -18,13 +19,45 @@ type PDFInjectionOptions struct {
 
 	// Placeholder is the magic string to be injected
 	Placeholder string
+
+	// DryRun performs the injection in memory without writing OutputPath
+	DryRun bool
+
+	// InPlace allows OutputPath to name the input file, which is then
+	// replaced atomically. Without it such an output is ErrOutputIsInput.
+	InPlace bool
+
+	// ObjectNumber is the object number to give the placeholder. It must be
+	// at least the trailer's /Size and listed in no xref table, or the
+	// injection fails with ErrPDFObjectInUse. Zero picks the first such number.
+	ObjectNumber int
+
+	// Reuse resets the placeholder object of a PDF prepared before, signed
+	// or not, to Placeholder in place instead of adding another, so preparing
+	// and signing again doesn't grow the file. A PDF without one gets one as
+	// usual; one with several fails with ErrPDFPlaceholderAmbiguous. A
+	// reused object keeps its number, whatever ObjectNumber says.
+	Reuse bool
+
+	// Prefix is the signature prefix Placeholder starts with, by which Reuse
+	// recognizes a signed placeholder object. Empty means SignaturePrefix.
+	Prefix string
 }
 
 var (
-	ErrNotPDF       = errors.New("file is not a valid PDF")
-	ErrPDFStructure = errors.New("unable to parse PDF structure")
+	ErrNotPDF         = errors.New("file is not a valid PDF")
+	ErrPDFStructure   = errors.New("unable to parse PDF structure")
+	ErrPDFObjectInUse = errors.New("PDF object number is not free")
+
+	ErrPDFPlaceholderAmbiguous = errors.New("PDF has more than one placeholder object to reuse")
 )
 
+// pdfXrefEntry is an object's entry in an xref table
+type pdfXrefEntry struct {
+	Offset int  // byte offset of the object, or next free object number if free
+	InUse  bool // n rather than f
+}
+
 type pdfTrailerInfo struct {
 	Size int    // total number of objects
 	Root string // indirect reference, e.g. "1 0 R"
@@ -40,30 +73,81 @@ type pdfTrailerInfo struct {
 //  2. Is the standard mechanism for modifying PDFs (same as form fills, annotations, etc.)
 //  3. Works with all conforming PDF readers
 func InjectPlaceholderIntoPDF(opts PDFInjectionOptions) error {
-	data, err := os.ReadFile(opts.InputPath)
+	_, err := InjectPlaceholderIntoPDFWithObjectNumber(opts)
+	return err
+}
+
+// InjectPlaceholderIntoPDFWithObjectNumber is like InjectPlaceholderIntoPDF
+// but also returns the object number the placeholder was given, so tools can
+// find it again through the xref with PDFPlaceholderOffset
+func InjectPlaceholderIntoPDFWithObjectNumber(opts PDFInjectionOptions) (int, error) {
+	if err := checkInjectionOutput(opts.InputPath, opts.OutputPath, opts.InPlace); err != nil {
+		return 0, err
+	}
+
+	data, perm, err := ReadFileWithMode(opts.InputPath)
 	if err != nil {
-		return fmt.Errorf("failed to read input file: %w", err)
+		return 0, fmt.Errorf("failed to read input file: %w", err)
 	}
 
 	if !IsPDF(data) {
-		return ErrNotPDF
+		return 0, ErrNotPDF
+	}
+
+	if opts.Reuse {
+		prefix := opts.Prefix
+		if prefix == "" {
+			prefix = SignaturePrefix
+		}
+		objNum, reused, err := reusePDFPlaceholder(data, opts.Placeholder, prefix)
+		if err != nil {
+			return 0, err
+		}
+		if reused {
+			if opts.DryRun {
+				return objNum, nil
+			}
+			if err := writeInjectionOutput(opts.InputPath, opts.OutputPath, data, perm); err != nil {
+				return 0, err
+			}
+			return objNum, nil
+		}
 	}
 
 	// Find last startxref value (byte offset of the most recent xref table)
 	prevXref, err := findLastStartxref(data)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrPDFStructure, err)
+		return 0, fmt.Errorf("%w: %v", ErrPDFStructure, err)
 	}
 
 	// Parse trailer to get /Size and /Root
 	info, err := findTrailerInfo(data, prevXref)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrPDFStructure, err)
+		return 0, fmt.Errorf("%w: %v", ErrPDFStructure, err)
 	}
 
-	// Build incremental update
-	newObjNum := info.Size
+	// The new object takes the number asked for, or else the first at or
+	// past /Size that no xref section lists, in case /Size understates the
+	// objects in use
+	entries, err := pdfXrefEntries(data, prevXref)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrPDFStructure, err)
+	}
+	listed := func(num int) bool {
+		_, ok := entries[num]
+		return ok
+	}
+	newObjNum := opts.ObjectNumber
+	if newObjNum == 0 {
+		newObjNum = info.Size
+		for listed(newObjNum) {
+			newObjNum++
+		}
+	} else if newObjNum < info.Size || listed(newObjNum) {
+		return 0, fmt.Errorf("%w: %d (/Size is %d)", ErrPDFObjectInUse, newObjNum, info.Size)
+	}
 
+	// Build incremental update
 	var update bytes.Buffer
 	update.WriteByte('\n')
 
@@ -90,7 +174,39 @@ func InjectPlaceholderIntoPDF(opts PDFInjectionOptions) error {
 	output = append(output, data...)
 	output = append(output, update.Bytes()...)
 
-	return os.WriteFile(opts.OutputPath, output, 0644)
+	if opts.DryRun {
+		return newObjNum, nil
+	}
+
+	if err := writeInjectionOutput(opts.InputPath, opts.OutputPath, output, perm); err != nil {
+		return 0, err
+	}
+	return newObjNum, nil
+}
+
+// reusePDFPlaceholder writes placeholder over the string of the one
+// placeholder object in data, returning its number. reused is false if data
+// has no placeholder object; the string must be as long as placeholder.
+func reusePDFPlaceholder(data []byte, placeholder, prefix string) (objNum int, reused bool, err error) {
+	objects, err := pdfPlaceholderObjects(data, prefix)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(objects) == 0 {
+		return 0, false, nil
+	}
+	if len(objects) > 1 {
+		return 0, false, fmt.Errorf("%w: found %d", ErrPDFPlaceholderAmbiguous, len(objects))
+	}
+
+	obj := objects[0]
+	end := obj.Offset + int64(len(placeholder))
+	if end >= int64(len(data)) || data[end] != ')' {
+		return 0, false, fmt.Errorf("%w: string of placeholder object %d is not %d bytes long",
+			ErrPDFStructure, obj.Num, len(placeholder))
+	}
+	copy(data[obj.Offset:end], placeholder)
+	return obj.Num, true, nil
 }
 
 // findLastStartxref searches backwards from the end of the file for
@@ -104,14 +220,255 @@ func findLastStartxref(data []byte) (int, error) {
 	return parseIntAfter(data[idx+len("startxref"):])
 }
 
+// maxPDFXrefSections bounds how many /Prev links walkXrefSections follows, so
+// a malformed chain can't make it loop
+const maxPDFXrefSections = 1024
+
+// walkXrefSections calls fn with the offset and trailer dictionary of the
+// xref section at xrefOffset, then of each earlier one its /Prev chain leads
+// to, until fn returns false or the chain ends
+func walkXrefSections(data []byte, xrefOffset int, fn func(offset int, dict []byte) (bool, error)) error {
+	visited := make(map[int]bool)
+	for offset := xrefOffset; ; {
+		if visited[offset] {
+			return fmt.Errorf("/Prev chain loops back to xref offset %d", offset)
+		}
+		if len(visited) == maxPDFXrefSections {
+			return fmt.Errorf("more than %d xref sections", maxPDFXrefSections)
+		}
+		visited[offset] = true
+
+		dict, err := trailerDictAt(data, offset)
+		if err != nil {
+			return err
+		}
+		more, err := fn(offset, dict)
+		if err != nil || !more {
+			return err
+		}
+
+		if pdfKeyIndex(dict, "/Prev") == -1 {
+			return nil
+		}
+		if offset, err = parsePDFIntKey(dict, "/Prev"); err != nil {
+			return fmt.Errorf("/Prev: %w", err)
+		}
+	}
+}
+
 // findTrailerInfo extracts /Size and /Root from the trailer dictionary
 // at the given xref offset. Works for both traditional xref tables
 // and cross-reference streams.
+//
+// A trailer written by an incremental update need not repeat /Root, so
+// /Prev is followed back through earlier xref sections until one has it.
+// /Size is the largest any of the sections visited declares.
 func findTrailerInfo(data []byte, xrefOffset int) (pdfTrailerInfo, error) {
 	var info pdfTrailerInfo
 
+	err := walkXrefSections(data, xrefOffset, func(_ int, dict []byte) (bool, error) {
+		// Parse /Size
+		if pdfKeyIndex(dict, "/Size") != -1 {
+			size, err := parsePDFIntKey(dict, "/Size")
+			if err != nil {
+				return false, fmt.Errorf("/Size: %w", err)
+			}
+			info.Size = max(info.Size, size)
+		}
+
+		// Parse /Root, or look for it in the previous section
+		if pdfKeyIndex(dict, "/Root") == -1 {
+			return true, nil
+		}
+		root, err := parsePDFRefKey(dict, "/Root")
+		if err != nil {
+			return false, fmt.Errorf("/Root: %w", err)
+		}
+		info.Root = root
+		return false, nil
+	})
+	if err != nil {
+		return info, err
+	}
+
+	if info.Root == "" {
+		return info, fmt.Errorf("/Root: key /Root not found in any trailer")
+	}
+	if info.Size == 0 {
+		return info, fmt.Errorf("/Size: key /Size not found")
+	}
+	return info, nil
+}
+
+// pdfXrefEntries returns the entry, in use or free, of every object in a
+// traditional xref table along the /Prev chain from xrefOffset; where
+// sections disagree the latest wins. A free number is never reused by the
+// injector: it may only be reused with the next generation number.
+// Cross-reference streams are compressed and are skipped, so their objects
+// have no entry.
+func pdfXrefEntries(data []byte, xrefOffset int) (map[int]pdfXrefEntry, error) {
+	entries := make(map[int]pdfXrefEntry)
+	err := walkXrefSections(data, xrefOffset, func(offset int, _ []byte) (bool, error) {
+		chunk := data[offset:]
+		if !bytes.HasPrefix(chunk, []byte("xref")) {
+			return true, nil
+		}
+		table := chunk[len("xref"):bytes.Index(chunk, []byte("trailer"))]
+
+		// Each subsection is "first count" followed by count entries of
+		// three fields: offset, generation and n or f
+		fields := bytes.Fields(table)
+		for i := 0; i < len(fields); {
+			if i+2 > len(fields) {
+				return false, fmt.Errorf("truncated xref subsection at offset %d", offset)
+			}
+			first, err1 := strconv.Atoi(string(fields[i]))
+			count, err2 := strconv.Atoi(string(fields[i+1]))
+			i += 2
+			if err1 != nil || err2 != nil || first < 0 || count < 0 || count > (len(fields)-i)/3 {
+				return false, fmt.Errorf("malformed xref subsection at offset %d", offset)
+			}
+			for k := 0; k < count; k++ {
+				objOffset, err := strconv.Atoi(string(fields[i]))
+				kind := string(fields[i+2])
+				if err != nil || (kind != "n" && kind != "f") {
+					return false, fmt.Errorf("malformed xref entry for object %d", first+k)
+				}
+				if _, seen := entries[first+k]; !seen {
+					entries[first+k] = pdfXrefEntry{Offset: objOffset, InUse: kind == "n"}
+				}
+				i += 3
+			}
+		}
+		return true, nil
+	})
+	return entries, err
+}
+
+// PDFPlaceholderOffset returns the offset of the placeholder held by object
+// objNum, as InjectPlaceholderIntoPDFWithObjectNumber wrote it: the object is
+// looked up in the xref rather than found by scanning the file
+func PDFPlaceholderOffset(data []byte, objNum int) (int64, error) {
+	entries, err := latestPDFXrefEntries(data)
+	if err != nil {
+		return 0, err
+	}
+	entry, ok := entries[objNum]
+	if !ok || !entry.InUse {
+		return 0, fmt.Errorf("%w: object %d is not in use", ErrPDFStructure, objNum)
+	}
+
+	offset, ok := pdfStringObjectOffset(data, objNum, entry)
+	if !ok {
+		return 0, fmt.Errorf("%w: object %d does not hold a placeholder string", ErrPDFStructure, objNum)
+	}
+	return offset, nil
+}
+
+// PDFPlaceholderOffsets returns, in file order, the offset of the string in
+// every object that, like those InjectPlaceholderIntoPDF writes, holds just
+// a string literal starting with prefix. Objects are found through the xref,
+// so prefix bytes elsewhere, such as inside a compressed content stream, are
+// never returned.
+func PDFPlaceholderOffsets(data []byte, prefix string) ([]int64, error) {
+	objects, err := pdfPlaceholderObjects(data, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, len(objects))
+	for i, obj := range objects {
+		offsets[i] = obj.Offset
+	}
+	return offsets, nil
+}
+
+// PDFPlaceholderString is the string held by a placeholder object
+type PDFPlaceholderString struct {
+	Offset int64 // offset of the string's contents
+	Len    int   // length of the contents, up to the closing parenthesis
+}
+
+// PDFPlaceholderStrings is like PDFPlaceholderOffsets, also returning how
+// long each string is, so the placeholder's length is read from the file
+// rather than assumed. A placeholder or signature never holds a parenthesis,
+// so the string ends at the first one; an object whose string doesn't
+// close is left out.
+func PDFPlaceholderStrings(data []byte, prefix string) ([]PDFPlaceholderString, error) {
+	objects, err := pdfPlaceholderObjects(data, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var strs []PDFPlaceholderString
+	for _, obj := range objects {
+		end := bytes.IndexByte(data[obj.Offset:], ')')
+		if end == -1 {
+			continue
+		}
+		strs = append(strs, PDFPlaceholderString{Offset: obj.Offset, Len: end})
+	}
+	return strs, nil
+}
+
+// pdfPlaceholderObject is an object holding just a string that starts with
+// the signature prefix, as written by InjectPlaceholderIntoPDF
+type pdfPlaceholderObject struct {
+	Num    int   // object number
+	Offset int64 // offset of the string's contents
+}
+
+// pdfPlaceholderObjects returns the placeholder objects of data in file order
+func pdfPlaceholderObjects(data []byte, prefix string) ([]pdfPlaceholderObject, error) {
+	entries, err := latestPDFXrefEntries(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []pdfPlaceholderObject
+	for objNum, entry := range entries {
+		if !entry.InUse {
+			continue
+		}
+		offset, ok := pdfStringObjectOffset(data, objNum, entry)
+		if ok && bytes.HasPrefix(data[offset:], []byte(prefix)) {
+			objects = append(objects, pdfPlaceholderObject{Num: objNum, Offset: offset})
+		}
+	}
+	slices.SortFunc(objects, func(a, b pdfPlaceholderObject) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	return objects, nil
+}
+
+// latestPDFXrefEntries returns the xref entries of data from its last startxref on
+func latestPDFXrefEntries(data []byte) (map[int]pdfXrefEntry, error) {
+	xrefOffset, err := findLastStartxref(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPDFStructure, err)
+	}
+	entries, err := pdfXrefEntries(data, xrefOffset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPDFStructure, err)
+	}
+	return entries, nil
+}
+
+// pdfStringObjectOffset returns the offset of the string literal object
+// objNum starts with, if entry points at the object header the injector writes
+func pdfStringObjectOffset(data []byte, objNum int, entry pdfXrefEntry) (int64, bool) {
+	header := []byte(fmt.Sprintf("%d 0 obj\n(", objNum))
+	if entry.Offset < 0 || entry.Offset > len(data) || !bytes.HasPrefix(data[entry.Offset:], header) {
+		return 0, false
+	}
+	return int64(entry.Offset + len(header)), true
+}
+
+// trailerDictAt returns the trailer dictionary of the xref section at
+// xrefOffset, cut at its closing ">>" so keys of later sections aren't read
+func trailerDictAt(data []byte, xrefOffset int) ([]byte, error) {
 	if xrefOffset < 0 || xrefOffset >= len(data) {
-		return info, fmt.Errorf("xref offset %d out of range", xrefOffset)
+		return nil, fmt.Errorf("xref offset %d out of range", xrefOffset)
 	}
 
 	chunk := data[xrefOffset:]
@@ -122,7 +479,7 @@ func findTrailerInfo(data []byte, xrefOffset int) (pdfTrailerInfo, error) {
 	if bytes.HasPrefix(chunk, []byte("xref")) {
 		trailerIdx := bytes.Index(chunk, []byte("trailer"))
 		if trailerIdx == -1 {
-			return info, fmt.Errorf("trailer keyword not found after xref table")
+			return nil, fmt.Errorf("trailer keyword not found after xref table")
 		}
 		dictArea = chunk[trailerIdx:]
 	} else {
@@ -130,26 +487,30 @@ func findTrailerInfo(data []byte, xrefOffset int) (pdfTrailerInfo, error) {
 		dictArea = chunk
 	}
 
-	// Parse /Size
-	size, err := parsePDFIntKey(dictArea, "/Size")
-	if err != nil {
-		return info, fmt.Errorf("/Size: %w", err)
+	start := bytes.Index(dictArea, []byte("<<"))
+	if start == -1 {
+		return nil, fmt.Errorf("trailer dictionary not found at xref offset %d", xrefOffset)
 	}
-	info.Size = size
-
-	// Parse /Root
-	root, err := parsePDFRefKey(dictArea, "/Root")
-	if err != nil {
-		return info, fmt.Errorf("/Root: %w", err)
+	depth := 0
+	for i := start; i+1 < len(dictArea); i++ {
+		switch {
+		case dictArea[i] == '<' && dictArea[i+1] == '<':
+			depth++
+			i++
+		case dictArea[i] == '>' && dictArea[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return dictArea[start : i+1], nil
+			}
+		}
 	}
-	info.Root = root
-
-	return info, nil
+	return nil, fmt.Errorf("trailer dictionary at xref offset %d is not terminated", xrefOffset)
 }
 
 // parsePDFIntKey finds "/Key NNN" in data and returns NNN as an int.
 func parsePDFIntKey(data []byte, key string) (int, error) {
-	idx := bytes.Index(data, []byte(key))
+	idx := pdfKeyIndex(data, key)
 	if idx == -1 {
 		return 0, fmt.Errorf("key %s not found", key)
 	}
@@ -157,45 +518,98 @@ func parsePDFIntKey(data []byte, key string) (int, error) {
 }
 
 // parsePDFRefKey finds "/Key N G R" in data and returns "N G R" as a string.
+// Anything else after the key, such as another name or a missing R, is an
+// error rather than a reference to write into a new trailer.
 func parsePDFRefKey(data []byte, key string) (string, error) {
-	idx := bytes.Index(data, []byte(key))
+	idx := pdfKeyIndex(data, key)
 	if idx == -1 {
 		return "", fmt.Errorf("key %s not found", key)
 	}
 
 	rest := data[idx+len(key):]
-	i := skipWhitespace(rest)
-
-	// Read until we hit a dict delimiter ('/' or '>') or newline
-	start := i
-	for i < len(rest) && rest[i] != '/' && rest[i] != '>' && rest[i] != '\n' && rest[i] != '\r' {
-		i++
+	var parts [2]int
+	for k := range parts {
+		n, used, err := parseUintPrefix(rest)
+		if err != nil {
+			return "", fmt.Errorf("value of %s is not an indirect reference: %w", key, err)
+		}
+		parts[k], rest = n, rest[used:]
 	}
-
-	ref := bytes.TrimSpace(rest[start:i])
-	if len(ref) == 0 {
-		return "", fmt.Errorf("empty value for %s", key)
+	rest = rest[skipWhitespace(rest):]
+	if len(rest) == 0 || rest[0] != 'R' || (len(rest) > 1 && isPDFRegular(rest[1])) {
+		return "", fmt.Errorf("value of %s is not an indirect reference: expected R", key)
 	}
-	return string(ref), nil
+	return fmt.Sprintf("%d %d R", parts[0], parts[1]), nil
 }
 
 // parseIntAfter skips whitespace then reads a decimal integer.
 func parseIntAfter(data []byte) (int, error) {
+	n, _, err := parseUintPrefix(data)
+	return n, err
+}
+
+// parseUintPrefix skips whitespace then reads a decimal integer, returning it
+// with the number of bytes it and the whitespace took
+func parseUintPrefix(data []byte) (int, int, error) {
 	i := skipWhitespace(data)
 	start := i
 	for i < len(data) && data[i] >= '0' && data[i] <= '9' {
 		i++
 	}
 	if i == start {
-		return 0, fmt.Errorf("expected integer")
+		return 0, 0, fmt.Errorf("expected integer")
+	}
+	n, err := strconv.Atoi(string(data[start:i]))
+	if err != nil {
+		return 0, 0, err
+	}
+	return n, i, nil
+}
+
+// pdfKeyIndex returns the index of the first occurrence of the name key in
+// data that isn't the start of a longer name, such as /Size in /SizeHint,
+// or -1 if there is none
+func pdfKeyIndex(data []byte, key string) int {
+	for pos := 0; pos < len(data); {
+		i := bytes.Index(data[pos:], []byte(key))
+		if i == -1 {
+			return -1
+		}
+		end := pos + i + len(key)
+		if end == len(data) || !isPDFRegular(data[end]) {
+			return pos + i
+		}
+		pos = end
 	}
-	return strconv.Atoi(string(data[start:i]))
+	return -1
+}
+
+// isPDFRegular reports whether c is a regular character, one that neither
+// separates tokens as whitespace does nor delimits them like / or >
+func isPDFRegular(c byte) bool {
+	return !isPDFWhitespace(c) && !bytes.ContainsRune([]byte("()<>[]{}/%"), rune(c))
 }
 
+// isPDFWhitespace reports whether c is one of the PDF whitespace characters
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+// skipWhitespace returns how many bytes of whitespace and comments, which
+// run from % to the end of the line, data starts with
 func skipWhitespace(data []byte) int {
 	i := 0
-	for i < len(data) && (data[i] == ' ' || data[i] == '\n' || data[i] == '\r' || data[i] == '\t') {
-		i++
+	for i < len(data) {
+		switch {
+		case isPDFWhitespace(data[i]):
+			i++
+		case data[i] == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		default:
+			return i
+		}
 	}
 	return i
 }
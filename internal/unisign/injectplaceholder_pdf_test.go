@@ -2,9 +2,12 @@ package unisign
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -180,6 +183,399 @@ func TestInjectPlaceholderIntoPDF_NoStartxref(t *testing.T) {
 	}
 }
 
+func TestInjectPlaceholderIntoPDF_PreservesFileMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	createMinimalPDF(t, pdfPath)
+	if err := os.Chmod(pdfPath, 0700); err != nil {
+		t.Fatalf("failed to chmod input: %v", err)
+	}
+
+	outPath := filepath.Join(tmpDir, "test.pdf.placeholder")
+	opts := PDFInjectionOptions{
+		InputPath:   pdfPath,
+		OutputPath:  outPath,
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoPDF(opts); err != nil {
+		t.Fatalf("injection failed: %v", err)
+	}
+
+	info, err := os.Stat(outPath)
+	if err != nil {
+		t.Fatalf("failed to stat output: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0700 {
+		t.Errorf("output mode = %o, want %o", got, 0700)
+	}
+}
+
+// appendPDFUpdate appends an incremental update adding object objNum to pdf,
+// whose trailer points back to prevXref and, like those of many editors,
+// doesn't repeat /Root. It returns the offset of the new xref section.
+func appendPDFUpdate(pdf *bytes.Buffer, objNum, prevXref int) int {
+	objOffset := pdf.Len()
+	fmt.Fprintf(pdf, "%d 0 obj\n<< /Type /Annot /Subtype /Text >>\nendobj\n", objNum)
+
+	xrefOffset := pdf.Len()
+	fmt.Fprintf(pdf, "xref\n%d 1\n%010d 00000 n \n", objNum, objOffset)
+	fmt.Fprintf(pdf, "trailer\n<< /Size %d /Prev %d >>\n", objNum+1, prevXref)
+	fmt.Fprintf(pdf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return xrefOffset
+}
+
+func TestInjectPlaceholderIntoPDF_PrevChain(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	createMinimalPDF(t, pdfPath)
+	original, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+	firstXref, err := findLastStartxref(original)
+	if err != nil {
+		t.Fatalf("findLastStartxref failed: %v", err)
+	}
+
+	// Two updates, so /Root is two /Prev links back from the last trailer
+	pdf := bytes.NewBuffer(original)
+	secondXref := appendPDFUpdate(pdf, 4, firstXref)
+	lastXref := appendPDFUpdate(pdf, 5, secondXref)
+	if err := os.WriteFile(pdfPath, pdf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write test PDF: %v", err)
+	}
+
+	info, err := findTrailerInfo(pdf.Bytes(), lastXref)
+	if err != nil {
+		t.Fatalf("findTrailerInfo failed: %v", err)
+	}
+	if info.Size != 6 || info.Root != "1 0 R" {
+		t.Errorf("trailer info = %+v, want /Size 6 /Root 1 0 R", info)
+	}
+
+	outPath := filepath.Join(tmpDir, "test.pdf.placeholder")
+	opts := PDFInjectionOptions{
+		InputPath:   pdfPath,
+		OutputPath:  outPath,
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoPDF(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoPDF failed: %v", err)
+	}
+	outData, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	// The placeholder gets the next free number and the update names /Root itself
+	if !bytes.Contains(outData, []byte("6 0 obj\n("+MagicString+")")) {
+		t.Error("placeholder not injected as object 6")
+	}
+	if !bytes.Contains(outData, []byte(fmt.Sprintf("<< /Size 7 /Prev %d /Root 1 0 R >>", lastXref))) {
+		t.Error("update trailer does not carry /Size 7, /Prev and /Root")
+	}
+}
+
+func TestInjectPlaceholderIntoPDF_SkipsListedObjects(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Object 3 is free, object 4 has no entry, and object 5 is in use
+	// although /Size says there are only 5 objects
+	var buf bytes.Buffer
+	offsets := make([]int, 6)
+	buf.WriteString("%PDF-1.4\n")
+	offsets[1] = buf.Len()
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	offsets[2] = buf.Len()
+	buf.WriteString("2 0 obj\n<< /Type /Pages /Kids [5 0 R] /Count 1 >>\nendobj\n")
+	offsets[5] = buf.Len()
+	buf.WriteString("5 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>\nendobj\n")
+
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n0 4\n")
+	buf.WriteString("0000000003 65535 f \n")
+	fmt.Fprintf(&buf, "%010d 00000 n \n%010d 00000 n \n", offsets[1], offsets[2])
+	buf.WriteString("0000000000 00001 f \n")
+	fmt.Fprintf(&buf, "5 1\n%010d 00000 n \n", offsets[5])
+	buf.WriteString("trailer\n<< /Size 5 /Root 1 0 R >>\n")
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	if err := os.WriteFile(pdfPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write test PDF: %v", err)
+	}
+
+	entries, err := pdfXrefEntries(buf.Bytes(), xrefOffset)
+	if err != nil {
+		t.Fatalf("pdfXrefEntries failed: %v", err)
+	}
+	for num := 0; num <= 6; num++ {
+		entry, listed := entries[num]
+		if want := num != 4 && num != 6; listed != want {
+			t.Errorf("object %d listed = %v, want %v", num, listed, want)
+		}
+		if inUse := num == 1 || num == 2 || num == 5; entry.InUse != inUse {
+			t.Errorf("object %d in use = %v, want %v", num, entry.InUse, inUse)
+		}
+	}
+	if entries[5].Offset != offsets[5] {
+		t.Errorf("object 5 offset = %d, want %d", entries[5].Offset, offsets[5])
+	}
+
+	outPath := filepath.Join(tmpDir, "test.pdf.placeholder")
+	opts := PDFInjectionOptions{
+		InputPath:   pdfPath,
+		OutputPath:  outPath,
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoPDF(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoPDF failed: %v", err)
+	}
+	outData, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	// Object 5 is taken, so the placeholder is object 6 and /Size grows past it
+	if !bytes.Contains(outData, []byte("6 0 obj\n("+MagicString+")")) {
+		t.Error("placeholder not injected as object 6")
+	}
+	if !bytes.Contains(outData, []byte("xref\n6 1\n")) || !bytes.Contains(outData, []byte("<< /Size 7 ")) {
+		t.Error("update xref or trailer does not cover object 6")
+	}
+}
+
+func TestInjectPlaceholderIntoPDFWithObjectNumber(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	createMinimalPDF(t, pdfPath)
+
+	tests := []struct {
+		name    string
+		asked   int
+		want    int
+		wantErr error
+	}{
+		{"automatic", 0, 4, nil},
+		{"asked for", 10, 10, nil},
+		{"below /Size", 2, 0, ErrPDFObjectInUse},
+		{"negative", -1, 0, ErrPDFObjectInUse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outPath := filepath.Join(tmpDir, "out.pdf")
+			opts := PDFInjectionOptions{
+				InputPath:    pdfPath,
+				OutputPath:   outPath,
+				Placeholder:  MagicString,
+				ObjectNumber: tt.asked,
+			}
+			got, err := InjectPlaceholderIntoPDFWithObjectNumber(opts)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("object number = %d, want %d", got, tt.want)
+			}
+
+			// The xref leads to the injected object and its placeholder
+			outData, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			offset, err := PDFPlaceholderOffset(outData, got)
+			if err != nil {
+				t.Fatalf("PDFPlaceholderOffset failed: %v", err)
+			}
+			if want := bytes.Index(outData, []byte(MagicString)); offset != int64(want) {
+				t.Errorf("placeholder offset = %d, want %d", offset, want)
+			}
+			if !bytes.Contains(outData, []byte(fmt.Sprintf("<< /Size %d ", got+1))) {
+				t.Errorf("update trailer does not have /Size %d", got+1)
+			}
+
+			// An existing object holds no placeholder
+			if _, err := PDFPlaceholderOffset(outData, 1); !errors.Is(err, ErrPDFStructure) {
+				t.Errorf("PDFPlaceholderOffset(1) error = %v, want ErrPDFStructure", err)
+			}
+		})
+	}
+
+	// A number already taken by an earlier update is refused
+	outPath := filepath.Join(tmpDir, "out.pdf")
+	twicePath := filepath.Join(tmpDir, "twice.pdf")
+	opts := PDFInjectionOptions{InputPath: outPath, OutputPath: twicePath, Placeholder: MagicString, ObjectNumber: 10}
+	if _, err := InjectPlaceholderIntoPDFWithObjectNumber(opts); !errors.Is(err, ErrPDFObjectInUse) {
+		t.Errorf("reusing object 10: error = %v, want ErrPDFObjectInUse", err)
+	}
+}
+
+func TestPDFPlaceholderOffsets(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	createMinimalPDF(t, pdfPath)
+
+	// Prefix bytes outside a placeholder object are not returned
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+	data = append(data, "% "+MagicString+"\n"...)
+	if err := os.WriteFile(pdfPath, data, 0644); err != nil {
+		t.Fatalf("failed to write test PDF: %v", err)
+	}
+
+	// Two placeholders, one per signer
+	for _, paths := range [][2]string{{pdfPath, pdfPath + ".1"}, {pdfPath + ".1", pdfPath + ".2"}} {
+		opts := PDFInjectionOptions{InputPath: paths[0], OutputPath: paths[1], Placeholder: MagicString}
+		if err := InjectPlaceholderIntoPDF(opts); err != nil {
+			t.Fatalf("InjectPlaceholderIntoPDF failed: %v", err)
+		}
+	}
+	outData, err := os.ReadFile(pdfPath + ".2")
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	offsets, err := PDFPlaceholderOffsets(outData, SignaturePrefix)
+	if err != nil {
+		t.Fatalf("PDFPlaceholderOffsets failed: %v", err)
+	}
+	decoy := int64(bytes.Index(outData, []byte(MagicString)))
+	var want []int64
+	for pos := decoy + 1; ; {
+		i := bytes.Index(outData[pos:], []byte(MagicString))
+		if i == -1 {
+			break
+		}
+		want = append(want, pos+int64(i))
+		pos += int64(i) + 1
+	}
+	if len(offsets) != 2 || offsets[0] != want[0] || offsets[1] != want[1] {
+		t.Errorf("offsets = %v, want %v (decoy at %d)", offsets, want, decoy)
+	}
+}
+
+func TestPDFPlaceholderStrings(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	createMinimalPDF(t, pdfPath)
+
+	// A placeholder longer than the built-in one is measured, not assumed
+	long := SignaturePrefix + strings.Repeat("A", len(MagicString))
+	opts := PDFInjectionOptions{InputPath: pdfPath, OutputPath: pdfPath + ".1", Placeholder: long}
+	if err := InjectPlaceholderIntoPDF(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoPDF failed: %v", err)
+	}
+	data, err := os.ReadFile(pdfPath + ".1")
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	strs, err := PDFPlaceholderStrings(data, SignaturePrefix)
+	if err != nil {
+		t.Fatalf("PDFPlaceholderStrings failed: %v", err)
+	}
+	want := PDFPlaceholderString{Offset: int64(bytes.Index(data, []byte(long))), Len: len(long)}
+	if len(strs) != 1 || strs[0] != want {
+		t.Errorf("strings = %+v, want [%+v]", strs, want)
+	}
+}
+
+func TestInjectPlaceholderIntoPDF_Reuse(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdfPath := filepath.Join(tmpDir, "test.pdf")
+	createMinimalPDF(t, pdfPath)
+
+	inject := func(input, output string, reuse bool) (int, []byte) {
+		t.Helper()
+		opts := PDFInjectionOptions{InputPath: input, OutputPath: output, Placeholder: MagicString, Reuse: reuse}
+		objNum, err := InjectPlaceholderIntoPDFWithObjectNumber(opts)
+		if err != nil {
+			t.Fatalf("InjectPlaceholderIntoPDFWithObjectNumber failed: %v", err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		return objNum, data
+	}
+
+	// Without a placeholder object to reuse, one is added as usual
+	objNum, prepared := inject(pdfPath, pdfPath+".prepared", true)
+	if objNum != 4 {
+		t.Errorf("object number = %d, want 4", objNum)
+	}
+
+	// Stand in for sign: the signature takes the placeholder's place
+	signature := SignaturePrefix + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xAB}, 64))
+	signed := bytes.Replace(prepared, []byte(MagicString), []byte(signature), 1)
+	signedPath := pdfPath + ".signed"
+	if err := os.WriteFile(signedPath, signed, 0644); err != nil {
+		t.Fatalf("failed to write signed PDF: %v", err)
+	}
+
+	// Preparing the signed PDF again resets the same object rather than adding one
+	objNum, reprepared := inject(signedPath, pdfPath+".reprepared", true)
+	if objNum != 4 {
+		t.Errorf("reused object number = %d, want 4", objNum)
+	}
+	if !bytes.Equal(reprepared, prepared) {
+		t.Errorf("re-prepared PDF is %d bytes and differs from the %d-byte first preparation", len(reprepared), len(prepared))
+	}
+
+	// Without Reuse another placeholder is added, after which Reuse can't choose
+	objNum, twice := inject(signedPath, pdfPath+".twice", false)
+	if objNum != 5 || len(twice) <= len(signed) {
+		t.Errorf("without Reuse: object %d, %d bytes from %d", objNum, len(twice), len(signed))
+	}
+	opts := PDFInjectionOptions{InputPath: pdfPath + ".twice", OutputPath: pdfPath + ".out", Placeholder: MagicString, Reuse: true}
+	if _, err := InjectPlaceholderIntoPDFWithObjectNumber(opts); !errors.Is(err, ErrPDFPlaceholderAmbiguous) {
+		t.Errorf("error = %v, want ErrPDFPlaceholderAmbiguous", err)
+	}
+
+	// An xref that can't be read is reported rather than taken for no placeholder
+	broken := []byte("%PDF-1.4\nbroken content\nstartxref\n9999\n%%EOF\n")
+	if _, reused, err := reusePDFPlaceholder(broken, MagicString, SignaturePrefix); !errors.Is(err, ErrPDFStructure) || reused {
+		t.Errorf("reusePDFPlaceholder on a broken xref = %v, %v; want ErrPDFStructure", reused, err)
+	}
+}
+
+func TestFindTrailerInfo_BrokenPrevChain(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(pdf *bytes.Buffer) int
+	}{
+		{"no /Root anywhere", func(pdf *bytes.Buffer) int {
+			xref := pdf.Len()
+			pdf.WriteString("xref\n0 1\n0000000000 65535 f \ntrailer\n<< /Size 1 >>\n")
+			return xref
+		}},
+		{"/Prev loop", func(pdf *bytes.Buffer) int {
+			xref := pdf.Len()
+			fmt.Fprintf(pdf, "xref\n0 1\n0000000000 65535 f \ntrailer\n<< /Size 1 /Prev %d >>\n", xref)
+			return xref
+		}},
+		{"/Prev out of range", func(pdf *bytes.Buffer) int {
+			xref := pdf.Len()
+			pdf.WriteString("xref\n0 1\n0000000000 65535 f \ntrailer\n<< /Size 1 /Prev 99999 >>\n")
+			return xref
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdf := bytes.NewBufferString("%PDF-1.4\n")
+			xref := tt.build(pdf)
+			if _, err := findTrailerInfo(pdf.Bytes(), xref); err == nil {
+				t.Error("findTrailerInfo succeeded")
+			}
+		})
+	}
+}
+
 func TestIsPDF(t *testing.T) {
 	tests := []struct {
 		name string
@@ -201,3 +597,74 @@ func TestIsPDF(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePDFTrailerKeys(t *testing.T) {
+	for dict, want := range map[string]string{
+		"<< /Size 2 /Root 1 0 R >>":            "1 0 R",
+		"<</Size 2/Root 12 0 R/Info 3 0 R>>":   "12 0 R",
+		"<< /Root % the catalog\n1 0 R >>":     "1 0 R",
+		"<< /RootHint 9 0 R /Root 4 0 R >>":    "4 0 R",
+		"<< /Root 1 0 Rx >>":                   "",
+		"<< /Root /Catalog >>":                 "",
+		"<< /Root 1 0 >>":                      "",
+		"<< /Size 2 /Root":                     "",
+		"<< /Root 99999999999999999999 0 R >>": "",
+	} {
+		got, err := parsePDFRefKey([]byte(dict), "/Root")
+		if want == "" {
+			if err == nil {
+				t.Errorf("%q: /Root = %q, want an error", dict, got)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("%q: /Root = %q, %v; want %q", dict, got, err, want)
+		}
+	}
+
+	for dict, want := range map[string]int{
+		"<< /Size 7 >>":             7,
+		"<< /SizeHint 1 /Size 7 >>": 7,
+		"<< /Size %\n 7 >>":         7,
+		"<< /Size >>":               -1,
+		"<< /SizeHint 1 >>":         -1,
+	} {
+		got, err := parsePDFIntKey([]byte(dict), "/Size")
+		if want == -1 {
+			if err == nil {
+				t.Errorf("%q: /Size = %d, want an error", dict, got)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("%q: /Size = %d, %v; want %d", dict, got, err, want)
+		}
+	}
+}
+
+func FuzzFindTrailerInfo(f *testing.F) {
+	table := "xref\n0 2\n0000000000 65535 f \n0000000015 00000 n \n"
+	for _, trailer := range []string{
+		table + "trailer\n<< /Size 2 /Root 1 0 R >>\nstartxref\n0\n%%EOF",
+		table + "trailer\n<</Size 2/Root 1 0 R/Info 3 0 R>>",
+		table + "trailer\n<< /Size 2 /Prev 0 >>",
+		"1 0 obj\n<< /Type /XRef /Size 3 /Root 2 0 R /W [1 2 1] >>\nstream\n",
+		table + "trailer\n<< /Size 2 /Root % catalog\n1 0 R >>",
+		table + "trailer\n<< /Size /Root 1 0 R >>",
+		table + "trailer\n<< /Size 2 /Root",
+		table + "trailer\n<< /Size 99999999999999999999 /Root 1 0 R >>",
+	} {
+		f.Add([]byte(trailer), 0)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, xrefOffset int) {
+		info, err := findTrailerInfo(data, xrefOffset)
+		if err != nil {
+			return
+		}
+		if info.Size <= 0 {
+			t.Errorf("Size = %d for %q", info.Size, data)
+		}
+		var num, gen int
+		var r string
+		if n, _ := fmt.Sscanf(info.Root, "%d %d %s", &num, &gen, &r); n != 3 || r != "R" || fmt.Sprintf("%d %d R", num, gen) != info.Root || num < 0 || gen < 0 {
+			t.Errorf("Root = %q is not an indirect reference, for %q", info.Root, data)
+		}
+	})
+}
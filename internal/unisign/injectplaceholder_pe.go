@@ -0,0 +1,173 @@
+package unisign
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// PEInjectionOptions defines the options for injecting a placeholder into a PE file
+type PEInjectionOptions struct {
+	// InputPath is the path to the input PE binary
+	InputPath string
+
+	// OutputPath is the path where the modified PE binary will be written
+	OutputPath string
+
+	// Placeholder is the magic string to be injected
+	Placeholder string
+
+	// DryRun performs the injection in memory without writing OutputPath
+	DryRun bool
+
+	// InPlace allows OutputPath to name the input file, which is then
+	// replaced atomically. Without it such an output is ErrOutputIsInput.
+	InPlace bool
+}
+
+// Common PE-related errors
+var (
+	ErrNotPE         = errors.New("file is not a valid PE binary")
+	ErrPEUnsupported = errors.New("unsupported PE layout")
+)
+
+// peCertificateDirectory is the index of the certificate table in the
+// optional header's data directories (IMAGE_DIRECTORY_ENTRY_SECURITY)
+const peCertificateDirectory = 4
+
+// WIN_CERTIFICATE fields of the certificate table entry holding the
+// placeholder. The type is not one Windows defines, so Authenticode
+// verifiers, which look for WIN_CERT_TYPE_PKCS_SIGNED_DATA, skip the entry.
+const (
+	peCertHeaderSize  = 8
+	peCertRevision    = 0x0200 // WIN_CERT_REVISION_2_0
+	peCertTypeUnisign = 0x7573 // "us"
+	peCertAlign       = 8
+)
+
+// InjectPlaceholderIntoPE injects a magic placeholder into a PE binary
+// without changing its loaded image or breaking an Authenticode signature.
+//
+// The Authenticode digest covers the whole file except the checksum, the
+// certificate table's data directory entry and the certificate table itself,
+// which is the last thing in a signed file. So:
+//   - An unsigned binary gets the placeholder appended as overlay, after
+//     the last section, where the loader never maps it.
+//   - A signed binary gets the placeholder as an extra entry at the end of
+//     the certificate table, whose directory entry is grown to cover it.
+//     Only excluded bytes change, so the existing signature still verifies.
+//
+// The PE checksum is left as is. It is not part of the Authenticode digest
+// and Windows only checks it for drivers.
+func InjectPlaceholderIntoPE(opts PEInjectionOptions) error {
+	_, err := InjectPlaceholderIntoPEWithOffset(opts)
+	return err
+}
+
+// InjectPlaceholderIntoPEWithOffset is like InjectPlaceholderIntoPE but
+// also returns the offset of the placeholder in the output, also with
+// opts.DryRun: in the overlay, or past the new certificate entry's header
+func InjectPlaceholderIntoPEWithOffset(opts PEInjectionOptions) (int64, error) {
+	if err := checkInjectionOutput(opts.InputPath, opts.OutputPath, opts.InPlace); err != nil {
+		return 0, err
+	}
+
+	data, perm, err := ReadFileWithMode(opts.InputPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	output, offset, err := injectPEData(data, opts.Placeholder)
+	if err != nil {
+		return 0, err
+	}
+	if opts.DryRun {
+		return offset, nil
+	}
+
+	if err := writeInjectionOutput(opts.InputPath, opts.OutputPath, output, perm); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// injectPEData performs the injection on an in-memory PE image and returns
+// the modified image and the placeholder's offset in it
+func injectPEData(data []byte, placeholder string) ([]byte, int64, error) {
+	pf, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrNotPE, err)
+	}
+	defer pf.Close()
+
+	dirOff, err := peDataDirectoryOffset(data, pf, peCertificateDirectory)
+	if err != nil {
+		return nil, 0, err
+	}
+	certOff := binary.LittleEndian.Uint32(data[dirOff:])
+	certSize := binary.LittleEndian.Uint32(data[dirOff+4:])
+
+	output := make([]byte, len(data), len(data)+peCertHeaderSize+len(placeholder)+2*peCertAlign)
+	copy(output, data)
+
+	// Not Authenticode-signed: the overlay is unused by the loader
+	if certSize == 0 {
+		return append(output, placeholder...), int64(len(data)), nil
+	}
+
+	// Signed: extend the certificate table, which must end the file
+	if uint64(certOff)+uint64(certSize) != uint64(len(data)) {
+		return nil, 0, fmt.Errorf("%w: certificate table at %d (%d bytes) does not end the file", ErrPEUnsupported, certOff, certSize)
+	}
+	if certOff%peCertAlign != 0 {
+		return nil, 0, fmt.Errorf("%w: certificate table at %d is not %d-byte aligned", ErrPEUnsupported, certOff, peCertAlign)
+	}
+
+	padTo(&output, peCertAlign)
+	header := make([]byte, peCertHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(peCertHeaderSize+len(placeholder))) // dwLength
+	binary.LittleEndian.PutUint16(header[4:], peCertRevision)                          // wRevision
+	binary.LittleEndian.PutUint16(header[6:], peCertTypeUnisign)                       // wCertificateType
+	output = append(output, header...)
+	offset := int64(len(output))
+	output = append(output, placeholder...)
+	padTo(&output, peCertAlign)
+
+	newSize := uint64(len(output)) - uint64(certOff)
+	if newSize > math.MaxUint32 {
+		return nil, 0, fmt.Errorf("%w: certificate table would exceed 4GB", ErrPEUnsupported)
+	}
+	binary.LittleEndian.PutUint32(output[dirOff+4:], uint32(newSize))
+
+	return output, offset, nil
+}
+
+// peDataDirectoryOffset returns the file offset of the optional header's
+// data directory entry at index, which holds an RVA (a file offset for the
+// certificate table) followed by a size
+func peDataDirectoryOffset(data []byte, pf *pe.File, index uint32) (int, error) {
+	var count uint32
+	var base int
+	switch oh := pf.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		count, base = oh.NumberOfRvaAndSizes, 96
+	case *pe.OptionalHeader64:
+		count, base = oh.NumberOfRvaAndSizes, 112
+	default:
+		return 0, fmt.Errorf("%w: no optional header", ErrPEUnsupported)
+	}
+	if index >= count {
+		return 0, fmt.Errorf("%w: optional header has %d data directories, no entry %d", ErrPEUnsupported, count, index)
+	}
+
+	// The optional header follows the "PE\0\0" signature and the 20-byte COFF header
+	lfanew := int(binary.LittleEndian.Uint32(data[peHeaderOffsetField:]))
+	off := lfanew + 4 + 20 + base + 8*int(index)
+	if off+8 > lfanew+4+20+int(pf.FileHeader.SizeOfOptionalHeader) || off+8 > len(data) {
+		return 0, fmt.Errorf("%w: data directory %d lies outside the optional header", ErrPEUnsupported, index)
+	}
+	return off, nil
+}
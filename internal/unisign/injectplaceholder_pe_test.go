@@ -0,0 +1,248 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// buildTestPE cross-compiles a small Go program for windows/amd64
+func buildTestPE(t *testing.T, dir string) []byte {
+	t.Helper()
+
+	srcPath := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(srcPath, []byte(`package main
+
+import "fmt"
+
+func main() { fmt.Println("hello from pe") }
+`), 0644); err != nil {
+		t.Fatalf("failed to write test source: %v", err)
+	}
+
+	binPath := filepath.Join(dir, "testbin.exe")
+	cmd := exec.Command("go", "build", "-o", binPath, srcPath)
+	cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH=amd64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to compile test binary: %v\n%s", err, out)
+	}
+
+	data, err := os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("failed to read test binary: %v", err)
+	}
+	return data
+}
+
+// peCertDirectory parses data and returns the offset of the certificate
+// table's data directory entry, and the table's offset and size
+func peCertDirectory(t *testing.T, data []byte) (dirOff int, certOff, certSize uint32) {
+	t.Helper()
+
+	pf, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not parseable as PE: %v", err)
+	}
+	defer pf.Close()
+	dirOff, err = peDataDirectoryOffset(data, pf, peCertificateDirectory)
+	if err != nil {
+		t.Fatalf("peDataDirectoryOffset failed: %v", err)
+	}
+	return dirOff, binary.LittleEndian.Uint32(data[dirOff:]), binary.LittleEndian.Uint32(data[dirOff+4:])
+}
+
+// fakeAuthenticodeSign appends a stand-in WIN_CERT_TYPE_PKCS_SIGNED_DATA
+// entry and points the certificate table at it, laid out as signtool does
+func fakeAuthenticodeSign(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	out := append([]byte(nil), data...)
+	padTo(&out, peCertAlign)
+	certOff := len(out)
+	blob := bytes.Repeat([]byte{0x30}, 100)
+	header := make([]byte, peCertHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(peCertHeaderSize+len(blob)))
+	binary.LittleEndian.PutUint16(header[4:], peCertRevision)
+	binary.LittleEndian.PutUint16(header[6:], 0x0002) // WIN_CERT_TYPE_PKCS_SIGNED_DATA
+	out = append(out, header...)
+	out = append(out, blob...)
+	padTo(&out, peCertAlign)
+
+	dirOff, _, _ := peCertDirectory(t, out)
+	binary.LittleEndian.PutUint32(out[dirOff:], uint32(certOff))
+	binary.LittleEndian.PutUint32(out[dirOff+4:], uint32(len(out)-certOff))
+	return out
+}
+
+// authenticodeDigest hashes data the way Authenticode does, skipping the
+// checksum, the certificate table's directory entry and the certificate
+// table itself. Gaps between sections are hashed too, which only makes
+// the comparison stricter.
+func authenticodeDigest(t *testing.T, data []byte) [sha256.Size]byte {
+	t.Helper()
+
+	dirOff, certOff, certSize := peCertDirectory(t, data)
+	lfanew := int(binary.LittleEndian.Uint32(data[peHeaderOffsetField:]))
+	checksumOff := lfanew + 4 + 20 + 64
+
+	end := len(data)
+	if certSize != 0 {
+		end = int(certOff)
+	}
+	h := sha256.New()
+	h.Write(data[:checksumOff])
+	h.Write(data[checksumOff+4 : dirOff])
+	h.Write(data[dirOff+8 : end])
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// signPlaceholder fills the placeholder in data with a real signature and
+// checks it verifies over the placeholder-restored bytes
+func signPlaceholder(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	offset, err := unisign.CheckExactlyOneMagicString(data, []byte(MagicString))
+	if err != nil {
+		t.Fatalf("placeholder not found exactly once: %v", err)
+	}
+	sig, err := unisign.SignBuffer(signer, data, uint64(offset))
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+	signed := append([]byte(nil), data...)
+	encoded := SignaturePrefix + base64.StdEncoding.EncodeToString(sig)
+	if err := unisign.ReplaceMagicAtOffset(signed, offset, []byte(encoded), []byte(MagicString)); err != nil {
+		t.Fatalf("ReplaceMagicAtOffset failed: %v", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to convert public key: %v", err)
+	}
+	if err := unisign.VerifySignature(sshPub, data, uint64(offset), sig); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	return signed
+}
+
+func TestInjectPlaceholderIntoPE_Unsigned(t *testing.T) {
+	data := buildTestPE(t, t.TempDir())
+	before := authenticodeDigest(t, data)
+
+	out, _, err := injectPEData(data, MagicString)
+	if err != nil {
+		t.Fatalf("injectPEData failed: %v", err)
+	}
+
+	// The placeholder is overlay: the original bytes are kept and it follows them
+	if !bytes.Equal(out[:len(data)], data) || string(out[len(data):]) != MagicString {
+		t.Fatal("placeholder was not appended as overlay")
+	}
+	if _, err := pe.NewFile(bytes.NewReader(out)); err != nil {
+		t.Fatalf("output is not parseable as PE: %v", err)
+	}
+
+	// Signing the overlay leaves everything before it alone, so a later
+	// Authenticode signature is made over the same image
+	signed := signPlaceholder(t, out)
+	if !bytes.Equal(signed[:len(data)], data) {
+		t.Error("signing changed bytes outside the overlay")
+	}
+	if got := authenticodeDigest(t, signed[:len(data)]); got != before {
+		t.Error("Authenticode digest of the image changed")
+	}
+}
+
+func TestInjectPlaceholderIntoPE_AuthenticodeSigned(t *testing.T) {
+	data := fakeAuthenticodeSign(t, buildTestPE(t, t.TempDir()))
+	before := authenticodeDigest(t, data)
+	_, certOff, certSize := peCertDirectory(t, data)
+
+	out, _, err := injectPEData(data, MagicString)
+	if err != nil {
+		t.Fatalf("injectPEData failed: %v", err)
+	}
+
+	_, newOff, newSize := peCertDirectory(t, out)
+	if newOff != certOff {
+		t.Errorf("certificate table moved from %d to %d", certOff, newOff)
+	}
+	if int(newOff)+int(newSize) != len(out) || newSize%peCertAlign != 0 {
+		t.Errorf("certificate table (%d bytes at %d) does not end the %d-byte file on an 8-byte boundary", newSize, newOff, len(out))
+	}
+
+	// The original entry is kept and the placeholder follows in an entry of our own
+	entry := out[certOff+certSize:]
+	if got := binary.LittleEndian.Uint32(entry[0:]); got != uint32(peCertHeaderSize+len(MagicString)) {
+		t.Errorf("dwLength = %d, want %d", got, peCertHeaderSize+len(MagicString))
+	}
+	if got := binary.LittleEndian.Uint16(entry[6:]); got != peCertTypeUnisign {
+		t.Errorf("wCertificateType = %#x, want %#x", got, peCertTypeUnisign)
+	}
+	if string(entry[peCertHeaderSize:peCertHeaderSize+len(MagicString)]) != MagicString {
+		t.Error("placeholder not found in the new certificate entry")
+	}
+
+	if got := authenticodeDigest(t, out); got != before {
+		t.Error("injection changed the Authenticode digest")
+	}
+	if got := authenticodeDigest(t, signPlaceholder(t, out)); got != before {
+		t.Error("signing changed the Authenticode digest")
+	}
+}
+
+func TestInjectPlaceholderIntoPE_CertTableNotAtEnd(t *testing.T) {
+	data := append(fakeAuthenticodeSign(t, buildTestPE(t, t.TempDir())), "trailing"...)
+
+	_, _, err := injectPEData(data, MagicString)
+	if !errors.Is(err, ErrPEUnsupported) {
+		t.Fatalf("expected ErrPEUnsupported, got %v", err)
+	}
+}
+
+func TestInjectPlaceholderIntoPE_NotPE(t *testing.T) {
+	_, _, err := injectPEData([]byte("MZ not really a PE file"), MagicString)
+	if !errors.Is(err, ErrNotPE) {
+		t.Fatalf("expected ErrNotPE, got %v", err)
+	}
+}
+
+func TestInjectPlaceholderIntoPE_DryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	inPath := filepath.Join(tmpDir, "in.exe")
+	if err := os.WriteFile(inPath, buildTestPE(t, tmpDir), 0755); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	outPath := filepath.Join(tmpDir, "out.exe")
+
+	opts := PEInjectionOptions{InputPath: inPath, OutputPath: outPath, Placeholder: MagicString, DryRun: true}
+	if err := InjectPlaceholderIntoPE(opts); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote %s", outPath)
+	}
+}
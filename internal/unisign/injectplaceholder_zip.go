@@ -3,10 +3,11 @@ package unisign
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"os"
+	"strings"
 )
 
 // ZipInjectionOptions defines the options for injecting a placeholder into a ZIP file
@@ -19,14 +20,30 @@ type ZipInjectionOptions struct {
 	
 	// Placeholder is the magic string to be injected as a ZIP comment
 	Placeholder string
+
+	// DryRun performs the injection in memory without writing OutputPath
+	DryRun bool
+
+	// InPlace allows OutputPath to name the input file, which is then
+	// replaced atomically. Without it such an output is ErrOutputIsInput.
+	InPlace bool
+
+	// Append keeps an existing archive comment and adds the placeholder on a
+	// new line after it, instead of replacing the comment
+	Append bool
 }
 
 // Common ZIP-related errors
 var (
-	ErrZipFileCorrupted = errors.New("zip file is corrupted or invalid")
-	ErrCommentTooLarge  = errors.New("comment is too large for ZIP format (max 65535 bytes)")
+	ErrZipFileCorrupted      = errors.New("zip file is corrupted or invalid")
+	ErrCommentTooLarge       = errors.New("comment is too large for ZIP format (max 65535 bytes)")
+	ErrCommentHasPlaceholder = errors.New("existing ZIP comment already contains the placeholder")
+	ErrZip64Unsupported      = errors.New("ZIP64 archives are not supported")
 )
 
+// maxZipCommentLen is the largest comment the EOCD's 16-bit length field can describe
+const maxZipCommentLen = 65535
+
 // InjectPlaceholderIntoZip injects a magic placeholder as a ZIP comment
 // without affecting the archived contents.
 //
@@ -38,105 +55,240 @@ var (
 // 1. The original ZIP contents remain intact and unchanged
 // 2. The placeholder is stored in clear text for easy detection
 // 3. Multiple injections can be performed (replacing previous comments)
+//
+// Only the comment and its length field in the end of central directory
+// record are rewritten. Every byte before them is copied as is, so entries
+// keep their exact framing: flags, data descriptors of streamed entries,
+// compressed data and extra fields.
+//
+// With opts.Append an existing comment is kept and the placeholder goes on a
+// line of its own after it.
 func InjectPlaceholderIntoZip(opts ZipInjectionOptions) error {
-	// Check if the placeholder is too large (ZIP format limits comments to 65535 bytes)
-	if len(opts.Placeholder) > 65535 {
-		return ErrCommentTooLarge
+	_, err := InjectPlaceholderIntoZipWithOffset(opts)
+	return err
+}
+
+// InjectPlaceholderIntoZipWithOffset is like InjectPlaceholderIntoZip but
+// also returns the offset of the placeholder in the output, also with
+// opts.DryRun. It lies in the archive comment, at its start unless
+// opts.Append kept an existing comment in front of it.
+func InjectPlaceholderIntoZipWithOffset(opts ZipInjectionOptions) (int64, error) {
+	if err := checkInjectionOutput(opts.InputPath, opts.OutputPath, opts.InPlace); err != nil {
+		return 0, err
 	}
 
 	// Open and read the input ZIP file
-	zipData, err := os.ReadFile(opts.InputPath)
+	zipData, perm, err := ReadFileWithMode(opts.InputPath)
 	if err != nil {
-		return fmt.Errorf("failed to read input file: %w", err)
+		return 0, fmt.Errorf("failed to read input file: %w", err)
 	}
 
-	// Verify that this is a valid ZIP file
-	zipReader, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	output, offset, err := injectZipData(zipData, opts)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrZipFileCorrupted, err)
-	}
-
-	// Create a buffer to hold the modified ZIP file
-	outputBuf := new(bytes.Buffer)
-
-	// Create a new ZIP writer
-	zipWriter := zip.NewWriter(outputBuf)
-
-	// Copy all files from the original ZIP to the new ZIP
-	for _, file := range zipReader.File {
-		// Create a new file header with the same attributes
-		fileHeader := &zip.FileHeader{
-			Name:               file.Name,
-			Comment:            file.Comment,
-			Method:             file.Method,
-			Modified:           file.Modified,
-			ModifiedTime:       file.ModifiedTime,
-			ModifiedDate:       file.ModifiedDate,
-			CRC32:              file.CRC32,
-			CompressedSize:     file.CompressedSize,
-			CompressedSize64:   file.CompressedSize64,
-			UncompressedSize:   file.UncompressedSize,
-			UncompressedSize64: file.UncompressedSize64,
-			Extra:              file.Extra,
-		}
+		return 0, err
+	}
+	if opts.DryRun {
+		return offset, nil
+	}
 
-		// Create the file in the new ZIP and copy its contents
-		if err := copyZipFile(zipWriter, file, fileHeader); err != nil {
-			return err
-		}
+	// Write the modified ZIP file to the output path
+	if err := writeInjectionOutput(opts.InputPath, opts.OutputPath, output, perm); err != nil {
+		return 0, fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return offset, nil
+}
+
+// InjectPlaceholderIntoZipBytes is like InjectPlaceholderIntoZip for an
+// archive held in memory. It returns the modified archive, replacing any
+// existing comment with the placeholder, and leaves data unchanged.
+func InjectPlaceholderIntoZipBytes(data []byte, placeholder string) ([]byte, error) {
+	output, _, err := injectZipData(data, ZipInjectionOptions{Placeholder: placeholder})
+	return output, err
+}
+
+// injectZipData performs the injection on an in-memory archive and returns
+// the modified archive and the placeholder's offset in it
+func injectZipData(zipData []byte, opts ZipInjectionOptions) ([]byte, int64, error) {
+	// Check if the placeholder is too large (ZIP format limits comments to 65535 bytes)
+	if len(opts.Placeholder) > maxZipCommentLen {
+		return nil, 0, ErrCommentTooLarge
 	}
 
-	// Set the comment (our placeholder) on the ZIP archive
-	// This will be stored in uncompressed form according to the ZIP specification
-	if err := zipWriter.SetComment(opts.Placeholder); err != nil {
-		return fmt.Errorf("failed to set ZIP comment: %w", err)
+	// Verify that this is a valid ZIP file
+	if _, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData))); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrZipFileCorrupted, err)
 	}
 
-	// Close the ZIP writer
-	if err := zipWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close ZIP writer: %w", err)
+	commentOffset, commentLen, err := LocateZipComment(zipData)
+	if err != nil {
+		return nil, 0, err
 	}
+	existing := string(zipData[commentOffset : commentOffset+int64(commentLen)])
 
-	// Write the modified ZIP file to the output path
-	if err := os.WriteFile(opts.OutputPath, outputBuf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write output file: %w", err)
+	comment, err := zipCommentWithPlaceholder(existing, opts)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return nil
+	// Keep everything up to the comment length field, then write the new comment
+	lengthOffset := commentOffset - 2
+	output := make([]byte, lengthOffset, lengthOffset+2+int64(len(comment)))
+	copy(output, zipData[:lengthOffset])
+	output = binary.LittleEndian.AppendUint16(output, uint16(len(comment)))
+	output = append(output, comment...)
+
+	// The placeholder ends the comment, which ends the file
+	return output, int64(len(output) - len(opts.Placeholder)), nil
 }
 
-// copyZipFile copies a file from the source ZIP to the destination ZIP writer
-func copyZipFile(zipWriter *zip.Writer, srcFile *zip.File, fileHeader *zip.FileHeader) error {
-	// Create the file in the new ZIP
-	writer, err := zipWriter.CreateHeader(fileHeader)
-	if err != nil {
-		return fmt.Errorf("failed to create file in new ZIP: %w", err)
+// zipCommentWithPlaceholder returns the archive comment to write: the
+// placeholder alone, or with opts.Append the existing comment followed by the
+// placeholder on a new line
+func zipCommentWithPlaceholder(existing string, opts ZipInjectionOptions) (string, error) {
+	if !opts.Append || existing == "" {
+		return opts.Placeholder, nil
 	}
 
-	// Open the original file
-	reader, err := srcFile.Open()
-	if err != nil {
-		return fmt.Errorf("failed to open file from original ZIP: %w", err)
+	// A second copy would leave the signer unable to tell which one to fill
+	if strings.Contains(existing, opts.Placeholder) {
+		return "", ErrCommentHasPlaceholder
 	}
-	defer reader.Close()
 
-	// Copy the content
-	if _, err = io.Copy(writer, reader); err != nil {
-		return fmt.Errorf("failed to copy file content: %w", err)
+	comment := existing + "\n" + opts.Placeholder
+	if len(comment) > maxZipCommentLen {
+		return "", fmt.Errorf("%w: existing comment of %d bytes leaves no room for the placeholder",
+			ErrCommentTooLarge, len(existing))
 	}
-	
-	return nil
+	return comment, nil
 }
 
 // GetZipComment extracts the comment from a ZIP file
 // This will return the uncompressed comment text
 func GetZipComment(zipPath string) (string, error) {
-	// Open the ZIP file
-	reader, err := zip.OpenReader(zipPath)
+	data, err := os.ReadFile(zipPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open ZIP file: %w", err)
 	}
-	defer reader.Close()
+	return GetZipCommentBytes(data)
+}
 
+// GetZipCommentBytes is like GetZipComment for an archive held in memory.
+// Returns ErrZipFileCorrupted if data is not a valid ZIP archive.
+func GetZipCommentBytes(data []byte) (string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrZipFileCorrupted, err)
+	}
 	return reader.Comment, nil
-} 
\ No newline at end of file
+}
+
+// GetZipCommentWithOffset extracts the comment from a ZIP file together with
+// the byte offset at which the comment starts within the file.
+// The offset is found by locating the end of central directory (EOCD) record,
+// so it never matches look-alike bytes inside archived entries.
+func GetZipCommentWithOffset(zipPath string) (string, int64, error) {
+	data, err := os.ReadFile(zipPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open ZIP file: %w", err)
+	}
+
+	offset, length, err := LocateZipComment(data)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return string(data[offset : offset+int64(length)]), offset, nil
+}
+
+// zipEOCDSize is the size of the end of central directory record without its comment
+const zipEOCDSize = 22
+
+// LocateZipComment finds the EOCD record by scanning backwards from the end
+// of data and returns the offset and length of the archive comment.
+// A candidate record is only accepted if its comment length field accounts
+// exactly for the bytes remaining in the file.
+func LocateZipComment(data []byte) (int64, int, error) {
+	if len(data) < zipEOCDSize {
+		return 0, 0, fmt.Errorf("%w: file too small for end of central directory", ErrZipFileCorrupted)
+	}
+
+	// The comment is at most 65535 bytes, which bounds how far back the EOCD can be
+	lowest := len(data) - zipEOCDSize - maxZipCommentLen
+	if lowest < 0 {
+		lowest = 0
+	}
+
+	for i := len(data) - zipEOCDSize; i >= lowest; i-- {
+		if data[i] != 'P' || data[i+1] != 'K' || data[i+2] != 0x05 || data[i+3] != 0x06 {
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(data[i+20:]))
+		if i+zipEOCDSize+commentLen == len(data) {
+			return int64(i + zipEOCDSize), commentLen, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("%w: end of central directory not found", ErrZipFileCorrupted)
+}
+
+// zipCentralHeaderSize is the size of a central directory file header without its variable fields
+const zipCentralHeaderSize = 46
+
+// ZipArchiveOffset returns where the archive proper starts in data: 0 for a
+// plain archive, or the length of the stub in front of a self-extracting one
+// (an executable followed by a ZIP). The stub ends at the first local file
+// header the central directory points to. Offsets in the archive may count
+// from the start of the stub, as zip -A leaves them, or from the start of
+// the archive, as concatenating a stub and an archive does; both are handled.
+func ZipArchiveOffset(data []byte) (int64, error) {
+	commentOffset, _, err := LocateZipComment(data)
+	if err != nil {
+		return 0, err
+	}
+	eocd := commentOffset - zipEOCDSize
+	entries := int(binary.LittleEndian.Uint16(data[eocd+10:]))
+	cdSize := int64(binary.LittleEndian.Uint32(data[eocd+12:]))
+	cdOffset := int64(binary.LittleEndian.Uint32(data[eocd+16:]))
+	if entries == 0xFFFF || cdSize == 0xFFFFFFFF || cdOffset == 0xFFFFFFFF {
+		return 0, ErrZip64Unsupported
+	}
+
+	// The central directory ends where the EOCD starts; any difference from
+	// the offset it records is data prepended without updating the offsets
+	cdStart := eocd - cdSize
+	if cdStart < cdOffset {
+		return 0, fmt.Errorf("%w: central directory does not fit before its end record", ErrZipFileCorrupted)
+	}
+	shift := cdStart - cdOffset
+
+	first := cdOffset
+	pos := cdStart
+	for i := 0; i < entries; i++ {
+		if pos+zipCentralHeaderSize > eocd || !bytes.Equal(data[pos:pos+4], []byte("PK\x01\x02")) {
+			return 0, fmt.Errorf("%w: bad central directory entry %d", ErrZipFileCorrupted, i)
+		}
+		headerOffset := int64(binary.LittleEndian.Uint32(data[pos+42:]))
+		if headerOffset == 0xFFFFFFFF {
+			return 0, ErrZip64Unsupported
+		}
+		first = min(first, headerOffset)
+		pos += zipCentralHeaderSize +
+			int64(binary.LittleEndian.Uint16(data[pos+28:])) + // file name
+			int64(binary.LittleEndian.Uint16(data[pos+30:])) + // extra field
+			int64(binary.LittleEndian.Uint16(data[pos+32:])) // file comment
+	}
+	return shift + first, nil
+}
+
+// IsZip checks if the given data starts with one of the ZIP signatures:
+// a local file header (PK\x03\x04), an end of central directory record
+// for an empty archive (PK\x05\x06), or a spanned archive marker (PK\x07\x08)
+func IsZip(data []byte) bool {
+	if len(data) < 4 || data[0] != 'P' || data[1] != 'K' {
+		return false
+	}
+	return (data[2] == 0x03 && data[3] == 0x04) ||
+		(data[2] == 0x05 && data[3] == 0x06) ||
+		(data[2] == 0x07 && data[3] == 0x08)
+}
@@ -3,9 +3,13 @@ package unisign
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -175,7 +179,429 @@ func TestErrorConditions(t *testing.T) {
 	}
 }
 
+func TestInjectPlaceholderIntoZip_PreservesFileMode(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sampleZipPath := filepath.Join(tempDir, "sample.zip")
+	createSampleZip(t, sampleZipPath)
+	if err := os.Chmod(sampleZipPath, 0700); err != nil {
+		t.Fatalf("Failed to chmod input: %v", err)
+	}
+
+	opts := ZipInjectionOptions{
+		InputPath:   sampleZipPath,
+		OutputPath:  filepath.Join(tempDir, "output.zip"),
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoZip(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoZip failed: %v", err)
+	}
+
+	info, err := os.Stat(opts.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat output: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0700 {
+		t.Errorf("Output mode = %o, want %o", got, 0700)
+	}
+}
+
+func TestInjectPlaceholderIntoZip_PreservesEntryFraming(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Create streams its entry with a data descriptor (flag bit 3);
+	// CreateRaw writes one with its sizes in the local header instead
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("streamed.txt")
+	if err != nil {
+		t.Fatalf("failed to create streamed entry: %v", err)
+	}
+	w.Write([]byte("streamed content, compressed with a data descriptor"))
+	raw := []byte("stored without a descriptor")
+	w, err = zw.CreateRaw(&zip.FileHeader{
+		Name:               "stored.txt",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(raw),
+		CompressedSize64:   uint64(len(raw)),
+		UncompressedSize64: uint64(len(raw)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create stored entry: %v", err)
+	}
+	w.Write(raw)
+	zw.Close()
+
+	inputPath := filepath.Join(tempDir, "streamed.zip")
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write zip file: %v", err)
+	}
+	opts := ZipInjectionOptions{
+		InputPath:   inputPath,
+		OutputPath:  filepath.Join(tempDir, "output.zip"),
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoZip(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoZip failed: %v", err)
+	}
+
+	// Everything before the EOCD comment length is byte-for-byte the input
+	output, err := os.ReadFile(opts.OutputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	input := buf.Bytes()
+	prefix := len(input) - 2
+	if !bytes.Equal(output[:prefix], input[:prefix]) {
+		t.Error("entries or central directory were rewritten")
+	}
+	if string(output[prefix+2:]) != MagicString {
+		t.Errorf("unexpected trailing comment %q", output[prefix+2:])
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("output is not a valid ZIP: %v", err)
+	}
+	if zr.File[0].Flags&0x8 == 0 {
+		t.Errorf("streamed entry lost its data descriptor flag (flags %#x)", zr.File[0].Flags)
+	}
+	if zr.File[1].Flags&0x8 != 0 {
+		t.Errorf("stored entry gained a data descriptor flag (flags %#x)", zr.File[1].Flags)
+	}
+	validateZipContents(t, inputPath, opts.OutputPath)
+}
+
+func TestInjectPlaceholderIntoZipBytes(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("hello.txt")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	w.Write([]byte("hello"))
+	zw.SetComment("old comment")
+	zw.Close()
+	input := append([]byte(nil), buf.Bytes()...)
+
+	output, err := InjectPlaceholderIntoZipBytes(buf.Bytes(), MagicString)
+	if err != nil {
+		t.Fatalf("InjectPlaceholderIntoZipBytes failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), input) {
+		t.Error("input slice was modified")
+	}
+
+	comment, err := GetZipCommentBytes(output)
+	if err != nil {
+		t.Fatalf("GetZipCommentBytes failed: %v", err)
+	}
+	if comment != MagicString {
+		t.Errorf("comment = %q, want the placeholder", comment)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("output is not a valid ZIP: %v", err)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatalf("failed to open entry: %v", err)
+	}
+	content, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(content) != "hello" {
+		t.Errorf("entry content = %q, want %q", content, "hello")
+	}
+}
+
+func TestInjectPlaceholderIntoZipBytes_Errors(t *testing.T) {
+	if _, err := InjectPlaceholderIntoZipBytes([]byte("not a zip archive at all"), MagicString); !errors.Is(err, ErrZipFileCorrupted) {
+		t.Errorf("invalid archive: error = %v, want ErrZipFileCorrupted", err)
+	}
+	if _, err := GetZipCommentBytes([]byte("not a zip archive at all")); !errors.Is(err, ErrZipFileCorrupted) {
+		t.Errorf("GetZipCommentBytes on invalid archive: error = %v, want ErrZipFileCorrupted", err)
+	}
+
+	var buf bytes.Buffer
+	zip.NewWriter(&buf).Close()
+	if _, err := InjectPlaceholderIntoZipBytes(buf.Bytes(), strings.Repeat("x", maxZipCommentLen+1)); !errors.Is(err, ErrCommentTooLarge) {
+		t.Errorf("oversized placeholder: error = %v, want ErrCommentTooLarge", err)
+	}
+}
+
+// buildSelfExtractingZip returns stub followed by an archive holding two
+// entries. With adjustOffsets the archive's offsets count from the start of
+// the stub, as zip -A leaves them; otherwise from the start of the archive.
+func buildSelfExtractingZip(t *testing.T, stub []byte, adjustOffsets bool) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	buf.Write(stub)
+	zw := zip.NewWriter(&buf)
+	if adjustOffsets {
+		zw.SetOffset(int64(len(stub)))
+	} else {
+		// Write the archive on its own, as if a stub were prepended with cat
+		buf.Reset()
+	}
+	for _, name := range []string{"setup.ini", "payload.bin"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		w.Write([]byte("contents of " + name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	if adjustOffsets {
+		return buf.Bytes()
+	}
+	return append(append([]byte(nil), stub...), buf.Bytes()...)
+}
+
+func TestInjectPlaceholderIntoZip_SelfExtracting(t *testing.T) {
+	stub := append([]byte("MZ"), bytes.Repeat([]byte{0x90}, 510)...)
+
+	for _, adjust := range []bool{false, true} {
+		t.Run(fmt.Sprintf("adjusted offsets %v", adjust), func(t *testing.T) {
+			input := buildSelfExtractingZip(t, stub, adjust)
+
+			offset, err := ZipArchiveOffset(input)
+			if err != nil {
+				t.Fatalf("ZipArchiveOffset failed: %v", err)
+			}
+			if offset != int64(len(stub)) {
+				t.Errorf("ZipArchiveOffset = %d, want %d", offset, len(stub))
+			}
+
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "setup.exe")
+			outputPath := filepath.Join(tmpDir, "setup.exe.placeholder")
+			if err := os.WriteFile(inputPath, input, 0755); err != nil {
+				t.Fatalf("failed to write input: %v", err)
+			}
+			opts := ZipInjectionOptions{InputPath: inputPath, OutputPath: outputPath, Placeholder: MagicString}
+			if err := InjectPlaceholderIntoZip(opts); err != nil {
+				t.Fatalf("InjectPlaceholderIntoZip failed: %v", err)
+			}
+
+			output, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if !bytes.HasPrefix(output, stub) {
+				t.Error("stub was not preserved")
+			}
+			if !bytes.Equal(output[:len(input)-2], input[:len(input)-2]) {
+				t.Error("bytes before the comment length changed")
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+			if err != nil {
+				t.Fatalf("output is not a valid ZIP: %v", err)
+			}
+			if zr.Comment != MagicString {
+				t.Errorf("comment = %q, want the placeholder", zr.Comment)
+			}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("failed to open %s: %v", f.Name, err)
+				}
+				content, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil || string(content) != "contents of "+f.Name {
+					t.Errorf("%s = %q, %v", f.Name, content, err)
+				}
+			}
+		})
+	}
+}
+
+func TestZipArchiveOffset(t *testing.T) {
+	plain := buildSelfExtractingZip(t, nil, false)
+	if offset, err := ZipArchiveOffset(plain); err != nil || offset != 0 {
+		t.Errorf("plain archive: ZipArchiveOffset = %d, %v, want 0", offset, err)
+	}
+
+	var empty bytes.Buffer
+	zip.NewWriter(&empty).Close()
+	stubbed := append([]byte("#!/bin/sh\nexit 0\n"), empty.Bytes()...)
+	if offset, err := ZipArchiveOffset(stubbed); err != nil || offset != 17 {
+		t.Errorf("empty archive after a stub: ZipArchiveOffset = %d, %v, want 17", offset, err)
+	}
+
+	if _, err := ZipArchiveOffset([]byte("not a zip archive at all")); !errors.Is(err, ErrZipFileCorrupted) {
+		t.Errorf("invalid archive: error = %v, want ErrZipFileCorrupted", err)
+	}
+}
+
+func TestIsZip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"local file header", []byte("PK\x03\x04rest"), true},
+		{"empty archive", []byte("PK\x05\x06rest"), true},
+		{"spanned archive", []byte("PK\x07\x08rest"), true},
+		{"too short", []byte("PK\x03"), false},
+		{"empty", []byte{}, false},
+		{"other PK marker", []byte("PK\x01\x02"), false},
+		{"elf magic", []byte{0x7f, 'E', 'L', 'F'}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsZip(tt.data); got != tt.want {
+				t.Errorf("IsZip() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetZipCommentWithOffset(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Store an entry uncompressed so its fake signature prefix appears verbatim in the file
+	samplePath := filepath.Join(tempDir, "sample.zip")
+	createZipWithStoredEntry(t, samplePath, "decoy.txt", "decoy us2-"+MagicString[4:])
+
+	opts := ZipInjectionOptions{
+		InputPath:   samplePath,
+		OutputPath:  filepath.Join(tempDir, "output.zip"),
+		Placeholder: MagicString,
+	}
+	if err := InjectPlaceholderIntoZip(opts); err != nil {
+		t.Fatalf("InjectPlaceholderIntoZip failed: %v", err)
+	}
+
+	comment, offset, err := GetZipCommentWithOffset(opts.OutputPath)
+	if err != nil {
+		t.Fatalf("GetZipCommentWithOffset failed: %v", err)
+	}
+	if comment != MagicString {
+		t.Errorf("comment = %q, want %q", comment, MagicString)
+	}
+
+	data, err := os.ReadFile(opts.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if first := bytes.Index(data, []byte("us2-")); int64(first) >= offset {
+		t.Fatalf("decoy was not placed before the comment (first match %d, comment %d)", first, offset)
+	}
+	if got := string(data[offset : offset+int64(len(MagicString))]); got != MagicString {
+		t.Errorf("bytes at offset %d = %q, want the comment", offset, got)
+	}
+	if offset+int64(len(MagicString)) != int64(len(data)) {
+		t.Errorf("comment at offset %d does not end at EOF (%d)", offset, len(data))
+	}
+}
+
+func TestGetZipCommentWithOffset_NotZip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.zip")
+	if err := os.WriteFile(path, []byte("definitely not a zip archive"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, _, err := GetZipCommentWithOffset(path); !errors.Is(err, ErrZipFileCorrupted) {
+		t.Errorf("expected ErrZipFileCorrupted, got %v", err)
+	}
+}
+
 // Helper function to create a sample ZIP file with a few text files inside
+func TestInjectPlaceholderIntoZip_Append(t *testing.T) {
+	tempDir := t.TempDir()
+
+	existing := "Release 1.2\nBuilt by CI"
+	withComment := filepath.Join(tempDir, "with_comment.zip")
+	createSampleZipWithComment(t, withComment, existing)
+	withoutComment := filepath.Join(tempDir, "without_comment.zip")
+	createSampleZip(t, withoutComment)
+
+	for _, tc := range []struct {
+		name   string
+		input  string
+		append bool
+		want   string
+	}{
+		{"overwrite", withComment, false, MagicString},
+		{"append", withComment, true, existing + "\n" + MagicString},
+		{"append to no comment", withoutComment, true, MagicString},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := ZipInjectionOptions{
+				InputPath:   tc.input,
+				OutputPath:  filepath.Join(tempDir, tc.name+".zip"),
+				Placeholder: MagicString,
+				Append:      tc.append,
+			}
+			if err := InjectPlaceholderIntoZip(opts); err != nil {
+				t.Fatalf("InjectPlaceholderIntoZip failed: %v", err)
+			}
+
+			comment, offset, err := GetZipCommentWithOffset(opts.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to get ZIP comment: %v", err)
+			}
+			if comment != tc.want {
+				t.Errorf("ZIP comment = %q, want %q", comment, tc.want)
+			}
+
+			// The placeholder closes the comment, wherever the comment starts
+			data, err := os.ReadFile(opts.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if n := bytes.Count(data, []byte(MagicString)); n != 1 {
+				t.Fatalf("placeholder found %d times, want once", n)
+			}
+			placeholderOffset := int64(bytes.Index(data, []byte(MagicString)))
+			if want := offset + int64(len(comment)-len(MagicString)); placeholderOffset != want {
+				t.Errorf("placeholder at offset %d, want %d", placeholderOffset, want)
+			}
+
+			validateZipContents(t, tc.input, opts.OutputPath)
+		})
+	}
+}
+
+func TestInjectPlaceholderIntoZip_AppendErrors(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A comment that already holds the placeholder would end up with two
+	prepared := filepath.Join(tempDir, "prepared.zip")
+	createSampleZipWithComment(t, prepared, "notes\n"+MagicString)
+	err := InjectPlaceholderIntoZip(ZipInjectionOptions{
+		InputPath:   prepared,
+		OutputPath:  filepath.Join(tempDir, "twice.zip"),
+		Placeholder: MagicString,
+		Append:      true,
+	})
+	if !errors.Is(err, ErrCommentHasPlaceholder) {
+		t.Errorf("err = %v, want %v", err, ErrCommentHasPlaceholder)
+	}
+
+	// The combined comment must fit the 16-bit length field
+	full := filepath.Join(tempDir, "full.zip")
+	createSampleZipWithComment(t, full, string(bytes.Repeat([]byte("x"), maxZipCommentLen-len(MagicString))))
+	outPath := filepath.Join(tempDir, "overflow.zip")
+	err = InjectPlaceholderIntoZip(ZipInjectionOptions{
+		InputPath:   full,
+		OutputPath:  outPath,
+		Placeholder: MagicString,
+		Append:      true,
+	})
+	if !errors.Is(err, ErrCommentTooLarge) {
+		t.Errorf("err = %v, want %v", err, ErrCommentTooLarge)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("output written despite the oversized comment")
+	}
+}
+
 func createSampleZip(t *testing.T, zipPath string) {
 	t.Helper()
 
@@ -335,4 +761,27 @@ func readZipFile(file *zip.File) ([]byte, error) {
 	defer rc.Close()
 
 	return io.ReadAll(rc)
-} 
\ No newline at end of file
+}
+
+// Helper function to create a ZIP file with a single uncompressed entry
+func createZipWithStoredEntry(t *testing.T, zipPath, name, content string) {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		t.Fatalf("Failed to create file in ZIP: %v", err)
+	}
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatalf("Failed to write content to ZIP file: %v", err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("Failed to close ZIP writer: %v", err)
+	}
+
+	if err := os.WriteFile(zipPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write ZIP file: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package unisign
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unisign/pkg/unisign"
+)
+
+// InjectAndSignELF injects the placeholder into an ELF binary as a new
+// .note.unisign section and signs it, entirely in memory, writing only the
+// signed binary to outputPath.
+//
+// Injection appends data and moves the section header table, so the
+// placeholder's offset is only known afterwards. The injection reports it
+// rather than leaving it to a scan, so the signature always lands in the
+// injected section even if the binary contains the magic string elsewhere.
+func InjectAndSignELF(inputPath, outputPath, keyPath string) error {
+	signer, err := unisign.ReadSSHPrivateKey(keyPath, "")
+	if err != nil {
+		return err
+	}
+
+	data, perm, err := ReadFileWithMode(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	output, offset, err := injectELFData(data, ELFInjectionOptions{
+		Placeholder: MagicString,
+		SectionName: defaultELFSection,
+	})
+	if err != nil {
+		return err
+	}
+
+	signature, err := unisign.SignBuffer(signer, output, uint64(offset))
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+
+	encodedSig := SignaturePrefix + base64.StdEncoding.EncodeToString(signature)
+	if err := unisign.ReplaceMagicAtOffset(output, offset, []byte(encodedSig), []byte(MagicString)); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	return WriteFileMode(outputPath, output, perm)
+}
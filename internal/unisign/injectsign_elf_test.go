@@ -0,0 +1,96 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"debug/elf"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"unisign/pkg/unisign"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeTestPrivateKey writes a fresh unencrypted OpenSSH ed25519 key and returns its public half
+func writeTestPrivateKey(t *testing.T, path string) ssh.PublicKey {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to convert public key: %v", err)
+	}
+	return sshPub
+}
+
+func TestInjectAndSignELF(t *testing.T) {
+	tmpDir := t.TempDir()
+	binPath := buildTestELF64(t, tmpDir)
+	keyPath := filepath.Join(tmpDir, "key")
+	pubKey := writeTestPrivateKey(t, keyPath)
+
+	outPath := filepath.Join(tmpDir, "testbin.signed")
+	if err := InjectAndSignELF(binPath, outPath, keyPath); err != nil {
+		t.Fatalf("InjectAndSignELF failed: %v", err)
+	}
+
+	signed, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	ef, err := elf.NewFile(bytes.NewReader(signed))
+	if err != nil {
+		t.Fatalf("output is not parseable as ELF: %v", err)
+	}
+	sec := ef.Section(defaultELFSection)
+	ef.Close()
+	if sec == nil {
+		t.Fatalf("%s section not found", defaultELFSection)
+	}
+	offset := int64(sec.Offset)
+
+	// Decode the embedded signature and verify it over the placeholder-restored binary
+	encoded := signed[offset : offset+int64(len(MagicString))]
+	if !bytes.HasPrefix(encoded, []byte(SignaturePrefix)) {
+		t.Fatalf("section does not hold a signature: %q", encoded)
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(encoded[len(SignaturePrefix):]))
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+	restored := append([]byte(nil), signed...)
+	copy(restored[offset:], MagicString)
+	if err := unisign.VerifySignature(pubKey, restored, uint64(offset), sig); err != nil {
+		t.Fatalf("VerifySignature failed: %v", err)
+	}
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return
+	}
+	os.Chmod(outPath, 0755)
+	out, err := exec.Command(outPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("signed binary failed to run: %v\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("hello from elf")) {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
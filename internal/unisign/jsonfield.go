@@ -0,0 +1,58 @@
+package unisign
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Common JSON signature field errors
+var (
+	ErrInvalidJSON         = errors.New("input is not a single JSON object")
+	ErrJSONFieldNotFound   = errors.New("signature field not found in JSON object")
+	ErrJSONFieldNotAString = errors.New("signature field is not a JSON string")
+)
+
+// CanonicalizeJSONField parses data as a JSON object and returns its
+// canonical encoding together with the string value of the top-level field.
+//
+// The canonical encoding has object keys sorted, no insignificant whitespace
+// and numbers kept exactly as written, so it survives key reordering and
+// reformatting by other tools. Signing and verifying that form instead of the
+// raw bytes lets a signature stored in field outlive re-serialization.
+func CanonicalizeJSONField(data []byte, field string) ([]byte, string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var object map[string]interface{}
+	if err := dec.Decode(&object); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	if object == nil {
+		return nil, "", ErrInvalidJSON
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, "", fmt.Errorf("%w: trailing data after the object", ErrInvalidJSON)
+	}
+
+	raw, ok := object[field]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %q", ErrJSONFieldNotFound, field)
+	}
+	value, ok := raw.(string)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %q", ErrJSONFieldNotAString, field)
+	}
+
+	var canonical bytes.Buffer
+	enc := json.NewEncoder(&canonical)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(object); err != nil {
+		return nil, "", fmt.Errorf("encoding canonical JSON: %w", err)
+	}
+
+	// Encode terminates the value with a newline, which is not part of the canonical form
+	return bytes.TrimSuffix(canonical.Bytes(), []byte("\n")), value, nil
+}
@@ -0,0 +1,56 @@
+package unisign
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanonicalizeJSONField(t *testing.T) {
+	original := []byte(`{"version": 2, "signature": "sig", "nested": {"b": [1, 2.50], "a": "<&>"}}`)
+	reformatted := []byte("{\n  \"nested\": {\n    \"a\": \"<&>\",\n    \"b\": [1, 2.50]\n  },\n  \"signature\": \"sig\",\n  \"version\": 2\n}\n")
+
+	canonical, value, err := CanonicalizeJSONField(original, "signature")
+	if err != nil {
+		t.Fatalf("CanonicalizeJSONField failed: %v", err)
+	}
+	if value != "sig" {
+		t.Errorf("field value = %q, want %q", value, "sig")
+	}
+	want := `{"nested":{"a":"<&>","b":[1,2.50]},"signature":"sig","version":2}`
+	if string(canonical) != want {
+		t.Errorf("canonical form = %s, want %s", canonical, want)
+	}
+
+	// Key order and whitespace don't change the canonical form
+	again, _, err := CanonicalizeJSONField(reformatted, "signature")
+	if err != nil {
+		t.Fatalf("CanonicalizeJSONField failed on reformatted input: %v", err)
+	}
+	if string(again) != want {
+		t.Errorf("canonical form of reformatted input = %s, want %s", again, want)
+	}
+}
+
+func TestCanonicalizeJSONField_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"not json", `signature: sig`, ErrInvalidJSON},
+		{"array", `["signature"]`, ErrInvalidJSON},
+		{"null", `null`, ErrInvalidJSON},
+		{"trailing data", `{"signature": "sig"} {}`, ErrInvalidJSON},
+		{"missing field", `{"sig": "sig"}`, ErrJSONFieldNotFound},
+		{"nested field only", `{"meta": {"signature": "sig"}}`, ErrJSONFieldNotFound},
+		{"not a string", `{"signature": 42}`, ErrJSONFieldNotAString},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := CanonicalizeJSONField([]byte(tt.data), "signature")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CanonicalizeJSONField() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
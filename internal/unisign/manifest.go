@@ -0,0 +1,151 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestHeader is the first line of every signature manifest
+const ManifestHeader = "unisign-manifest v1"
+
+// ErrInvalidManifest is returned when a signature manifest cannot be parsed
+var ErrInvalidManifest = errors.New("invalid signature manifest")
+
+// ManifestEntry records the hash of one file in a manifest
+type ManifestEntry struct {
+	// Path is the file's slash-separated path, relative to the directory the manifest covers
+	Path string
+
+	// SHA256 is the hash of the file's contents
+	SHA256 [sha256.Size]byte
+}
+
+// line returns the entry in sha256sum format
+func (e ManifestEntry) line() string {
+	return hex.EncodeToString(e.SHA256[:]) + "  " + e.Path
+}
+
+// Manifest lists the hashes of a set of files under one signature
+type Manifest struct {
+	// Entries lists the files the manifest covers
+	Entries []ManifestEntry
+
+	// Signature is the encoded signature over SignedMessage, prefix included
+	Signature string
+}
+
+// sortedEntries returns a copy of the entries sorted by path
+func (m Manifest) sortedEntries() []ManifestEntry {
+	entries := append([]ManifestEntry(nil), m.Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// SignedMessage returns the bytes the manifest's signature covers: the
+// header, the number of entries, then every entry in sha256sum format,
+// sorted by path. One signature thus covers the whole list, so entries can
+// be neither dropped, added nor spliced in from another manifest.
+func (m Manifest) SignedMessage() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(ManifestHeader + "\n")
+	fmt.Fprintf(&buf, "%d\n", len(m.Entries))
+	for _, e := range m.sortedEntries() {
+		buf.WriteString(e.line() + "\n")
+	}
+	return buf.Bytes()
+}
+
+// validateManifestPath accepts only paths that stay inside the manifest's
+// directory and fit on one manifest line
+func validateManifestPath(path string) error {
+	if strings.ContainsAny(path, "\r\n") {
+		return fmt.Errorf("%w: path %q contains a line break", ErrInvalidManifest, path)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(path)) {
+		return fmt.Errorf("%w: path %q is not relative to the manifest directory", ErrInvalidManifest, path)
+	}
+	return nil
+}
+
+// validateManifestEntries rejects empty manifests, bad paths and paths listed twice
+func validateManifestEntries(entries []ManifestEntry) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: no entries", ErrInvalidManifest)
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if err := validateManifestPath(e.Path); err != nil {
+			return err
+		}
+		if seen[e.Path] {
+			return fmt.Errorf("%w: %s is listed twice", ErrInvalidManifest, e.Path)
+		}
+		seen[e.Path] = true
+	}
+	return nil
+}
+
+// MarshalManifest encodes m as ManifestHeader, a "signature <signature>"
+// line, then one sha256sum line per entry, sorted by path
+func MarshalManifest(m Manifest) ([]byte, error) {
+	if err := validateManifestEntries(m.Entries); err != nil {
+		return nil, err
+	}
+	if m.Signature == "" || strings.ContainsAny(m.Signature, " \r\n") {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidManifest)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(ManifestHeader + "\n")
+	fmt.Fprintf(&buf, "signature %s\n", m.Signature)
+	for _, e := range m.sortedEntries() {
+		buf.WriteString(e.line() + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseManifest decodes a manifest written by MarshalManifest. A manifest
+// with no entries is rejected, since it would vouch for nothing.
+func ParseManifest(data []byte) (Manifest, error) {
+	header, body, _ := bytes.Cut(data, []byte("\n"))
+	if string(header) != ManifestHeader {
+		return Manifest{}, fmt.Errorf("%w: missing %q header", ErrInvalidManifest, ManifestHeader)
+	}
+
+	sigLine, body, _ := bytes.Cut(body, []byte("\n"))
+	signature, ok := strings.CutPrefix(string(sigLine), "signature ")
+	if !ok || signature == "" || strings.Contains(signature, " ") {
+		return Manifest{}, fmt.Errorf("%w: line 2 is not \"signature <signature>\"", ErrInvalidManifest)
+	}
+
+	m := Manifest{Signature: signature}
+	for i, line := range strings.Split(string(body), "\n") {
+		if line == "" {
+			continue
+		}
+		sumHex, path, ok := strings.Cut(line, "  ")
+		if !ok {
+			return Manifest{}, fmt.Errorf("%w: line %d is not \"<sha256>  <path>\"", ErrInvalidManifest, i+3)
+		}
+
+		var e ManifestEntry
+		sum, err := hex.DecodeString(sumHex)
+		if err != nil || len(sum) != sha256.Size {
+			return Manifest{}, fmt.Errorf("%w: line %d has a malformed SHA-256", ErrInvalidManifest, i+3)
+		}
+		copy(e.SHA256[:], sum)
+		e.Path = path
+
+		m.Entries = append(m.Entries, e)
+	}
+	if err := validateManifestEntries(m.Entries); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
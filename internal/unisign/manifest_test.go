@@ -0,0 +1,111 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	m := Manifest{
+		Entries: []ManifestEntry{
+			{Path: "docs/read me.txt", SHA256: sha256.Sum256([]byte("docs"))},
+			{Path: "app.tar.gz", SHA256: sha256.Sum256([]byte("app"))},
+		},
+		Signature: "us2-c2ln",
+	}
+
+	data, err := MarshalManifest(m)
+	if err != nil {
+		t.Fatalf("MarshalManifest failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), ManifestHeader+"\nsignature us2-c2ln\n") {
+		t.Errorf("manifest does not start with its header and signature: %q", data)
+	}
+
+	got, err := ParseManifest(data)
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	if got.Signature != m.Signature {
+		t.Errorf("signature = %q, want %q", got.Signature, m.Signature)
+	}
+	// Entries are written sorted by path
+	want := []ManifestEntry{m.Entries[1], m.Entries[0]}
+	if len(got.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got.Entries), len(want))
+	}
+	for i := range want {
+		if got.Entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got.Entries[i], want[i])
+		}
+	}
+}
+
+func TestManifestSignedMessage(t *testing.T) {
+	a := ManifestEntry{Path: "dir/file", SHA256: sha256.Sum256([]byte("contents"))}
+	b := ManifestEntry{Path: "other", SHA256: sha256.Sum256([]byte("other"))}
+
+	want := ManifestHeader + "\n2\n" +
+		"d1b2a59fbea7e20077af9f91b27e95e865061b270be03ff539ab3b73587882e8  dir/file\n" +
+		"d9298a10d1b0735837dc4bd85dac641b0f3cef27a47e5d53a54f2f3f5b2fcffa  other\n"
+	if got := string(Manifest{Entries: []ManifestEntry{b, a}}.SignedMessage()); got != want {
+		t.Errorf("SignedMessage() = %q, want %q", got, want)
+	}
+
+	// Dropping an entry changes the signed bytes
+	whole := Manifest{Entries: []ManifestEntry{a, b}}.SignedMessage()
+	if bytes.Equal(Manifest{Entries: []ManifestEntry{a}}.SignedMessage(), whole) {
+		t.Error("SignedMessage() does not depend on every entry")
+	}
+}
+
+func TestMarshalManifest_Errors(t *testing.T) {
+	entry := func(path string) []ManifestEntry { return []ManifestEntry{{Path: path}} }
+	tests := []struct {
+		name string
+		m    Manifest
+	}{
+		{"no entries", Manifest{Signature: "us2-c2ln"}},
+		{"no signature", Manifest{Entries: entry("file")}},
+		{"empty path", Manifest{Entries: entry(""), Signature: "us2-c2ln"}},
+		{"path outside directory", Manifest{Entries: entry("../escape"), Signature: "us2-c2ln"}},
+		{"absolute path", Manifest{Entries: entry("/etc/passwd"), Signature: "us2-c2ln"}},
+		{"line break", Manifest{Entries: entry("line\nbreak"), Signature: "us2-c2ln"}},
+		{"duplicate path", Manifest{Entries: append(entry("file"), entry("file")...), Signature: "us2-c2ln"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MarshalManifest(tt.m); !errors.Is(err, ErrInvalidManifest) {
+				t.Errorf("MarshalManifest() error = %v, want %v", err, ErrInvalidManifest)
+			}
+		})
+	}
+}
+
+func TestParseManifest_Errors(t *testing.T) {
+	sum := strings.Repeat("ab", sha256.Size)
+	head := ManifestHeader + "\nsignature us2-c2ln\n"
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing header", sum + "  file\n"},
+		{"wrong version", "unisign-manifest v2\n"},
+		{"missing signature", ManifestHeader + "\n" + sum + "  file\n"},
+		{"no entries", head},
+		{"single space", head + sum + " file\n"},
+		{"malformed hash", head + "abc  file\n"},
+		{"path outside directory", head + sum + "  ../file\n"},
+		{"duplicate path", head + sum + "  file\n" + sum + "  file\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseManifest([]byte(tt.data)); !errors.Is(err, ErrInvalidManifest) {
+				t.Errorf("ParseManifest() error = %v, want %v", err, ErrInvalidManifest)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package unisign
+
+import (
+	"errors"
+	"os"
+)
+
+// errMmapUnsupported is returned by mapFileWithHeadroom on platforms without a mapping implementation
+var errMmapUnsupported = errors.New("memory-mapped reads are not supported on this platform")
+
+// ErrFileTruncated is reported when a file shrinks while it is memory-mapped
+var ErrFileTruncated = errors.New("file was truncated while it was mapped")
+
+// mmapThreshold is the file size from which LoadFileWithHeadroom maps the file instead of reading it
+var mmapThreshold int64 = 64 << 20
+
+// LoadFileWithHeadroom returns the file at path laid out like ReadFileWithHeadroom.
+// Files of at least 64MB are memory-mapped copy-on-write where the platform
+// supports it, so their contents stay in the page cache instead of being
+// copied onto the heap; writes to the returned slice never reach the file.
+// Smaller files, and every file on other platforms, are read as usual.
+//
+// The returned release function unmaps the file and must be called once the
+// data is no longer used. Reading a mapped page that a truncation has cut
+// off the file raises SIGBUS, which crashes the program unless the reading
+// goroutine called debug.SetPanicOnFault(true); see IsMappedFault.
+func LoadFileWithHeadroom(path string, headroom int) ([]byte, os.FileMode, func() error, error) {
+	noop := func() error { return nil }
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if info.Mode().IsRegular() && info.Size() >= mmapThreshold {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		defer f.Close()
+
+		data, release, err := mapFileWithHeadroom(f, info.Size(), headroom)
+		if err == nil {
+			return data, info.Mode().Perm(), release, nil
+		}
+		if !errors.Is(err, errMmapUnsupported) {
+			return nil, 0, nil, err
+		}
+	}
+
+	data, perm, err := ReadFileWithHeadroom(path, headroom)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return data, perm, noop, nil
+}
+
+// IsMappedFault reports whether r, as returned by recover, is the panic
+// raised by reading mapped pages a truncation cut off the file, in a
+// goroutine that called debug.SetPanicOnFault(true). Callers report it as
+// ErrFileTruncated rather than crash.
+func IsMappedFault(r interface{}) bool {
+	_, ok := r.(interface{ Addr() uintptr })
+	return ok
+}
@@ -0,0 +1,37 @@
+//go:build linux && (amd64 || arm64 || riscv64)
+
+package unisign
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mapFileWithHeadroom maps size bytes of f copy-on-write so that they are
+// immediately preceded by headroom writable bytes. It reserves one anonymous
+// page plus the file's length, then maps the file over the reservation right
+// after the first page, giving a single contiguous slice.
+func mapFileWithHeadroom(f *os.File, size int64, headroom int) ([]byte, func() error, error) {
+	pageSize := os.Getpagesize()
+	if headroom > pageSize {
+		return nil, nil, fmt.Errorf("headroom of %d bytes exceeds the page size", headroom)
+	}
+
+	region, err := syscall.Mmap(-1, 0, pageSize+int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reserving address space: %w", err)
+	}
+
+	fileStart := uintptr(unsafe.Pointer(&region[pageSize]))
+	_, _, errno := syscall.Syscall6(syscall.SYS_MMAP, fileStart, uintptr(size),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_FIXED, f.Fd(), 0)
+	if errno != 0 {
+		syscall.Munmap(region)
+		return nil, nil, fmt.Errorf("mapping file: %w", errno)
+	}
+
+	release := func() error { return syscall.Munmap(region) }
+	return region[pageSize-headroom:], release, nil
+}
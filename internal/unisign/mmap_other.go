@@ -0,0 +1,10 @@
+//go:build !(linux && (amd64 || arm64 || riscv64))
+
+package unisign
+
+import "os"
+
+// mapFileWithHeadroom is not implemented on this platform; LoadFileWithHeadroom falls back to reading the file
+func mapFileWithHeadroom(f *os.File, size int64, headroom int) ([]byte, func() error, error) {
+	return nil, nil, errMmapUnsupported
+}
@@ -0,0 +1,97 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+)
+
+func TestLoadFileWithHeadroom(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "input")
+
+	content := make([]byte, 3*os.Getpagesize()+123)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+	if err := os.WriteFile(path, content, 0640); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	// Exercise both the read path and, where supported, the mapped path
+	for _, threshold := range []int64{int64(len(content)) + 1, 1} {
+		saved := mmapThreshold
+		mmapThreshold = threshold
+
+		data, perm, release, err := LoadFileWithHeadroom(path, 24)
+		mmapThreshold = saved
+		if err != nil {
+			t.Fatalf("LoadFileWithHeadroom (threshold %d) failed: %v", threshold, err)
+		}
+
+		if perm != 0640 {
+			t.Errorf("threshold %d: perm = %o, want 640", threshold, perm)
+		}
+		if len(data) != 24+len(content) || !bytes.Equal(data[24:], content) {
+			t.Errorf("threshold %d: contents do not match the file", threshold)
+		}
+
+		// Headroom and contents are writable without touching the file
+		copy(data, bytes.Repeat([]byte{0xAA}, 24))
+		data[24] ^= 0xFF
+		if err := release(); err != nil {
+			t.Errorf("threshold %d: release failed: %v", threshold, err)
+		}
+
+		onDisk, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to re-read input: %v", err)
+		}
+		if !bytes.Equal(onDisk, content) {
+			t.Errorf("threshold %d: writing to the loaded data modified the file", threshold)
+		}
+	}
+}
+
+func TestLoadFileWithHeadroomTruncated(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "input")
+	if err := os.WriteFile(path, make([]byte, 3*os.Getpagesize()), 0640); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	saved := mmapThreshold
+	mmapThreshold = 1
+	data, _, release, err := LoadFileWithHeadroom(path, 24)
+	mmapThreshold = saved
+	if err != nil {
+		t.Fatalf("LoadFileWithHeadroom failed: %v", err)
+	}
+	defer release()
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("failed to truncate input: %v", err)
+	}
+
+	// Reading the pages cut off the file faults, which SetPanicOnFault turns into a panic
+	recovered := func() (r interface{}) {
+		defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+		defer func() { r = recover() }()
+		if bytes.IndexByte(data[24:], 1) != -1 {
+			t.Error("unexpected contents")
+		}
+		return nil
+	}()
+	if recovered == nil {
+		t.Skip("the file was read rather than mapped")
+	}
+	if !IsMappedFault(recovered) {
+		t.Errorf("IsMappedFault(%v) = false, want true", recovered)
+	}
+	if IsMappedFault("some other panic") {
+		t.Error("IsMappedFault accepted an unrelated panic")
+	}
+}
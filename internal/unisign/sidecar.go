@@ -0,0 +1,93 @@
+package unisign
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SidecarHeader is the first line of every signature sidecar
+const SidecarHeader = "unisign-sidecar v1"
+
+// SidecarSuffix is appended to a file's name to name its signature sidecar
+const SidecarSuffix = ".unisig"
+
+// ErrInvalidSidecar is returned when a signature sidecar cannot be parsed
+var ErrInvalidSidecar = errors.New("invalid signature sidecar")
+
+// Sidecar is a signature kept next to the file it covers, for files that
+// can't hold a placeholder. The signature is made as an embedded one is,
+// over the signature header and the file, with the header fields recorded
+// here rather than taken from a placeholder's position.
+type Sidecar struct {
+	// Length is the length of the signed file, as in the signature header
+	Length uint64
+
+	// Offset is the header's offset field; the whole file is signed, so it is 0
+	Offset uint64
+
+	// Signature is the encoded signature, prefix included
+	Signature string
+}
+
+// MarshalSidecar encodes s as SidecarHeader followed by one "<field> <value>"
+// line for each of the length, offset and signature
+func MarshalSidecar(s Sidecar) ([]byte, error) {
+	if s.Signature == "" || strings.ContainsAny(s.Signature, " \r\n") {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidSidecar)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(SidecarHeader + "\n")
+	fmt.Fprintf(&buf, "length %d\n", s.Length)
+	fmt.Fprintf(&buf, "offset %d\n", s.Offset)
+	fmt.Fprintf(&buf, "signature %s\n", s.Signature)
+	return buf.Bytes(), nil
+}
+
+// ParseSidecar decodes a sidecar written by MarshalSidecar. Every field must
+// appear exactly once; their order doesn't matter.
+func ParseSidecar(data []byte) (Sidecar, error) {
+	header, body, _ := bytes.Cut(data, []byte("\n"))
+	if string(header) != SidecarHeader {
+		return Sidecar{}, fmt.Errorf("%w: missing %q header", ErrInvalidSidecar, SidecarHeader)
+	}
+
+	var s Sidecar
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(string(body), "\n") {
+		if line == "" {
+			continue
+		}
+		field, value, ok := strings.Cut(line, " ")
+		if !ok || value == "" {
+			return Sidecar{}, fmt.Errorf("%w: line %d is not \"<field> <value>\"", ErrInvalidSidecar, i+2)
+		}
+		if seen[field] {
+			return Sidecar{}, fmt.Errorf("%w: %s is given twice", ErrInvalidSidecar, field)
+		}
+		seen[field] = true
+
+		var err error
+		switch field {
+		case "length":
+			s.Length, err = strconv.ParseUint(value, 10, 64)
+		case "offset":
+			s.Offset, err = strconv.ParseUint(value, 10, 64)
+		case "signature":
+			s.Signature = value
+		default:
+			return Sidecar{}, fmt.Errorf("%w: unknown field %q on line %d", ErrInvalidSidecar, field, i+2)
+		}
+		if err != nil {
+			return Sidecar{}, fmt.Errorf("%w: malformed %s on line %d", ErrInvalidSidecar, field, i+2)
+		}
+	}
+	for _, field := range []string{"length", "offset", "signature"} {
+		if !seen[field] {
+			return Sidecar{}, fmt.Errorf("%w: missing %s", ErrInvalidSidecar, field)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,57 @@
+package unisign
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSidecarRoundTrip(t *testing.T) {
+	s := Sidecar{Length: 1234, Offset: 0, Signature: "us2-c2lnbmF0dXJl"}
+
+	data, err := MarshalSidecar(s)
+	if err != nil {
+		t.Fatalf("MarshalSidecar failed: %v", err)
+	}
+	want := SidecarHeader + "\nlength 1234\noffset 0\nsignature us2-c2lnbmF0dXJl\n"
+	if string(data) != want {
+		t.Errorf("sidecar = %q, want %q", data, want)
+	}
+
+	got, err := ParseSidecar(data)
+	if err != nil {
+		t.Fatalf("ParseSidecar failed: %v", err)
+	}
+	if got != s {
+		t.Errorf("got %+v, want %+v", got, s)
+	}
+
+	if _, err := MarshalSidecar(Sidecar{Signature: "us2-a b"}); !errors.Is(err, ErrInvalidSidecar) {
+		t.Errorf("MarshalSidecar with a space in the signature = %v, want ErrInvalidSidecar", err)
+	}
+}
+
+func TestParseSidecarErrors(t *testing.T) {
+	valid := "length 5\noffset 0\nsignature us2-c2ln\n"
+	for name, data := range map[string]string{
+		"no header":         valid,
+		"other header":      "unisign-sidecar v9\n" + valid,
+		"missing signature": SidecarHeader + "\nlength 5\noffset 0\n",
+		"repeated field":    SidecarHeader + "\n" + valid + "length 6\n",
+		"unknown field":     SidecarHeader + "\n" + valid + "comment hi\n",
+		"negative length":   SidecarHeader + "\nlength -5\noffset 0\nsignature us2-c2ln\n",
+		"no value":          SidecarHeader + "\nlength\noffset 0\nsignature us2-c2ln\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseSidecar([]byte(data)); !errors.Is(err, ErrInvalidSidecar) {
+				t.Errorf("error = %v, want ErrInvalidSidecar", err)
+			}
+		})
+	}
+
+	// Field order is free
+	reordered := SidecarHeader + "\n" + strings.Join([]string{"signature us2-c2ln", "offset 0", "length 5"}, "\n") + "\n"
+	if _, err := ParseSidecar([]byte(reordered)); err != nil {
+		t.Errorf("reordered sidecar: %v", err)
+	}
+}
@@ -0,0 +1,421 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// TimestampSuffix is appended to a signed file's name to name the sidecar
+// holding its RFC 3161 timestamp token
+const TimestampSuffix = ".tst"
+
+// maxTimestampResponse bounds how much of a TSA's response is read; tokens
+// are a few kilobytes, certificates included
+const maxTimestampResponse = 1 << 20
+
+var (
+	// ErrTimestampRejected is returned when a TSA refuses a timestamp request
+	ErrTimestampRejected = errors.New("timestamp request rejected")
+	// ErrInvalidTimestamp is returned when a timestamp token is malformed or
+	// doesn't cover the data it is checked against
+	ErrInvalidTimestamp = errors.New("invalid timestamp token")
+)
+
+var (
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// The ASN.1 structures below follow RFC 3161 (TimeStampReq, TimeStampResp,
+// TSTInfo) and RFC 5652 (the CMS SignedData the token is wrapped in)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// rawElement keeps an element's DER, tag included
+type rawElement struct {
+	Raw asn1.RawContent
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     rawElement   `asn1:"optional,tag:0"`
+	CRLs             rawElement   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        rawElement `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time  `asn1:"generalized"`
+	Accuracy       rawElement `asn1:"optional"`
+	Ordering       bool       `asn1:"optional,default:false"`
+	Nonce          *big.Int   `asn1:"optional"`
+}
+
+// Timestamp is what a verified timestamp token attests
+type Timestamp struct {
+	// Time is when the TSA saw the data
+	Time time.Time
+
+	// Signer is the TSA certificate the token is signed with
+	Signer *x509.Certificate
+}
+
+// RequestTimestamp asks the RFC 3161 time-stamping authority at tsaURL for
+// a token over the SHA-256 of data and returns the token's DER. The response
+// must echo the request's digest and nonce; the token's signature is not
+// checked here, that is VerifyTimestamp's job. timeout covers the whole
+// request.
+func RequestTimestamp(tsaURL string, data []byte, timeout time.Duration) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	digest := crypto.SHA256.New()
+	digest.Write(data)
+	imprint := messageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+		HashedMessage: digest.Sum(nil),
+	}
+	req, err := asn1.Marshal(timeStampReq{Version: 1, MessageImprint: imprint, Nonce: nonce, CertReq: true})
+	if err != nil {
+		return nil, fmt.Errorf("encoding timestamp request: %w", err)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(tsaURL, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("requesting timestamp from %s: server returned %s", tsaURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTimestampResponse+1))
+	if err != nil {
+		return nil, fmt.Errorf("requesting timestamp from %s: %w", tsaURL, err)
+	}
+	if len(body) > maxTimestampResponse {
+		return nil, fmt.Errorf("requesting timestamp from %s: response exceeds the %d-byte limit", tsaURL, maxTimestampResponse)
+	}
+
+	var tsResp timeStampResp
+	if rest, err := asn1.Unmarshal(body, &tsResp); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed response from %s", ErrInvalidTimestamp, tsaURL)
+	}
+	// 0 is granted, 1 granted with modifications
+	if tsResp.Status.Status > 1 {
+		return nil, fmt.Errorf("%w: status %d %v", ErrTimestampRejected, tsResp.Status.Status, tsResp.Status.StatusString)
+	}
+	token := tsResp.TimeStampToken.FullBytes
+	if len(token) == 0 {
+		return nil, fmt.Errorf("%w: response from %s holds no token", ErrInvalidTimestamp, tsaURL)
+	}
+
+	_, info, err := parseTimestampToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkImprint(info.MessageImprint, data); err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w: nonce does not match the request", ErrInvalidTimestamp)
+	}
+	return token, nil
+}
+
+// VerifyTimestamp checks that token is an RFC 3161 timestamp token over
+// data, signed by a TSA certificate that chains to roots and is valid for
+// time stamping at the token's time. The certificates the TSA needs,
+// intermediates included, must be in the token.
+func VerifyTimestamp(token, data []byte, roots *x509.CertPool) (*Timestamp, error) {
+	sd, info, err := parseTimestampToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkImprint(info.MessageImprint, data); err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: %d signers, want 1", ErrInvalidTimestamp, len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Raw) != 0 {
+		var set asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.Certificates.Raw, &set); err != nil {
+			return nil, fmt.Errorf("%w: certificates: %v", ErrInvalidTimestamp, err)
+		}
+		if certs, err = x509.ParseCertificates(set.Bytes); err != nil {
+			return nil, fmt.Errorf("%w: certificates: %v", ErrInvalidTimestamp, err)
+		}
+	}
+	signer, err := findSignerCertificate(si.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 3161 tokens always carry signed attributes; the signature covers
+	// them, re-tagged as the SET OF they are, and they in turn bind the TSTInfo
+	if len(si.SignedAttrs.Raw) == 0 {
+		return nil, fmt.Errorf("%w: no signed attributes", ErrInvalidTimestamp)
+	}
+	hash, err := hashForOID(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignedAttributes(si.SignedAttrs.Raw, hash, sd.EncapContentInfo.EContent); err != nil {
+		return nil, err
+	}
+	algorithm, err := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, hash, signer)
+	if err != nil {
+		return nil, err
+	}
+	signedAttrs := append([]byte{0x31}, si.SignedAttrs.Raw[1:]...)
+	if err := signer.CheckSignature(algorithm, signedAttrs, si.Signature); err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidTimestamp, err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		if cert != signer {
+			intermediates.AddCert(cert)
+		}
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: TSA certificate: %v", ErrInvalidTimestamp, err)
+	}
+	return &Timestamp{Time: info.GenTime, Signer: signer}, nil
+}
+
+// parseTimestampToken unwraps a token's SignedData and the TSTInfo inside it
+func parseTimestampToken(token []byte) (*signedData, *tstInfo, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil || len(rest) != 0 {
+		return nil, nil, fmt.Errorf("%w: not a CMS ContentInfo", ErrInvalidTimestamp)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, fmt.Errorf("%w: content type %v is not SignedData", ErrInvalidTimestamp, ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, nil, fmt.Errorf("%w: SignedData: %v", ErrInvalidTimestamp, err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, nil, fmt.Errorf("%w: encapsulated content type %v is not TSTInfo", ErrInvalidTimestamp, sd.EncapContentInfo.EContentType)
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, nil, fmt.Errorf("%w: TSTInfo: %v", ErrInvalidTimestamp, err)
+	}
+	return &sd, &info, nil
+}
+
+// checkImprint reports whether imprint is the hash of data
+func checkImprint(imprint messageImprint, data []byte) error {
+	hash, err := hashForOID(imprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), imprint.HashedMessage) {
+		return fmt.Errorf("%w: token is over different data", ErrInvalidTimestamp)
+	}
+	return nil
+}
+
+// checkSignedAttributes requires the content type attribute to name TSTInfo
+// and the message digest attribute to be the hash of content
+func checkSignedAttributes(raw []byte, hash crypto.Hash, content []byte) error {
+	var set asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("%w: signed attributes: %v", ErrInvalidTimestamp, err)
+	}
+	var contentType asn1.ObjectIdentifier
+	var digest []byte
+	for rest := set.Bytes; len(rest) > 0; {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return fmt.Errorf("%w: signed attributes: %v", ErrInvalidTimestamp, err)
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &contentType)
+		case attr.Type.Equal(oidMessageDigest):
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &digest)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: signed attribute %v: %v", ErrInvalidTimestamp, attr.Type, err)
+		}
+	}
+	if !contentType.Equal(oidTSTInfo) {
+		return fmt.Errorf("%w: signed content type is not TSTInfo", ErrInvalidTimestamp)
+	}
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return fmt.Errorf("%w: message digest does not match the TSTInfo", ErrInvalidTimestamp)
+	}
+	return nil
+}
+
+// findSignerCertificate returns the certificate sid names, either by issuer
+// and serial number or by subject key identifier
+func findSignerCertificate(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	switch {
+	case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+		var ias issuerAndSerialNumber
+		if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("%w: signer identifier: %v", ErrInvalidTimestamp, err)
+		}
+		for _, cert := range certs {
+			if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+				return cert, nil
+			}
+		}
+	case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+		for _, cert := range certs {
+			if len(cert.SubjectKeyId) != 0 && bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown signer identifier", ErrInvalidTimestamp)
+	}
+	return nil, fmt.Errorf("%w: token does not include the TSA certificate", ErrInvalidTimestamp)
+}
+
+// hashForOID maps the digest algorithms TSAs use to their crypto.Hash
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("%w: unsupported digest algorithm %v", ErrInvalidTimestamp, oid)
+}
+
+// signatureAlgorithm maps a SignerInfo's signature algorithm, which CMS
+// may give as just the key type, and its digest to the x509 algorithm for
+// checking it with the signer's key
+func signatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash, signer *x509.Certificate) (x509.SignatureAlgorithm, error) {
+	byHash := func(sha256, sha384, sha512 x509.SignatureAlgorithm) x509.SignatureAlgorithm {
+		switch hash {
+		case crypto.SHA384:
+			return sha384
+		case crypto.SHA512:
+			return sha512
+		}
+		return sha256
+	}
+	switch key := signer.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if oid.Equal(oidRSAEncryption) || oid.Equal(oidSHA256WithRSA) || oid.Equal(oidSHA384WithRSA) || oid.Equal(oidSHA512WithRSA) {
+			return byHash(x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA), nil
+		}
+	case *ecdsa.PublicKey:
+		if oid.Equal(oidECPublicKey) || oid.Equal(oidECDSAWithSHA256) || oid.Equal(oidECDSAWithSHA384) || oid.Equal(oidECDSAWithSHA512) {
+			return byHash(x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512), nil
+		}
+	case ed25519.PublicKey:
+		if oid.Equal(oidEd25519) {
+			return x509.PureEd25519, nil
+		}
+	default:
+		return 0, fmt.Errorf("%w: unsupported TSA key type %T", ErrInvalidTimestamp, key)
+	}
+	return 0, fmt.Errorf("%w: unsupported signature algorithm %v", ErrInvalidTimestamp, oid)
+}
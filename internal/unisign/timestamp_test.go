@@ -0,0 +1,83 @@
+package unisign
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+	"unisign/internal/tsatest"
+)
+
+func newTestTSA(t *testing.T, opts tsatest.Options) *tsatest.Server {
+	t.Helper()
+
+	tsa, err := tsatest.NewServer(opts)
+	if err != nil {
+		t.Fatalf("failed to start mock TSA: %v", err)
+	}
+	t.Cleanup(tsa.Close)
+	return tsa
+}
+
+func TestTimestamp(t *testing.T) {
+	tsa := newTestTSA(t, tsatest.Options{})
+	signature := []byte("an ed25519 signature stands in here")
+
+	before := time.Now().Add(-time.Second)
+	token, err := RequestTimestamp(tsa.URL, signature, 5*time.Second)
+	if err != nil {
+		t.Fatalf("RequestTimestamp failed: %v", err)
+	}
+	ts, err := VerifyTimestamp(token, signature, tsa.RootPool())
+	if err != nil {
+		t.Fatalf("VerifyTimestamp failed: %v", err)
+	}
+	if ts.Time.Before(before.Truncate(time.Second)) || ts.Time.After(time.Now()) {
+		t.Errorf("timestamp %v is not around now", ts.Time)
+	}
+	if !ts.Signer.Equal(tsa.Cert) {
+		t.Errorf("signer is %s, want the TSA certificate", ts.Signer.Subject)
+	}
+
+	other := newTestTSA(t, tsatest.Options{})
+	tampered := append([]byte(nil), token...)
+	tampered[len(tampered)-1] ^= 1
+	for name, tc := range map[string]struct {
+		token []byte
+		data  []byte
+		roots *x509.CertPool
+	}{
+		"other data":     {token, []byte("another signature"), tsa.RootPool()},
+		"untrusted TSA":  {token, signature, other.RootPool()},
+		"tampered token": {tampered, signature, tsa.RootPool()},
+		"not a token":    {signature, signature, tsa.RootPool()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := VerifyTimestamp(tc.token, tc.data, tc.roots); !errors.Is(err, ErrInvalidTimestamp) {
+				t.Errorf("error = %v, want ErrInvalidTimestamp", err)
+			}
+		})
+	}
+}
+
+func TestTimestamp_NotForTimeStamping(t *testing.T) {
+	tsa := newTestTSA(t, tsatest.Options{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}})
+	signature := []byte("signature")
+
+	token, err := RequestTimestamp(tsa.URL, signature, 5*time.Second)
+	if err != nil {
+		t.Fatalf("RequestTimestamp failed: %v", err)
+	}
+	if _, err := VerifyTimestamp(token, signature, tsa.RootPool()); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Errorf("error = %v, want ErrInvalidTimestamp for a certificate without the time stamping usage", err)
+	}
+}
+
+func TestRequestTimestamp_Rejected(t *testing.T) {
+	tsa := newTestTSA(t, tsatest.Options{})
+	tsa.Reject = true
+
+	if _, err := RequestTimestamp(tsa.URL, []byte("signature"), 5*time.Second); !errors.Is(err, ErrTimestampRejected) {
+		t.Errorf("error = %v, want ErrTimestampRejected", err)
+	}
+}
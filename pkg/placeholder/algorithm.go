@@ -0,0 +1,101 @@
+package placeholder
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnknownAlgorithm is returned when no placeholder size is known for an algorithm
+var ErrUnknownAlgorithm = errors.New("unknown signature algorithm")
+
+// The prefix of an embedded signature names its algorithm family in the
+// letter after the "u" and the signature format version in the digit, so
+// a signed file tells a verifier how long its signature is and how to decode it
+const (
+	// ECDSAPrefix starts every ECDSA signature
+	ECDSAPrefix = "uc2-"
+
+	// RSAPrefix starts every RSA signature
+	RSAPrefix = "ur2-"
+)
+
+// algorithm is the embedded layout of one signature algorithm
+type algorithm struct {
+	prefix string // prefix of the encoded signature
+	size   int    // size in bytes of the raw signature
+}
+
+// algorithms maps an algorithm name to its prefix and the size of its raw
+// signature. ECDSA signatures are sized in their fixed-width r||s form, so
+// the encoded length doesn't depend on the values of r and s.
+var algorithms = map[string]algorithm{
+	"ed25519":    {SignaturePrefix, 64},
+	"ecdsa-p256": {ECDSAPrefix, 64},
+	"ecdsa-p384": {ECDSAPrefix, 96},
+	"ecdsa-p521": {ECDSAPrefix, 132},
+	"rsa-2048":   {RSAPrefix, 256},
+	"rsa-3072":   {RSAPrefix, 384},
+	"rsa-4096":   {RSAPrefix, 512},
+
+	// An ed25519 signature behind the 8-byte key ID tag of unisign.SignWithKeyID
+	"ed25519-keyid": {SignaturePrefix, 72},
+}
+
+// PrefixFor returns the prefix that starts an encoded signature of the given algorithm
+func PrefixFor(algo string) (string, error) {
+	a, ok := algorithms[algo]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algo)
+	}
+	return a.prefix, nil
+}
+
+// SignatureSize returns the size in bytes of a raw signature of the given algorithm
+func SignatureSize(algo string) (int, error) {
+	a, ok := algorithms[algo]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algo)
+	}
+	return a.size, nil
+}
+
+// AlgorithmsForPrefix returns the algorithms whose signatures start with
+// prefix, sorted by name. Algorithms sharing a prefix differ in signature
+// size, so the length of an encoded signature picks one of them.
+func AlgorithmsForPrefix(prefix string) []string {
+	var names []string
+	for name, a := range algorithms {
+		if a.prefix == prefix {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PlaceholderFor returns a placeholder of exactly the length an encoded
+// signature (the algorithm's prefix + base64) of the given algorithm occupies.
+// The filler after the prefix is valid base64 derived from SHA-256, so it is
+// deterministic across builds and unlikely to occur by accident.
+// For ed25519 this is MagicStringConst, the placeholder unisign looks for by default.
+func PlaceholderFor(algo string) (string, error) {
+	a, ok := algorithms[algo]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algo)
+	}
+	if algo == "ed25519" {
+		return MagicStringConst, nil
+	}
+
+	// Expand a seed with a SHA-256 counter until we have size bytes of filler
+	filler := make([]byte, 0, a.size+sha256.Size)
+	for counter := 0; len(filler) < a.size; counter++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("unisign placeholder %s %d", algo, counter)))
+		filler = append(filler, sum[:]...)
+	}
+
+	return a.prefix + base64.StdEncoding.EncodeToString(filler[:a.size]), nil
+}
@@ -0,0 +1,100 @@
+package placeholder
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPlaceholderForEd25519(t *testing.T) {
+	got, err := PlaceholderFor("ed25519")
+	if err != nil {
+		t.Fatalf("PlaceholderFor failed: %v", err)
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	encoded := SignaturePrefix + base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("message")))
+
+	if len(got) != len(encoded) {
+		t.Errorf("placeholder length = %d, want %d", len(got), len(encoded))
+	}
+	if got != MagicStringConst {
+		t.Errorf("ed25519 placeholder = %q, want the default magic string", got)
+	}
+}
+
+func TestPlaceholderForP256(t *testing.T) {
+	got, err := PlaceholderFor("ecdsa-p256")
+	if err != nil {
+		t.Fatalf("PlaceholderFor failed: %v", err)
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	digest := sha256.Sum256([]byte("message"))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	raw := make([]byte, 64)
+	r.FillBytes(raw[:32])
+	s.FillBytes(raw[32:])
+	encoded := ECDSAPrefix + base64.StdEncoding.EncodeToString(raw)
+
+	if len(got) != len(encoded) {
+		t.Errorf("placeholder length = %d, want %d", len(got), len(encoded))
+	}
+	if !strings.HasPrefix(got, ECDSAPrefix) {
+		t.Errorf("placeholder %q does not start with %q", got, ECDSAPrefix)
+	}
+	if got == MagicStringConst {
+		t.Error("P-256 placeholder should differ from the ed25519 one")
+	}
+}
+
+func TestPlaceholderForUnknown(t *testing.T) {
+	if _, err := PlaceholderFor("dsa-1024"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("expected ErrUnknownAlgorithm, got %v", err)
+	}
+}
+
+func TestAlgorithmPrefixes(t *testing.T) {
+	for prefix, want := range map[string][]string{
+		SignaturePrefix: {"ed25519", "ed25519-keyid"},
+		ECDSAPrefix:     {"ecdsa-p256", "ecdsa-p384", "ecdsa-p521"},
+		RSAPrefix:       {"rsa-2048", "rsa-3072", "rsa-4096"},
+		"ux2-":          nil,
+	} {
+		got := AlgorithmsForPrefix(prefix)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("AlgorithmsForPrefix(%q) = %v, want %v", prefix, got, want)
+		}
+		for _, algo := range got {
+			if p, err := PrefixFor(algo); err != nil || p != prefix {
+				t.Errorf("PrefixFor(%q) = %q, %v, want %q", algo, p, err, prefix)
+			}
+			placeholder, err := PlaceholderFor(algo)
+			if err != nil || !strings.HasPrefix(placeholder, prefix) {
+				t.Errorf("PlaceholderFor(%q) = %q, %v, want prefix %q", algo, placeholder, err, prefix)
+			}
+		}
+	}
+
+	if _, err := PrefixFor("dsa-1024"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("expected ErrUnknownAlgorithm, got %v", err)
+	}
+	if _, err := SignatureSize("dsa-1024"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("expected ErrUnknownAlgorithm, got %v", err)
+	}
+}
@@ -9,7 +9,7 @@
     // Linux/other - ELF format
     __attribute__((section(".note.unisign")))
 #endif
-const char magic_comment[] = "us1-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA==";
+const char magic_comment[] = "us2-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA==";
 
 int main() {
     printf("Hello, world!\n");
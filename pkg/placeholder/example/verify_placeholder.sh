@@ -28,7 +28,7 @@ BINARY_PATH="$TEMP_DIR/example"
 MODULE_PREFIX="unisign/pkg/placeholder"
 
 # Magic string placeholder - must match the one in placeholder.go
-MAGIC_STRING="us1-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA=="
+MAGIC_STRING="us2-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA=="
 
 echo "Compiling example with aggressive optimizations..."
 go build -o "$BINARY_PATH" -ldflags="-s -w" main.go
@@ -57,7 +57,7 @@ fi
 echo "Exact match not found, checking for partial matches..."
 
 # Check for distinctive chunks of the magic string
-PREFIX="us1-"
+PREFIX="us2-"
 CHUNK1="r/GZBm1d749E+KbBLWa"
 CHUNK2="EOqGw+DeMQUNHb5TLBt"
 CHUNK3="p82zcb9sMDO+Ai7e2TA"
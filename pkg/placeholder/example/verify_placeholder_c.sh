@@ -20,7 +20,7 @@ cd "$SCRIPT_DIR/c"
 BINARY_PATH="./hello"
 
 # Magic string placeholder - must match the one in hello.c
-MAGIC_STRING="us1-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA=="
+MAGIC_STRING="us2-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA=="
 
 echo "Compiling C program with make..."
 make clean
@@ -64,7 +64,7 @@ fi
 echo "Exact match not found, checking for partial matches..."
 
 # Check for distinctive chunks of the magic string
-PREFIX="us1-"
+PREFIX="us2-"
 CHUNK1="r/GZBm1d749E+KbBLWa"
 CHUNK2="EOqGw+DeMQUNHb5TLBt"
 CHUNK3="p82zcb9sMDO+Ai7e2TA"
@@ -11,13 +11,13 @@ import (
 // MagicStringConst is the placeholder string constant that will be replaced with a signature
 // Exactly 92 characters to match base64 encoded signature with prefix
 // An ed25519 signature is 64 bytes which encodes to 88 chars in base64, plus 4 chars for prefix
-const MagicStringConst = "us1-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA=="
+const MagicStringConst = "us2-r/GZBm1d749E+KbBLWaEnR5fNz626Deutp0P9F4ICt5EOqGw+DeMQUNHb5TLBt+gol0p82zcb9sMDO+Ai7e2TA=="
 
 // MagicString is a variable initialized with the constant value to allow taking its address
 var MagicString = MagicStringConst
 
 // SignaturePrefix is added to the base64 encoded signature
-const SignaturePrefix = "us1-"
+const SignaturePrefix = "us2-"
 
 // volatileString prevents compiler optimizations
 var volatileString atomic.Value
@@ -0,0 +1,109 @@
+package unisign
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"unisign/pkg/placeholder"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// batchChunkSize is how much of a file SignFilesContext reads between
+// checks for cancellation
+const batchChunkSize = 1 << 20
+
+// Result reports a file signed by SignFilesContext
+type Result struct {
+	// Path is the input file
+	Path string
+
+	// Output is the signed copy, Path with ".signed" appended; empty if Err is set
+	Output string
+
+	// Offset is where the signature was written
+	Offset int64
+
+	// Err is why the file could not be signed, if it couldn't
+	Err error
+}
+
+// SignFilesContext signs each of paths the way the unisign command does: the
+// file must contain placeholder.MagicString exactly once, and a copy with the
+// placeholder replaced by the signature is written next to it with ".signed"
+// appended. A file that cannot be signed is reported in its Result and the
+// batch moves on.
+//
+// ctx is checked between files and between chunks while a file is read. On
+// cancellation SignFilesContext returns the results of the files it finished,
+// in order, together with ctx.Err(); the file in progress is not written.
+// A file whose signed copy was written before ctx was canceled counts as
+// finished.
+func SignFilesContext(ctx context.Context, paths []string, signer ssh.Signer) ([]Result, error) {
+	results := make([]Result, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		result := Result{Path: path}
+		result.Offset, result.Err = signFileContext(ctx, path, signer)
+		if err := ctx.Err(); err != nil && result.Err == err {
+			// Interrupted before its copy was written
+			return results, err
+		}
+		if result.Err == nil {
+			result.Output = path + ".signed"
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// signFileContext signs one file for SignFilesContext and returns the signature's offset
+func signFileContext(ctx context.Context, path string, signer ssh.Signer) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// Read the file, checking ctx between chunks
+	data := make([]byte, 0, info.Size())
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := io.ReadFull(f, data[len(data):min(cap(data), len(data)+batchChunkSize)])
+		data = data[:len(data)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF || len(data) == cap(data) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(data)) != info.Size() {
+		return 0, fmt.Errorf("%s is %d bytes, expected %d; was it modified?", path, len(data), info.Size())
+	}
+
+	offset, err := SignAndReplace(signer, data, []byte(placeholder.MagicString), placeholder.SignaturePrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	output := path + ".signed"
+	if err := os.WriteFile(output, data, info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	return offset, os.Chmod(output, info.Mode().Perm())
+}
@@ -0,0 +1,200 @@
+package unisign
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"unisign/pkg/placeholder"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// cancelingSigner cancels a context once it has produced its after-th signature
+type cancelingSigner struct {
+	ssh.Signer
+	cancel context.CancelFunc
+	after  int
+	signed int
+}
+
+func (s *cancelingSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	if s.signed++; s.signed == s.after {
+		defer s.cancel()
+	}
+	return s.Signer.Sign(rand, data)
+}
+
+// writeBatchFiles creates count files in dir, each holding the placeholder once
+func writeBatchFiles(t *testing.T, dir string, count int) []string {
+	t.Helper()
+
+	var paths []string
+	for i := 0; i < count; i++ {
+		path := filepath.Join(dir, string(rune('a'+i))+".bin")
+		content := append([]byte("file "+path+" "), placeholder.MagicString...)
+		if err := os.WriteFile(path, append(content, " end"...), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestSignFilesContext(t *testing.T) {
+	privPath, pubPath := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	pubData, err := os.ReadFile(pubPath)
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubData)
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+
+	dir := t.TempDir()
+	paths := writeBatchFiles(t, dir, 2)
+	noMagic := filepath.Join(dir, "nomagic.bin")
+	if err := os.WriteFile(noMagic, []byte("no placeholder here"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", noMagic, err)
+	}
+	paths = append(paths[:1], noMagic, paths[1])
+
+	results, err := SignFilesContext(context.Background(), paths, signer)
+	if err != nil {
+		t.Fatalf("SignFilesContext failed: %v", err)
+	}
+	if len(results) != len(paths) {
+		t.Fatalf("got %d results, want %d", len(results), len(paths))
+	}
+	if !errors.Is(results[1].Err, ErrMagicNotFound) {
+		t.Errorf("results[1].Err = %v, want %v", results[1].Err, ErrMagicNotFound)
+	}
+
+	for _, i := range []int{0, 2} {
+		r := results[i]
+		if r.Err != nil || r.Path != paths[i] || r.Output != paths[i]+".signed" {
+			t.Fatalf("results[%d] = %+v, want a signed copy of %s", i, r, paths[i])
+		}
+		original, _ := os.ReadFile(r.Path)
+		signed, err := os.ReadFile(r.Output)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", r.Output, err)
+		}
+
+		encoded := signed[r.Offset : r.Offset+int64(len(placeholder.MagicString))]
+		if !bytes.HasPrefix(encoded, []byte(placeholder.SignaturePrefix)) {
+			t.Fatalf("%s has %q at offset %d, want a signature", r.Output, encoded, r.Offset)
+		}
+		signature, err := base64.StdEncoding.DecodeString(string(encoded[len(placeholder.SignaturePrefix):]))
+		if err != nil {
+			t.Fatalf("failed to decode signature: %v", err)
+		}
+		if err := VerifySignature(pubKey, original, uint64(r.Offset), signature); err != nil {
+			t.Errorf("signature in %s does not verify: %v", r.Output, err)
+		}
+	}
+}
+
+func TestSignFilesContextCanceled(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	paths := writeBatchFiles(t, t.TempDir(), 3)
+
+	t.Run("first file", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Signing the first file cancels ctx before it is written
+		results, err := SignFilesContext(ctx, paths, &cancelingSigner{Signer: signer, cancel: cancel, after: 1})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want %v", err, context.Canceled)
+		}
+		if len(results) != 0 {
+			t.Fatalf("got %d results, want none since the first file was interrupted", len(results))
+		}
+		for _, path := range paths {
+			if _, err := os.Stat(path + ".signed"); !os.IsNotExist(err) {
+				t.Errorf("%s.signed was written after cancellation", path)
+			}
+		}
+	})
+
+	t.Run("mid-batch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The first file completes and the second is interrupted
+		results, err := SignFilesContext(ctx, paths, &cancelingSigner{Signer: signer, cancel: cancel, after: 2})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want %v", err, context.Canceled)
+		}
+		if len(results) != 1 || results[0].Path != paths[0] || results[0].Err != nil {
+			t.Fatalf("results = %+v, want only %s completed", results, paths[0])
+		}
+		if _, err := os.Stat(paths[0] + ".signed"); err != nil {
+			t.Errorf("completed file was not written: %v", err)
+		}
+		for _, path := range paths[1:] {
+			if _, err := os.Stat(path + ".signed"); !os.IsNotExist(err) {
+				t.Errorf("%s.signed was written after cancellation", path)
+			}
+		}
+	})
+
+	t.Run("before start", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := SignFilesContext(ctx, paths, signer)
+		if !errors.Is(err, context.Canceled) || len(results) != 0 {
+			t.Fatalf("got %d results and err %v, want none and %v", len(results), err, context.Canceled)
+		}
+	})
+}
+
+// writtenContext reports itself canceled once the file at path exists
+type writtenContext struct {
+	context.Context
+	path string
+}
+
+func (c writtenContext) Err() error {
+	if _, err := os.Stat(c.path); err == nil {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestSignFilesContextCanceledAfterWrite(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	paths := writeBatchFiles(t, t.TempDir(), 2)
+
+	// ctx is canceled as soon as the first signed copy is written
+	ctx := writtenContext{Context: context.Background(), path: paths[0] + ".signed"}
+	results, err := SignFilesContext(ctx, paths, signer)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if len(results) != 1 || results[0].Path != paths[0] || results[0].Err != nil || results[0].Output != paths[0]+".signed" {
+		t.Fatalf("results = %+v, want the written copy of %s reported", results, paths[0])
+	}
+	if _, err := os.Stat(paths[1] + ".signed"); !os.IsNotExist(err) {
+		t.Errorf("%s.signed was written after cancellation", paths[1])
+	}
+}
@@ -0,0 +1,78 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyIDSize is the length of the key ID tag SignWithKeyID puts in front of
+// a signature. It is a prefix of the key's SHA-256 fingerprint, enough to
+// tell a verifier's keys apart; it is not signed and proves nothing itself.
+const KeyIDSize = 8
+
+// ErrInvalidKeyIDSignature is returned when a tagged signature is too short to hold a key ID
+var ErrInvalidKeyIDSignature = errors.New("invalid key ID tagged signature")
+
+// KeyID returns the key ID tag of publicKey: the first KeyIDSize bytes of the
+// SHA-256 of its wire form, the hash ssh-keygen -l prints. A certificate has
+// the ID of the key it certifies, so either verifies a tag its signer wrote.
+func KeyID(publicKey ssh.PublicKey) []byte {
+	sum := sha256.Sum256(certifiedKey(publicKey).Marshal())
+	return sum[:KeyIDSize]
+}
+
+// SignWithKeyID is like SignBuffer but returns the signature prefixed with
+// the signer's key ID, KeyIDSize+64 bytes in all, so a verifier holding
+// several keys can go straight to the one that signed
+func SignWithKeyID(signer ssh.Signer, message []byte, offset uint64) ([]byte, error) {
+	signature, err := SignBuffer(signer, message, offset)
+	if err != nil {
+		return nil, err
+	}
+	return append(KeyID(signer.PublicKey()), signature...), nil
+}
+
+// SplitKeyID separates a signature made by SignWithKeyID into its key ID and the signature proper
+func SplitKeyID(tagged []byte) (keyID, signature []byte, err error) {
+	if len(tagged) <= KeyIDSize {
+		return nil, nil, fmt.Errorf("%w: %d bytes", ErrInvalidKeyIDSignature, len(tagged))
+	}
+	return tagged[:KeyIDSize], tagged[KeyIDSize:], nil
+}
+
+// OrderByKeyID returns the indexes of publicKeys with those whose KeyID is
+// keyID first, so a verifier tries the tagged key before any other. The rest
+// follow in their original order: the tag is not signed, so a wrong one must
+// only cost time, never make a valid signature fail.
+func OrderByKeyID(publicKeys []ssh.PublicKey, keyID []byte) []int {
+	order := make([]int, 0, len(publicKeys))
+	var rest []int
+	for i, publicKey := range publicKeys {
+		if keyID != nil && bytes.Equal(KeyID(publicKey), keyID) {
+			order = append(order, i)
+		} else {
+			rest = append(rest, i)
+		}
+	}
+	return append(order, rest...)
+}
+
+// VerifyWithKeyID verifies a signature made by SignWithKeyID against the key
+// set publicKeys, starting with the key its tag names. It returns the index
+// of the key that verified it.
+func VerifyWithKeyID(publicKeys []ssh.PublicKey, message []byte, offset uint64, tagged []byte) (int, error) {
+	keyID, signature, err := SplitKeyID(tagged)
+	if err != nil {
+		return -1, err
+	}
+	for _, i := range OrderByKeyID(publicKeys, keyID) {
+		if VerifySignature(publicKeys[i], message, offset, signature) == nil {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("signature verification failed with all %d keys", len(publicKeys))
+}
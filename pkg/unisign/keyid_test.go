@@ -0,0 +1,73 @@
+package unisign
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVerifyWithKeyID_ChoosesTaggedKey(t *testing.T) {
+	signers, publicKeys := generateMultiSigKeys(t, 4)
+	message := []byte("release 1.2.3")
+
+	for i, signer := range signers {
+		tagged, err := SignWithKeyID(signer, message, 7)
+		if err != nil {
+			t.Fatalf("SignWithKeyID failed: %v", err)
+		}
+		if len(tagged) != KeyIDSize+64 {
+			t.Fatalf("tagged signature is %d bytes, want %d", len(tagged), KeyIDSize+64)
+		}
+		keyID, _, err := SplitKeyID(tagged)
+		if err != nil {
+			t.Fatalf("SplitKeyID failed: %v", err)
+		}
+		if !bytes.Equal(keyID, KeyID(publicKeys[i])) {
+			t.Errorf("key %d: tag %x, want %x", i, keyID, KeyID(publicKeys[i]))
+		}
+
+		// The tagged key comes first and is the one that verifies
+		if order := OrderByKeyID(publicKeys, keyID); order[0] != i || len(order) != len(publicKeys) {
+			t.Errorf("key %d: order = %v, want it first of %d", i, order, len(publicKeys))
+		}
+		matched, err := VerifyWithKeyID(publicKeys, message, 7, tagged)
+		if err != nil {
+			t.Fatalf("key %d: VerifyWithKeyID failed: %v", i, err)
+		}
+		if matched != i {
+			t.Errorf("key %d: matched key %d", i, matched)
+		}
+	}
+}
+
+func TestVerifyWithKeyID_TagIsOnlyAHint(t *testing.T) {
+	signers, publicKeys := generateMultiSigKeys(t, 3)
+	message := []byte("release 1.2.3")
+
+	tagged, err := SignWithKeyID(signers[2], message, 0)
+	if err != nil {
+		t.Fatalf("SignWithKeyID failed: %v", err)
+	}
+
+	// A tag naming another key, or no key at all, costs only time
+	for name, tag := range map[string][]byte{
+		"other key": KeyID(publicKeys[0]),
+		"unknown":   make([]byte, KeyIDSize),
+	} {
+		retagged := append(append([]byte{}, tag...), tagged[KeyIDSize:]...)
+		if matched, err := VerifyWithKeyID(publicKeys, message, 0, retagged); err != nil || matched != 2 {
+			t.Errorf("%s: VerifyWithKeyID() = %d, %v; want 2, nil", name, matched, err)
+		}
+	}
+
+	// The tag doesn't make a signature by a key outside the set verify
+	if _, err := VerifyWithKeyID(publicKeys[:2], message, 0, tagged); err == nil {
+		t.Error("VerifyWithKeyID succeeded without the signing key")
+	}
+	if _, err := VerifyWithKeyID(publicKeys, []byte("release 1.2.4"), 0, tagged); err == nil {
+		t.Error("VerifyWithKeyID succeeded on a different message")
+	}
+	if _, err := VerifyWithKeyID(publicKeys, message, 0, tagged[:KeyIDSize]); !errors.Is(err, ErrInvalidKeyIDSignature) {
+		t.Errorf("VerifyWithKeyID() error = %v, want ErrInvalidKeyIDSignature", err)
+	}
+}
@@ -0,0 +1,153 @@
+package unisign
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A multi-signature frames several signatures over the same headered message
+// so a single placeholder can hold them all:
+//
+//	count   uint8            number of signatures
+//	repeated count times:
+//	  length  uint16 (big endian)  length of the signature blob
+//	  blob    [length]byte         signature as returned by SignBuffer
+//
+// Every signature covers the same header and message, so each one verifies
+// on its own with VerifySignature.
+
+// MaxMultiSignatures is the most signatures a multi-signature can frame
+const MaxMultiSignatures = math.MaxUint8
+
+// multiSigLengthSize is the size of the length field in front of each signature
+const multiSigLengthSize = 2
+
+// ErrInvalidMultiSignature is returned when a multi-signature blob is malformed
+var ErrInvalidMultiSignature = errors.New("invalid multi-signature")
+
+// ErrQuorumNotMet is returned when fewer distinct keys than the threshold signed
+var ErrQuorumNotMet = errors.New("signature quorum not met")
+
+// MultiSignatureSize returns the size in bytes of a multi-signature holding
+// n ed25519 signatures, for sizing the placeholder it will replace
+func MultiSignatureSize(n int) int {
+	return 1 + n*(multiSigLengthSize+ed25519.SignatureSize)
+}
+
+// SignMultiBuffer signs message with every signer, as SignBuffer does, and
+// frames the signatures into one multi-signature blob
+func SignMultiBuffer(signers []ssh.Signer, message []byte, offset uint64) ([]byte, error) {
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no signers given")
+	}
+	if len(signers) > MaxMultiSignatures {
+		return nil, fmt.Errorf("%d signers exceed the limit of %d", len(signers), MaxMultiSignatures)
+	}
+
+	// The header and message are the same for every signer, so frame them once
+	buf := writeHeader(message, offset)
+	signatures := make([][]byte, len(signers))
+	for i, signer := range signers {
+		signature, err := signHeadered(signer, buf)
+		if err != nil {
+			return nil, fmt.Errorf("signer %d: %w", i, err)
+		}
+		signatures[i] = signature
+	}
+
+	return EncodeMultiSignature(signatures)
+}
+
+// EncodeMultiSignature frames signatures into a multi-signature blob
+func EncodeMultiSignature(signatures [][]byte) ([]byte, error) {
+	if len(signatures) > MaxMultiSignatures {
+		return nil, fmt.Errorf("%d signatures exceed the limit of %d", len(signatures), MaxMultiSignatures)
+	}
+
+	size := 1
+	for i, signature := range signatures {
+		if len(signature) > math.MaxUint16 {
+			return nil, fmt.Errorf("signature %d is %d bytes, longer than the %d-byte limit", i, len(signature), math.MaxUint16)
+		}
+		size += multiSigLengthSize + len(signature)
+	}
+
+	blob := make([]byte, 1, size)
+	blob[0] = uint8(len(signatures))
+	for _, signature := range signatures {
+		blob = binary.BigEndian.AppendUint16(blob, uint16(len(signature)))
+		blob = append(blob, signature...)
+	}
+	return blob, nil
+}
+
+// DecodeMultiSignature splits a multi-signature blob into its signatures.
+// Returns ErrInvalidMultiSignature if it is truncated or has trailing bytes.
+func DecodeMultiSignature(blob []byte) ([][]byte, error) {
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidMultiSignature)
+	}
+
+	count := int(blob[0])
+	rest := blob[1:]
+	signatures := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if len(rest) < multiSigLengthSize {
+			return nil, fmt.Errorf("%w: truncated before signature %d", ErrInvalidMultiSignature, i)
+		}
+		length := int(binary.BigEndian.Uint16(rest))
+		rest = rest[multiSigLengthSize:]
+		if len(rest) < length {
+			return nil, fmt.Errorf("%w: signature %d needs %d bytes, %d left", ErrInvalidMultiSignature, i, length, len(rest))
+		}
+		signatures = append(signatures, rest[:length])
+		rest = rest[length:]
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidMultiSignature, len(rest))
+	}
+	return signatures, nil
+}
+
+// VerifyMultiBuffer verifies a multi-signature made by SignMultiBuffer and
+// checks that at least threshold distinct keys from publicKeys signed the
+// message. Each key counts once however many signatures it made, and
+// signatures that match no key are ignored. Returns ErrQuorumNotMet if too
+// few keys signed.
+func VerifyMultiBuffer(publicKeys []ssh.PublicKey, threshold int, message []byte, offset uint64, blob []byte) error {
+	if threshold < 1 || threshold > len(publicKeys) {
+		return fmt.Errorf("threshold %d must be between 1 and the number of keys (%d)", threshold, len(publicKeys))
+	}
+
+	signatures, err := DecodeMultiSignature(blob)
+	if err != nil {
+		return err
+	}
+
+	// Keys are told apart by the wire form of the key they certify, so the same
+	// key given twice, bare or under a certificate, still counts once
+	buf := writeHeader(message, offset)
+	signed := make(map[string]bool, len(publicKeys))
+	for _, signature := range signatures {
+		for _, publicKey := range publicKeys {
+			id := string(certifiedKey(publicKey).Marshal())
+			if signed[id] {
+				continue
+			}
+			if verifyHeadered(publicKey, buf, signature) == nil {
+				signed[id] = true
+				break
+			}
+		}
+	}
+
+	if len(signed) < threshold {
+		return fmt.Errorf("%w: %d of %d required keys signed", ErrQuorumNotMet, len(signed), threshold)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package unisign
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// generateMultiSigKeys creates n key pairs and returns their signers and public keys
+func generateMultiSigKeys(t *testing.T, n int) ([]ssh.Signer, []ssh.PublicKey) {
+	t.Helper()
+
+	signers := make([]ssh.Signer, n)
+	publicKeys := make([]ssh.PublicKey, n)
+	for i := range signers {
+		privPath, _ := generateTestKey(t)
+		signer, err := ReadSSHPrivateKey(privPath, "")
+		if err != nil {
+			t.Fatalf("failed to read private key: %v", err)
+		}
+		signers[i], publicKeys[i] = signer, signer.PublicKey()
+	}
+	return signers, publicKeys
+}
+
+func TestVerifyMultiBuffer_Quorum(t *testing.T) {
+	signers, publicKeys := generateMultiSigKeys(t, 3)
+	message := []byte("release 1.2.3")
+
+	testCases := []struct {
+		name    string
+		signers []ssh.Signer
+		wantErr error
+	}{
+		{"2 of 3", signers[:2], nil},
+		{"3 of 3", signers, nil},
+		{"1 of 3", signers[1:2], ErrQuorumNotMet},
+		{"same key twice", []ssh.Signer{signers[0], signers[0]}, ErrQuorumNotMet},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			blob, err := SignMultiBuffer(tc.signers, message, 7)
+			if err != nil {
+				t.Fatalf("SignMultiBuffer failed: %v", err)
+			}
+			if len(blob) != MultiSignatureSize(len(tc.signers)) {
+				t.Errorf("blob is %d bytes, want %d", len(blob), MultiSignatureSize(len(tc.signers)))
+			}
+
+			err = VerifyMultiBuffer(publicKeys, 2, message, 7, blob)
+			if !errors.Is(err, tc.wantErr) || (tc.wantErr == nil && err != nil) {
+				t.Errorf("VerifyMultiBuffer() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyMultiBuffer_CertifiedKeyCountsOnce(t *testing.T) {
+	signers, publicKeys := generateMultiSigKeys(t, 2)
+	message := []byte("release 1.2.3")
+
+	blob, err := SignMultiBuffer([]ssh.Signer{signers[0], signers[0]}, message, 0)
+	if err != nil {
+		t.Fatalf("SignMultiBuffer failed: %v", err)
+	}
+
+	certify := func(keyID string) *ssh.Certificate {
+		cert := &ssh.Certificate{Key: publicKeys[0], KeyId: keyID, CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+		if err := cert.SignCert(rand.Reader, signers[1]); err != nil {
+			t.Fatalf("SignCert failed: %v", err)
+		}
+		return cert
+	}
+
+	// A certificate stands for the key it certifies, so it is not a second signer
+	for _, keys := range [][]ssh.PublicKey{
+		{publicKeys[0], certify("a"), publicKeys[1]},
+		{certify("a"), certify("other"), publicKeys[1]},
+	} {
+		if err := VerifyMultiBuffer(keys, 2, message, 0, blob); !errors.Is(err, ErrQuorumNotMet) {
+			t.Errorf("VerifyMultiBuffer() error = %v, want %v", err, ErrQuorumNotMet)
+		}
+	}
+}
+
+func TestVerifyMultiBuffer_WrongMessageOrOffset(t *testing.T) {
+	signers, publicKeys := generateMultiSigKeys(t, 3)
+	message := []byte("release 1.2.3")
+	blob, err := SignMultiBuffer(signers, message, 7)
+	if err != nil {
+		t.Fatalf("SignMultiBuffer failed: %v", err)
+	}
+
+	if err := VerifyMultiBuffer(publicKeys, 2, []byte("release 1.2.4"), 7, blob); !errors.Is(err, ErrQuorumNotMet) {
+		t.Errorf("tampered message: error = %v, want ErrQuorumNotMet", err)
+	}
+	if err := VerifyMultiBuffer(publicKeys, 2, message, 8, blob); !errors.Is(err, ErrQuorumNotMet) {
+		t.Errorf("wrong offset: error = %v, want ErrQuorumNotMet", err)
+	}
+}
+
+func TestVerifyMultiBuffer_EachSignatureVerifiesAlone(t *testing.T) {
+	signers, publicKeys := generateMultiSigKeys(t, 2)
+	message := []byte("release 1.2.3")
+	blob, err := SignMultiBuffer(signers, message, 0)
+	if err != nil {
+		t.Fatalf("SignMultiBuffer failed: %v", err)
+	}
+
+	signatures, err := DecodeMultiSignature(blob)
+	if err != nil {
+		t.Fatalf("DecodeMultiSignature failed: %v", err)
+	}
+	for i, signature := range signatures {
+		if err := VerifySignature(publicKeys[i], message, 0, signature); err != nil {
+			t.Errorf("signature %d does not verify with VerifySignature: %v", i, err)
+		}
+	}
+}
+
+func TestVerifyMultiBuffer_InvalidThreshold(t *testing.T) {
+	signers, publicKeys := generateMultiSigKeys(t, 1)
+	blob, err := SignMultiBuffer(signers, []byte("msg"), 0)
+	if err != nil {
+		t.Fatalf("SignMultiBuffer failed: %v", err)
+	}
+
+	for _, threshold := range []int{0, 2} {
+		if err := VerifyMultiBuffer(publicKeys, threshold, []byte("msg"), 0, blob); err == nil {
+			t.Errorf("threshold %d with 1 key was accepted", threshold)
+		}
+	}
+}
+
+func TestDecodeMultiSignature(t *testing.T) {
+	blob, err := EncodeMultiSignature([][]byte{[]byte("first"), {}, []byte("third")})
+	if err != nil {
+		t.Fatalf("EncodeMultiSignature failed: %v", err)
+	}
+	signatures, err := DecodeMultiSignature(blob)
+	if err != nil {
+		t.Fatalf("DecodeMultiSignature failed: %v", err)
+	}
+	if len(signatures) != 3 || string(signatures[0]) != "first" || len(signatures[1]) != 0 || string(signatures[2]) != "third" {
+		t.Errorf("round trip gave %q", signatures)
+	}
+
+	testCases := []struct {
+		name string
+		blob []byte
+	}{
+		{"empty", nil},
+		{"truncated length", []byte{1, 0}},
+		{"truncated signature", []byte{1, 0, 5, 'a', 'b'}},
+		{"trailing bytes", append(append([]byte(nil), blob...), 0)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodeMultiSignature(tc.blob); !errors.Is(err, ErrInvalidMultiSignature) {
+				t.Errorf("error = %v, want ErrInvalidMultiSignature", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package unisign
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Signer produces the signatures unisign embeds. It is ssh.Signer, so any
+// signer the rest of the package takes can come from a registered backend:
+// a backend implements PublicKey and Sign, where Sign returns an ed25519
+// ssh.Signature over exactly the bytes it is given.
+type Signer = ssh.Signer
+
+// SignerFactory opens the signer a URI names. It is given the whole URI,
+// scheme included.
+type SignerFactory func(uri string) (Signer, error)
+
+var (
+	// ErrUnknownSignerScheme is returned by OpenSigner for a URI whose scheme has no registered factory
+	ErrUnknownSignerScheme = errors.New("unknown signer scheme")
+	// ErrAgentKeyNotFound is returned when an agent:// URI names no key the agent holds
+	ErrAgentKeyNotFound = errors.New("key not found in SSH agent")
+)
+
+var (
+	signerFactoriesMu sync.RWMutex
+	signerFactories   = map[string]SignerFactory{
+		"file":  openFileSigner,
+		"agent": openAgentSigner,
+	}
+)
+
+// RegisterSigner makes factory the way OpenSigner opens URIs of the form
+// scheme://..., so a program can add a signing backend, such as a KMS or
+// an internal signing service, without changes to unisign. The file and
+// agent schemes are registered from the start. Registering a scheme again
+// replaces its factory, and a nil factory removes it. Schemes are case
+// insensitive. It is safe to call concurrently with OpenSigner.
+func RegisterSigner(scheme string, factory SignerFactory) {
+	scheme = strings.ToLower(scheme)
+	signerFactoriesMu.Lock()
+	defer signerFactoriesMu.Unlock()
+	if factory == nil {
+		delete(signerFactories, scheme)
+		return
+	}
+	signerFactories[scheme] = factory
+}
+
+// SignerSchemes returns the registered schemes, sorted
+func SignerSchemes() []string {
+	signerFactoriesMu.RLock()
+	defer signerFactoriesMu.RUnlock()
+	schemes := make([]string, 0, len(signerFactories))
+	for scheme := range signerFactories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// SignerURIScheme returns the scheme of a scheme://... signer URI. Anything
+// else, such as a plain key path, reports false.
+func SignerURIScheme(uri string) (string, bool) {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok || scheme == "" {
+		return "", false
+	}
+	// RFC 3986: a letter, then letters, digits, "+", "-" or "."
+	for i, c := range scheme {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || !(c >= '0' && c <= '9') && c != '+' && c != '-' && c != '.') {
+			return "", false
+		}
+	}
+	return strings.ToLower(scheme), true
+}
+
+// OpenSigner returns the signer uri names, using the factory registered for
+// its scheme:
+//
+//   - file:///path/to/key reads an unencrypted private key file, as ReadSSHPrivateKey does
+//   - agent://SHA256:... uses the key with that fingerprint in the SSH agent at
+//     SSH_AUTH_SOCK; agent:// alone uses the agent's only key
+func OpenSigner(uri string) (Signer, error) {
+	scheme, ok := SignerURIScheme(uri)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not a scheme://... URI", ErrUnknownSignerScheme, uri)
+	}
+	signerFactoriesMu.RLock()
+	factory := signerFactories[scheme]
+	signerFactoriesMu.RUnlock()
+	if factory == nil {
+		return nil, fmt.Errorf("%w: %s (registered: %s)", ErrUnknownSignerScheme, scheme, strings.Join(SignerSchemes(), ", "))
+	}
+	return factory(uri)
+}
+
+// openFileSigner opens a file:// URI
+func openFileSigner(uri string) (Signer, error) {
+	_, path, _ := strings.Cut(uri, "://")
+	return ReadSSHPrivateKey(path, "")
+}
+
+// openAgentSigner opens an agent:// URI. The fingerprint is taken as is,
+// not URL-decoded, so it can be pasted from ssh-add -l. The connection to
+// the agent stays open for as long as the signer is used.
+func openAgentSigner(uri string) (Signer, error) {
+	_, fingerprint, _ := strings.Cut(uri, "://")
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("no SSH agent available (SSH_AUTH_SOCK is not set)")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to SSH agent: %w", err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("listing SSH agent keys: %w", err)
+	}
+	if fingerprint == "" {
+		if len(signers) == 1 {
+			return signers[0], nil
+		}
+		conn.Close()
+		return nil, fmt.Errorf("%w: agent:// needs a fingerprint when the agent holds %d keys", ErrAgentKeyNotFound, len(signers))
+	}
+	for _, signer := range signers {
+		if ssh.FingerprintSHA256(signer.PublicKey()) == fingerprint {
+			return signer, nil
+		}
+	}
+	conn.Close()
+	return nil, fmt.Errorf("%w: no key with fingerprint %s (%d keys loaded)", ErrAgentKeyNotFound, fingerprint, len(signers))
+}
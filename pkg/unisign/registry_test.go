@@ -0,0 +1,189 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unisign/pkg/placeholder"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// serviceSigner stands in for a signing service with its own API: the
+// private key never leaves the "service", which is asked for raw ed25519
+// signatures
+type serviceSigner struct {
+	publicKey ssh.PublicKey
+	sign      func(data []byte) []byte
+}
+
+func (s *serviceSigner) PublicKey() ssh.PublicKey { return s.publicKey }
+
+func (s *serviceSigner) Sign(_ io.Reader, data []byte) (*ssh.Signature, error) {
+	return &ssh.Signature{Format: ssh.KeyAlgoED25519, Blob: s.sign(data)}, nil
+}
+
+func TestRegisterSigner(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to convert public key: %v", err)
+	}
+
+	var opened []string
+	RegisterSigner("signsvc", func(uri string) (Signer, error) {
+		opened = append(opened, uri)
+		if !strings.HasSuffix(uri, "/release-key") {
+			return nil, errors.New("no such key")
+		}
+		return &serviceSigner{publicKey: sshPub, sign: func(data []byte) []byte { return ed25519.Sign(priv, data) }}, nil
+	})
+	t.Cleanup(func() { RegisterSigner("signsvc", nil) })
+
+	// Sign through the backend and verify the result like any other signature
+	signer, err := OpenSigner("SignSvc://signing.internal/release-key")
+	if err != nil {
+		t.Fatalf("OpenSigner failed: %v", err)
+	}
+	if len(opened) != 1 || opened[0] != "SignSvc://signing.internal/release-key" {
+		t.Errorf("factory was given %q, want the whole URI", opened)
+	}
+	magic := []byte(placeholder.MagicString)
+	signed := append(append([]byte("payload "), magic...), " trailer"...)
+	if _, err := SignAndReplace(signer, signed, magic, placeholder.SignaturePrefix); err != nil {
+		t.Fatalf("SignAndReplace failed: %v", err)
+	}
+	got, err := io.ReadAll(NewVerifyingReader(bytes.NewReader(signed), sshPub, magic, placeholder.SignaturePrefix))
+	if err != nil || !bytes.Equal(got, signed) {
+		t.Errorf("signature from the registered backend does not verify: %v", err)
+	}
+
+	// Factory errors come back as they are
+	if _, err := OpenSigner("signsvc://signing.internal/other-key"); err == nil || err.Error() != "no such key" {
+		t.Errorf("OpenSigner error = %v, want the factory's", err)
+	}
+
+	// A removed scheme is unknown again
+	RegisterSigner("signsvc", nil)
+	if _, err := OpenSigner("signsvc://signing.internal/release-key"); !errors.Is(err, ErrUnknownSignerScheme) {
+		t.Errorf("OpenSigner after removal = %v, want ErrUnknownSignerScheme", err)
+	}
+	for _, uri := range []string{"pkcs11://token/key", "/home/user/.ssh/id_ed25519", "./1a://key"} {
+		if _, err := OpenSigner(uri); !errors.Is(err, ErrUnknownSignerScheme) {
+			t.Errorf("OpenSigner(%q) = %v, want ErrUnknownSignerScheme", uri, err)
+		}
+	}
+}
+
+func TestSignerURIScheme(t *testing.T) {
+	for uri, want := range map[string]string{
+		"file:///tmp/key":      "file",
+		"AGENT://SHA256:abc":   "agent",
+		"my-kms+v2://key/1":    "my-kms+v2",
+		"/tmp/key":             "",
+		"keys/a://b":           "",
+		"1kms://key":           "",
+		"://key":               "",
+		"C:\\keys\\id_ed25519": "",
+	} {
+		got, ok := SignerURIScheme(uri)
+		if got != want || ok != (want != "") {
+			t.Errorf("SignerURIScheme(%q) = %q, %v, want %q", uri, got, ok, want)
+		}
+	}
+}
+
+func TestOpenSigner_BuiltinSchemes(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	fileSigner, err := OpenSigner("file://" + privPath)
+	if err != nil {
+		t.Fatalf("OpenSigner(file://) failed: %v", err)
+	}
+
+	// An in-memory agent, holding another key at first
+	keyring := agent.NewKeyring()
+	otherPub, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: otherPriv}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on agent socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	// With a single key, agent:// needs no fingerprint
+	agentSigner, err := OpenSigner("agent://")
+	if err != nil {
+		t.Fatalf("OpenSigner(agent://) failed: %v", err)
+	}
+	otherSSHPub, err := ssh.NewPublicKey(otherPub)
+	if err != nil {
+		t.Fatalf("failed to convert public key: %v", err)
+	}
+	if !bytes.Equal(agentSigner.PublicKey().Marshal(), otherSSHPub.Marshal()) {
+		t.Error("agent:// opened the wrong key")
+	}
+
+	keyData, err := os.ReadFile(privPath)
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	key, err := ssh.ParseRawPrivateKey(keyData)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+	if _, err := OpenSigner("agent://"); !errors.Is(err, ErrAgentKeyNotFound) {
+		t.Errorf("agent:// with two keys = %v, want ErrAgentKeyNotFound", err)
+	}
+	agentSigner, err = OpenSigner("agent://" + ssh.FingerprintSHA256(fileSigner.PublicKey()))
+	if err != nil {
+		t.Fatalf("OpenSigner(agent://fingerprint) failed: %v", err)
+	}
+
+	// Both open the same key, and ed25519 signatures are deterministic
+	message := []byte("signed through either backend")
+	fromFile, err := SignBuffer(fileSigner, message, 0)
+	if err != nil {
+		t.Fatalf("SignBuffer with file signer failed: %v", err)
+	}
+	fromAgent, err := SignBuffer(agentSigner, message, 0)
+	if err != nil {
+		t.Fatalf("SignBuffer with agent signer failed: %v", err)
+	}
+	if !bytes.Equal(fromFile, fromAgent) {
+		t.Error("file:// and agent:// signatures over the same key differ")
+	}
+
+	if _, err := OpenSigner("agent://SHA256:not-loaded"); !errors.Is(err, ErrAgentKeyNotFound) {
+		t.Errorf("unknown fingerprint = %v, want ErrAgentKeyNotFound", err)
+	}
+}
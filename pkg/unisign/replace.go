@@ -2,8 +2,11 @@ package unisign
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
+
+	"golang.org/x/crypto/ssh"
 )
 
 var (
@@ -17,8 +20,64 @@ var (
 	ErrInvalidOffset = errors.New("invalid offset")
 	// ErrMagicMismatch is returned when the old magic string doesn't match at the specified offset
 	ErrMagicMismatch = errors.New("old magic string not found at specified offset")
+	// ErrReplaceVerifyFailed is returned when the bytes written don't match the replacement magic string
+	ErrReplaceVerifyFailed = errors.New("replaced bytes do not match the new magic string")
+	// ErrSignatureLengthMismatch is matched by a SignatureLengthError
+	ErrSignatureLengthMismatch = errors.New("encoded signature length doesn't match magic string length")
 )
 
+// SignatureLengthError is returned when an encoded signature would not
+// exactly fill the magic string it replaces, as with a magic string sized
+// for another algorithm. errors.Is reports it as ErrSignatureLengthMismatch.
+type SignatureLengthError struct {
+	Encoded int // length of the prefix plus the base64-encoded signature
+	Magic   int // length of the magic string
+}
+
+func (e *SignatureLengthError) Error() string {
+	return fmt.Sprintf("encoded signature length (%d) doesn't match magic string length (%d)", e.Encoded, e.Magic)
+}
+
+// Is reports whether target is ErrSignatureLengthMismatch
+func (e *SignatureLengthError) Is(target error) bool {
+	return target == ErrSignatureLengthMismatch
+}
+
+// EncodeSignature returns signature in its embedded form, prefix followed by
+// base64, or a *SignatureLengthError if that is not exactly as long as magic
+func EncodeSignature(signature []byte, prefix string, magic []byte) ([]byte, error) {
+	encoded := []byte(prefix + base64.StdEncoding.EncodeToString(signature))
+	if len(encoded) != len(magic) {
+		return nil, &SignatureLengthError{Encoded: len(encoded), Magic: len(magic)}
+	}
+	return encoded, nil
+}
+
+// SignAndReplace signs buf, which must contain magic exactly once, and
+// replaces magic with the signature in its embedded form (prefix followed by
+// base64), as the unisign command does. It returns the signature's offset.
+// buf is left unchanged on error, including the *SignatureLengthError
+// returned if the encoded signature doesn't exactly fill magic.
+func SignAndReplace(signer ssh.Signer, buf []byte, magic []byte, prefix string) (int64, error) {
+	offset, err := CheckExactlyOneMagicString(buf, magic)
+	if err != nil {
+		return 0, err
+	}
+
+	signature, err := SignBuffer(signer, buf, uint64(offset))
+	if err != nil {
+		return 0, err
+	}
+	encoded, err := EncodeSignature(signature, prefix, magic)
+	if err != nil {
+		return 0, err
+	}
+	if err := ReplaceMagicAtOffset(buf, offset, encoded, magic); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
 // FindMagicOffset finds the offset of a magic string in a buffer.
 // Returns ErrMagicNotFound if the magic string is not found.
 func FindMagicOffset(buf []byte, magic []byte) (int64, error) {
@@ -35,29 +94,101 @@ func FindMagicOffset(buf []byte, magic []byte) (int64, error) {
 	return int64(offset), nil
 }
 
+// FindAllMagicOffsets returns the offsets of every non-overlapping occurrence
+// of a magic string in a buffer, in increasing order.
+// Returns ErrMagicNotFound if the magic string is not found.
+func FindAllMagicOffsets(buf []byte, magic []byte) ([]int64, error) {
+	var offsets []int64
+	for start := int64(0); ; {
+		index, err := FindMagicOffset(buf[start:], magic)
+		if err != nil {
+			break
+		}
+		offsets = append(offsets, start+index)
+		start += index + int64(len(magic))
+	}
+
+	if len(offsets) == 0 {
+		return nil, ErrMagicNotFound
+	}
+	return offsets, nil
+}
+
+// PlaceholderContextLen is the number of bytes InspectPlaceholders keeps on
+// either side of a placeholder in PlaceholderLocation.Context
+const PlaceholderContextLen = 16
+
+// PlaceholderLocation describes one occurrence of a placeholder in a buffer
+type PlaceholderLocation struct {
+	// Offset is the position of the placeholder in the buffer
+	Offset int64
+
+	// Context holds the placeholder with up to PlaceholderContextLen bytes
+	// before and after it, fewer near the start or end of the buffer.
+	// It is a copy, so it stays valid if the buffer is later modified.
+	Context []byte
+}
+
+// InspectPlaceholders returns the location of every non-overlapping
+// occurrence of magic in buf, in increasing order, each with a short preview
+// of the surrounding bytes. It returns nil if magic does not occur.
+func InspectPlaceholders(buf []byte, magic []byte) []PlaceholderLocation {
+	offsets, err := FindAllMagicOffsets(buf, magic)
+	if err != nil {
+		return nil
+	}
+
+	locations := make([]PlaceholderLocation, len(offsets))
+	for i, offset := range offsets {
+		start := max(offset-PlaceholderContextLen, 0)
+		end := min(offset+int64(len(magic))+PlaceholderContextLen, int64(len(buf)))
+		locations[i] = PlaceholderLocation{
+			Offset:  offset,
+			Context: bytes.Clone(buf[start:end]),
+		}
+	}
+	return locations
+}
+
 // CheckExactlyOneMagicString ensures there is exactly one occurrence of the magic string in the buffer.
 // Returns the offset of the magic string if exactly one is found.
 // Returns ErrMagicNotFound if no magic string is found.
 // Returns ErrMultipleMagicStrings if multiple magic strings are found.
 func CheckExactlyOneMagicString(buf []byte, magic []byte) (int64, error) {
-	// Find the first occurrence using FindMagicOffset
-	firstIndex, err := FindMagicOffset(buf, magic)
-	if err != nil {
-		return 0, err
+	if len(magic) == 0 || len(buf) < len(magic) {
+		return 0, ErrMagicNotFound
 	}
-	
-	// Check for a second occurrence after the first one
-	secondIndex := bytes.Index(buf[firstIndex+int64(len(magic)):], magic)
-	if secondIndex != -1 {
-		return 0, fmt.Errorf("%w: found at least 2 occurrences", ErrMultipleMagicStrings)
+
+	// Make a single pass over buf, recording at most two matches. Each search
+	// resumes just past the previous match, so no byte is scanned twice, and
+	// the pass stops as soon as a second match shows the input is ambiguous.
+	var matches [2]int64
+	found := 0
+	for start := 0; found < len(matches); {
+		index := bytes.Index(buf[start:], magic)
+		if index == -1 {
+			break
+		}
+		matches[found] = int64(start + index)
+		found++
+		start += index + len(magic)
 	}
 
-	return firstIndex, nil
+	switch found {
+	case 0:
+		return 0, ErrMagicNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, fmt.Errorf("%w: found at least 2 occurrences", ErrMultipleMagicStrings)
+	}
 }
 
 // ReplaceMagicAtOffset replaces a magic string with another one at the specified offset.
 // The replacement magic string must have the same length as the original.
 // Returns an error if the offset is invalid or if the magic strings have different lengths.
+// Returns ErrReplaceVerifyFailed, leaving buf unchanged, if newMagic aliases the
+// region being replaced and so no longer matches the bytes that were written.
 func ReplaceMagicAtOffset(buf []byte, offset int64, newMagic []byte, oldMagic []byte) error {
 	// Check that the magic strings have the same length
 	if len(newMagic) != len(oldMagic) {
@@ -75,7 +206,19 @@ func ReplaceMagicAtOffset(buf []byte, offset int64, newMagic []byte, oldMagic []
 		return ErrMagicMismatch
 	}
 
+	// Snapshot the region and the replacement so aliasing between newMagic
+	// and buf can neither corrupt the copy nor go unnoticed
+	original := append([]byte(nil), buf[offset:offset+magicLen]...)
+	replacement := append([]byte(nil), newMagic...)
+
 	// Replace the magic string
-	copy(buf[offset:], newMagic)
+	copy(buf[offset:], replacement)
+
+	// Check that newMagic didn't change underneath us because it overlaps buf
+	if !bytes.Equal(newMagic, replacement) {
+		copy(buf[offset:], original)
+		return ErrReplaceVerifyFailed
+	}
+
 	return nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,44 @@
+package unisign
+
+import (
+	"bytes"
+	"testing"
+)
+
+// benchmarkSearchSize is large enough that the search, not setup, dominates
+const benchmarkSearchSize = 256 << 20
+
+// BenchmarkCheckExactlyOneMagicString measures the placeholder search over a
+// large buffer with the placeholder near the start, at the end (the whole
+// buffer is scanned for a second one) and twice (the search stops early)
+func BenchmarkCheckExactlyOneMagicString(b *testing.B) {
+	magic := []byte("UNISIGN-PLACEHOLDER-FOR-BENCHMARKING")
+	place := func(offsets ...int) []byte {
+		buf := bytes.Repeat([]byte("unisign "), benchmarkSearchSize/8)
+		for _, offset := range offsets {
+			copy(buf[offset:], magic)
+		}
+		return buf
+	}
+
+	cases := []struct {
+		name string
+		buf  []byte
+		err  bool
+	}{
+		{"start", place(4096), false},
+		{"end", place(benchmarkSearchSize - len(magic)), false},
+		{"duplicate", place(4096, benchmarkSearchSize/2), true},
+	}
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(tc.buf)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := CheckExactlyOneMagicString(tc.buf, magic); (err != nil) != tc.err {
+					b.Fatalf("CheckExactlyOneMagicString: unexpected error %v", err)
+				}
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package unisign
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"testing"
+	"unisign/pkg/placeholder"
 )
 
 func TestFindMagicOffset(t *testing.T) {
@@ -205,6 +207,13 @@ func TestCheckExactlyOneMagicString(t *testing.T) {
 			expected: 0,
 			err:      ErrMultipleMagicStrings,
 		},
+		{
+			name:     "self-overlapping match counts once",
+			buf:      []byte("xAAAx"),
+			magic:    []byte("AA"),
+			expected: 1,
+			err:      nil,
+		},
 		{
 			name:     "empty buffer",
 			buf:      []byte{},
@@ -252,4 +261,221 @@ func TestCheckExactlyOneMagicString(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestReplaceMagicAtOffsetOverlapping(t *testing.T) {
+	buf := []byte("xxMAGICyy")
+	want := make([]byte, len(buf))
+	copy(want, buf)
+
+	// newMagic aliases the bytes being replaced, shifted by one
+	oldMagic := []byte("MAGIC")
+	newMagic := buf[3:8]
+
+	err := ReplaceMagicAtOffset(buf, 2, newMagic, oldMagic)
+	if !errors.Is(err, ErrReplaceVerifyFailed) {
+		t.Fatalf("expected ErrReplaceVerifyFailed, got %v", err)
+	}
+	if !bytes.Equal(buf, want) {
+		t.Errorf("buffer was modified: got %q, want %q", buf, want)
+	}
+}
+
+func TestFindAllMagicOffsets(t *testing.T) {
+	testCases := []struct {
+		name     string
+		buf      []byte
+		magic    []byte
+		expected []int64
+		err      error
+	}{
+		{
+			name:     "single magic string",
+			buf:      []byte("xx MAGIC yy"),
+			magic:    []byte("MAGIC"),
+			expected: []int64{3},
+		},
+		{
+			name:     "multiple magic strings",
+			buf:      []byte("MAGIC in the beginning, MAGIC in the middle"),
+			magic:    []byte("MAGIC"),
+			expected: []int64{0, 24},
+		},
+		{
+			name:     "adjacent magic strings",
+			buf:      []byte("MAGICMAGIC"),
+			magic:    []byte("MAGIC"),
+			expected: []int64{0, 5},
+		},
+		{
+			name:  "no magic string",
+			buf:   []byte("nothing here"),
+			magic: []byte("MAGIC"),
+			err:   ErrMagicNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FindAllMagicOffsets(tc.buf, tc.magic)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if len(got) != len(tc.expected) {
+				t.Fatalf("expected offsets %v, got %v", tc.expected, got)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("expected offsets %v, got %v", tc.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectPlaceholders(t *testing.T) {
+	pad := func(n int) string { return string(bytes.Repeat([]byte("."), n)) }
+	testCases := []struct {
+		name     string
+		buf      []byte
+		magic    []byte
+		expected []PlaceholderLocation
+	}{
+		{
+			name:     "placeholder is the whole buffer",
+			buf:      []byte("MAGIC"),
+			magic:    []byte("MAGIC"),
+			expected: []PlaceholderLocation{{Offset: 0, Context: []byte("MAGIC")}},
+		},
+		{
+			name:     "placeholder at start of buffer",
+			buf:      []byte("MAGIC" + pad(20)),
+			magic:    []byte("MAGIC"),
+			expected: []PlaceholderLocation{{Offset: 0, Context: []byte("MAGIC" + pad(16))}},
+		},
+		{
+			name:     "placeholder at end of buffer",
+			buf:      []byte(pad(20) + "MAGIC"),
+			magic:    []byte("MAGIC"),
+			expected: []PlaceholderLocation{{Offset: 20, Context: []byte(pad(16) + "MAGIC")}},
+		},
+		{
+			name:     "short context on both sides",
+			buf:      []byte("ab MAGIC cd"),
+			magic:    []byte("MAGIC"),
+			expected: []PlaceholderLocation{{Offset: 3, Context: []byte("ab MAGIC cd")}},
+		},
+		{
+			name:     "context exactly fills the bound",
+			buf:      []byte(pad(17) + "MAGIC" + pad(17)),
+			magic:    []byte("MAGIC"),
+			expected: []PlaceholderLocation{{Offset: 17, Context: []byte(pad(16) + "MAGIC" + pad(16))}},
+		},
+		{
+			name:  "multiple placeholders with overlapping context",
+			buf:   []byte("xx MAGIC yy MAGIC zz"),
+			magic: []byte("MAGIC"),
+			expected: []PlaceholderLocation{
+				{Offset: 3, Context: []byte("xx MAGIC yy MAGIC zz")},
+				{Offset: 12, Context: []byte("xx MAGIC yy MAGIC zz")},
+			},
+		},
+		{
+			name:  "no placeholder",
+			buf:   []byte("nothing here"),
+			magic: []byte("MAGIC"),
+		},
+		{
+			name:  "empty buffer",
+			buf:   []byte{},
+			magic: []byte("MAGIC"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := InspectPlaceholders(tc.buf, tc.magic)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("expected %d locations, got %v", len(tc.expected), got)
+			}
+			for i := range got {
+				if got[i].Offset != tc.expected[i].Offset {
+					t.Errorf("location %d: expected offset %d, got %d", i, tc.expected[i].Offset, got[i].Offset)
+				}
+				if !bytes.Equal(got[i].Context, tc.expected[i].Context) {
+					t.Errorf("location %d: expected context %q, got %q", i, tc.expected[i].Context, got[i].Context)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectPlaceholders_ContextIsCopy(t *testing.T) {
+	buf := []byte("xx MAGIC yy")
+	got := InspectPlaceholders(buf, []byte("MAGIC"))
+	if len(got) != 1 {
+		t.Fatalf("expected 1 location, got %v", got)
+	}
+
+	copy(buf, "zz")
+	if !bytes.Equal(got[0].Context, []byte("xx MAGIC yy")) {
+		t.Errorf("context changed with the buffer: %q", got[0].Context)
+	}
+}
+
+func TestSignAndReplace(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	magic := []byte(placeholder.MagicString)
+	original := append(append([]byte("header "), magic...), " trailer"...)
+
+	buf := append([]byte(nil), original...)
+	offset, err := SignAndReplace(signer, buf, magic, placeholder.SignaturePrefix)
+	if err != nil {
+		t.Fatalf("SignAndReplace failed: %v", err)
+	}
+	if offset != 7 || len(buf) != len(original) {
+		t.Fatalf("offset = %d, length %d; want 7, %d", offset, len(buf), len(original))
+	}
+
+	// The signature covers buf with the placeholder in place
+	encoded := buf[offset : offset+int64(len(magic))]
+	signature, err := base64.StdEncoding.DecodeString(string(encoded[len(placeholder.SignaturePrefix):]))
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+	if err := VerifySignature(signer.PublicKey(), original, uint64(offset), signature); err != nil {
+		t.Errorf("VerifySignature failed: %v", err)
+	}
+}
+
+func TestSignAndReplace_LengthMismatch(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	// A magic string too short for an ed25519 signature
+	magic := []byte(placeholder.SignaturePrefix + "short")
+	original := append(append([]byte("header "), magic...), " trailer"...)
+	buf := append([]byte(nil), original...)
+
+	_, err = SignAndReplace(signer, buf, magic, placeholder.SignaturePrefix)
+	if !errors.Is(err, ErrSignatureLengthMismatch) {
+		t.Fatalf("error = %v, want ErrSignatureLengthMismatch", err)
+	}
+	var lengthErr *SignatureLengthError
+	if !errors.As(err, &lengthErr) {
+		t.Fatalf("expected *SignatureLengthError, got %T", err)
+	}
+	if lengthErr.Encoded != len(placeholder.MagicString) || lengthErr.Magic != len(magic) {
+		t.Errorf("lengths = %d, %d; want %d, %d", lengthErr.Encoded, lengthErr.Magic, len(placeholder.MagicString), len(magic))
+	}
+	if !bytes.Equal(buf, original) {
+		t.Error("buffer changed on error")
+	}
+}
@@ -1,54 +1,207 @@
 package unisign
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"golang.org/x/crypto/ssh"
 )
 
 // Magic value used to identify our signatures
 const SignatureMagic uint64 = 0x554E495349474E // "UNISIGN" in ASCII
 
+// SignatureVersion is the current signature format version.
+// It is stamped into the top byte of the header's magic word, which the
+// 7-byte "UNISIGN" magic leaves free, and matches the digit in the "us2-" prefix.
+// Version 2 added SignatureNamespace to the signed bytes; version 1
+// signatures, made without it, no longer verify.
+const SignatureVersion uint8 = 2
+
+// SignatureNamespace opens every signature header, so the bytes unisign
+// signs can't be mistaken for what another protocol signs with the same
+// key, such as an SSH login or an SSHSIG signature. It is fixed, unlike the
+// SSHSIG namespace of SignSSHSig, and changes only with the format version.
+const SignatureNamespace = "unisign-v2"
+
+// ErrUnsupportedFormatVersion is returned when a signature uses a format version this build doesn't know
+var ErrUnsupportedFormatVersion = errors.New("unsupported signature format version")
+
+// ErrInvalidHeader is returned when a buffer does not start with a valid signature header
+var ErrInvalidHeader = errors.New("invalid signature header")
+
+// HeaderLengthError is returned when a header's Length doesn't match the message that follows it
+type HeaderLengthError struct {
+	Declared uint64 // Length recorded in the header
+	Actual   uint64 // Number of message bytes actually present
+}
+
+func (e *HeaderLengthError) Error() string {
+	return fmt.Sprintf("signature header declares a %d-byte message but %d bytes follow", e.Declared, e.Actual)
+}
+
 // SignatureHeader represents the binary header prepended to signed messages
 type SignatureHeader struct {
-	Magic  uint64 // Fixed magic value to identify our signatures
-	Length uint64 // Length of the message
-	Offset uint64 // Offset value passed to the signing function
+	Magic   uint64 // Fixed magic value to identify our signatures
+	Version uint8  // Signature format version, stored in the top byte of the magic word
+	Length  uint64 // Length of the message
+	Offset  uint64 // Offset value passed to the signing function
 }
 
-// writeHeader creates a buffer with the header and message
-func writeHeader(message []byte, offset uint64) []byte {
-	// Create the header
+// HeaderSize is the size in bytes of the encoded SignatureHeader
+const HeaderSize = len(SignatureNamespace) + 24 // namespace, then 3 uint64 fields * 8 bytes each
+
+// putHeader encodes the header for a message of the given length into the first HeaderSize bytes of buf
+func putHeader(buf []byte, length, offset uint64) {
 	header := SignatureHeader{
-		Magic:  SignatureMagic,
-		Length: uint64(len(message)),
-		Offset: offset,
+		Magic:   SignatureMagic,
+		Version: SignatureVersion,
+		Length:  length,
+		Offset:  offset,
+	}
+
+	fields := buf[copy(buf, SignatureNamespace):]
+	binary.BigEndian.PutUint64(fields[0:], uint64(header.Version)<<56|header.Magic)
+	binary.BigEndian.PutUint64(fields[8:], header.Length)
+	binary.BigEndian.PutUint64(fields[16:], header.Offset)
+}
+
+// ParseSignatureHeader decodes the header at the start of buf, as built by
+// SignBuffer, and returns it together with the message that follows.
+// Returns ErrInvalidHeader if buf is too short or lacks the namespace or
+// magic, ErrUnsupportedFormatVersion for an unknown version, and a
+// *HeaderLengthError if Length disagrees with the remaining bytes.
+func ParseSignatureHeader(buf []byte) (SignatureHeader, []byte, error) {
+	if !bytes.HasPrefix(buf, []byte(SignatureNamespace)) {
+		// Version 1 headers had no namespace and began with the magic word
+		if len(buf) >= 8 {
+			if word := binary.BigEndian.Uint64(buf); word&^(0xFF<<56) == SignatureMagic {
+				return SignatureHeader{}, nil, fmt.Errorf("%w: %d (supported: %d)", ErrUnsupportedFormatVersion, word>>56, SignatureVersion)
+			}
+		}
+		return SignatureHeader{}, nil, fmt.Errorf("%w: missing %q namespace", ErrInvalidHeader, SignatureNamespace)
+	}
+	if len(buf) < HeaderSize {
+		return SignatureHeader{}, nil, fmt.Errorf("%w: %d bytes is shorter than the %d-byte header", ErrInvalidHeader, len(buf), HeaderSize)
+	}
+
+	fields := buf[len(SignatureNamespace):]
+	word := binary.BigEndian.Uint64(fields[0:])
+	header := SignatureHeader{
+		Magic:   word &^ (0xFF << 56),
+		Version: uint8(word >> 56),
+		Length:  binary.BigEndian.Uint64(fields[8:]),
+		Offset:  binary.BigEndian.Uint64(fields[16:]),
+	}
+
+	if header.Magic != SignatureMagic {
+		return SignatureHeader{}, nil, fmt.Errorf("%w: bad magic 0x%X", ErrInvalidHeader, header.Magic)
 	}
+	if header.Version != SignatureVersion {
+		return SignatureHeader{}, nil, fmt.Errorf("%w: %d (supported: %d)", ErrUnsupportedFormatVersion, header.Version, SignatureVersion)
+	}
+
+	message := buf[HeaderSize:]
+	if header.Length != uint64(len(message)) {
+		return SignatureHeader{}, nil, &HeaderLengthError{Declared: header.Length, Actual: uint64(len(message))}
+	}
+
+	return header, message, nil
+}
 
+// writeHeader creates a buffer with the header and message. Each call gets
+// a buffer of its own, so concurrent signing never shares one.
+func writeHeader(message []byte, offset uint64) []byte {
 	// Create a buffer to hold the header and message
-	headerSize := 24 // 3 uint64 fields * 8 bytes each
-	buf := make([]byte, headerSize+len(message))
+	buf := make([]byte, HeaderSize+len(message))
 
 	// Write the header
-	binary.BigEndian.PutUint64(buf[0:], header.Magic)
-	binary.BigEndian.PutUint64(buf[8:], header.Length)
-	binary.BigEndian.PutUint64(buf[16:], header.Offset)
+	putHeader(buf, uint64(len(message)), offset)
 
 	// Copy the message
-	copy(buf[headerSize:], message)
+	copy(buf[HeaderSize:], message)
 	
 	return buf
 }
 
+// readHeader creates a buffer with the header followed by exactly length
+// bytes read from r. The message is read straight into place, so no second
+// copy is made.
+func readHeader(r io.Reader, length, offset uint64) ([]byte, error) {
+	if length > uint64(math.MaxInt-HeaderSize) {
+		return nil, fmt.Errorf("message length %d is too large", length)
+	}
+
+	buf := make([]byte, HeaderSize+int(length))
+	putHeader(buf, length, offset)
+
+	if _, err := io.ReadFull(r, buf[HeaderSize:]); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	// A reader holding more than length bytes is a different message, not a prefix of it
+	extra, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	if extra > 0 {
+		return nil, &HeaderLengthError{Declared: length, Actual: length + uint64(extra)}
+	}
+
+	return buf, nil
+}
+
 // SignBuffer signs a binary buffer using an SSH signer.
 // The function prepends a binary header containing:
-// - A fixed magic value (0x554E495349474E)
+// - SignatureNamespace
+// - A fixed magic value (0x554E495349474E), with SignatureVersion in the top byte
 // - The length of the message
 // - The provided offset value
+//
+// SignBuffer may be called from many goroutines at once, with the same
+// signer, as long as signer.Sign is safe for concurrent use and message is
+// not modified meanwhile. Signers for private keys, as ReadSSHPrivateKey and
+// ReadSSHCertSigner return, keep no state between signatures. Signers of an
+// SSH agent (agent.NewClient) serialize their requests to it, so they are
+// safe too, but goroutines then wait for one another.
 func SignBuffer(signer ssh.Signer, message []byte, offset uint64) ([]byte, error) {
 	// Create the buffer with header and message
-	buf := writeHeader(message, offset)
+	return signHeadered(signer, writeHeader(message, offset))
+}
+
+// SignBufferWithHeadroom is like SignBuffer for a message stored at
+// buf[HeaderSize:]. The header is written into buf[:HeaderSize] and the
+// buffer is signed in place, so unlike SignBuffer no copy of the message is
+// made. The caller's bytes in buf[:HeaderSize] are overwritten, so unlike
+// message in SignBuffer, buf must not be shared with concurrent calls.
+func SignBufferWithHeadroom(signer ssh.Signer, buf []byte, offset uint64) ([]byte, error) {
+	if len(buf) < HeaderSize {
+		return nil, fmt.Errorf("buffer of %d bytes has no room for the %d-byte header", len(buf), HeaderSize)
+	}
+	putHeader(buf, uint64(len(buf)-HeaderSize), offset)
+	return signHeadered(signer, buf)
+}
+
+// SignReader is like SignBuffer for a message of the given length read from r.
+//
+// ed25519 signs the message itself rather than a digest of it, so the signed
+// bytes cannot be fed to the signer incrementally without switching to
+// prehashed Ed25519ph, which would change every signature. SignReader therefore
+// still holds the header and message in memory, but reads the message directly
+// behind the header instead of copying a caller-provided buffer, halving peak
+// memory compared to reading the file and calling SignBuffer.
+func SignReader(signer ssh.Signer, r io.Reader, length, offset uint64) ([]byte, error) {
+	buf, err := readHeader(r, length, offset)
+	if err != nil {
+		return nil, err
+	}
+	return signHeadered(signer, buf)
+}
 
+// signHeadered signs a buffer that already starts with the signature header
+func signHeadered(signer ssh.Signer, buf []byte) ([]byte, error) {
 	// Sign the buffer
 	signature, err := signer.Sign(nil, buf)
 	if err != nil {
@@ -60,9 +213,117 @@ func SignBuffer(signer ssh.Signer, message []byte, offset uint64) ([]byte, error
 
 // VerifySignature verifies a signature against a message and header.
 // It reconstructs the signed buffer using the provided message and header values.
+// It only reads publicKey and message, so any number of goroutines may
+// verify with the same key at once.
 func VerifySignature(publicKey ssh.PublicKey, message []byte, offset uint64, signature []byte) error {
-	// Create the buffer with header and message
-	buf := writeHeader(message, offset)
+	_, err := VerifyDetailed(publicKey, message, offset, signature)
+	return err
+}
+
+// VerifyWithAuthorizedKey is like VerifySignature for a public key given as
+// one line in authorized_keys format, as found in a .pub file, so a caller
+// that only verifies needs no ssh.PublicKey of its own
+func VerifyWithAuthorizedKey(authorizedKeyLine string, message []byte, offset uint64, signature []byte) error {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKeyLine))
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return VerifySignature(publicKey, message, offset, signature)
+}
+
+// VerifyInfo describes a signature that VerifyDetailed accepted
+type VerifyInfo struct {
+	// Header is the signature header the signature covers
+	Header SignatureHeader
+
+	// KeyType is the algorithm of the key that made the signature, which
+	// for a certificate is the key it certifies
+	KeyType string
+
+	// Fingerprint is the SHA256 fingerprint of that key, as printed by ssh-keygen -l
+	Fingerprint string
+}
+
+// VerifyDetailed is like VerifySignature, and on success also reports the
+// header that was validated and the key that made the signature
+func VerifyDetailed(publicKey ssh.PublicKey, message []byte, offset uint64, signature []byte) (VerifyInfo, error) {
+	header, err := VerifyFramed(publicKey, writeHeader(message, offset), signature)
+	if err != nil {
+		return VerifyInfo{}, err
+	}
+
+	signingKey := certifiedKey(publicKey)
+	return VerifyInfo{
+		Header:      header,
+		KeyType:     signingKey.Type(),
+		Fingerprint: ssh.FingerprintSHA256(signingKey),
+	}, nil
+}
+
+// VerifySignatureVersion is like VerifySignature for a signature that declares
+// the given format version, e.g. as parsed from its embedded prefix.
+// Returns ErrUnsupportedFormatVersion if the version is not one this build produces,
+// rather than a generic verification failure.
+func VerifySignatureVersion(publicKey ssh.PublicKey, message []byte, offset uint64, signature []byte, version uint8) error {
+	if version != SignatureVersion {
+		return fmt.Errorf("%w: %d (supported: %d)", ErrUnsupportedFormatVersion, version, SignatureVersion)
+	}
+	return VerifySignature(publicKey, message, offset, signature)
+}
+
+// VerifyReader is like VerifySignature for a message of the given length read
+// from r. See SignReader for why the message is still buffered in full.
+func VerifyReader(publicKey ssh.PublicKey, r io.Reader, length, offset uint64, signature []byte) error {
+	buf, err := readHeader(r, length, offset)
+	if err != nil {
+		return err
+	}
+	return verifyHeadered(publicKey, buf, signature)
+}
+
+// VerifyReaderKeys is like VerifyReader for a signature made by any of
+// publicKeys. The message is read once and checked against each key in turn;
+// the index of the key that verified it is returned, or -1 with the last
+// key's error.
+func VerifyReaderKeys(publicKeys []ssh.PublicKey, r io.Reader, length, offset uint64, signature []byte) (int, error) {
+	buf, err := readHeader(r, length, offset)
+	if err != nil {
+		return -1, err
+	}
+	err = fmt.Errorf("signature verification failed: no keys")
+	for i, publicKey := range publicKeys {
+		if err = verifyHeadered(publicKey, buf, signature); err == nil {
+			return i, nil
+		}
+	}
+	return -1, err
+}
+
+// VerifyFramed verifies a signature over framed, a buffer that holds the
+// signature header followed by the message, as signed by SignBuffer.
+// The header is validated with ParseSignatureHeader first, so a Length that
+// disagrees with the message is rejected with a *HeaderLengthError even
+// before the signature is checked. The parsed header is returned on success.
+func VerifyFramed(publicKey ssh.PublicKey, framed []byte, signature []byte) (SignatureHeader, error) {
+	header, _, err := ParseSignatureHeader(framed)
+	if err != nil {
+		return SignatureHeader{}, err
+	}
+	if err := verifyHeadered(publicKey, framed, signature); err != nil {
+		return SignatureHeader{}, err
+	}
+	return header, nil
+}
+
+// verifyHeadered verifies a signature over a buffer that already starts with the signature header
+func verifyHeadered(publicKey ssh.PublicKey, buf []byte, signature []byte) error {
+	// The header must describe exactly the message it frames
+	if _, _, err := ParseSignatureHeader(buf); err != nil {
+		return err
+	}
+
+	// A certificate is checked through the key it certifies, which made the signature
+	publicKey = certifiedKey(publicKey)
 
 	// Create the signature
 	sig := &ssh.Signature{
@@ -1,7 +1,19 @@
 package unisign
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 func TestSignAndVerify(t *testing.T) {
@@ -72,4 +84,406 @@ func TestSignAndVerify(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestVerifyDetailed(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	message := []byte("a message signed at a nonzero offset")
+	signature, err := SignBuffer(signer, message, 7)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+
+	info, err := VerifyDetailed(signer.PublicKey(), message, 7, signature)
+	if err != nil {
+		t.Fatalf("VerifyDetailed failed: %v", err)
+	}
+
+	// The reported header is the one SignBuffer embedded
+	embedded, _, err := ParseSignatureHeader(writeHeader(message, 7))
+	if err != nil {
+		t.Fatalf("ParseSignatureHeader failed: %v", err)
+	}
+	if info.Header != embedded {
+		t.Errorf("Header = %+v, want %+v", info.Header, embedded)
+	}
+	if info.Header.Length != uint64(len(message)) || info.Header.Offset != 7 || info.Header.Version != SignatureVersion {
+		t.Errorf("Header = %+v, want length %d, offset 7, version %d", info.Header, len(message), SignatureVersion)
+	}
+	if info.KeyType != ssh.KeyAlgoED25519 {
+		t.Errorf("KeyType = %q, want %q", info.KeyType, ssh.KeyAlgoED25519)
+	}
+	if want := ssh.FingerprintSHA256(signer.PublicKey()); info.Fingerprint != want {
+		t.Errorf("Fingerprint = %q, want %q", info.Fingerprint, want)
+	}
+
+	// Nothing is reported for a signature that does not verify
+	info, err = VerifyDetailed(signer.PublicKey(), message, 8, signature)
+	if err == nil {
+		t.Fatal("VerifyDetailed should fail with the wrong offset")
+	}
+	if info != (VerifyInfo{}) {
+		t.Errorf("VerifyDetailed returned %+v alongside an error", info)
+	}
+}
+
+func TestVerifyWithAuthorizedKey(t *testing.T) {
+	privPath, pubPath := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	pubData, err := os.ReadFile(pubPath)
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	authorizedKeyLine := string(pubData)
+
+	message := []byte("verified with nothing but strings and bytes")
+	signature, err := SignBuffer(signer, message, 7)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+
+	// The .pub line as ssh-keygen wrote it, comment and newline included
+	if err := VerifyWithAuthorizedKey(authorizedKeyLine, message, 7, signature); err != nil {
+		t.Fatalf("VerifyWithAuthorizedKey failed: %v", err)
+	}
+	// So does an authorized_keys line with options in front
+	if err := VerifyWithAuthorizedKey(`from="10.0.0.0/8" `+authorizedKeyLine, message, 7, signature); err != nil {
+		t.Errorf("VerifyWithAuthorizedKey failed with key options: %v", err)
+	}
+
+	if err := VerifyWithAuthorizedKey(authorizedKeyLine, message, 8, signature); err == nil {
+		t.Error("VerifyWithAuthorizedKey should fail with the wrong offset")
+	}
+	_, otherPub := generateTestKey(t)
+	otherData, err := os.ReadFile(otherPub)
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	if err := VerifyWithAuthorizedKey(string(otherData), message, 7, signature); err == nil {
+		t.Error("VerifyWithAuthorizedKey should fail with another key")
+	}
+	for _, line := range []string{"", "# no key here", "ssh-ed25519 not-base64"} {
+		if err := VerifyWithAuthorizedKey(line, message, 7, signature); err == nil || !strings.Contains(err.Error(), "failed to parse public key") {
+			t.Errorf("VerifyWithAuthorizedKey(%q) = %v, want a parse error", line, err)
+		}
+	}
+}
+
+func TestVerifySignatureUnsupportedVersion(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	message := []byte("versioned message")
+	signature, err := SignBuffer(signer, message, 7)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+
+	if err := VerifySignatureVersion(signer.PublicKey(), message, 7, signature, SignatureVersion); err != nil {
+		t.Fatalf("VerifySignatureVersion failed for current version: %v", err)
+	}
+
+	err = VerifySignatureVersion(signer.PublicKey(), message, 7, signature, SignatureVersion+1)
+	if !errors.Is(err, ErrUnsupportedFormatVersion) {
+		t.Errorf("expected ErrUnsupportedFormatVersion, got %v", err)
+	}
+}
+
+func TestSignReaderAndVerifyReader(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	message := []byte("streamed message")
+	length := uint64(len(message))
+
+	// Reader and buffer signatures are interchangeable
+	signature, err := SignReader(signer, bytes.NewReader(message), length, 3)
+	if err != nil {
+		t.Fatalf("SignReader failed: %v", err)
+	}
+	if err := VerifySignature(signer.PublicKey(), message, 3, signature); err != nil {
+		t.Errorf("VerifySignature rejected a SignReader signature: %v", err)
+	}
+
+	bufferSignature, err := SignBuffer(signer, message, 3)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+	if err := VerifyReader(signer.PublicKey(), bytes.NewReader(message), length, 3, bufferSignature); err != nil {
+		t.Errorf("VerifyReader rejected a SignBuffer signature: %v", err)
+	}
+
+	if err := VerifyReader(signer.PublicKey(), bytes.NewReader(message), length, 4, signature); err == nil {
+		t.Error("VerifyReader should fail with wrong offset")
+	}
+
+	// A reader shorter than the declared length is an error, not a shorter message
+	if _, err := SignReader(signer, bytes.NewReader(message), length+1, 3); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a short reader, got %v", err)
+	}
+}
+
+func TestVerifyReaderKeys(t *testing.T) {
+	var signers []ssh.Signer
+	var publicKeys []ssh.PublicKey
+	for i := 0; i < 3; i++ {
+		privPath, _ := generateTestKey(t)
+		signer, err := ReadSSHPrivateKey(privPath, "")
+		if err != nil {
+			t.Fatalf("failed to read private key: %v", err)
+		}
+		signers = append(signers, signer)
+		publicKeys = append(publicKeys, signer.PublicKey())
+	}
+
+	message := []byte("streamed message")
+	length := uint64(len(message))
+	signature, err := SignBuffer(signers[1], message, 3)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+
+	// The message is read once, so a one-shot reader is enough for all keys
+	k, err := VerifyReaderKeys(publicKeys, iotest.OneByteReader(bytes.NewReader(message)), length, 3, signature)
+	if err != nil || k != 1 {
+		t.Errorf("VerifyReaderKeys = %d, %v; want 1, nil", k, err)
+	}
+
+	if k, err := VerifyReaderKeys([]ssh.PublicKey{publicKeys[0], publicKeys[2]}, bytes.NewReader(message), length, 3, signature); err == nil || k != -1 {
+		t.Errorf("VerifyReaderKeys without the signing key = %d, %v; want -1 and an error", k, err)
+	}
+
+	var lengthErr *HeaderLengthError
+	if _, err := VerifyReaderKeys(publicKeys, bytes.NewReader(append(message, '!')), length, 3, signature); !errors.As(err, &lengthErr) {
+		t.Errorf("expected a *HeaderLengthError for a longer reader, got %v", err)
+	}
+}
+
+func TestSignBufferWithHeadroom(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	message := []byte("message signed in place")
+	buf := make([]byte, HeaderSize+len(message))
+	copy(buf[HeaderSize:], message)
+
+	signature, err := SignBufferWithHeadroom(signer, buf, 9)
+	if err != nil {
+		t.Fatalf("SignBufferWithHeadroom failed: %v", err)
+	}
+	if err := VerifySignature(signer.PublicKey(), message, 9, signature); err != nil {
+		t.Errorf("VerifySignature rejected an in-place signature: %v", err)
+	}
+	if !bytes.Equal(buf[HeaderSize:], message) {
+		t.Errorf("SignBufferWithHeadroom modified the message")
+	}
+
+	if _, err := SignBufferWithHeadroom(signer, make([]byte, HeaderSize-1), 0); err == nil {
+		t.Error("SignBufferWithHeadroom should reject a buffer shorter than the header")
+	}
+}
+
+func TestParseSignatureHeader(t *testing.T) {
+	message := []byte("framed message")
+	buf := writeHeader(message, 77)
+
+	header, rest, err := ParseSignatureHeader(buf)
+	if err != nil {
+		t.Fatalf("ParseSignatureHeader failed: %v", err)
+	}
+	want := SignatureHeader{Magic: SignatureMagic, Version: SignatureVersion, Length: uint64(len(message)), Offset: 77}
+	if header != want {
+		t.Errorf("header = %+v, want %+v", header, want)
+	}
+	if !bytes.Equal(rest, message) {
+		t.Errorf("message = %q, want %q", rest, message)
+	}
+
+	// Length that disagrees with the remaining bytes
+	var lengthErr *HeaderLengthError
+	if _, _, err := ParseSignatureHeader(buf[:len(buf)-1]); !errors.As(err, &lengthErr) {
+		t.Fatalf("expected *HeaderLengthError, got %v", err)
+	}
+	if lengthErr.Declared != uint64(len(message)) || lengthErr.Actual != uint64(len(message)-1) {
+		t.Errorf("unexpected length error: %+v", lengthErr)
+	}
+
+	// Too short, bad magic and unknown version
+	if _, _, err := ParseSignatureHeader(buf[:HeaderSize-1]); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader for a short buffer, got %v", err)
+	}
+	fields := len(SignatureNamespace)
+	badMagic := append([]byte(nil), buf...)
+	badMagic[fields+7] ^= 0xFF
+	if _, _, err := ParseSignatureHeader(badMagic); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader for bad magic, got %v", err)
+	}
+	badVersion := append([]byte(nil), buf...)
+	badVersion[fields]++
+	if _, _, err := ParseSignatureHeader(badVersion); !errors.Is(err, ErrUnsupportedFormatVersion) {
+		t.Errorf("expected ErrUnsupportedFormatVersion, got %v", err)
+	}
+}
+
+func TestSignatureNamespace(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	message := []byte("same key, same message, different namespace")
+	framed := writeHeader(message, 3)
+	if !bytes.HasPrefix(framed, []byte(SignatureNamespace)) {
+		t.Fatalf("signed bytes start with %q, want the %q namespace", framed[:len(SignatureNamespace)], SignatureNamespace)
+	}
+
+	// The version 1 preimage: the header fields without the namespace
+	legacy := make([]byte, 24+len(message))
+	binary.BigEndian.PutUint64(legacy[0:], 1<<56|SignatureMagic)
+	binary.BigEndian.PutUint64(legacy[8:], uint64(len(message)))
+	binary.BigEndian.PutUint64(legacy[16:], 3)
+	copy(legacy[24:], message)
+
+	oldSignature, err := signer.Sign(nil, legacy)
+	if err != nil {
+		t.Fatalf("failed to sign the version 1 preimage: %v", err)
+	}
+	if err := VerifySignature(signer.PublicKey(), message, 3, oldSignature.Blob); err == nil {
+		t.Error("a version 1 signature verified under the namespace")
+	}
+
+	newSignature, err := SignBuffer(signer, message, 3)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+	if err := signer.PublicKey().Verify(legacy, &ssh.Signature{Format: oldSignature.Format, Blob: newSignature}); err == nil {
+		t.Error("a namespaced signature verified as a version 1 signature")
+	}
+
+	// A version 1 header is recognized as such rather than as garbage
+	if _, _, err := ParseSignatureHeader(legacy); !errors.Is(err, ErrUnsupportedFormatVersion) {
+		t.Errorf("expected ErrUnsupportedFormatVersion for a version 1 header, got %v", err)
+	}
+	if _, _, err := ParseSignatureHeader(message); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader without the namespace, got %v", err)
+	}
+}
+
+func TestVerifyRejectsHeaderLengthMismatch(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	message := []byte("message whose length matters")
+	signature, err := SignBuffer(signer, message, 5)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+
+	framed := writeHeader(message, 5)
+	header, err := VerifyFramed(signer.PublicKey(), framed, signature)
+	if err != nil {
+		t.Fatalf("VerifyFramed failed on a well-formed buffer: %v", err)
+	}
+	if header.Offset != 5 || header.Length != uint64(len(message)) {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	// A truncated message behind the original header
+	var lengthErr *HeaderLengthError
+	if _, err := VerifyFramed(signer.PublicKey(), framed[:len(framed)-4], signature); !errors.As(err, &lengthErr) {
+		t.Errorf("expected *HeaderLengthError for a truncated message, got %v", err)
+	}
+
+	// A header claiming a different length than the message it frames
+	mismatched := append([]byte(nil), framed...)
+	binary.BigEndian.PutUint64(mismatched[len(SignatureNamespace)+8:], uint64(len(message)+1))
+	if _, err := VerifyFramed(signer.PublicKey(), mismatched, signature); !errors.As(err, &lengthErr) {
+		t.Errorf("expected *HeaderLengthError for a mismatched length, got %v", err)
+	}
+
+	// A reader with more data than the declared length
+	longer := append(append([]byte(nil), message...), "trailing"...)
+	if err := VerifyReader(signer.PublicKey(), bytes.NewReader(longer), uint64(len(message)), 5, signature); !errors.As(err, &lengthErr) {
+		t.Errorf("expected *HeaderLengthError for trailing data, got %v", err)
+	}
+}
+
+func TestSignBuffer_Concurrent(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	fileSigner, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	// The same key held by an SSH agent, served over an in-memory connection
+	keyBytes, err := os.ReadFile(privPath)
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	rawKey, err := ssh.ParseRawPrivateKey(keyBytes)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: rawKey}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+	clientConn, agentConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	go agent.ServeAgent(keyring, agentConn)
+	agentSigners, err := agent.NewClient(clientConn).Signers()
+	if err != nil || len(agentSigners) != 1 {
+		t.Fatalf("failed to get agent signer: %v", err)
+	}
+
+	message := bytes.Repeat([]byte("concurrent "), 1000)
+	for name, signer := range map[string]ssh.Signer{"file key": fileSigner, "agent": agentSigners[0]} {
+		t.Run(name, func(t *testing.T) {
+			const goroutines = 32
+			signatures := make([][]byte, goroutines)
+			errs := make([]error, goroutines)
+			var wg sync.WaitGroup
+			for i := range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if signatures[i], errs[i] = SignBuffer(signer, message, uint64(i%4)); errs[i] == nil {
+						errs[i] = VerifySignature(signer.PublicKey(), message, uint64(i%4), signatures[i])
+					}
+				}()
+			}
+			wg.Wait()
+
+			// ed25519 is deterministic, so calls with the same offset agree
+			for i := range goroutines {
+				if errs[i] != nil {
+					t.Fatalf("goroutine %d: %v", i, errs[i])
+				}
+				if !bytes.Equal(signatures[i], signatures[i%4]) {
+					t.Errorf("goroutine %d: signature differs from goroutine %d's", i, i%4)
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,18 @@
 package unisign
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"golang.org/x/crypto/ssh"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -134,4 +142,226 @@ func TestReadSSHPrivateKeyInvalidKeyType(t *testing.T) {
 	if err == nil {
 		t.Error("expected error for invalid key type")
 	}
-} 
\ No newline at end of file
+}
+
+func TestReadSSHPrivateKeyPKCS8(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS#8 key: %v", err)
+	}
+
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	// A passphrase for an unencrypted PEM key must not prevent reading it
+	for _, passphrase := range []string{"", "unused"} {
+		signer, err := ReadSSHPrivateKey(keyPath, passphrase)
+		if err != nil {
+			t.Fatalf("ReadSSHPrivateKey(passphrase=%q) failed: %v", passphrase, err)
+		}
+
+		message := []byte("pkcs8 message")
+		signature, err := SignBuffer(signer, message, 3)
+		if err != nil {
+			t.Fatalf("SignBuffer failed: %v", err)
+		}
+		if err := VerifySignature(signer.PublicKey(), message, 3, signature); err != nil {
+			t.Fatalf("VerifySignature failed: %v", err)
+		}
+	}
+}
+
+func TestReadSSHPrivateKeyPKCS8RejectsNonEd25519(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS#8 key: %v", err)
+	}
+
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	if _, err := ReadSSHPrivateKey(keyPath, ""); err == nil {
+		t.Error("expected error for non-ed25519 PKCS#8 key")
+	}
+}
+
+func TestParseSSHPrivateKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	plain, err := ssh.MarshalPrivateKey(priv, "in memory")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "in memory", []byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to marshal encrypted key: %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		keyBytes   []byte
+		passphrase string
+	}{
+		{"OpenSSH", pem.EncodeToMemory(plain), ""},
+		{"encrypted OpenSSH", pem.EncodeToMemory(encrypted), "secret"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signer, err := ParseSSHPrivateKey(tc.keyBytes, tc.passphrase)
+			if err != nil {
+				t.Fatalf("ParseSSHPrivateKey failed: %v", err)
+			}
+			want, err := ssh.NewPublicKey(priv.Public())
+			if err != nil {
+				t.Fatalf("failed to convert public key: %v", err)
+			}
+			if !bytes.Equal(signer.PublicKey().Marshal(), want.Marshal()) {
+				t.Error("parsed key does not match the generated one")
+			}
+		})
+	}
+
+	if _, err := ParseSSHPrivateKey(pem.EncodeToMemory(encrypted), "wrong"); err == nil {
+		t.Error("expected error for a wrong passphrase")
+	}
+	if _, err := ParseSSHPrivateKey([]byte("not a key"), ""); err == nil || !strings.HasPrefix(err.Error(), "failed to parse private key") {
+		t.Errorf("garbage: error = %v, want a parse error", err)
+	}
+
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ecBlock, err := ssh.MarshalPrivateKey(ecPriv, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	if _, err := ParseSSHPrivateKey(pem.EncodeToMemory(ecBlock), ""); err == nil {
+		t.Error("expected error for a non-ed25519 key")
+	}
+}
+
+// generateTestCertificate signs the public key at pubPath with a fresh CA using
+// ssh-keygen and returns the path of the resulting certificate
+func generateTestCertificate(t *testing.T, privPath, pubPath string) string {
+	t.Helper()
+
+	caPath := filepath.Join(filepath.Dir(privPath), "ca")
+	cmd := exec.Command("ssh-keygen", "-t", "ed25519", "-f", caPath, "-N", "", "-C", "ca@example.com")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate CA key: %v\n%s", err, output)
+	}
+
+	cmd = exec.Command("ssh-keygen", "-s", caPath, "-I", "release-signer", "-n", "alice,bob", "-V", "+1h", pubPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to sign certificate: %v\n%s", err, output)
+	}
+
+	return privPath + "-cert.pub"
+}
+
+func TestReadSSHCertSigner(t *testing.T) {
+	privPath, pubPath := generateTestKey(t)
+	certPath := generateTestCertificate(t, privPath, pubPath)
+
+	signer, cert, err := ReadSSHCertSigner(privPath, certPath, nil)
+	if err != nil {
+		t.Fatalf("ReadSSHCertSigner failed: %v", err)
+	}
+	if signer.PublicKey().Type() != ssh.CertAlgoED25519v01 {
+		t.Errorf("signer type = %s, want %s", signer.PublicKey().Type(), ssh.CertAlgoED25519v01)
+	}
+	if cert.KeyId != "release-signer" || len(cert.ValidPrincipals) != 2 || cert.ValidPrincipals[0] != "alice" {
+		t.Errorf("unexpected certificate: key id %q, principals %v", cert.KeyId, cert.ValidPrincipals)
+	}
+
+	message := []byte("signed under a certificate")
+	signature, err := SignBuffer(signer, message, 11)
+	if err != nil {
+		t.Fatalf("SignBuffer failed: %v", err)
+	}
+
+	// The signature verifies against both the certificate and the plain key
+	if err := VerifySignature(cert, message, 11, signature); err != nil {
+		t.Errorf("VerifySignature with certificate failed: %v", err)
+	}
+	plain, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	if err := VerifySignature(plain.PublicKey(), message, 11, signature); err != nil {
+		t.Errorf("VerifySignature with plain key failed: %v", err)
+	}
+
+	// A certificate for another key is rejected
+	otherPriv, _ := generateTestKey(t)
+	if _, _, err := ReadSSHCertSigner(otherPriv, certPath, nil); err == nil {
+		t.Error("ReadSSHCertSigner should reject a certificate for a different key")
+	}
+	// So is a plain public key in place of a certificate
+	if _, _, err := ReadSSHCertSigner(privPath, pubPath, nil); err == nil {
+		t.Error("ReadSSHCertSigner should reject a plain public key")
+	}
+}
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	var pubKeys [][]byte
+	for i := 0; i < 3; i++ {
+		_, pubPath := generateTestKey(t)
+		data, err := os.ReadFile(pubPath)
+		if err != nil {
+			t.Fatalf("failed to read public key: %v", err)
+		}
+		pubKeys = append(pubKeys, bytes.TrimSpace(data))
+	}
+
+	file := "# release signers\n\n" +
+		string(pubKeys[0]) + "\n" +
+		"  # rotated out in 2025\n" +
+		`from="10.0.0.0/8" ` + string(pubKeys[1]) + "\n\n" +
+		string(pubKeys[2]) + "\n" +
+		"# end of file\n"
+
+	keys, comments, err := ParseAuthorizedKeys([]byte(file))
+	if err != nil {
+		t.Fatalf("ParseAuthorizedKeys failed: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("got %d keys, want 3", len(keys))
+	}
+	for i, key := range keys {
+		want, _, _, _, err := ssh.ParseAuthorizedKey(pubKeys[i])
+		if err != nil {
+			t.Fatalf("failed to parse public key %d: %v", i, err)
+		}
+		if !bytes.Equal(key.Marshal(), want.Marshal()) {
+			t.Errorf("key %d does not match the file's key %d", i, i)
+		}
+		if comments[i] != "test@example.com" {
+			t.Errorf("comment %d = %q, want %q", i, comments[i], "test@example.com")
+		}
+	}
+
+	// A file with nothing but comments holds no keys
+	for _, data := range []string{"", "# no keys here\n\n"} {
+		if _, _, err := ParseAuthorizedKeys([]byte(data)); err == nil {
+			t.Errorf("ParseAuthorizedKeys(%q) should fail", data)
+		}
+	}
+}
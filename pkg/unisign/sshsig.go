@@ -0,0 +1,214 @@
+package unisign
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH signatures as made by ssh-keygen -Y sign, described in OpenSSH's
+// PROTOCOL.sshsig. The key signs a hash of the message rather than the
+// message itself, framed with a namespace so a signature made for one
+// purpose (e.g. "git") is not accepted for another (e.g. "file").
+
+// sshsigMagic starts both the signed data and the signature blob
+const sshsigMagic = "SSHSIG"
+
+// sshsigVersion is the only signature blob version defined
+const sshsigVersion = 1
+
+// SSHSigHashAlgorithm is the hash SignSSHSig uses, matching ssh-keygen's default
+const SSHSigHashAlgorithm = "sha512"
+
+// Armor lines around the base64 signature blob, which is wrapped at 70 columns like ssh-keygen's
+const (
+	sshsigBegin    = "-----BEGIN SSH SIGNATURE-----"
+	sshsigEnd      = "-----END SSH SIGNATURE-----"
+	sshsigLineSize = 70
+)
+
+// ErrInvalidSSHSig is returned when an armored SSH signature cannot be parsed
+var ErrInvalidSSHSig = errors.New("invalid SSH signature")
+
+// sshsigBlob is the signature blob inside the armor
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshsigSignedData is what the key actually signs
+type sshsigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// sshsigHash returns a new hash for one of the algorithms PROTOCOL.sshsig allows
+func sshsigHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %q", ErrInvalidSSHSig, algorithm)
+	}
+}
+
+// sshsigMessage hashes the message read from r and returns the data the key signs
+func sshsigMessage(r io.Reader, namespace, algorithm string) ([]byte, error) {
+	h, err := sshsigHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	return append([]byte(sshsigMagic), ssh.Marshal(sshsigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: algorithm,
+		Hash:          h.Sum(nil),
+	})...), nil
+}
+
+// SignSSHSig signs the message read from r in the format of ssh-keygen -Y
+// sign and returns the armored signature. The message is hashed as it is
+// read, so unlike SignReader it is never held in memory. RSA keys sign with
+// rsa-sha2-512, as ssh-keygen does.
+func SignSSHSig(signer ssh.Signer, r io.Reader, namespace string) ([]byte, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace must not be empty")
+	}
+	signed, err := sshsigMessage(r, namespace, SSHSigHashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature *ssh.Signature
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && keyType(signer.PublicKey()) == ssh.KeyAlgoRSA {
+		signature, err = as.SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	blob := append([]byte(sshsigMagic), ssh.Marshal(sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: SSHSigHashAlgorithm,
+		Signature:     ssh.Marshal(signature),
+	})...)
+	return armorSSHSig(blob), nil
+}
+
+// VerifySSHSig verifies an armored signature made by SignSSHSig or ssh-keygen
+// -Y sign over the message read from r. The signature must be for namespace
+// and made by publicKey; for a certificate, by the key it certifies.
+func VerifySSHSig(publicKey ssh.PublicKey, r io.Reader, namespace string, armored []byte) error {
+	_, err := VerifySSHSigKeys([]ssh.PublicKey{publicKey}, r, namespace, armored)
+	return err
+}
+
+// VerifySSHSigKeys is like VerifySSHSig for a signature made by any of
+// publicKeys. The key is picked by the one the signature names, so the
+// message is read and hashed once; the index of that key is returned, or -1
+// on error.
+func VerifySSHSigKeys(publicKeys []ssh.PublicKey, r io.Reader, namespace string, armored []byte) (int, error) {
+	sig, err := parseSSHSig(armored)
+	if err != nil {
+		return -1, err
+	}
+	if sig.Namespace != namespace {
+		return -1, fmt.Errorf("signature is for namespace %q, not %q", sig.Namespace, namespace)
+	}
+
+	// The blob names its key, which may itself be a certificate
+	sigKey, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return -1, fmt.Errorf("%w: %v", ErrInvalidSSHSig, err)
+	}
+	sigKey = certifiedKey(sigKey)
+	k := -1
+	for i, publicKey := range publicKeys {
+		if bytes.Equal(certifiedKey(publicKey).Marshal(), sigKey.Marshal()) {
+			k = i
+			break
+		}
+	}
+	if k == -1 {
+		return -1, fmt.Errorf("signature was made by a different key (%s)", ssh.FingerprintSHA256(sigKey))
+	}
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return -1, fmt.Errorf("%w: %v", ErrInvalidSSHSig, err)
+	}
+	signed, err := sshsigMessage(r, sig.Namespace, sig.HashAlgorithm)
+	if err != nil {
+		return -1, err
+	}
+	if err := sigKey.Verify(signed, &signature); err != nil {
+		return -1, fmt.Errorf("signature verification failed: %w", err)
+	}
+	return k, nil
+}
+
+// armorSSHSig wraps a signature blob in the SSH SIGNATURE armor
+func armorSSHSig(blob []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var buf bytes.Buffer
+	buf.WriteString(sshsigBegin + "\n")
+	for len(encoded) > sshsigLineSize {
+		buf.WriteString(encoded[:sshsigLineSize] + "\n")
+		encoded = encoded[sshsigLineSize:]
+	}
+	buf.WriteString(encoded + "\n")
+	buf.WriteString(sshsigEnd + "\n")
+	return buf.Bytes()
+}
+
+// parseSSHSig removes the armor and decodes the signature blob
+func parseSSHSig(armored []byte) (sshsigBlob, error) {
+	text := strings.TrimSpace(string(armored))
+	body, ok := strings.CutPrefix(text, sshsigBegin)
+	if ok {
+		body, ok = strings.CutSuffix(body, sshsigEnd)
+	}
+	if !ok {
+		return sshsigBlob{}, fmt.Errorf("%w: missing %s armor", ErrInvalidSSHSig, "SSH SIGNATURE")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return sshsigBlob{}, fmt.Errorf("%w: %v", ErrInvalidSSHSig, err)
+	}
+
+	rest, ok := bytes.CutPrefix(raw, []byte(sshsigMagic))
+	if !ok {
+		return sshsigBlob{}, fmt.Errorf("%w: missing %s preamble", ErrInvalidSSHSig, sshsigMagic)
+	}
+	var sig sshsigBlob
+	if err := ssh.Unmarshal(rest, &sig); err != nil {
+		return sshsigBlob{}, fmt.Errorf("%w: %v", ErrInvalidSSHSig, err)
+	}
+	if sig.Version != sshsigVersion {
+		return sshsigBlob{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidSSHSig, sig.Version)
+	}
+	return sig, nil
+}
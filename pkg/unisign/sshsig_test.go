@@ -0,0 +1,168 @@
+package unisign
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHSig_RoundTrip(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	message := []byte("release 1.2.3\n")
+
+	armored, err := SignSSHSig(signer, bytes.NewReader(message), "file")
+	if err != nil {
+		t.Fatalf("SignSSHSig failed: %v", err)
+	}
+	if !bytes.HasPrefix(armored, []byte(sshsigBegin+"\n")) || !bytes.HasSuffix(armored, []byte(sshsigEnd+"\n")) {
+		t.Errorf("signature is not armored:\n%s", armored)
+	}
+
+	if err := VerifySSHSig(signer.PublicKey(), bytes.NewReader(message), "file", armored); err != nil {
+		t.Errorf("VerifySSHSig failed: %v", err)
+	}
+	if err := VerifySSHSig(signer.PublicKey(), strings.NewReader("release 1.2.4\n"), "file", armored); err == nil {
+		t.Error("tampered message was accepted")
+	}
+	if err := VerifySSHSig(signer.PublicKey(), bytes.NewReader(message), "git", armored); err == nil {
+		t.Error("signature was accepted for another namespace")
+	}
+
+	otherPriv, _ := generateTestKey(t)
+	other, err := ReadSSHPrivateKey(otherPriv, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	if err := VerifySSHSig(other.PublicKey(), bytes.NewReader(message), "file", armored); err == nil {
+		t.Error("signature was accepted for another key")
+	}
+}
+
+func TestSSHSig_KeySet(t *testing.T) {
+	var publicKeys []ssh.PublicKey
+	var signer ssh.Signer
+	for i := 0; i < 3; i++ {
+		privPath, _ := generateTestKey(t)
+		s, err := ReadSSHPrivateKey(privPath, "")
+		if err != nil {
+			t.Fatalf("failed to read private key: %v", err)
+		}
+		signer = s
+		publicKeys = append(publicKeys, s.PublicKey())
+	}
+	message := []byte("release 1.2.3\n")
+	armored, err := SignSSHSig(signer, bytes.NewReader(message), "file")
+	if err != nil {
+		t.Fatalf("SignSSHSig failed: %v", err)
+	}
+
+	// The reader is consumed by the one hash, so the key must be picked before it
+	k, err := VerifySSHSigKeys(publicKeys, bytes.NewReader(message), "file", armored)
+	if err != nil || k != 2 {
+		t.Errorf("VerifySSHSigKeys = %d, %v; want 2, nil", k, err)
+	}
+
+	if k, err := VerifySSHSigKeys(publicKeys[:2], bytes.NewReader(message), "file", armored); err == nil || k != -1 {
+		t.Errorf("VerifySSHSigKeys without the signing key = %d, %v; want -1 and an error", k, err)
+	}
+	if k, err := VerifySSHSigKeys(publicKeys, strings.NewReader("release 1.2.4\n"), "file", armored); err == nil || k != -1 {
+		t.Errorf("VerifySSHSigKeys over a tampered message = %d, %v; want -1 and an error", k, err)
+	}
+}
+
+func TestSSHSig_Invalid(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		armored string
+	}{
+		{"empty", ""},
+		{"no armor", "U1NIU0lH"},
+		{"bad base64", sshsigBegin + "\n!!!\n" + sshsigEnd + "\n"},
+		{"no preamble", sshsigBegin + "\nQUJDREVG\n" + sshsigEnd + "\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifySSHSig(signer.PublicKey(), strings.NewReader("msg"), "file", []byte(tc.armored))
+			if !errors.Is(err, ErrInvalidSSHSig) {
+				t.Errorf("error = %v, want ErrInvalidSSHSig", err)
+			}
+		})
+	}
+}
+
+// TestSSHSig_SSHKeygen checks that ssh-keygen -Y verify accepts SignSSHSig's
+// signatures and that VerifySSHSig accepts ssh-keygen -Y sign's
+func TestSSHSig_SSHKeygen(t *testing.T) {
+	privPath, pubPath := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	pubKey, err := os.ReadFile(pubPath)
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.txt")
+	message := []byte("release 1.2.3\n")
+	if err := os.WriteFile(dataPath, message, 0644); err != nil {
+		t.Fatalf("failed to write data: %v", err)
+	}
+	allowedSigners := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, append([]byte("test@example.com "), pubKey...), 0644); err != nil {
+		t.Fatalf("failed to write allowed signers: %v", err)
+	}
+
+	t.Run("ssh-keygen verifies unisign", func(t *testing.T) {
+		armored, err := SignSSHSig(signer, bytes.NewReader(message), "file")
+		if err != nil {
+			t.Fatalf("SignSSHSig failed: %v", err)
+		}
+		sigPath := filepath.Join(dir, "unisign.sig")
+		if err := os.WriteFile(sigPath, armored, 0644); err != nil {
+			t.Fatalf("failed to write signature: %v", err)
+		}
+
+		cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", allowedSigners,
+			"-I", "test@example.com", "-n", "file", "-s", sigPath)
+		cmd.Stdin = bytes.NewReader(message)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("ssh-keygen -Y verify failed: %v\n%s", err, out)
+		}
+	})
+
+	t.Run("unisign verifies ssh-keygen", func(t *testing.T) {
+		cmd := exec.Command("ssh-keygen", "-Y", "sign", "-f", privPath, "-n", "file", dataPath)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen -Y sign failed: %v\n%s", err, out)
+		}
+		armored, err := os.ReadFile(dataPath + ".sig")
+		if err != nil {
+			t.Fatalf("failed to read signature: %v", err)
+		}
+
+		if err := VerifySSHSig(signer.PublicKey(), bytes.NewReader(message), "file", armored); err != nil {
+			t.Errorf("VerifySSHSig failed: %v", err)
+		}
+		if err := VerifySSHSig(signer.PublicKey(), strings.NewReader("release 1.2.4\n"), "file", armored); err == nil {
+			t.Error("tampered message was accepted")
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package unisign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"unisign/pkg/placeholder"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrWriterClosed is returned when a SigningWriter is used after Close
+	ErrWriterClosed = errors.New("signing writer is closed")
+	// ErrStreamNotVerified is returned by a VerifyingReader whose stream carries no valid signature
+	ErrStreamNotVerified = errors.New("stream does not carry a valid signature")
+)
+
+// maxSignatureCandidates caps how many signatures verifyEmbedded will try, so
+// a stream stuffed with look-alike signatures cannot make it run unboundedly
+const maxSignatureCandidates = 64
+
+// SigningWriter is an io.WriteCloser that signs what is written to it. The
+// placeholder can be anywhere in the stream and signing needs all of it, so
+// everything written is held in memory until Close.
+type SigningWriter struct {
+	dst    io.Writer
+	signer ssh.Signer
+	magic  []byte
+	buf    bytes.Buffer
+	closed bool
+}
+
+// NewSigningWriter returns a SigningWriter that writes the signed stream to
+// dst. The stream must contain magic exactly once, which Close replaces by
+// the signature prefixed with placeholder.SignaturePrefix, as SignAndReplace
+// does.
+func NewSigningWriter(dst io.Writer, signer ssh.Signer, magic []byte) *SigningWriter {
+	return &SigningWriter{dst: dst, signer: signer, magic: append([]byte(nil), magic...)}
+}
+
+// Write buffers p; nothing reaches dst before Close
+func (w *SigningWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	return w.buf.Write(p)
+}
+
+// Close signs the buffered stream and writes it to dst, which is not closed.
+// If the stream cannot be signed, e.g. because magic is missing, nothing is
+// written to dst. Either way the writer can't be used again.
+func (w *SigningWriter) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+
+	data := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	if _, err := SignAndReplace(w.signer, data, w.magic, placeholder.SignaturePrefix); err != nil {
+		return err
+	}
+	_, err := w.dst.Write(data)
+	return err
+}
+
+// VerifyingReader is an io.Reader that yields a signed stream only once its
+// embedded signature has verified. The signature can be anywhere in the
+// stream, so the first Read reads all of it into memory and verifies it;
+// nothing is returned from a stream that fails.
+type VerifyingReader struct {
+	src       io.Reader
+	publicKey ssh.PublicKey
+	magic     []byte
+	prefix    string
+	data      *bytes.Reader
+	err       error
+}
+
+// NewVerifyingReader returns a VerifyingReader for src, a stream signed by
+// the holder of publicKey with magic as its placeholder and prefix in front of
+// the encoded signature, as SignAndReplace writes it
+func NewVerifyingReader(src io.Reader, publicKey ssh.PublicKey, magic []byte, prefix string) *VerifyingReader {
+	return &VerifyingReader{src: src, publicKey: publicKey, magic: append([]byte(nil), magic...), prefix: prefix}
+}
+
+// Read yields the stream's bytes, unchanged, once it has verified. A stream
+// that doesn't makes every Read fail with an error matching
+// ErrStreamNotVerified.
+func (r *VerifyingReader) Read(p []byte) (int, error) {
+	if r.data == nil && r.err == nil {
+		r.err = r.load()
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.data.Read(p)
+}
+
+// load reads the whole stream and verifies it
+func (r *VerifyingReader) load() error {
+	data, err := io.ReadAll(r.src)
+	if err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	if _, err := verifyEmbedded(data, r.publicKey, r.magic, r.prefix); err != nil {
+		return err
+	}
+	r.data = bytes.NewReader(data)
+	return nil
+}
+
+// verifyEmbedded looks for an encoded signature in data that verifies with
+// publicKey and returns its offset. Each candidate is checked over data with
+// magic put back in its place; data is restored afterwards. Past
+// maxSignatureCandidates candidates it gives up.
+func verifyEmbedded(data []byte, publicKey ssh.PublicKey, magic []byte, prefix string) (int64, error) {
+	saved := make([]byte, len(magic))
+	candidates := 0
+	for start := 0; ; {
+		index := bytes.Index(data[start:], []byte(prefix))
+		if index < 0 {
+			break
+		}
+		offset := start + index
+		start = offset + 1
+		if offset+len(magic) > len(data) {
+			break
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(string(data[offset+len(prefix) : offset+len(magic)]))
+		if err != nil {
+			continue
+		}
+		if candidates++; candidates > maxSignatureCandidates {
+			return 0, fmt.Errorf("%w: too many signature candidates (limit %d)", ErrStreamNotVerified, maxSignatureCandidates)
+		}
+		copy(saved, data[offset:])
+		copy(data[offset:], magic)
+		err = VerifySignature(publicKey, data, uint64(offset), signature)
+		copy(data[offset:], saved)
+		if err == nil {
+			return int64(offset), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no signature after %q verifies", ErrStreamNotVerified, prefix)
+}
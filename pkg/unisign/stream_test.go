@@ -0,0 +1,161 @@
+package unisign
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unisign/pkg/placeholder"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSigningWriter(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	magic := []byte(placeholder.MagicString)
+	original := append(append(bytes.Repeat([]byte("streamed "), 500), magic...), " trailer"...)
+
+	// Written one byte at a time, so the placeholder arrives in pieces
+	var dst bytes.Buffer
+	w := NewSigningWriter(&dst, signer, magic)
+	if _, err := io.Copy(w, iotest.OneByteReader(bytes.NewReader(original))); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	if dst.Len() != 0 {
+		t.Fatalf("%d bytes reached dst before Close", dst.Len())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// ed25519 is deterministic, so the output is exactly what SignAndReplace makes
+	want := append([]byte(nil), original...)
+	if _, err := SignAndReplace(signer, want, magic, placeholder.SignaturePrefix); err != nil {
+		t.Fatalf("SignAndReplace failed: %v", err)
+	}
+	if !bytes.Equal(dst.Bytes(), want) {
+		t.Error("SigningWriter output differs from SignAndReplace")
+	}
+
+	if _, err := w.Write([]byte("late")); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Write after Close = %v, want ErrWriterClosed", err)
+	}
+	if err := w.Close(); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("second Close = %v, want ErrWriterClosed", err)
+	}
+}
+
+func TestSigningWriter_NoMagic(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+
+	var dst bytes.Buffer
+	w := NewSigningWriter(&dst, signer, []byte(placeholder.MagicString))
+	if _, err := w.Write([]byte("no placeholder in here")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, ErrMagicNotFound) {
+		t.Errorf("Close = %v, want ErrMagicNotFound", err)
+	}
+	if dst.Len() != 0 {
+		t.Errorf("%d bytes written to dst for a stream that wasn't signed", dst.Len())
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	magic := []byte(placeholder.MagicString)
+	signed := append(append(bytes.Repeat([]byte("streamed "), 500), magic...), " trailer"...)
+	offset, err := SignAndReplace(signer, signed, magic, placeholder.SignaturePrefix)
+	if err != nil {
+		t.Fatalf("SignAndReplace failed: %v", err)
+	}
+
+	// An intact stream passes through byte for byte
+	r := NewVerifyingReader(iotest.OneByteReader(bytes.NewReader(signed)), signer.PublicKey(), magic, placeholder.SignaturePrefix)
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading a signed stream failed: %v", err)
+	}
+	if !bytes.Equal(got, signed) {
+		t.Error("VerifyingReader changed the stream")
+	}
+
+	otherPriv, _ := generateTestKey(t)
+	otherSigner, err := ReadSSHPrivateKey(otherPriv, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	tampered := append([]byte(nil), signed...)
+	tampered[3] ^= 1
+	badSignature := append([]byte(nil), signed...)
+	badSignature[offset+10] ^= 1
+	unsigned := append(append([]byte("header "), magic...), " trailer"...)
+
+	for name, tc := range map[string]struct {
+		data      []byte
+		publicKey ssh.PublicKey
+	}{
+		"tampered content":   {tampered, signer.PublicKey()},
+		"tampered signature": {badSignature, signer.PublicKey()},
+		"other key":          {signed, otherSigner.PublicKey()},
+		"unsigned":           {unsigned, signer.PublicKey()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := NewVerifyingReader(bytes.NewReader(tc.data), tc.publicKey, magic, placeholder.SignaturePrefix)
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, ErrStreamNotVerified) {
+				t.Errorf("error = %v, want ErrStreamNotVerified", err)
+			}
+			if len(got) != 0 {
+				t.Errorf("%d bytes of an unverified stream were returned", len(got))
+			}
+			if _, err := r.Read(make([]byte, 1)); !errors.Is(err, ErrStreamNotVerified) {
+				t.Errorf("later Read = %v, want ErrStreamNotVerified", err)
+			}
+		})
+	}
+}
+
+func TestVerifyingReader_TooManyCandidates(t *testing.T) {
+	privPath, _ := generateTestKey(t)
+	signer, err := ReadSSHPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	magic := []byte(placeholder.MagicString)
+
+	// Decodable signatures that don't verify, ahead of the real one
+	decoy := append([]byte(placeholder.SignaturePrefix), bytes.Repeat([]byte("A"), len(magic)-len(placeholder.SignaturePrefix))...)
+	stream := func(decoys int) []byte {
+		data := append(bytes.Repeat(append(append([]byte(nil), decoy...), ' '), decoys), magic...)
+		if _, err := SignAndReplace(signer, data, magic, placeholder.SignaturePrefix); err != nil {
+			t.Fatalf("SignAndReplace failed: %v", err)
+		}
+		return data
+	}
+
+	r := NewVerifyingReader(bytes.NewReader(stream(maxSignatureCandidates-1)), signer.PublicKey(), magic, placeholder.SignaturePrefix)
+	if _, err := io.ReadAll(r); err != nil {
+		t.Errorf("a stream with %d candidates failed: %v", maxSignatureCandidates, err)
+	}
+
+	r = NewVerifyingReader(bytes.NewReader(stream(maxSignatureCandidates)), signer.PublicKey(), magic, placeholder.SignaturePrefix)
+	_, err = io.ReadAll(r)
+	if !errors.Is(err, ErrStreamNotVerified) || !strings.Contains(err.Error(), "too many signature candidates") {
+		t.Errorf("a stream with %d candidates: error = %v, want too many signature candidates", maxSignatureCandidates+1, err)
+	}
+}